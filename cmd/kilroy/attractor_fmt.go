@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/dot"
+)
+
+// attractorFmt rewrites DOT pipelines in the canonical layout. Without paths
+// it filters stdin to stdout.
+func attractorFmt(args []string) {
+	var write, check bool
+	var paths []string
+
+	for _, a := range args {
+		switch a {
+		case "-w":
+			write = true
+		case "--check":
+			check = true
+		default:
+			if strings.HasPrefix(a, "-") {
+				fmt.Fprintf(os.Stderr, "unknown arg: %s\n", a)
+				os.Exit(1)
+			}
+			paths = append(paths, a)
+		}
+	}
+
+	if len(paths) == 0 {
+		if write {
+			fmt.Fprintln(os.Stderr, "-w requires file arguments")
+			os.Exit(1)
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		out, err := dot.Format(src)
+		if err != nil {
+			printFormatError("<stdin>", err)
+			os.Exit(1)
+		}
+		if check {
+			if !bytes.Equal(src, out) {
+				fmt.Println("<stdin>")
+				os.Exit(1)
+			}
+			return
+		}
+		_, _ = os.Stdout.Write(out)
+		return
+	}
+
+	files, err := findFilesWithSuffix(paths, ".dot")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	failed, unformatted := false, false
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		out, err := dot.Format(src)
+		if err != nil {
+			printFormatError(f, err)
+			failed = true
+			continue
+		}
+		changed := !bytes.Equal(src, out)
+		if check && changed {
+			fmt.Println(f)
+			unformatted = true
+		}
+		if write {
+			if changed {
+				if err := writeFileKeepMode(f, out); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					failed = true
+				}
+			}
+			continue
+		}
+		if !check {
+			_, _ = os.Stdout.Write(out)
+		}
+	}
+	if failed || unformatted {
+		os.Exit(1)
+	}
+}
+
+// printFormatError reports syntax errors one per line as path:line:col.
+func printFormatError(path string, err error) {
+	var list dot.ErrorList
+	if !errors.As(err, &list) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return
+	}
+	for _, e := range list {
+		fmt.Fprintf(os.Stderr, "%s:%s: %s\n", path, e.Span.Start, e.Msg)
+	}
+}
+
+func writeFileKeepMode(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, info.Mode().Perm())
+}
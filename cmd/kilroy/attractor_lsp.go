@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/danshapiro/kilroy/internal/attractor/lsp"
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+)
+
+// attractorLSP serves the language server on stdin/stdout. Editors start it
+// as a subprocess; nothing but protocol messages may go to stdout.
+func attractorLSP(args []string) {
+	for _, a := range args {
+		switch a {
+		case "--stdio":
+			// The only transport; accepted because most clients pass it.
+		default:
+			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", a)
+			os.Exit(1)
+		}
+	}
+	cat, err := modeldb.LoadEmbeddedCatalog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: model catalog unavailable: %v\n", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := lsp.NewServer(cat).Serve(ctx, os.Stdin, os.Stdout); err != nil && err != context.Canceled {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
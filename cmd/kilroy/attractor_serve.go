@@ -3,12 +3,16 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/danshapiro/kilroy/internal/server"
 )
 
 func attractorServe(args []string) {
 	addr := "127.0.0.1:8080"
+	stateDir := ""
+	authFile := ""
+	auditLog := ""
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -19,15 +23,61 @@ func attractorServe(args []string) {
 				os.Exit(1)
 			}
 			addr = args[i]
+		case "--state-dir":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--state-dir requires a value")
+				os.Exit(1)
+			}
+			stateDir = args[i]
+		case "--auth-file":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--auth-file requires a value")
+				os.Exit(1)
+			}
+			authFile = args[i]
+		case "--audit-log":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--audit-log requires a value")
+				os.Exit(1)
+			}
+			auditLog = args[i]
 		default:
 			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
 			os.Exit(1)
 		}
 	}
 
-	srv := server.New(server.Config{
-		Addr: addr,
+	var tokens []server.Token
+	if authFile != "" {
+		fileTokens, err := server.LoadTokensFile(authFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+	if v := strings.TrimSpace(os.Getenv(server.TokensEnvVar)); v != "" {
+		envTokens, err := server.ParseTokensEnv(v)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		tokens = append(tokens, envTokens...)
+	}
+
+	srv, err := server.New(server.Config{
+		Addr:         addr,
+		StateDir:     stateDir,
+		Tokens:       tokens,
+		AuditLogPath: auditLog,
 	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	if err := srv.ListenAndServe(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
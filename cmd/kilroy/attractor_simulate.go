@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+)
+
+func attractorSimulate(args []string) {
+	var graphPath string
+	var scriptPath string
+	var jsonOutput bool
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--graph":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--graph requires a value")
+				os.Exit(1)
+			}
+			graphPath = args[i]
+		case "--script":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--script requires a value")
+				os.Exit(1)
+			}
+			scriptPath = args[i]
+		case "--json":
+			jsonOutput = true
+		default:
+			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
+			os.Exit(1)
+		}
+	}
+
+	if graphPath == "" {
+		usage()
+		os.Exit(1)
+	}
+	dotSource, err := os.ReadFile(graphPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	script := &engine.SimulationScript{}
+	if scriptPath != "" {
+		if script, err = engine.LoadSimulationScript(scriptPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	rep, err := engine.Simulate(ctx, dotSource, script)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			fmt.Fprintln(os.Stderr, "json encode:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	printSimulationReport(os.Stdout, rep)
+}
+
+func printSimulationReport(w io.Writer, rep *engine.SimulationReport) {
+	fmt.Fprintln(w, "path:")
+	for i, s := range rep.Path {
+		line := fmt.Sprintf("  %2d. %s  %s", i+1, s.NodeID, s.Status)
+		if s.Branch != "" {
+			line += fmt.Sprintf("  [branch %s]", s.Branch)
+		}
+		if s.Restart > 0 {
+			line += fmt.Sprintf("  [restart %d]", s.Restart)
+		}
+		if s.FailureReason != "" {
+			line += "  (" + s.FailureReason + ")"
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "final_status=%s\n", rep.FinalStatus)
+	if rep.FailureReason != "" {
+		fmt.Fprintf(w, "failure_reason=%s\n", rep.FailureReason)
+	}
+	if rep.Restarts > 0 {
+		fmt.Fprintf(w, "restarts=%d\n", rep.Restarts)
+	}
+
+	fmt.Fprintln(w, "visits:")
+	ids := make([]string, 0, len(rep.Visits))
+	for id := range rep.Visits {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(w, "  %s: %d\n", id, rep.Visits[id])
+	}
+	if len(rep.UnvisitedNodes) > 0 {
+		fmt.Fprintln(w, "unvisited nodes:")
+		for _, id := range rep.UnvisitedNodes {
+			fmt.Fprintf(w, "  %s\n", id)
+		}
+	}
+	if len(rep.UnusedEdges) > 0 {
+		fmt.Fprintln(w, "unused edges:")
+		for _, e := range rep.UnusedEdges {
+			fmt.Fprintf(w, "  %s\n", e)
+		}
+	}
+}
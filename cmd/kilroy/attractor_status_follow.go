@@ -418,6 +418,9 @@ func printSnapshot(logsRoot string, stdout io.Writer, stderr io.Writer, asJSON b
 	if snapshot.FailureReason != "" {
 		fmt.Fprintf(stdout, "failure_reason=%s\n", snapshot.FailureReason)
 	}
+	if snapshot.CostUSD != nil {
+		fmt.Fprintf(stdout, "cost_usd=%.4f\n", *snapshot.CostUSD)
+	}
 
 	if verbose {
 		printVerboseSnapshot(stdout, snapshot)
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+)
+
+// pipelineSuiteResult is one test file's results. Err is set when the file or
+// its graph could not be loaded.
+type pipelineSuiteResult struct {
+	Path    string                        `json:"path"`
+	Graph   string                        `json:"graph,omitempty"`
+	Err     string                        `json:"error,omitempty"`
+	Results []engine.SimulationCaseResult `json:"tests,omitempty"`
+}
+
+func attractorTest(args []string) {
+	var junitPath string
+	var jsonOutput bool
+	var paths []string
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--junit":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--junit requires a value")
+				os.Exit(1)
+			}
+			junitPath = args[i]
+		case "--json":
+			jsonOutput = true
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
+				os.Exit(1)
+			}
+			paths = append(paths, args[i])
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findFilesWithSuffix(paths, engine.SimulationSuiteSuffix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "no *%s files found\n", engine.SimulationSuiteSuffix)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	suites := make([]pipelineSuiteResult, 0, len(files))
+	for _, f := range files {
+		sr := pipelineSuiteResult{Path: f}
+		suite, err := engine.LoadSimulationSuite(f)
+		if err == nil {
+			sr.Graph = suite.Graph
+			sr.Results, err = engine.RunSimulationSuite(ctx, suite)
+		}
+		if err != nil {
+			sr.Err = err.Error()
+		}
+		suites = append(suites, sr)
+	}
+
+	if junitPath != "" {
+		if err := writeJUnitReport(junitPath, suites); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(suites); err != nil {
+			fmt.Fprintln(os.Stderr, "json encode:", err)
+			os.Exit(1)
+		}
+	} else {
+		printPipelineTestResults(os.Stdout, suites)
+	}
+	for _, s := range suites {
+		if s.Err != "" {
+			os.Exit(1)
+		}
+		for _, r := range s.Results {
+			if !r.Passed() {
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// findFilesWithSuffix expands directories to the files beneath them whose
+// names end in suffix, skipping hidden directories.
+func findFilesWithSuffix(paths []string, suffix string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if !seen[p] {
+				seen[p] = true
+				files = append(files, p)
+			}
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != p && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(d.Name(), suffix) && !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func printPipelineTestResults(w io.Writer, suites []pipelineSuiteResult) {
+	total, failed := 0, 0
+	for _, s := range suites {
+		if s.Err != "" {
+			total++
+			failed++
+			fmt.Fprintf(w, "ERROR %s: %s\n", s.Path, s.Err)
+			continue
+		}
+		for _, r := range s.Results {
+			total++
+			switch {
+			case r.Error != "":
+				failed++
+				fmt.Fprintf(w, "ERROR %s: %s\n      %s\n", s.Path, r.Name, r.Error)
+			case len(r.Failures) > 0:
+				failed++
+				fmt.Fprintf(w, "FAIL  %s: %s\n", s.Path, r.Name)
+				for _, f := range r.Failures {
+					fmt.Fprintf(w, "      %s\n", f)
+				}
+			default:
+				fmt.Fprintf(w, "PASS  %s: %s\n", s.Path, r.Name)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d tests, %d passed, %d failed\n", total, total-failed, failed)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func writeJUnitReport(path string, suites []pipelineSuiteResult) error {
+	var doc junitTestSuites
+	var total time.Duration
+	for _, s := range suites {
+		js := junitTestSuite{Name: s.Path}
+		var elapsed time.Duration
+		if s.Err != "" {
+			js.Cases = append(js.Cases, junitTestCase{
+				Name:      "load",
+				Classname: s.Path,
+				Time:      junitSeconds(0),
+				Error:     &junitMessage{Message: s.Err},
+			})
+			js.Errors++
+		}
+		for _, r := range s.Results {
+			tc := junitTestCase{Name: r.Name, Classname: s.Graph, Time: junitSeconds(r.Duration)}
+			switch {
+			case r.Error != "":
+				tc.Error = &junitMessage{Message: r.Error}
+				js.Errors++
+			case len(r.Failures) > 0:
+				tc.Failure = &junitMessage{Message: r.Failures[0], Body: strings.Join(r.Failures, "\n")}
+				js.Failures++
+			}
+			elapsed += r.Duration
+			js.Cases = append(js.Cases, tc)
+		}
+		js.Tests = len(js.Cases)
+		js.Time = junitSeconds(elapsed)
+		total += elapsed
+		doc.Tests += js.Tests
+		doc.Failures += js.Failures
+		doc.Errors += js.Errors
+		doc.Suites = append(doc.Suites, js)
+	}
+	doc.Time = junitSeconds(total)
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(b, '\n')...), 0o644)
+}
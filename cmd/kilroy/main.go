@@ -110,18 +110,23 @@ func loadEnvFile(args []string) []string {
 func usage() {
 	fmt.Fprintln(os.Stderr, "usage:")
 	fmt.Fprintln(os.Stderr, "  kilroy --version")
-	fmt.Fprintln(os.Stderr, "  kilroy [--env-file <path>] attractor run [--detach] [--allow-test-shim] [--confirm-stale-build] [--no-cxdb] [--force-model <provider=model>] --graph <file.dot> --config <run.yaml> [--run-id <id>] [--logs-root <dir>]")
+	fmt.Fprintln(os.Stderr, "  kilroy [--env-file <path>] attractor run [--detach] [--allow-test-shim] [--confirm-stale-build] [--no-cxdb] [--force-model <provider=model>] [--param <key=value>] [--record] --graph <file.dot> --config <run.yaml> [--run-id <id>] [--logs-root <dir>]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor run --replay <recorded_logs_root> [--graph <file.dot>] [--config <run.yaml>] [--run-id <id>] [--logs-root <dir>] [--no-cxdb]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --logs-root <dir>")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --cxdb <http_base_url> --context-id <id>")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --run-branch <attractor/run/...> [--repo <path>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor status [--logs-root <dir> | --latest] [--json] [-v|--verbose] [--follow|-f] [--cxdb] [--raw] [--watch] [--interval <sec>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor stop --logs-root <dir> [--grace-ms <ms>] [--force]")
-	fmt.Fprintln(os.Stderr, "  kilroy attractor validate --graph <file.dot>")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor validate --graph <file.dot> [--json]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor validate --batch <file.dot> [<file.dot> ...] [--json]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor ingest [--output <file.dot>] [--model <model>] [--skill <skill.md>] [--repo <path>] [--max-turns <n>] <requirements>")
-	fmt.Fprintln(os.Stderr, "  kilroy attractor serve [--addr <host:port>]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor serve [--addr <host:port>] [--state-dir <dir>] [--auth-file <tokens.yaml>] [--audit-log <path>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor modeldb suggest [--refresh] [--ttl <duration>] [--provider <name>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor review --graph <file.dot> [--output <file>] [--json] [--max-turns <n>]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor simulate --graph <file.dot> [--script <outcomes.yaml>] [--json]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor test [--junit <report.xml>] [--json] [<file.test.yaml|dir> ...]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor lsp [--stdio]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor fmt [-w] [--check] [<file.dot|dir> ...]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor runs list [--json]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor runs prune [--before YYYY-MM-DD] [--graph PATTERN] [--label KEY=VALUE] [--orphans] [--dry-run | --yes]")
 }
@@ -150,6 +155,14 @@ func attractor(args []string) {
 		attractorModelDB(args[1:])
 	case "review":
 		attractorReview(args[1:])
+	case "simulate":
+		attractorSimulate(args[1:])
+	case "test":
+		attractorTest(args[1:])
+	case "lsp":
+		attractorLSP(args[1:])
+	case "fmt":
+		attractorFmt(args[1:])
 	case "runs":
 		attractorRuns(args[1:])
 	default:
@@ -169,11 +182,23 @@ func attractorRun(args []string) {
 	var noCXDB bool
 	var skipCLIHeadlessWarning bool
 	var forceModelSpecs []string
+	var paramSpecs []string
+	var recordLLM bool
+	var replayFrom string
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--detach":
 			detach = true
+		case "--record":
+			recordLLM = true
+		case "--replay":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--replay requires a value")
+				os.Exit(1)
+			}
+			replayFrom = args[i]
 		case "--allow-test-shim":
 			allowTestShim = true
 		case "--confirm-stale-build":
@@ -189,6 +214,13 @@ func attractorRun(args []string) {
 				os.Exit(1)
 			}
 			forceModelSpecs = append(forceModelSpecs, args[i])
+		case "--param":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--param requires a value in the form key=value")
+				os.Exit(1)
+			}
+			paramSpecs = append(paramSpecs, args[i])
 		case "--graph":
 			i++
 			if i >= len(args) {
@@ -223,6 +255,25 @@ func attractorRun(args []string) {
 		}
 	}
 
+	if replayFrom != "" {
+		if recordLLM {
+			fmt.Fprintln(os.Stderr, "--record and --replay cannot be combined")
+			os.Exit(1)
+		}
+		// Default to the recorded run's own graph and resolved config.
+		if graphPath == "" {
+			graphPath = filepath.Join(replayFrom, "graph.dot")
+		}
+		if configPath == "" {
+			configPath = filepath.Join(replayFrom, "run_config.json")
+		}
+		abs, err := filepath.Abs(replayFrom)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		replayFrom = abs
+	}
 	if graphPath == "" || configPath == "" {
 		usage()
 		os.Exit(1)
@@ -236,6 +287,15 @@ func attractorRun(args []string) {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	params, err := parseParamFlags(paramSpecs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if replayFrom != "" && params == nil {
+		// Replays expand the graph with the recorded run's parameters.
+		params = recordedRunParams(replayFrom)
+	}
 
 	if detach {
 		cfg, err := engine.LoadRunConfigFile(configPath)
@@ -291,10 +351,19 @@ func attractorRun(args []string) {
 		if noCXDB {
 			childArgs = append(childArgs, "--no-cxdb")
 		}
+		if recordLLM {
+			childArgs = append(childArgs, "--record")
+		}
+		if replayFrom != "" {
+			childArgs = append(childArgs, "--replay", replayFrom)
+		}
 		childArgs = append(childArgs, skipCLIHeadlessWarningFlag)
 		for _, spec := range canonicalForceSpecs {
 			childArgs = append(childArgs, "--force-model", spec)
 		}
+		for _, spec := range paramSpecs {
+			childArgs = append(childArgs, "--param", spec)
+		}
 
 		if err := launchDetached(childArgs, logsRoot); err != nil {
 			fmt.Fprintln(os.Stderr, err)
@@ -330,6 +399,9 @@ func attractorRun(args []string) {
 		AllowTestShim: allowTestShim,
 		DisableCXDB:   noCXDB,
 		ForceModels:   forceModels,
+		Params:        params,
+		RecordLLM:     recordLLM,
+		ReplayFrom:    replayFrom,
 		OnCXDBStartup: func(info *engine.CXDBStartupInfo) {
 			if info == nil {
 				return
@@ -367,6 +439,43 @@ func attractorRun(args []string) {
 	os.Exit(1)
 }
 
+// parseParamFlags turns repeated --param key=value flags into a map. Values
+// are checked against the graph's declarations when the run is prepared.
+func parseParamFlags(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	params := map[string]string{}
+	for _, raw := range specs {
+		key, value, ok := strings.Cut(raw, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("--param %q is invalid; expected key=value", raw)
+		}
+		if _, exists := params[key]; exists {
+			return nil, fmt.Errorf("--param %q specified multiple times", key)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+// recordedRunParams returns the parameters recorded in a run's manifest.json,
+// or nil when it has none.
+func recordedRunParams(logsRoot string) map[string]string {
+	b, err := os.ReadFile(filepath.Join(logsRoot, "manifest.json"))
+	if err != nil {
+		return nil
+	}
+	var m struct {
+		Params map[string]string `json:"params"`
+	}
+	if json.Unmarshal(b, &m) != nil {
+		return nil
+	}
+	return m.Params
+}
+
 func parseForceModelFlags(specs []string) (map[string]string, []string, error) {
 	if len(specs) == 0 {
 		return nil, nil, nil
@@ -512,21 +621,63 @@ func attractorValidate(args []string) {
 		fmt.Fprintf(os.Stderr, "WARNING: model catalog unavailable, model ID checks skipped: %v\n", catErr)
 		cat = nil
 	}
-	_, diags, err := engine.PrepareWithOptions(dotSource, engine.PrepareOptions{Catalog: cat})
+	_, diags, err := engine.PrepareWithOptions(dotSource, engine.PrepareOptions{Catalog: cat, CallRoot: callRoot(graphPath)})
+	if jsonOutput {
+		res := batchFileResult{File: graphPath, Errors: []validate.Diagnostic{}, Warnings: []validate.Diagnostic{}}
+		for _, d := range diags {
+			switch d.Severity {
+			case validate.SeverityError:
+				res.Errors = append(res.Errors, d)
+			case validate.SeverityWarning:
+				res.Warnings = append(res.Warnings, d)
+			}
+		}
+		if err != nil && len(res.Errors) == 0 {
+			res.ParseErr = err.Error()
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(res); encErr != nil {
+			fmt.Fprintln(os.Stderr, "json encode:", encErr)
+			os.Exit(1)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	if err != nil {
 		for _, d := range diags {
-			fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", d.Severity, d.Message, d.Rule)
+			fmt.Fprintf(os.Stderr, "%s: %s: %s (%s)\n", diagnosticLocation(graphPath, d), d.Severity, d.Message, d.Rule)
 		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 	fmt.Printf("ok: %s\n", filepath.Base(graphPath))
 	for _, d := range diags {
-		fmt.Printf("%s: %s (%s)\n", d.Severity, d.Message, d.Rule)
+		fmt.Printf("%s: %s: %s (%s)\n", diagnosticLocation(graphPath, d), d.Severity, d.Message, d.Rule)
 	}
 	os.Exit(0)
 }
 
+// callRoot is the directory stack.call_dotfile paths in graphPath resolve
+// against: the enclosing git checkout, else the graph's own directory.
+func callRoot(graphPath string) string {
+	dir := filepath.Dir(graphPath)
+	if root, ok := gitTopLevel(dir); ok {
+		return root
+	}
+	return dir
+}
+
+// diagnosticLocation formats where a diagnostic points as file:line:col.
+func diagnosticLocation(path string, d validate.Diagnostic) string {
+	if d.Range == nil {
+		return path
+	}
+	return fmt.Sprintf("%s:%d:%d", path, d.Range.Start.Line, d.Range.Start.Column)
+}
+
 // batchFileResult holds per-file validate results for batch mode.
 type batchFileResult struct {
 	File     string                `json:"file"`
@@ -561,7 +712,7 @@ func attractorValidateBatch(files []string, jsonOutput bool) {
 			results = append(results, res)
 			continue
 		}
-		_, diags, prepErr := engine.Prepare(dotSource)
+		_, diags, prepErr := engine.PrepareWithOptions(dotSource, engine.PrepareOptions{CallRoot: callRoot(f)})
 		// Collect diagnostics even when Prepare returns an error.
 		for _, d := range diags {
 			switch d.Severity {
@@ -612,10 +763,10 @@ func attractorValidateBatch(files []string, jsonOutput bool) {
 				fmt.Printf("  parse error: %s\n", r.ParseErr)
 			}
 			for _, d := range r.Errors {
-				fmt.Printf("  ERROR   %-30s %s\n", "("+d.Rule+")", d.Message)
+				fmt.Printf("  ERROR   %-30s %s: %s\n", "("+d.Rule+")", diagnosticLocation(r.File, d), d.Message)
 			}
 			for _, d := range r.Warnings {
-				fmt.Printf("  WARNING %-30s %s\n", "("+d.Rule+")", d.Message)
+				fmt.Printf("  WARNING %-30s %s: %s\n", "("+d.Rule+")", diagnosticLocation(r.File, d), d.Message)
 			}
 		}
 		fmt.Println(strings.Repeat("-", 70))
@@ -173,3 +173,40 @@ func testdataBatchFile(t *testing.T, name string) string {
 	}
 	return p
 }
+
+// TestAttractorValidate_DiagnosticsCarryPositions verifies that single-file
+// validate prints file:line:col and that --json includes source ranges.
+func TestAttractorValidate_DiagnosticsCarryPositions(t *testing.T) {
+	bin := buildKilroyBinary(t)
+	f := filepath.Join(t.TempDir(), "g.dot")
+	_ = os.WriteFile(f, []byte(`digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  start -> exit
+  start -> nowhere
+}
+`), 0o644)
+
+	code, out := runKilroy(t, bin, "attractor", "validate", "--graph", f)
+	if code != 1 || !strings.Contains(out, f+":5:12: ERROR: edge references missing to-node (edge_target_exists)") {
+		t.Fatalf("exit %d, output:\n%s", code, out)
+	}
+
+	code, out = runKilroy(t, bin, "attractor", "validate", "--graph", f, "--json")
+	if code != 1 {
+		t.Fatalf("expected exit code 1, got %d\n%s", code, out)
+	}
+	var res batchFileResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("json: %v\n%s", err, out)
+	}
+	if len(res.Errors) == 0 || res.Errors[0].Range == nil || res.Errors[0].Range.Start.Line != 5 || res.Errors[0].Range.End.Column != 19 {
+		t.Fatalf("errors: %+v", res.Errors)
+	}
+
+	_ = os.WriteFile(f, []byte("digraph G {\n  a [x=]\n  b [y=1 z=2]\n}\n"), 0o644)
+	code, out = runKilroy(t, bin, "attractor", "validate", "--graph", f)
+	if code != 1 || !strings.Contains(out, f+":2:8: ERROR: empty attr value (dot_syntax)") || !strings.Contains(out, f+":3:10: ERROR: expected ',' or ']', got \"z\" (dot_syntax)") {
+		t.Fatalf("exit %d, output:\n%s", code, out)
+	}
+}
@@ -689,6 +689,22 @@ func TestParseForceModelFlags_RejectsInvalidShape(t *testing.T) {
 	}
 }
 
+func TestParseParamFlags(t *testing.T) {
+	got, err := parseParamFlags([]string{"module=internal/billing", "query=a=b", "empty="})
+	if err != nil {
+		t.Fatalf("parseParamFlags: %v", err)
+	}
+	want := map[string]string{"module": "internal/billing", "query": "a=b", "empty": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("params: got %#v want %#v", got, want)
+	}
+	for _, bad := range [][]string{{"module"}, {"=x"}, {"a=1", "a=2"}} {
+		if _, err := parseParamFlags(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
 func TestParseForceModelFlags_RejectsUnsupportedProvider(t *testing.T) {
 	if _, _, err := parseForceModelFlags([]string{"foo=model"}); err == nil {
 		t.Fatalf("expected parse error for unsupported provider")
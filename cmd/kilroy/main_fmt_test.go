@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttractorFmt_CheckAndWrite(t *testing.T) {
+	bin := buildKilroyBinary(t)
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.dot")
+	clean := filepath.Join(dir, "clean.dot")
+	if err := os.WriteFile(messy, []byte("digraph G { start [shape=\"Mdiamond\"]; exit [shape=Msquare]; start -> exit }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := "digraph G {\n    start [shape=Mdiamond]\n    exit [shape=Msquare]\n\n    start -> exit\n}\n"
+	if err := os.WriteFile(clean, []byte(want), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, out := runKilroy(t, bin, "attractor", "fmt", "--check", dir)
+	if code != 1 || strings.TrimSpace(out) != messy {
+		t.Fatalf("--check: code=%d out=%q", code, out)
+	}
+	code, out = runKilroy(t, bin, "attractor", "fmt", messy)
+	if code != 0 || out != want {
+		t.Fatalf("stdout: code=%d out=%q", code, out)
+	}
+	if code, out = runKilroy(t, bin, "attractor", "fmt", "-w", dir); code != 0 {
+		t.Fatalf("-w: code=%d out=%s", code, out)
+	}
+	got, err := os.ReadFile(messy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("-w wrote %q", got)
+	}
+	if code, out = runKilroy(t, bin, "attractor", "fmt", "--check", dir); code != 0 {
+		t.Fatalf("--check after -w: code=%d out=%s", code, out)
+	}
+}
+
+func TestAttractorFmt_SyntaxError(t *testing.T) {
+	bin := buildKilroyBinary(t)
+	path := filepath.Join(t.TempDir(), "bad.dot")
+	if err := os.WriteFile(path, []byte("digraph G {\n  a [shape=box\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, out := runKilroy(t, bin, "attractor", "fmt", "--check", path)
+	if code != 1 || !strings.Contains(out, path+":3:1:") {
+		t.Fatalf("code=%d out=%s", code, out)
+	}
+}
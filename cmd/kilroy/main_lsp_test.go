@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func lspFrame(body string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func TestAttractorLSP_StdioSession(t *testing.T) {
+	bin := buildKilroyBinary(t)
+	input := lspFrame(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{}}}`) +
+		lspFrame(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///p.dot","languageId":"dot","version":1,"text":"digraph G {\n  start [shape=Mdiamond]\n  start -> missing\n}\n"}}}`) +
+		lspFrame(`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`) +
+		lspFrame(`{"jsonrpc":"2.0","method":"exit"}`)
+	code, out := runKilroyWithInput(t, bin, input, "attractor", "lsp", "--stdio")
+	if code != 0 {
+		t.Fatalf("exit code: got %d want 0\n%s", code, out)
+	}
+	for _, want := range []string{`"definitionProvider":true`, `"method":"textDocument/publishDiagnostics"`, `"code":"edge_target_exists"`, `"id":2,"result":null`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestAttractorLSP_ExitWithoutShutdownFails(t *testing.T) {
+	bin := buildKilroyBinary(t)
+	code, _ := runKilroyWithInput(t, bin, lspFrame(`{"jsonrpc":"2.0","method":"exit"}`), "attractor", "lsp")
+	if code != 1 {
+		t.Fatalf("exit code: got %d want 1", code)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttractorTest_ReportsTextAndJUnit(t *testing.T) {
+	bin := buildKilroyBinary(t)
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "pipeline.dot"), []byte(`
+digraph G {
+  graph [goal="ship", default_max_retry=0]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  verify     [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="verify"]
+  postmortem [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="postmortem"]
+  start -> verify
+  verify -> exit [condition="outcome=success"]
+  verify -> postmortem
+  postmortem -> exit
+}
+`), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "pipeline.test.yaml"), []byte(`
+tests:
+  - name: failure routes to postmortem
+    nodes: {verify: fail}
+    expect:
+      path: [start, verify, postmortem, exit]
+  - name: stale expectation
+    expect:
+      visits: {postmortem: 1}
+`), 0o644)
+	junit := filepath.Join(dir, "out", "junit.xml")
+
+	code, out := runKilroy(t, bin, "attractor", "test", "--junit", junit, dir)
+	if code != 1 {
+		t.Fatalf("expected exit code 1, got %d\n%s", code, out)
+	}
+	for _, want := range []string{
+		"PASS  " + filepath.Join(dir, "pipeline.test.yaml") + ": failure routes to postmortem",
+		"FAIL  " + filepath.Join(dir, "pipeline.test.yaml") + ": stale expectation",
+		"visits[postmortem]: got 0, want 1",
+		"2 tests, 1 passed, 1 failed",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in output:\n%s", want, out)
+		}
+	}
+
+	b, err := os.ReadFile(junit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc junitTestSuites
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("junit: %v\n%s", err, b)
+	}
+	if doc.Tests != 2 || doc.Failures != 1 || len(doc.Suites) != 1 || len(doc.Suites[0].Cases) != 2 {
+		t.Fatalf("junit counts: %s", b)
+	}
+	if f := doc.Suites[0].Cases[1].Failure; f == nil || !strings.Contains(f.Message, "visits[postmortem]") {
+		t.Fatalf("junit failure: %s", b)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttractorSimulate_PrintsPathVisitsAndUnusedEdges(t *testing.T) {
+	bin := buildKilroyBinary(t)
+	dir := t.TempDir()
+	graph := filepath.Join(dir, "g.dot")
+	script := filepath.Join(dir, "outcomes.yaml")
+	_ = os.WriteFile(graph, []byte(`
+digraph G {
+  graph [goal="ship", default_max_retry=0]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  verify     [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="verify"]
+  postmortem [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="postmortem"]
+  start -> verify
+  verify -> exit [condition="outcome=success"]
+  verify -> postmortem [condition="outcome=fail"]
+  verify -> exit
+  postmortem -> exit
+}
+`), 0o644)
+	_ = os.WriteFile(script, []byte("nodes:\n  verify: fail\n"), 0o644)
+
+	code, out := runKilroy(t, bin, "attractor", "simulate", "--graph", graph, "--script", script)
+	if code != 0 {
+		t.Fatalf("exit code %d\n%s", code, out)
+	}
+	for _, want := range []string{
+		"2. verify  fail",
+		"3. postmortem  success",
+		"final_status=success",
+		"  postmortem: 1",
+		`verify -> exit [condition="outcome=success"]`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in output:\n%s", want, out)
+		}
+	}
+
+	_ = os.WriteFile(script, []byte("nodes:\n  missing: fail\n"), 0o644)
+	code, out = runKilroy(t, bin, "attractor", "simulate", "--graph", graph, "--script", script)
+	if code != 1 || !strings.Contains(out, `unknown node "missing"`) {
+		t.Fatalf("expected script error, got exit %d:\n%s", code, out)
+	}
+}
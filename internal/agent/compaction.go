@@ -0,0 +1,343 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// CompactionMode selects how Session shrinks its history when the context
+// window fills up.
+type CompactionMode string
+
+const (
+	// CompactionOff keeps the default behavior: warn at ~80% usage and let the
+	// provider reject oversized requests.
+	CompactionOff CompactionMode = ""
+	// CompactionElide replaces the content of older tool results (and oversized
+	// tool-call arguments) with short placeholders. No extra LLM calls.
+	CompactionElide CompactionMode = "elide"
+	// CompactionSummarize replaces older turns with an LLM-written summary,
+	// falling back to elision if summarization fails.
+	CompactionSummarize CompactionMode = "summarize"
+)
+
+// CompactionPolicy configures automatic context compaction.
+type CompactionPolicy struct {
+	Mode CompactionMode
+	// ThresholdPercent is the share of ContextWindowSize (approximate tokens)
+	// at which compaction runs before the next model call. Default 70.
+	ThresholdPercent int
+	// KeepRecentTurns is the number of most recent history turns kept verbatim.
+	// Default 20.
+	KeepRecentTurns int
+}
+
+const (
+	defaultCompactionThresholdPercent = 70
+	defaultCompactionKeepRecentTurns  = 20
+
+	// compactionRegrowPercent is how much of the context window the history
+	// must grow by before the threshold triggers again after a compaction
+	// that left it above the threshold.
+	compactionRegrowPercent = 10
+
+	compactionElideMinChars      = 256
+	compactionElideArgsMinChars  = 1024
+	compactionTranscriptMaxChars = 2000
+)
+
+// ParseCompactionMode accepts "", "off", "none", "elide" and "summarize".
+func ParseCompactionMode(s string) (CompactionMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off", "none":
+		return CompactionOff, nil
+	case string(CompactionElide):
+		return CompactionElide, nil
+	case string(CompactionSummarize):
+		return CompactionSummarize, nil
+	default:
+		return CompactionOff, fmt.Errorf("invalid context compaction mode: %q (want off|elide|summarize)", s)
+	}
+}
+
+func (p *CompactionPolicy) applyDefaults() {
+	if p.ThresholdPercent <= 0 || p.ThresholdPercent > 100 {
+		p.ThresholdPercent = defaultCompactionThresholdPercent
+	}
+	if p.KeepRecentTurns <= 0 {
+		p.KeepRecentTurns = defaultCompactionKeepRecentTurns
+	}
+}
+
+func approxTokensForMessages(msgs []llm.Message) int {
+	totalChars := 0
+	for _, m := range msgs {
+		totalChars += messageCharCount(m)
+	}
+	return int(math.Round(float64(totalChars) / 4.0))
+}
+
+func approxTokensForTurns(sys string, turns []Turn) int {
+	msgs := make([]llm.Message, 0, len(turns)+1)
+	msgs = append(msgs, llm.System(sys))
+	for _, t := range turns {
+		msgs = append(msgs, t.Message)
+	}
+	return approxTokensForMessages(msgs)
+}
+
+// maybeCompactHistory compacts the session history when it exceeds the
+// configured threshold (or unconditionally when force is set, e.g. after a
+// provider context-length error). Returns true when the history changed.
+func (s *Session) maybeCompactHistory(ctx context.Context, sys string, force bool, trigger string) bool {
+	if s == nil || s.cfg.Compaction.Mode == CompactionOff || s.profile == nil {
+		return false
+	}
+	cw := s.profile.ContextWindowSize()
+	if cw <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	turns := append([]Turn{}, s.history...)
+	last := s.compactedTokens
+	s.mu.Unlock()
+
+	before := approxTokensForTurns(sys, turns)
+	threshold := cw * s.cfg.Compaction.ThresholdPercent / 100
+	if !force && before <= threshold {
+		return false
+	}
+	// Compacting again right after a compaction that could not get under the
+	// threshold would redo it every round; wait until the history has grown.
+	if !force && last > 0 && before < last+cw*compactionRegrowPercent/100 {
+		return false
+	}
+
+	mode := s.cfg.Compaction.Mode
+	var compacted []Turn
+	var n int
+	if mode == CompactionSummarize {
+		var err error
+		compacted, n, err = s.summarizeTurns(ctx, turns)
+		if err != nil {
+			s.emit(EventWarning, map[string]any{
+				"message": fmt.Sprintf("context compaction summary failed; eliding instead: %v", err),
+			})
+			mode = CompactionElide
+		}
+	}
+	if mode == CompactionElide {
+		compacted, n = elideTurns(turns, s.cfg.Compaction.KeepRecentTurns)
+	}
+	if n == 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	// Keep anything appended concurrently after the snapshot.
+	if len(s.history) > len(turns) {
+		compacted = append(compacted, s.history[len(turns):]...)
+	}
+	s.history = compacted
+	after := approxTokensForTurns(sys, compacted)
+	s.compactedTokens = 0
+	if after > threshold {
+		s.compactedTokens = after
+	}
+	s.mu.Unlock()
+
+	s.emit(EventContextCompaction, map[string]any{
+		"mode":                 string(mode),
+		"trigger":              trigger,
+		"turns_compacted":      n,
+		"approx_tokens_before": before,
+		"approx_tokens_after":  after,
+		"context_window_size":  cw,
+	})
+	return true
+}
+
+// elideTurns replaces bulky content in all but the last keepRecent turns.
+// Tool-call/result pairing is preserved so the history stays valid for every
+// provider. Returns the new history and the number of turns modified.
+func elideTurns(turns []Turn, keepRecent int) ([]Turn, int) {
+	boundary := len(turns) - keepRecent
+	if boundary <= 0 {
+		return turns, 0
+	}
+	out := make([]Turn, len(turns))
+	copy(out, turns)
+	changed := 0
+	for i := 0; i < boundary; i++ {
+		m, ok := elideMessage(out[i].Message)
+		if ok {
+			out[i] = Turn{Kind: out[i].Kind, Message: m}
+			changed++
+		}
+	}
+	return out, changed
+}
+
+func elideMessage(m llm.Message) (llm.Message, bool) {
+	changed := false
+	parts := make([]llm.ContentPart, len(m.Content))
+	for i, p := range m.Content {
+		parts[i] = p
+		switch p.Kind {
+		case llm.ContentToolResult:
+			if p.ToolResult == nil {
+				continue
+			}
+			n := toolResultChars(p.ToolResult.Content)
+			if n < compactionElideMinChars {
+				continue
+			}
+			tr := *p.ToolResult
+			tr.Content = fmt.Sprintf("[tool output elided by context compaction: %d chars]", n)
+			tr.ImageData = nil
+			tr.ImageMediaType = ""
+			parts[i].ToolResult = &tr
+			changed = true
+		case llm.ContentToolCall:
+			if p.ToolCall == nil || len(p.ToolCall.Arguments) < compactionElideArgsMinChars {
+				continue
+			}
+			tc := *p.ToolCall
+			tc.Arguments = json.RawMessage(fmt.Sprintf(`{"_elided_chars":%d}`, len(p.ToolCall.Arguments)))
+			parts[i].ToolCall = &tc
+			changed = true
+		}
+	}
+	if !changed {
+		return m, false
+	}
+	m.Content = parts
+	return m, true
+}
+
+func toolResultChars(v any) int {
+	switch x := v.(type) {
+	case string:
+		return len(x)
+	case []byte:
+		return len(x)
+	case nil:
+		return 0
+	default:
+		b, _ := json.Marshal(x)
+		return len(b)
+	}
+}
+
+const compactionSummaryPrompt = "You are compacting the history of a coding agent session that is running out of context window. " +
+	"Summarize the transcript below so the agent can continue the task without it. Preserve: the task, decisions made, " +
+	"files read or changed (with paths), commands run and their important results, errors still unresolved, and next steps. " +
+	"Be specific and terse."
+
+// summarizeTurns replaces all but the most recent turns with one summary turn.
+// The most recent user input in the summarized range is kept verbatim so the
+// current task statement is never lost.
+func (s *Session) summarizeTurns(ctx context.Context, turns []Turn) ([]Turn, int, error) {
+	boundary := len(turns) - s.cfg.Compaction.KeepRecentTurns
+	// Never start the kept range with tool results whose call was summarized
+	// away: keep the whole call/result group instead.
+	for boundary > 0 && boundary < len(turns) && turns[boundary].Kind == TurnTool {
+		boundary--
+	}
+	if boundary <= 0 || boundary >= len(turns) {
+		return turns, 0, nil
+	}
+	older := turns[:boundary]
+	pinned := -1
+	for i := len(older) - 1; i >= 0; i-- {
+		if older[i].Kind == TurnUserInput {
+			pinned = i
+			break
+		}
+	}
+	if len(older) == 1 && pinned == 0 {
+		// Nothing to summarize besides the task statement itself.
+		return turns, 0, nil
+	}
+
+	req := llm.Request{
+		Provider: s.profile.ID(),
+		Model:    s.profile.Model(),
+		Messages: []llm.Message{
+			llm.System(compactionSummaryPrompt),
+			llm.User(renderTranscript(older)),
+		},
+	}
+	policy := llm.DefaultRetryPolicy()
+	if s.cfg.LLMRetryPolicy != nil {
+		policy = *s.cfg.LLMRetryPolicy
+	}
+	resp, err := llm.Retry(ctx, policy, s.cfg.LLMSleep, nil, func() (llm.Response, error) {
+		return s.client.Complete(ctx, req)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	summary := strings.TrimSpace(resp.Text())
+	if summary == "" {
+		return nil, 0, errors.New("empty summary")
+	}
+
+	out := make([]Turn, 0, len(turns)-boundary+2)
+	if pinned >= 0 {
+		out = append(out, older[pinned])
+	}
+	out = append(out, Turn{
+		Kind:    TurnCompaction,
+		Message: llm.User("[Summary of earlier conversation, compacted to save context]\n" + summary),
+	})
+	out = append(out, turns[boundary:]...)
+	return out, len(older), nil
+}
+
+func renderTranscript(turns []Turn) string {
+	var b strings.Builder
+	for _, t := range turns {
+		for _, p := range t.Message.Content {
+			switch p.Kind {
+			case llm.ContentText:
+				if strings.TrimSpace(p.Text) == "" {
+					continue
+				}
+				fmt.Fprintf(&b, "[%s] %s\n", t.Kind, clipForTranscript(p.Text))
+			case llm.ContentToolCall:
+				if p.ToolCall != nil {
+					fmt.Fprintf(&b, "[TOOL_CALL %s] %s\n", p.ToolCall.Name, clipForTranscript(string(p.ToolCall.Arguments)))
+				}
+			case llm.ContentToolResult:
+				if p.ToolResult != nil {
+					content, ok := p.ToolResult.Content.(string)
+					if !ok {
+						raw, _ := json.Marshal(p.ToolResult.Content)
+						content = string(raw)
+					}
+					label := "TOOL_RESULT"
+					if p.ToolResult.IsError {
+						label = "TOOL_ERROR"
+					}
+					fmt.Fprintf(&b, "[%s %s] %s\n", label, p.ToolResult.Name, clipForTranscript(content))
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+func clipForTranscript(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= compactionTranscriptMaxChars {
+		return s
+	}
+	return s[:compactionTranscriptMaxChars] + fmt.Sprintf(" ... (%d chars clipped)", len(s)-compactionTranscriptMaxChars)
+}
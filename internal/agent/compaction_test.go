@@ -0,0 +1,341 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+func readFileCallResponse(id string, path string) llm.Response {
+	call := llm.ToolCallData{
+		ID:        id,
+		Name:      "read_file",
+		Arguments: json.RawMessage(`{"file_path":"` + path + `"}`),
+		Type:      "function",
+	}
+	return llm.Response{Message: llm.Message{
+		Role:    llm.RoleAssistant,
+		Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: &call}},
+	}}
+}
+
+func writeBigFile(t *testing.T, dir string) {
+	t.Helper()
+	var b strings.Builder
+	for i := 0; i < 200; i++ {
+		b.WriteString("line of filler text for compaction tests\n")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "big.txt"), []byte(b.String()), 0o644); err != nil {
+		t.Fatalf("write big.txt: %v", err)
+	}
+}
+
+func requestText(req llm.Request) string {
+	b, _ := json.Marshal(req.Messages)
+	return string(b)
+}
+
+func compactionEvents(sess *Session) []SessionEvent {
+	var out []SessionEvent
+	for ev := range sess.Events() {
+		if ev.Kind == EventContextCompaction {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func TestSession_CompactionElide_ReplacesOldToolOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeBigFile(t, dir)
+
+	c := llm.NewClient()
+	f := &fakeAdapter{
+		name: "tiny",
+		steps: []func(req llm.Request) llm.Response{
+			func(req llm.Request) llm.Response { return readFileCallResponse("c1", "big.txt") },
+			func(req llm.Request) llm.Response { return readFileCallResponse("c2", "big.txt") },
+			func(req llm.Request) llm.Response { return llm.Response{Message: llm.Assistant("done")} },
+		},
+	}
+	c.Register(f)
+
+	// One read of big.txt is ~2.5k approx tokens; the threshold (70% of 4000)
+	// is crossed once two reads are in history.
+	sess, err := NewSession(c, tinyProfile{id: "tiny", mod: "m", cw: 4000}, NewLocalExecutionEnvironment(dir), SessionConfig{
+		Compaction: CompactionPolicy{Mode: CompactionElide, KeepRecentTurns: 2},
+	})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := sess.ProcessInput(ctx, "read it twice"); err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	sess.Close()
+
+	reqs := f.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("requests: got %d want 3", len(reqs))
+	}
+	last := requestText(reqs[2])
+	if !strings.Contains(last, "tool output elided by context compaction") {
+		t.Fatalf("expected elided tool output in final request")
+	}
+	if !strings.Contains(last, "line of filler text") {
+		t.Fatalf("expected most recent tool output to be kept verbatim")
+	}
+	evs := compactionEvents(sess)
+	if len(evs) == 0 {
+		t.Fatalf("expected CONTEXT_COMPACTION event")
+	}
+	if evs[0].Data["mode"] != "elide" || evs[0].Data["trigger"] != "threshold" {
+		t.Fatalf("compaction event data: %+v", evs[0].Data)
+	}
+	before, _ := evs[0].Data["approx_tokens_before"].(int)
+	after, _ := evs[0].Data["approx_tokens_after"].(int)
+	if after >= before {
+		t.Fatalf("expected compaction to shrink history: before=%d after=%d", before, after)
+	}
+}
+
+func TestSession_CompactionSummarize_ReplacesOlderTurnsWithSummary(t *testing.T) {
+	dir := t.TempDir()
+	writeBigFile(t, dir)
+
+	c := llm.NewClient()
+	f := &fakeAdapter{
+		name: "tiny",
+		steps: []func(req llm.Request) llm.Response{
+			func(req llm.Request) llm.Response { return readFileCallResponse("c1", "big.txt") },
+			func(req llm.Request) llm.Response { return readFileCallResponse("c2", "big.txt") },
+			func(req llm.Request) llm.Response {
+				if !strings.Contains(req.Messages[0].Text(), "compacting the history") {
+					return llm.Response{Message: llm.Assistant("expected summary request")}
+				}
+				return llm.Response{Message: llm.Assistant("SUMMARY: read big.txt once")}
+			},
+			func(req llm.Request) llm.Response { return llm.Response{Message: llm.Assistant("done")} },
+		},
+	}
+	c.Register(f)
+
+	sess, err := NewSession(c, tinyProfile{id: "tiny", mod: "m", cw: 4000}, NewLocalExecutionEnvironment(dir), SessionConfig{
+		Compaction: CompactionPolicy{Mode: CompactionSummarize, KeepRecentTurns: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := sess.ProcessInput(ctx, "read it twice")
+	if err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	if strings.TrimSpace(out) != "done" {
+		t.Fatalf("out: %q", out)
+	}
+	sess.Close()
+
+	reqs := f.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("requests: got %d want 4", len(reqs))
+	}
+	final := reqs[3].Messages
+	// system + pinned task + summary + last call/result group.
+	if len(final) != 5 {
+		t.Fatalf("final request messages: got %d want 5: %s", len(final), requestText(reqs[3]))
+	}
+	if final[1].Text() != "read it twice" {
+		t.Fatalf("expected task input to be pinned, got %q", final[1].Text())
+	}
+	if !strings.Contains(final[2].Text(), "SUMMARY: read big.txt once") {
+		t.Fatalf("expected summary turn, got %q", final[2].Text())
+	}
+	if final[4].Role != llm.RoleTool {
+		t.Fatalf("expected kept range to end with the latest tool result, got role %q", final[4].Role)
+	}
+
+	hist := sess.History()
+	foundCompaction := false
+	for _, tr := range hist {
+		if tr.Kind == TurnCompaction {
+			foundCompaction = true
+		}
+	}
+	if !foundCompaction {
+		t.Fatalf("expected a COMPACTION turn in history")
+	}
+	evs := compactionEvents(sess)
+	if len(evs) != 1 || evs[0].Data["mode"] != "summarize" {
+		t.Fatalf("compaction events: %+v", evs)
+	}
+}
+
+func TestSession_CompactionSummarize_WaitsForGrowthWhenStillOverThreshold(t *testing.T) {
+	dir := t.TempDir()
+	writeBigFile(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "small.txt"), []byte("tiny\n"), 0o644); err != nil {
+		t.Fatalf("write small.txt: %v", err)
+	}
+
+	summaries := 0
+	summaryOr := func(next llm.Response) func(req llm.Request) llm.Response {
+		return func(req llm.Request) llm.Response {
+			if strings.Contains(req.Messages[0].Text(), "compacting the history") {
+				summaries++
+				// Still well above the threshold (70% of 4000).
+				return llm.Response{Message: llm.Assistant("SUMMARY: " + strings.Repeat("detail ", 2000))}
+			}
+			return next
+		}
+	}
+	c := llm.NewClient()
+	f := &fakeAdapter{
+		name: "tiny",
+		steps: []func(req llm.Request) llm.Response{
+			func(req llm.Request) llm.Response { return readFileCallResponse("c1", "big.txt") },
+			func(req llm.Request) llm.Response { return readFileCallResponse("c2", "big.txt") },
+			summaryOr(llm.Response{}),
+			summaryOr(readFileCallResponse("c3", "small.txt")),
+			summaryOr(readFileCallResponse("c4", "small.txt")),
+			summaryOr(llm.Response{Message: llm.Assistant("done")}),
+		},
+	}
+	c.Register(f)
+
+	sess, err := NewSession(c, tinyProfile{id: "tiny", mod: "m", cw: 4000}, NewLocalExecutionEnvironment(dir), SessionConfig{
+		Compaction: CompactionPolicy{Mode: CompactionSummarize, KeepRecentTurns: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := sess.ProcessInput(ctx, "read files"); err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	sess.Close()
+
+	// The small reads do not grow the history enough to compact again.
+	if summaries != 1 {
+		t.Fatalf("summary requests: got %d want 1", summaries)
+	}
+	if evs := compactionEvents(sess); len(evs) != 1 {
+		t.Fatalf("compaction events: got %d want 1", len(evs))
+	}
+}
+
+// overflowOnceAdapter answers request failAt (0-based) with a context length
+// error and defers every other request to fakeAdapter.
+type overflowOnceAdapter struct {
+	*fakeAdapter
+	failAt int
+	calls  int
+}
+
+func (a *overflowOnceAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	a.calls++
+	if a.calls-1 == a.failAt {
+		return llm.Response{}, llm.ErrorFromHTTPStatus(a.name, 413, "context too long", nil, nil)
+	}
+	return a.fakeAdapter.Complete(ctx, req)
+}
+
+func TestSession_CompactionOnOverflow_RetriesWithinTheSameTurn(t *testing.T) {
+	dir := t.TempDir()
+	writeBigFile(t, dir)
+
+	c := llm.NewClient()
+	f := &fakeAdapter{
+		name: "tiny",
+		steps: []func(req llm.Request) llm.Response{
+			func(req llm.Request) llm.Response { return readFileCallResponse("c1", "big.txt") },
+			func(req llm.Request) llm.Response { return readFileCallResponse("c2", "big.txt") },
+			func(req llm.Request) llm.Response { return llm.Response{Message: llm.Assistant("done")} },
+		},
+	}
+	c.Register(&overflowOnceAdapter{fakeAdapter: f, failAt: 2})
+
+	// The window is large enough that only the overflow error compacts.
+	// Three turns reach the model; the retried one must not count twice.
+	sess, err := NewSession(c, tinyProfile{id: "tiny", mod: "m", cw: 1_000_000}, NewLocalExecutionEnvironment(dir), SessionConfig{
+		MaxTurns:   3,
+		Compaction: CompactionPolicy{Mode: CompactionElide, KeepRecentTurns: 2},
+	})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := sess.ProcessInput(ctx, "read it twice"); err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	sess.Close()
+
+	if got := len(f.Requests()); got != 3 {
+		t.Fatalf("answered requests: got %d want 3", got)
+	}
+	sess.mu.Lock()
+	turns := sess.turns
+	sess.mu.Unlock()
+	if turns != 3 {
+		t.Fatalf("turns: got %d want 3", turns)
+	}
+	evs := compactionEvents(sess)
+	if len(evs) != 1 || evs[0].Data["trigger"] != "context_length_error" {
+		t.Fatalf("compaction events: %+v", evs)
+	}
+}
+
+func TestSession_CompactionOff_DoesNotCompact(t *testing.T) {
+	dir := t.TempDir()
+	writeBigFile(t, dir)
+
+	c := llm.NewClient()
+	f := &fakeAdapter{
+		name: "tiny",
+		steps: []func(req llm.Request) llm.Response{
+			func(req llm.Request) llm.Response { return readFileCallResponse("c1", "big.txt") },
+			func(req llm.Request) llm.Response { return readFileCallResponse("c2", "big.txt") },
+			func(req llm.Request) llm.Response { return llm.Response{Message: llm.Assistant("done")} },
+		},
+	}
+	c.Register(f)
+
+	sess, err := NewSession(c, tinyProfile{id: "tiny", mod: "m", cw: 4000}, NewLocalExecutionEnvironment(dir), SessionConfig{})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := sess.ProcessInput(ctx, "read it twice"); err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	sess.Close()
+	if evs := compactionEvents(sess); len(evs) != 0 {
+		t.Fatalf("expected no compaction events, got %d", len(evs))
+	}
+	if strings.Contains(requestText(f.Requests()[2]), "elided by context compaction") {
+		t.Fatalf("did not expect elision with compaction off")
+	}
+}
+
+func TestParseCompactionMode(t *testing.T) {
+	for in, want := range map[string]CompactionMode{"": CompactionOff, "off": CompactionOff, "Elide": CompactionElide, " summarize ": CompactionSummarize} {
+		got, err := ParseCompactionMode(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseCompactionMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseCompactionMode("truncate"); err == nil {
+		t.Fatalf("expected error for unknown mode")
+	}
+}
@@ -187,6 +187,45 @@ func NewGeminiProfile(model string) ProviderProfile {
 	}
 }
 
+// NewLocalProfile targets small self-hosted models behind OpenAI-compatible
+// servers: search/replace edits instead of apply_patch, sequential tool calls,
+// no subagents, and a conservative context window. Callers that know the
+// served context length should size the profile with WithContextWindow.
+func NewLocalProfile(model string) ProviderProfile {
+	return &baseProfile{
+		id:            "local",
+		model:         strings.TrimSpace(model),
+		parallel:      false,
+		contextWindow: 8_192,
+		basePrompt:    localProfileBasePrompt,
+		docFiles:      []string{"AGENTS.md"},
+		toolDefs: []llm.ToolDefinition{
+			defReadFile(),
+			defWriteFile(),
+			defEditFile(),
+			defShell(),
+			defGrep(),
+			defGlob(),
+		},
+	}
+}
+
+// WithContextWindow returns p reporting n as its context window. n <= 0
+// returns p unchanged.
+func WithContextWindow(p ProviderProfile, n int) ProviderProfile {
+	if p == nil || n <= 0 {
+		return p
+	}
+	return contextWindowProfile{ProviderProfile: p, contextWindow: n}
+}
+
+type contextWindowProfile struct {
+	ProviderProfile
+	contextWindow int
+}
+
+func (p contextWindowProfile) ContextWindowSize() int { return p.contextWindow }
+
 func envInfoFromEnv(env ExecutionEnvironment) EnvironmentInfo {
 	wd := ""
 	plat := ""
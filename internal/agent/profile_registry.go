@@ -12,6 +12,7 @@ var (
 		"openai":    NewOpenAIProfile,
 		"anthropic": NewAnthropicProfile,
 		"google":    NewGeminiProfile,
+		"local":     NewLocalProfile,
 	}
 )
 
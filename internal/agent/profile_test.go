@@ -92,6 +92,31 @@ func TestProviderProfiles_ToolLists_MatchSpec(t *testing.T) {
 			"close_agent",
 		})
 	})
+	t.Run("local", func(t *testing.T) {
+		p := NewLocalProfile("qwen2.5-coder:7b")
+		assertToolListExact(t, p, []string{
+			"read_file",
+			"write_file",
+			"edit_file",
+			"shell",
+			"grep",
+			"glob",
+		})
+	})
+}
+
+func TestWithContextWindow_OverridesProfileSize(t *testing.T) {
+	p := NewLocalProfile("m")
+	if p.ContextWindowSize() != 8_192 {
+		t.Fatalf("local default context window: %d", p.ContextWindowSize())
+	}
+	sized := WithContextWindow(p, 32_768)
+	if sized.ContextWindowSize() != 32_768 || sized.ID() != "local" || len(sized.ToolDefinitions()) != 6 {
+		t.Fatalf("sized profile: id=%s cw=%d", sized.ID(), sized.ContextWindowSize())
+	}
+	if WithContextWindow(p, 0) != p {
+		t.Fatal("non-positive window should leave the profile unchanged")
+	}
 }
 
 func TestProviderProfiles_BuildSystemPrompt_IncludesProviderSpecificBaseInstructions(t *testing.T) {
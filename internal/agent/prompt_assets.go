@@ -13,6 +13,8 @@ var (
 	anthropicProfileBasePromptRaw string
 	//go:embed prompts/gemini_profile_system.txt
 	geminiProfileBasePromptRaw string
+	//go:embed prompts/local_profile_system.txt
+	localProfileBasePromptRaw string
 	//go:embed prompts/loop_detection_steering_user.txt
 	loopDetectionSteeringPromptRaw string
 )
@@ -21,6 +23,7 @@ var (
 	openAIProfileBasePrompt     = mustEmbeddedPromptText("openai_profile_system", openAIProfileBasePromptRaw)
 	anthropicProfileBasePrompt  = mustEmbeddedPromptText("anthropic_profile_system", anthropicProfileBasePromptRaw)
 	geminiProfileBasePrompt     = mustEmbeddedPromptText("gemini_profile_system", geminiProfileBasePromptRaw)
+	localProfileBasePrompt      = mustEmbeddedPromptText("local_profile_system", localProfileBasePromptRaw)
 	loopDetectionSteeringPrompt = mustEmbeddedPromptText(
 		"loop_detection_steering_user",
 		loopDetectionSteeringPromptRaw,
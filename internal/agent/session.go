@@ -51,6 +51,19 @@ type SessionConfig struct {
 	EnableLoopDetection *bool
 	LoopDetectionWindow int
 
+	// Compaction enables automatic history compaction when the context window
+	// fills up. The zero value keeps warn-only behavior.
+	Compaction CompactionPolicy
+
+	// ExtraTools are registered after the core tools (e.g. tools discovered
+	// from MCP servers). A name that collides with a core tool is an error.
+	ExtraTools []RegisteredTool
+
+	// InitialHistory seeds the conversation history before the first input.
+	// Use this to continue a prior session's thread (e.g., fidelity=full
+	// thread reuse across pipeline stages).
+	InitialHistory []Turn
+
 	// LLMRetryPolicy controls retries for retryable Unified LLM errors (429, 5xx, etc).
 	// Nil means use llm.DefaultRetryPolicy().
 	LLMRetryPolicy *llm.RetryPolicy
@@ -83,6 +96,7 @@ func (c *SessionConfig) applyDefaults() {
 	if c.LoopDetectionWindow <= 0 {
 		c.LoopDetectionWindow = 10
 	}
+	c.Compaction.applyDefaults()
 }
 
 type Session struct {
@@ -99,6 +113,9 @@ type Session struct {
 	closed  bool
 	turns   int
 	history []Turn
+	// compactedTokens is the approximate history size a compaction left
+	// above the threshold, 0 when the last one got under it.
+	compactedTokens int
 
 	reg *ToolRegistry
 
@@ -129,7 +146,7 @@ func NewSession(client *llm.Client, profile ProviderProfile, env ExecutionEnviro
 		profile:   profile,
 		env:       env,
 		events:    make(chan SessionEvent, 256),
-		history:   []Turn{},
+		history:   append([]Turn{}, cfg.InitialHistory...),
 		subagents: map[string]*subagent{},
 	}
 
@@ -148,6 +165,14 @@ func NewSession(client *llm.Client, profile ProviderProfile, env ExecutionEnviro
 	if err := registerCoreTools(reg, s); err != nil {
 		return nil, err
 	}
+	for _, t := range cfg.ExtraTools {
+		if _, exists := reg.tools[t.Definition.Name]; exists {
+			return nil, fmt.Errorf("tool %s conflicts with a built-in tool", t.Definition.Name)
+		}
+		if err := reg.Register(t); err != nil {
+			return nil, err
+		}
+	}
 	// Allow SessionConfig to override default tool output limits (spec).
 	if len(cfg.ToolOutputLimits) > 0 {
 		reg.mu.Lock()
@@ -181,6 +206,22 @@ func NewSession(client *llm.Client, profile ProviderProfile, env ExecutionEnviro
 
 func (s *Session) Events() <-chan SessionEvent { return s.events }
 
+// toolDefinitions returns the profile's tools followed by SessionConfig.ExtraTools.
+func (s *Session) toolDefinitions() []llm.ToolDefinition {
+	defs := s.profile.ToolDefinitions()
+	for _, t := range s.cfg.ExtraTools {
+		defs = append(defs, t.Definition)
+	}
+	return defs
+}
+
+// History returns a copy of the session's conversation history.
+func (s *Session) History() []Turn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Turn{}, s.history...)
+}
+
 // SetReasoningEffort updates the reasoning effort used for future LLM calls.
 // Takes effect on the next request (spec).
 func (s *Session) SetReasoningEffort(effort string) {
@@ -439,6 +480,10 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 	malformedRepeats := 0
 	loopWarned := false
 	ctxWarned := false
+	overflowCompacted := false
+	// retrying is set when the previous round's call is being sent again
+	// after an overflow compaction; it is the same turn, not a new one.
+	retrying := false
 
 	for round := 0; round < s.cfg.MaxToolRoundsPerInput; round++ {
 		select {
@@ -447,8 +492,12 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 			return "", ctx.Err()
 		default:
 		}
+		s.maybeCompactHistory(ctx, sys, false, "threshold")
 		s.mu.Lock()
-		s.turns++
+		if !retrying {
+			s.turns++
+		}
+		retrying = false
 		turns := s.turns
 		historyTurns := append([]Turn{}, s.history...)
 		s.mu.Unlock()
@@ -471,7 +520,7 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 			Model:    s.profile.Model(),
 			Provider: s.profile.ID(),
 			Messages: append([]llm.Message{llm.System(sys)}, history...),
-			Tools:    s.profile.ToolDefinitions(),
+			Tools:    s.toolDefinitions(),
 		}
 		if strings.TrimSpace(s.cfg.ReasoningEffort) != "" {
 			v := strings.TrimSpace(s.cfg.ReasoningEffort)
@@ -492,9 +541,18 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 			return s.client.Complete(ctx, req)
 		})
 		if err != nil {
-			s.emit(EventError, map[string]any{"error": err.Error()})
-			// Spec: context overflow should emit a warning (no automatic compaction).
+			// Context overflow: compact once and retry when compaction is enabled.
 			var cle *llm.ContextLengthError
+			if errors.As(err, &cle) && !overflowCompacted {
+				overflowCompacted = true
+				if s.maybeCompactHistory(ctx, sys, true, "context_length_error") {
+					s.emit(EventWarning, map[string]any{"message": "Context length exceeded; history compacted, retrying"})
+					retrying = true
+					continue
+				}
+			}
+			s.emit(EventError, map[string]any{"error": err.Error()})
+			// Spec: context overflow should emit a warning.
 			if errors.As(err, &cle) {
 				s.emit(EventWarning, map[string]any{"message": "Context length exceeded"})
 			}
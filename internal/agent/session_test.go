@@ -709,3 +709,128 @@ func anyToString(v any) string {
 		return string(b)
 	}
 }
+
+func TestSession_InitialHistory_IsSentAndExtendedByHistory(t *testing.T) {
+	dir := t.TempDir()
+	c := llm.NewClient()
+	f := &fakeAdapter{
+		name: "openai",
+		steps: []func(req llm.Request) llm.Response{
+			func(req llm.Request) llm.Response {
+				return llm.Response{Message: llm.Assistant("second answer")}
+			},
+		},
+	}
+	c.Register(f)
+
+	seed := []Turn{
+		{Kind: TurnUserInput, Message: llm.User("first question")},
+		{Kind: TurnAssistant, Message: llm.Assistant("first answer")},
+	}
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.2"), NewLocalExecutionEnvironment(dir), SessionConfig{InitialHistory: seed})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := sess.ProcessInput(ctx, "second question"); err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	sess.Close()
+
+	reqs := f.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("requests: got %d want 1", len(reqs))
+	}
+	// system + 2 seeded turns + new user input
+	msgs := reqs[0].Messages
+	if len(msgs) != 4 {
+		t.Fatalf("messages: got %d want 4: %+v", len(msgs), msgs)
+	}
+	if msgs[1].Text() != "first question" || msgs[2].Text() != "first answer" || msgs[3].Text() != "second question" {
+		t.Fatalf("unexpected request history: %+v", msgs)
+	}
+
+	hist := sess.History()
+	if len(hist) != 4 {
+		t.Fatalf("History: got %d turns want 4", len(hist))
+	}
+	if hist[3].Kind != TurnAssistant || hist[3].Message.Text() != "second answer" {
+		t.Fatalf("History last turn: %+v", hist[3])
+	}
+	// The seed slice must not be aliased by the session.
+	if len(seed) != 2 {
+		t.Fatalf("seed mutated: %+v", seed)
+	}
+}
+
+func TestSession_ExtraTools_AreAdvertisedValidatedAndExecuted(t *testing.T) {
+	dir := t.TempDir()
+	c := llm.NewClient()
+	bad := llm.ToolCallData{ID: "c1", Name: "mcp__tickets__get", Arguments: json.RawMessage(`{}`), Type: "function"}
+	good := llm.ToolCallData{ID: "c2", Name: "mcp__tickets__get", Arguments: json.RawMessage(`{"id":"T-7"}`), Type: "function"}
+	callStep := func(call *llm.ToolCallData) func(req llm.Request) llm.Response {
+		return func(req llm.Request) llm.Response {
+			return llm.Response{Message: llm.Message{
+				Role:    llm.RoleAssistant,
+				Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: call}},
+			}}
+		}
+	}
+	f := &fakeAdapter{name: "openai", steps: []func(req llm.Request) llm.Response{callStep(&bad), callStep(&good)}}
+	c.Register(f)
+
+	var got []string
+	extra := RegisteredTool{
+		Definition: llm.ToolDefinition{
+			Name:        "mcp__tickets__get",
+			Description: "Fetch a ticket",
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"id": map[string]any{"type": "string"}},
+				"required":   []any{"id"},
+			},
+		},
+		Exec: func(ctx context.Context, env ExecutionEnvironment, args map[string]any) (any, error) {
+			got = append(got, args["id"].(string))
+			return "ticket " + args["id"].(string), nil
+		},
+	}
+	sess, err := NewSession(c, NewOpenAIProfile("gpt-5.2"), NewLocalExecutionEnvironment(dir), SessionConfig{ExtraTools: []RegisteredTool{extra}})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := sess.ProcessInput(ctx, "look up the ticket"); err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	sess.Close()
+
+	if len(got) != 1 || got[0] != "T-7" {
+		t.Fatalf("executions: %v (schema-invalid call must not execute)", got)
+	}
+	reqs := f.Requests()
+	advertised := false
+	for _, td := range reqs[0].Tools {
+		if td.Name == "mcp__tickets__get" {
+			advertised = true
+		}
+	}
+	if !advertised {
+		t.Fatalf("extra tool missing from request tools")
+	}
+	b, _ := json.Marshal(reqs[1].Messages)
+	if !strings.Contains(string(b), "schema validation failed") {
+		t.Fatalf("expected a schema validation error for the first call")
+	}
+	b, _ = json.Marshal(reqs[2].Messages)
+	if !strings.Contains(string(b), "ticket T-7") {
+		t.Fatalf("expected the tool result in the next request")
+	}
+
+	extra.Definition.Name = "read_file"
+	if _, err := NewSession(c, NewOpenAIProfile("gpt-5.2"), NewLocalExecutionEnvironment(dir), SessionConfig{ExtraTools: []RegisteredTool{extra}}); err == nil {
+		t.Fatal("expected a conflict error for an extra tool named like a core tool")
+	}
+}
@@ -9,11 +9,13 @@ const (
 	TurnSteering  TurnKind = "STEERING"
 	TurnAssistant TurnKind = "ASSISTANT"
 	TurnTool      TurnKind = "TOOL"
+	// TurnCompaction holds a summary that replaced older turns during context compaction.
+	TurnCompaction TurnKind = "COMPACTION"
 )
 
 // Turn is the Session's typed history item. Steering turns are kept distinct for observability,
 // but are converted to user-role messages when building the LLM request.
 type Turn struct {
-	Kind    TurnKind
-	Message llm.Message
+	Kind    TurnKind    `json:"kind"`
+	Message llm.Message `json:"message"`
 }
@@ -2,76 +2,112 @@ package cond
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/danshapiro/kilroy/internal/attractor/runtime"
 )
 
-// Evaluate evaluates a minimal AND-only condition language used on edges.
+// Evaluate evaluates the condition language used on edges.
 //
-// Grammar (per attractor-spec.md Section 10):
+// Grammar (extends attractor-spec.md Section 10; every AND-only condition
+// keeps its meaning):
 //
-//	ConditionExpr ::= Clause ( '&&' Clause )*
-//	Clause        ::= Key Operator Literal
-//	Key           ::= 'outcome' | 'preferred_label' | 'context.' Path
-//	Operator      ::= '=' | '!='
+//	OrExpr   ::= AndExpr ( '||' AndExpr )*
+//	AndExpr  ::= Primary ( '&&' Primary )*
+//	Primary  ::= '(' OrExpr ')' | Clause
+//	Clause   ::= Key [ CmpOp Literal | 'in' '[' Literal ( ',' Literal )* ']'
+//	                 | 'contains' Literal | 'matches' Literal ]
+//	Key      ::= 'outcome' | 'preferred_label' | 'context.' Path
+//	CmpOp    ::= '=' | '==' | '!=' | '<' | '<=' | '>' | '>='
+//	Literal  ::= '"' quoted '"' | bare text up to '&&', '||' or a closing ')'
 //
-// Missing keys resolve to empty string. Comparisons are exact string comparisons.
+// Missing keys resolve to empty string. '=', '!=' and 'in' compare strings
+// exactly; '<', '<=', '>' and '>=' compare numbers and are false when either
+// side is not a number. 'contains' is a substring test and 'matches' an
+// unanchored RE2 match. A bare key is truthy unless empty, "false", "0" or "no".
 func Evaluate(condition string, outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
-	condition = strings.TrimSpace(condition)
-	if condition == "" {
-		return true, nil
+	expr, err := Parse(condition)
+	if err != nil {
+		return false, err
 	}
-	clauses := strings.Split(condition, "&&")
-	for _, clause := range clauses {
-		clause = strings.TrimSpace(clause)
-		if clause == "" {
-			continue
-		}
-		ok, err := evalClause(clause, outcome, ctx)
-		if err != nil {
-			return false, err
+	return expr.Eval(outcome, ctx), nil
+}
+
+// Eval evaluates a parsed expression.
+func (e *Expr) Eval(outcome runtime.Outcome, ctx *runtime.Context) bool {
+	if e == nil {
+		return true
+	}
+	return evalNode(e.root, outcome, ctx)
+}
+
+func evalNode(n node, outcome runtime.Outcome, ctx *runtime.Context) bool {
+	switch n := n.(type) {
+	case orNode:
+		for _, t := range n {
+			if evalNode(t, outcome, ctx) {
+				return true
+			}
 		}
-		if !ok {
-			return false, nil
+		return false
+	case andNode:
+		for _, t := range n {
+			if !evalNode(t, outcome, ctx) {
+				return false
+			}
 		}
+		return true
+	case *Clause:
+		return evalClause(n, outcome, ctx)
 	}
-	return true, nil
+	return false
 }
 
-func evalClause(clause string, outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
-	if strings.Contains(clause, "!=") {
-		parts := strings.SplitN(clause, "!=", 2)
-		if len(parts) != 2 {
-			return false, fmt.Errorf("invalid clause: %q", clause)
+func evalClause(c *Clause, outcome runtime.Outcome, ctx *runtime.Context) bool {
+	got := resolveKey(c.Key, outcome, ctx)
+	switch c.Op {
+	case OpEq:
+		return got == canonicalizeCompareValue(c.Key, c.Values[0])
+	case OpNe:
+		return got != canonicalizeCompareValue(c.Key, c.Values[0])
+	case OpIn:
+		for _, v := range c.Values {
+			if got == canonicalizeCompareValue(c.Key, v) {
+				return true
+			}
 		}
-		k := strings.TrimSpace(parts[0])
-		want := strings.TrimSpace(parts[1])
-		got := resolveKey(k, outcome, ctx)
-		want = canonicalizeCompareValue(k, want)
-		return got != want, nil
-	}
-	if strings.Contains(clause, "=") {
-		parts := strings.SplitN(clause, "=", 2)
-		if len(parts) != 2 {
-			return false, fmt.Errorf("invalid clause: %q", clause)
+		return false
+	case OpLt, OpLe, OpGt, OpGe:
+		a, errA := strconv.ParseFloat(strings.TrimSpace(got), 64)
+		b, errB := strconv.ParseFloat(c.Values[0], 64)
+		if errA != nil || errB != nil {
+			return false
+		}
+		switch c.Op {
+		case OpLt:
+			return a < b
+		case OpLe:
+			return a <= b
+		case OpGt:
+			return a > b
+		default:
+			return a >= b
 		}
-		k := strings.TrimSpace(parts[0])
-		want := strings.TrimSpace(parts[1])
-		got := resolveKey(k, outcome, ctx)
-		want = canonicalizeCompareValue(k, want)
-		return got == want, nil
+	case OpContains:
+		return strings.Contains(got, c.Values[0])
+	case OpMatches:
+		return c.re.MatchString(got)
 	}
 	// Bare key: truthy if non-empty and not "false"/"0" (best-effort).
-	got := resolveKey(strings.TrimSpace(clause), outcome, ctx)
 	if got == "" {
-		return false, nil
+		return false
 	}
 	switch strings.ToLower(got) {
 	case "false", "0", "no":
-		return false, nil
+		return false
 	default:
-		return true, nil
+		return true
 	}
 }
 
@@ -156,3 +156,91 @@ func TestEvaluate_OutcomeAliasesMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluate_ExtendedGrammar(t *testing.T) {
+	ctx := runtime.NewContext()
+	ctx.Set("retry_count", 4)
+	ctx.Set("failure_class", "transient_infra")
+	ctx.Set("log", "2 tests FAILED in pkg/parser")
+	ctx.Set("ratio", "0.75")
+	ctx.Set("step", "retry)")
+
+	out := runtime.Outcome{Status: runtime.StatusFail, PreferredLabel: "Fix the bug"}
+
+	cases := []struct {
+		cond string
+		want bool
+	}{
+		{"outcome=success || outcome=fail", true},
+		{"outcome=success || context.retry_count>3", true},
+		{"(outcome=success || outcome=fail) && context.retry_count<3", false},
+		{"outcome=fail && (context.failure_class=budget_exhausted || context.failure_class=transient_infra)", true},
+		{"context.retry_count > 3", true},
+		{"context.retry_count >= 4", true},
+		{"context.retry_count <= 3", false},
+		{"context.ratio < 1", true},
+		{"context.failure_class > 3", false},
+		{"context.missing >= 0", false},
+		{"outcome in [success, partial_success]", false},
+		{"outcome in [success, failure]", true},
+		{`context.failure_class in ["deterministic", "transient_infra"]`, true},
+		{"context.log contains FAILED", true},
+		{"context.log contains passed", false},
+		{`context.log matches "^\\d+ tests FAILED"`, true},
+		{"context.log matches pkg/(lexer|ast)", false},
+		{"context.retry_count == 4", true},
+		{"preferred_label=Fix the bug", true},
+		{"(preferred_label=Fix the bug)", true},
+		// Outside parentheses a ")" is part of the value.
+		{"context.step=retry)", true},
+		{"(context.step=retry)", false},
+		{"a && && outcome=fail", false},
+		{"&&&&", true},
+	}
+	for _, tc := range cases {
+		got, err := Evaluate(tc.cond, out, ctx)
+		if err != nil {
+			t.Fatalf("Evaluate(%q) error: %v", tc.cond, err)
+		}
+		if got != tc.want {
+			t.Fatalf("Evaluate(%q)=%v, want %v", tc.cond, got, tc.want)
+		}
+	}
+}
+
+func TestParse_RejectsMalformedExpressions(t *testing.T) {
+	for _, c := range []string{
+		"(outcome=success",
+		"(outcome=success))",
+		"outcome=success ||",
+		"|| outcome=success",
+		"()",
+		"outcome in success",
+		"outcome in []",
+		"outcome in [a, b",
+		`context.x matches "("`,
+		`context.x = "unterminated`,
+		"=success",
+	} {
+		if _, err := Parse(c); err == nil {
+			t.Fatalf("Parse(%q): expected error", c)
+		}
+	}
+}
+
+func TestParse_Clauses(t *testing.T) {
+	e, err := Parse(`outcome=fail && (context.n > 2 || context.tag in [a, "b c"])`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got := e.Clauses()
+	if len(got) != 3 {
+		t.Fatalf("clauses: %+v", got)
+	}
+	if got[1].Key != "context.n" || got[1].Op != OpGt || got[1].Values[0] != "2" || got[1].Text != "context.n > 2" {
+		t.Fatalf("clause 1: %+v", got[1])
+	}
+	if got[2].Op != OpIn || len(got[2].Values) != 2 || got[2].Values[1] != "b c" {
+		t.Fatalf("clause 2: %+v", got[2])
+	}
+}
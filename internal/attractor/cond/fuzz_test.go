@@ -71,6 +71,16 @@ func FuzzConditionEval(f *testing.F) {
 	f.Add("a && && b")          // double &&
 	f.Add("context.")           // incomplete context key
 
+	// Seeds for ||, parentheses, numeric comparison, in, contains, matches.
+	f.Add("outcome=success || outcome=partial_success")
+	f.Add("(outcome=fail && context.n>3) || preferred_label=Yes")
+	f.Add("context.n >= 2.5")
+	f.Add("outcome in [success, fail]")
+	f.Add(`context.log contains "FAILED"`)
+	f.Add("context.log matches ^ok$")
+	f.Add("((")
+	f.Add(`x in ["a\`)
+
 	f.Fuzz(func(t *testing.T, condition string) {
 		// The invariant: Evaluate must never panic.
 		// It may return an error for malformed conditions — that is correct behavior.
@@ -0,0 +1,326 @@
+package cond
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Clause operators. OpTruthy is a bare key with no operator.
+const (
+	OpTruthy   = ""
+	OpEq       = "="
+	OpNe       = "!="
+	OpLt       = "<"
+	OpLe       = "<="
+	OpGt       = ">"
+	OpGe       = ">="
+	OpIn       = "in"
+	OpContains = "contains"
+	OpMatches  = "matches"
+)
+
+// Clause is one comparison in a parsed condition.
+type Clause struct {
+	Text   string   // source text of the clause
+	Key    string   // outcome, preferred_label, context.<path>, or a bare context key
+	Op     string   // one of the Op* constants
+	Values []string // literal operands; one for binary operators, the list for "in"
+
+	re *regexp.Regexp // compiled pattern for "matches"
+}
+
+// Expr is a parsed condition expression.
+type Expr struct {
+	root    node
+	clauses []*Clause
+}
+
+// Clauses returns the expression's clauses in source order.
+func (e *Expr) Clauses() []Clause {
+	if e == nil {
+		return nil
+	}
+	out := make([]Clause, 0, len(e.clauses))
+	for _, c := range e.clauses {
+		out = append(out, *c)
+	}
+	return out
+}
+
+type node any
+
+type orNode []node
+type andNode []node
+
+// Parse parses a condition expression. An empty expression is valid and
+// always true.
+func Parse(condition string) (*Expr, error) {
+	p := &parser{s: condition}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, fmt.Errorf("invalid condition %q: unexpected %q at offset %d", condition, p.s[p.pos:], p.pos)
+	}
+	return &Expr{root: root, clauses: p.clauses}, nil
+}
+
+type parser struct {
+	s       string
+	pos     int
+	depth   int // open parentheses
+	clauses []*Clause
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.s) }
+
+func (p *parser) skipSpace() {
+	for !p.eof() && isSpace(p.s[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *parser) peek(tok string) bool { return strings.HasPrefix(p.s[p.pos:], tok) }
+
+func (p *parser) consume(tok string) bool {
+	if p.peek(tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *parser) atGroupEnd() bool { return p.depth > 0 && p.peek(")") }
+
+func (p *parser) parseOr() (node, error) {
+	var terms orNode
+	for {
+		start := p.pos
+		t, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume("||") {
+			if len(t) == 0 && len(terms) > 0 {
+				return nil, fmt.Errorf("invalid condition %q: missing operand after || at offset %d", p.s, start)
+			}
+			terms = append(terms, t)
+			break
+		}
+		if len(t) == 0 {
+			return nil, fmt.Errorf("invalid condition %q: missing operand before || at offset %d", p.s, start)
+		}
+		terms = append(terms, t)
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+// parseAnd parses &&-joined operands. Empty operands ("a && && b") are skipped,
+// as they always have been.
+func (p *parser) parseAnd() (andNode, error) {
+	var terms andNode
+	for {
+		p.skipSpace()
+		if p.eof() || p.peek("||") || p.atGroupEnd() {
+			return terms, nil
+		}
+		if p.consume("&&") {
+			continue
+		}
+		t, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+		p.skipSpace()
+		if !p.consume("&&") {
+			return terms, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	start := p.pos
+	if !p.consume("(") {
+		return p.parseClause()
+	}
+	p.depth++
+	inner, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.consume(")") {
+		return nil, fmt.Errorf("invalid condition %q: missing ) for ( at offset %d", p.s, start)
+	}
+	p.depth--
+	if and, ok := inner.(andNode); ok && len(and) == 0 {
+		return nil, fmt.Errorf("invalid condition %q: empty parentheses at offset %d", p.s, start)
+	}
+	return inner, nil
+}
+
+func (p *parser) parseClause() (node, error) {
+	start := p.pos
+	for !p.eof() && isKeyChar(p.s[p.pos]) {
+		p.pos++
+	}
+	c := &Clause{Key: p.s[start:p.pos]}
+	if c.Key == "" {
+		return nil, fmt.Errorf("invalid condition %q: expected a key at offset %d", p.s, start)
+	}
+	afterKey := p.pos
+	p.skipSpace()
+	switch {
+	case p.consume("!="):
+		c.Op = OpNe
+	case p.consume("=="), p.consume("="):
+		c.Op = OpEq
+	case p.consume("<="):
+		c.Op = OpLe
+	case p.consume(">="):
+		c.Op = OpGe
+	case p.consume("<"):
+		c.Op = OpLt
+	case p.consume(">"):
+		c.Op = OpGt
+	case p.consumeWord(OpIn):
+		c.Op = OpIn
+	case p.consumeWord(OpContains):
+		c.Op = OpContains
+	case p.consumeWord(OpMatches):
+		c.Op = OpMatches
+	default:
+		p.pos = afterKey
+		c.Op = OpTruthy
+	}
+	var err error
+	switch c.Op {
+	case OpTruthy:
+	case OpIn:
+		c.Values, err = p.parseList()
+	default:
+		var v string
+		v, err = p.parseLiteral(false)
+		c.Values = []string{v}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Op == OpMatches {
+		if c.re, err = regexp.Compile(c.Values[0]); err != nil {
+			return nil, fmt.Errorf("invalid condition %q: bad regex %q: %v", p.s, c.Values[0], err)
+		}
+	}
+	c.Text = strings.TrimSpace(p.s[start:p.pos])
+	p.clauses = append(p.clauses, c)
+	return c, nil
+}
+
+// consumeWord consumes a keyword operator that is followed by a separator.
+func (p *parser) consumeWord(w string) bool {
+	if !p.peek(w) {
+		return false
+	}
+	end := p.pos + len(w)
+	if end < len(p.s) && !isSpace(p.s[end]) && p.s[end] != '[' && p.s[end] != '"' {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *parser) parseList() ([]string, error) {
+	p.skipSpace()
+	start := p.pos
+	if !p.consume("[") {
+		return nil, fmt.Errorf("invalid condition %q: expected [ after in at offset %d", p.s, start)
+	}
+	p.skipSpace()
+	if p.peek("]") {
+		return nil, fmt.Errorf("invalid condition %q: empty list at offset %d", p.s, start)
+	}
+	var out []string
+	for {
+		v, err := p.parseLiteral(true)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		p.skipSpace()
+		if p.consume("]") {
+			return out, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("invalid condition %q: missing ] for [ at offset %d", p.s, start)
+		}
+	}
+}
+
+// parseLiteral reads a quoted string or a bare literal. Bare literals keep
+// inner spaces and balanced parentheses, and run until &&, ||, an unmatched
+// ), or (in a list) a comma or ].
+func (p *parser) parseLiteral(inList bool) (string, error) {
+	p.skipSpace()
+	if p.peek(`"`) {
+		start := p.pos
+		p.pos++
+		for !p.eof() && p.s[p.pos] != '"' {
+			if p.s[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.eof() {
+			return "", fmt.Errorf("invalid condition %q: unterminated string at offset %d", p.s, start)
+		}
+		p.pos++
+		v, err := strconv.Unquote(p.s[start:p.pos])
+		if err != nil {
+			return "", fmt.Errorf("invalid condition %q: bad string at offset %d: %v", p.s, start, err)
+		}
+		return v, nil
+	}
+	start := p.pos
+	parens := 0
+	for !p.eof() {
+		ch := p.s[p.pos]
+		if p.peek("&&") || p.peek("||") {
+			break
+		}
+		if inList && (ch == ',' || ch == ']') {
+			break
+		}
+		if ch == '(' {
+			parens++
+		} else if ch == ')' {
+			// A ")" closes an enclosing group only inside one; at the top
+			// level it is part of the literal.
+			if parens == 0 && p.depth > 0 {
+				break
+			}
+			if parens > 0 {
+				parens--
+			}
+		}
+		p.pos++
+	}
+	return strings.TrimSpace(p.s[start:p.pos]), nil
+}
+
+func isSpace(ch byte) bool { return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' }
+
+func isKeyChar(ch byte) bool {
+	if isSpace(ch) {
+		return false
+	}
+	return !strings.ContainsRune(`=!<>()[],"&|`, rune(ch))
+}
@@ -2,17 +2,23 @@ package dot
 
 import "fmt"
 
-// stripComments removes // and /* */ comments from DOT source, while preserving comment-like
-// sequences inside double-quoted strings.
-func stripComments(src []byte) ([]byte, error) {
-	out := make([]byte, 0, len(src))
+// commentRange is the byte range of one comment in DOT source. Line comments
+// end before their newline.
+type commentRange struct {
+	pos, end int
+}
+
+// findComments locates // and /* */ comments in DOT source, skipping
+// comment-like sequences inside double-quoted strings.
+func findComments(src []byte) ([]commentRange, error) {
+	var comments []commentRange
 	inString := false
 	escaped := false
+	stringStart := 0
 
 	for i := 0; i < len(src); {
 		ch := src[i]
 		if inString {
-			out = append(out, ch)
 			i++
 			if escaped {
 				escaped = false
@@ -31,7 +37,7 @@ func stripComments(src []byte) ([]byte, error) {
 		// Not in string: detect comment starts.
 		if ch == '"' {
 			inString = true
-			out = append(out, ch)
+			stringStart = i
 			i++
 			continue
 		}
@@ -39,32 +45,66 @@ func stripComments(src []byte) ([]byte, error) {
 		if ch == '/' && i+1 < len(src) {
 			next := src[i+1]
 			if next == '/' {
-				// Line comment: skip until newline (but keep the newline).
-				i += 2
+				// Line comment: runs until the newline.
+				start := i
 				for i < len(src) && src[i] != '\n' {
 					i++
 				}
+				comments = append(comments, commentRange{pos: start, end: i})
 				continue
 			}
 			if next == '*' {
-				// Block comment: skip until closing */.
+				// Block comment: runs through the closing */.
+				start := i
 				i += 2
 				for i+1 < len(src) && !(src[i] == '*' && src[i+1] == '/') {
 					i++
 				}
 				if i+1 >= len(src) {
-					return nil, fmt.Errorf("dot: unterminated block comment")
+					return nil, &offsetError{pos: start, msg: "unterminated block comment"}
 				}
 				i += 2
+				comments = append(comments, commentRange{pos: start, end: i})
 				continue
 			}
 		}
-
-		out = append(out, ch)
 		i++
 	}
 	if inString {
-		return nil, fmt.Errorf("dot: unterminated string (while stripping comments)")
+		return nil, &offsetError{pos: stringStart, msg: "unterminated string"}
+	}
+	return comments, nil
+}
+
+// stripComments blanks out // and /* */ comments from DOT source, while preserving comment-like
+// sequences inside double-quoted strings. Comment bytes become spaces (newlines are kept) so byte
+// offsets in the result still point into the original source.
+func stripComments(src []byte) ([]byte, error) {
+	comments, err := findComments(src)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), src...)
+	for _, c := range comments {
+		for i := c.pos; i < c.end; i++ {
+			out[i] = blank(src[i])
+		}
 	}
 	return out, nil
 }
+
+// offsetError is a comment-stripping or lexer failure at a byte offset; the
+// parser turns it into a SyntaxError.
+type offsetError struct {
+	pos int
+	msg string
+}
+
+func (e *offsetError) Error() string { return fmt.Sprintf("dot: %s at %d", e.msg, e.pos) }
+
+func blank(b byte) byte {
+	if b == '\n' || b == '\r' {
+		return b
+	}
+	return ' '
+}
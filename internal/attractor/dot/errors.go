@@ -0,0 +1,64 @@
+package dot
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+// maxSyntaxErrors bounds how many errors Parse collects before giving up.
+const maxSyntaxErrors = 10
+
+// SyntaxError is a lexing or parsing error at a DOT source span.
+type SyntaxError struct {
+	Span model.Span
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("dot parse: %s: %s", e.Span.Start, e.Msg)
+}
+
+// ErrorList is returned by Parse when the source has syntax errors. The
+// parser resynchronizes at the next statement after an error, so one Parse
+// call can report several independent mistakes.
+type ErrorList []*SyntaxError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// lineIndex maps byte offsets to 1-based line/column positions.
+type lineIndex []int
+
+func newLineIndex(src []byte) lineIndex {
+	idx := lineIndex{0}
+	for i, b := range src {
+		if b == '\n' {
+			idx = append(idx, i+1)
+		}
+	}
+	return idx
+}
+
+func (idx lineIndex) position(offset int) model.Position {
+	line := sort.Search(len(idx), func(i int) bool { return idx[i] > offset }) - 1
+	if line < 0 {
+		line = 0
+	}
+	return model.Position{Offset: offset, Line: line + 1, Column: offset - idx[line] + 1}
+}
+
+func (idx lineIndex) span(start, end int) model.Span {
+	if end < start {
+		end = start
+	}
+	return model.Span{Start: idx.position(start), End: idx.position(end)}
+}
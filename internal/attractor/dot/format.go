@@ -0,0 +1,690 @@
+package dot
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/style"
+)
+
+// Format rewrites DOT source in the canonical layout used for checked-in
+// pipelines:
+//
+//   - four-space indentation, one statement per line, no semicolons;
+//   - attribute lists on one line when they fit in 120 columns and hold no
+//     comments or multi-line values, otherwise one attribute per line;
+//   - attributes ordered goal, shape, type, label, class, condition, weight,
+//     llm_provider, llm_model, reasoning_effort, then the rest by name, with
+//     prompt, llm_prompt and model_stylesheet last;
+//   - values left unquoted only when they are identifiers or numbers;
+//     prompt and llm_prompt keep real line breaks, other values use \n;
+//   - within each run of statements between defaults, graph attributes and
+//     subgraphs, node statements first and edge statements after them, so
+//     defaults still apply to the same nodes and edges;
+//   - model_stylesheet printed one rule per line.
+//
+// Comments stay with the statement or attribute they precede, or follow on
+// the same line, and single blank lines between statements are kept. The
+// result parses to the same graph. Source that does not parse returns the
+// Parse error.
+func Format(src []byte) ([]byte, error) {
+	if _, err := Parse(src); err != nil {
+		return nil, err
+	}
+	ranges, err := findComments(src)
+	if err != nil {
+		return nil, err
+	}
+	clean, err := stripComments(src)
+	if err != nil {
+		return nil, err
+	}
+	fp := &fmtParser{lx: newLexer(clean)}
+	f, err := fp.file()
+	if err != nil {
+		return nil, err
+	}
+
+	text := string(src)
+	var inner []*fmtComment
+	for _, r := range ranges {
+		c := &fmtComment{text: strings.TrimRight(text[r.pos:r.end], " \t\r"), pos: r.pos, end: r.end}
+		switch {
+		case r.pos < f.body.open:
+			f.header = append(f.header, c)
+		case r.pos > f.body.close:
+			f.footer = append(f.footer, c)
+		default:
+			inner = append(inner, c)
+		}
+	}
+	attachComments(text, f.body, inner)
+	markBlankLines(text, f.body)
+	prevEnd := 0
+	for _, c := range f.header {
+		c.blankBefore = hasBlankLine(text, prevEnd, c.pos)
+		prevEnd = c.end
+	}
+	headerGap := len(f.header) > 0 && hasBlankLine(text, prevEnd, f.pos)
+	prevEnd = f.body.close + 1
+	for _, c := range f.footer {
+		c.blankBefore = hasBlankLine(text, prevEnd, c.pos)
+		prevEnd = c.end
+	}
+
+	p := &printer{}
+	p.comments(0, f.header, false)
+	if headerGap {
+		p.b.WriteString("\n")
+	}
+	p.line(0, "digraph "+f.name+" {")
+	p.block(f.body, 1)
+	p.line(0, "}")
+	p.comments(0, f.footer, true)
+	return []byte(p.b.String()), nil
+}
+
+// maxLineWidth is the widest a one-line attribute list may get.
+const maxLineWidth = 120
+
+const indentUnit = "    "
+
+// attrRank orders attributes. Keys without a rank sort by name between the
+// leading and trailing groups.
+var attrRank = func() map[string]int {
+	m := map[string]int{}
+	lead := []string{"goal", "shape", "type", "label", "class", "condition", "weight", "llm_provider", "llm_model", "reasoning_effort"}
+	for i, k := range lead {
+		m[k] = i - len(lead)
+	}
+	for i, k := range []string{"prompt", "llm_prompt", "model_stylesheet"} {
+		m[k] = i + 1
+	}
+	return m
+}()
+
+// multilineKeys are the attributes whose values keep literal line breaks.
+var multilineKeys = map[string]bool{"prompt": true, "llm_prompt": true}
+
+var bareValueRe = regexp.MustCompile(`^(?:[A-Za-z_][A-Za-z0-9_]*|-?[0-9]+(?:\.[0-9]+)?[A-Za-z]*)$`)
+
+type fmtFile struct {
+	name           string
+	pos            int // offset of "digraph"
+	body           *fmtBlock
+	header, footer []*fmtComment
+}
+
+type fmtBlock struct {
+	open, close int // offsets of '{' and '}'
+	stmts       []*fmtStmt
+	footer      []*fmtComment
+}
+
+type stmtKind int
+
+const (
+	stmtDefaults stmtKind = iota // graph/node/edge [...]
+	stmtAssign                   // key = value
+	stmtNode
+	stmtEdge
+	stmtSubgraph
+)
+
+type fmtStmt struct {
+	kind stmtKind
+	// head is the graph/node/edge keyword, the assigned key, or the subgraph
+	// name.
+	head  string
+	ids   []string // node ID or edge chain
+	value string   // stmtAssign
+	attrs []*fmtAttr
+	// lbrack and rbrack locate the attribute list; lbrack is -1 without one.
+	lbrack, rbrack int
+	body           *fmtBlock
+	pos, end       int
+
+	leading, trailing []*fmtComment
+	// attrFooter holds the comments after the last attribute.
+	attrFooter []*fmtComment
+	// blankBefore is a blank line before the statement and its leading
+	// comments; blankAfterLeading one between those comments and the
+	// statement.
+	blankBefore, blankAfterLeading bool
+}
+
+type fmtAttr struct {
+	key, value        string
+	pos, end          int
+	leading, trailing []*fmtComment
+}
+
+type fmtComment struct {
+	text        string
+	pos, end    int
+	blankBefore bool
+}
+
+// fmtParser reads the statement structure Format prints. It only runs on
+// source Parse accepted, so it stops at the first error.
+type fmtParser struct {
+	lx      *lexer
+	peek    token
+	has     bool
+	lastEnd int
+}
+
+func (p *fmtParser) read() (token, error) {
+	if !p.has {
+		tok, err := p.lx.next()
+		if err != nil {
+			return token{}, err
+		}
+		p.peek, p.has = tok, true
+	}
+	return p.peek, nil
+}
+
+func (p *fmtParser) next() (token, error) {
+	tok, err := p.read()
+	if err != nil {
+		return token{}, err
+	}
+	p.has = false
+	p.lastEnd = tok.end
+	return tok, nil
+}
+
+func (p *fmtParser) peekSymbol(sym string) bool {
+	tok, err := p.read()
+	return err == nil && tok.typ == tokenSymbol && tok.lit == sym
+}
+
+func (p *fmtParser) expect(typ tokenType, lit string) (token, error) {
+	tok, err := p.next()
+	if err != nil {
+		return tok, err
+	}
+	if tok.typ != typ || (lit != "" && tok.lit != lit) {
+		return tok, &offsetError{pos: tok.pos, msg: fmt.Sprintf("unexpected %s", describe(tok))}
+	}
+	return tok, nil
+}
+
+func (p *fmtParser) file() (*fmtFile, error) {
+	kw, err := p.expect(tokenIdent, "digraph")
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.expect(tokenIdent, "")
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return &fmtFile{name: name.lit, pos: kw.pos, body: body}, nil
+}
+
+// block parses "{ statements }".
+func (p *fmtParser) block() (*fmtBlock, error) {
+	open, err := p.expect(tokenSymbol, "{")
+	if err != nil {
+		return nil, err
+	}
+	b := &fmtBlock{open: open.pos}
+	for {
+		if p.peekSymbol("}") {
+			tok, _ := p.next()
+			b.close = tok.pos
+			return b, nil
+		}
+		s, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		b.stmts = append(b.stmts, s)
+	}
+}
+
+func (p *fmtParser) stmt() (*fmtStmt, error) {
+	tok, err := p.expect(tokenIdent, "")
+	if err != nil {
+		return nil, err
+	}
+	s := &fmtStmt{pos: tok.pos, lbrack: -1}
+	switch tok.lit {
+	case "graph", "node", "edge":
+		s.kind, s.head = stmtDefaults, tok.lit
+		err = p.attrList(s)
+	case "subgraph":
+		s.kind = stmtSubgraph
+		if next, rerr := p.read(); rerr == nil && next.typ == tokenIdent {
+			_, _ = p.next()
+			s.head = next.lit
+		}
+		s.body, err = p.block()
+	default:
+		switch {
+		case p.peekSymbol("="):
+			_, _ = p.next()
+			s.kind, s.head = stmtAssign, tok.lit
+			s.value, err = p.topValue()
+		case p.peekSymbol("->"):
+			s.kind, s.ids = stmtEdge, []string{tok.lit}
+			for err == nil && p.peekSymbol("->") {
+				_, _ = p.next()
+				var to token
+				if to, err = p.expect(tokenIdent, ""); err == nil {
+					s.ids = append(s.ids, to.lit)
+				}
+			}
+			if err == nil && p.peekSymbol("[") {
+				err = p.attrList(s)
+			}
+		default:
+			s.kind, s.ids = stmtNode, []string{tok.lit}
+			if p.peekSymbol("[") {
+				err = p.attrList(s)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.peekSymbol(";") {
+		_, _ = p.next()
+	}
+	s.end = p.lastEnd
+	return s, nil
+}
+
+func (p *fmtParser) attrList(s *fmtStmt) error {
+	lb, err := p.expect(tokenSymbol, "[")
+	if err != nil {
+		return err
+	}
+	s.lbrack = lb.pos
+	for {
+		if p.peekSymbol("]") {
+			tok, _ := p.next()
+			s.rbrack = tok.pos
+			return nil
+		}
+		keyTok, err := p.expect(tokenIdent, "")
+		if err != nil {
+			return err
+		}
+		a := &fmtAttr{key: keyTok.lit, pos: keyTok.pos}
+		for p.peekSymbol(".") {
+			_, _ = p.next()
+			part, err := p.expect(tokenIdent, "")
+			if err != nil {
+				return err
+			}
+			a.key += "." + part.lit
+		}
+		if _, err := p.expect(tokenSymbol, "="); err != nil {
+			return err
+		}
+		if a.value, err = p.attrValue(); err != nil {
+			return err
+		}
+		a.end = p.lastEnd
+		s.attrs = append(s.attrs, a)
+		if p.peekSymbol(",") {
+			_, _ = p.next()
+		}
+	}
+}
+
+// attrValue reads a quoted value, or the adjacent tokens of an unquoted one,
+// the way parseAttrValue does.
+func (p *fmtParser) attrValue() (string, error) {
+	tok, err := p.read()
+	if err != nil {
+		return "", err
+	}
+	if tok.typ == tokenString {
+		_, _ = p.next()
+		return tok.lit, nil
+	}
+	var b strings.Builder
+	for {
+		tok, err := p.read()
+		if err != nil {
+			return "", err
+		}
+		if tok.typ == tokenEOF || (tok.typ == tokenSymbol && (tok.lit == "," || tok.lit == "]")) || (b.Len() > 0 && tok.pos > p.lastEnd) {
+			return strings.TrimSpace(b.String()), nil
+		}
+		_, _ = p.next()
+		b.WriteString(tok.lit)
+	}
+}
+
+func (p *fmtParser) topValue() (string, error) {
+	tok, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if tok.typ == tokenSymbol && tok.lit == "-" {
+		num, err := p.expect(tokenIdent, "")
+		return "-" + num.lit, err
+	}
+	return tok.lit, nil
+}
+
+// attachComments hands each comment inside b to what it documents. A comment
+// on the same line as the end of a statement trails it; any other comment
+// leads the next statement, or stays at the end of the block when nothing
+// follows. Comments in the middle of a statement, outside its attribute
+// list, move before it.
+func attachComments(text string, b *fmtBlock, comments []*fmtComment) {
+	nested := map[*fmtStmt][]*fmtComment{}
+	for _, c := range comments {
+		var in *fmtStmt
+		for _, s := range b.stmts {
+			if s.pos <= c.pos && c.pos < s.end {
+				in = s
+				break
+			}
+		}
+		switch {
+		case in != nil && in.kind == stmtSubgraph && c.pos > in.body.open && c.pos < in.body.close:
+			nested[in] = append(nested[in], c)
+		case in != nil && in.lbrack >= 0 && c.pos > in.lbrack && c.pos < in.rbrack:
+			attachAttrComment(text, in, c)
+		case in != nil:
+			in.leading = append(in.leading, c)
+		default:
+			var prev, next *fmtStmt
+			for _, s := range b.stmts {
+				if s.end <= c.pos {
+					prev = s
+				} else if next == nil && s.pos >= c.end {
+					next = s
+				}
+			}
+			switch {
+			case prev != nil && sameLine(text, prev.end, c.pos):
+				prev.trailing = append(prev.trailing, c)
+			case next != nil:
+				next.leading = append(next.leading, c)
+			default:
+				b.footer = append(b.footer, c)
+			}
+		}
+	}
+	for _, s := range b.stmts {
+		if s.kind == stmtSubgraph {
+			attachComments(text, s.body, nested[s])
+		}
+	}
+}
+
+func attachAttrComment(text string, s *fmtStmt, c *fmtComment) {
+	var prev, next *fmtAttr
+	for _, a := range s.attrs {
+		if a.end <= c.pos {
+			prev = a
+		} else if next == nil && a.pos >= c.end {
+			next = a
+		}
+	}
+	switch {
+	case prev != nil && sameLine(text, prev.end, c.pos):
+		prev.trailing = append(prev.trailing, c)
+	case next != nil:
+		next.leading = append(next.leading, c)
+	default:
+		s.attrFooter = append(s.attrFooter, c)
+	}
+}
+
+// markBlankLines records where the source separates statements and comments
+// in b with blank lines.
+func markBlankLines(text string, b *fmtBlock) {
+	prevEnd := b.open + 1
+	for _, s := range b.stmts {
+		first := true
+		for _, c := range s.leading {
+			if c.pos > s.pos {
+				// Moved out of the middle of the statement.
+				continue
+			}
+			if first {
+				s.blankBefore = hasBlankLine(text, prevEnd, c.pos)
+				first = false
+			} else {
+				c.blankBefore = hasBlankLine(text, prevEnd, c.pos)
+			}
+			prevEnd = c.end
+		}
+		if first {
+			s.blankBefore = hasBlankLine(text, prevEnd, s.pos)
+		} else {
+			s.blankAfterLeading = hasBlankLine(text, prevEnd, s.pos)
+		}
+		prevEnd = s.end
+		for _, c := range s.trailing {
+			prevEnd = max(prevEnd, c.end)
+		}
+		if s.kind == stmtSubgraph {
+			markBlankLines(text, s.body)
+		}
+	}
+	for _, c := range b.footer {
+		c.blankBefore = hasBlankLine(text, prevEnd, c.pos)
+		prevEnd = c.end
+	}
+}
+
+func hasBlankLine(text string, from, to int) bool {
+	return from < to && strings.Count(text[from:to], "\n") >= 2
+}
+
+func sameLine(text string, from, to int) bool {
+	return from <= to && !strings.Contains(text[from:to], "\n")
+}
+
+type printer struct {
+	b strings.Builder
+}
+
+func (p *printer) line(depth int, s string) {
+	p.b.WriteString(strings.Repeat(indentUnit, depth))
+	p.b.WriteString(s)
+	p.b.WriteString("\n")
+}
+
+// comments prints cs on their own lines, keeping the blank lines between
+// them; the one before the first is kept only when leadingBlank is set.
+func (p *printer) comments(depth int, cs []*fmtComment, leadingBlank bool) {
+	for i, c := range cs {
+		if c.blankBefore && (i > 0 || leadingBlank) {
+			p.b.WriteString("\n")
+		}
+		p.line(depth, c.text)
+	}
+}
+
+func (p *printer) block(b *fmtBlock, depth int) {
+	first := true
+	for _, seg := range segments(b.stmts) {
+		for i, s := range seg {
+			blank := s.blankBefore || (i > 0 && s.kind == stmtEdge && seg[i-1].kind == stmtNode)
+			if blank && !first {
+				p.b.WriteString("\n")
+			}
+			p.stmt(s, depth)
+			first = false
+		}
+	}
+	p.comments(depth, b.footer, !first)
+}
+
+// segments splits stmts at defaults, graph attributes and subgraphs, and
+// moves each run's node statements ahead of its edge statements. Node and
+// edge order is otherwise unchanged, and no statement crosses a default, so
+// the parsed graph stays the same.
+func segments(stmts []*fmtStmt) [][]*fmtStmt {
+	var out [][]*fmtStmt
+	var nodes, edges []*fmtStmt
+	flush := func() {
+		if len(nodes)+len(edges) > 0 {
+			out = append(out, append(nodes, edges...))
+		}
+		nodes, edges = nil, nil
+	}
+	for _, s := range stmts {
+		switch s.kind {
+		case stmtNode:
+			nodes = append(nodes, s)
+		case stmtEdge:
+			edges = append(edges, s)
+		default:
+			flush()
+			out = append(out, []*fmtStmt{s})
+		}
+	}
+	flush()
+	return out
+}
+
+func (p *printer) stmt(s *fmtStmt, depth int) {
+	for i, c := range s.leading {
+		if c.blankBefore && i > 0 {
+			p.b.WriteString("\n")
+		}
+		p.line(depth, c.text)
+	}
+	if len(s.leading) > 0 && s.blankAfterLeading {
+		p.b.WriteString("\n")
+	}
+
+	var head string
+	switch s.kind {
+	case stmtAssign:
+		p.line(depth, s.head+"="+formatValue(s.head, s.value, depth)+trailer(s.trailing))
+		return
+	case stmtSubgraph:
+		open := "subgraph {"
+		if s.head != "" {
+			open = "subgraph " + s.head + " {"
+		}
+		p.line(depth, open)
+		p.block(s.body, depth+1)
+		p.line(depth, "}"+trailer(s.trailing))
+		return
+	case stmtDefaults:
+		head = s.head
+	default:
+		head = strings.Join(s.ids, " -> ")
+	}
+	if s.lbrack < 0 || (len(s.attrs) == 0 && len(s.attrFooter) == 0 && s.kind != stmtDefaults) {
+		p.line(depth, head+trailer(s.trailing))
+		return
+	}
+
+	attrs := append([]*fmtAttr(nil), s.attrs...)
+	sort.SliceStable(attrs, func(i, j int) bool {
+		ri, rj := attrRank[attrs[i].key], attrRank[attrs[j].key]
+		if ri != rj {
+			return ri < rj
+		}
+		return ri == 0 && attrs[i].key < attrs[j].key
+	})
+
+	inline := len(s.attrFooter) == 0
+	parts := make([]string, len(attrs))
+	for i, a := range attrs {
+		parts[i] = a.key + "=" + formatValue(a.key, a.value, depth+1)
+		if len(a.leading)+len(a.trailing) > 0 || strings.Contains(parts[i], "\n") {
+			inline = false
+		}
+	}
+	one := head + " [" + strings.Join(parts, ", ") + "]"
+	if inline && len(indentUnit)*depth+len(one) <= maxLineWidth {
+		p.line(depth, one+trailer(s.trailing))
+		return
+	}
+
+	p.line(depth, head+" [")
+	for i, a := range attrs {
+		p.comments(depth+1, a.leading, false)
+		sep := ","
+		if i == len(attrs)-1 {
+			sep = ""
+		}
+		p.line(depth+1, parts[i]+sep+trailer(a.trailing))
+	}
+	p.comments(depth+1, s.attrFooter, false)
+	p.line(depth, "]"+trailer(s.trailing))
+}
+
+func trailer(cs []*fmtComment) string {
+	var b strings.Builder
+	for _, c := range cs {
+		b.WriteString(" ")
+		b.WriteString(c.text)
+	}
+	return b.String()
+}
+
+// formatValue renders the value of key for an attribute printed at depth.
+func formatValue(key, v string, depth int) string {
+	if key == "model_stylesheet" {
+		rules, err := style.ParseStylesheet(v)
+		if err != nil || len(rules) == 0 {
+			// Leave a stylesheet that does not parse as written.
+			return quoteValue(v, true)
+		}
+		indent := strings.Repeat(indentUnit, depth)
+		var b strings.Builder
+		b.WriteString("\n")
+		for _, r := range rules {
+			b.WriteString(indent + indentUnit + r.String() + "\n")
+		}
+		b.WriteString(indent)
+		return quoteValue(b.String(), true)
+	}
+	if bareValueRe.MatchString(v) {
+		return v
+	}
+	return quoteValue(v, multilineKeys[key])
+}
+
+// quoteValue quotes v as a DOT string. Backslashes are doubled only where
+// the lexer would otherwise read an escape, so patterns such as \d stay as
+// written. Line breaks are kept when multiline is set and written as \n
+// otherwise.
+func quoteValue(v string, multiline bool) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			if i+1 == len(v) || strings.IndexByte("\"\\nt", v[i+1]) >= 0 {
+				b.WriteString(`\\`)
+			} else {
+				b.WriteByte(c)
+			}
+		case '\n':
+			if multiline {
+				b.WriteByte(c)
+			} else {
+				b.WriteString(`\n`)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,215 @@
+package dot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/style"
+)
+
+func TestFormat_CanonicalLayout(t *testing.T) {
+	src := `// Header comment.
+
+digraph  G{
+  graph [model_stylesheet="* { llm_provider: openai; llm_model: gpt-5.2 } .hard {llm_model:\"gpt-5.2-pro\";}", goal="Ship it", rankdir="LR"];
+  start [shape="Mdiamond"]; exit [shape=Msquare]
+  start -> plan // kick off
+  plan [prompt="Plan the work.\nThen list steps.", shape=box, label="Plan", max_retries=2]
+  node [shape=box]
+  /* build stage */
+  build [
+    // the prompt
+    prompt="Build \d+ things",
+    class="hard"
+  ]
+  build -> exit [condition="outcome=success", label="done\nok"]
+  plan -> build
+
+
+  build -> plan
+}
+// trailing
+`
+	want := `// Header comment.
+
+digraph G {
+    graph [
+        goal="Ship it",
+        rankdir=LR,
+        model_stylesheet="
+            * { llm_model: gpt-5.2; llm_provider: openai; }
+            .hard { llm_model: gpt-5.2-pro; }
+        "
+    ]
+    start [shape=Mdiamond]
+    exit [shape=Msquare]
+    plan [
+        shape=box,
+        label=Plan,
+        max_retries=2,
+        prompt="Plan the work.
+Then list steps."
+    ]
+
+    start -> plan // kick off
+    node [shape=box]
+    /* build stage */
+    build [
+        class=hard,
+        // the prompt
+        prompt="Build \d+ things"
+    ]
+
+    build -> exit [label="done\nok", condition="outcome=success"]
+    plan -> build
+
+    build -> plan
+}
+// trailing
+`
+	got, err := Format([]byte(src))
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("Format mismatch\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+	assertSameGraph(t, []byte(src), got)
+}
+
+func TestFormat_QuotesOnlyWhenNeeded(t *testing.T) {
+	src := `digraph G {
+    a [timeout="900s", weight="-2", label="a b", tool_command="printf '%s\\n' \"x\"", note="c:\\"]
+    ratio = -1.5
+}
+`
+	got, err := Format([]byte(src))
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	for _, want := range []string{`weight=-2`, `label="a b"`, `note="c:\\"`, `timeout=900s`, `tool_command="printf '%s\\n' \"x\""`, `ratio=-1.5`} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+	assertSameGraph(t, []byte(src), got)
+}
+
+func TestFormat_KeepsUnparseableStylesheet(t *testing.T) {
+	src := `digraph G { graph [model_stylesheet="box { llm_model: x"] }`
+	got, err := Format([]byte(src))
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if !strings.Contains(string(got), `model_stylesheet="box { llm_model: x"`) {
+		t.Fatalf("stylesheet rewritten:\n%s", got)
+	}
+}
+
+func TestFormat_ReturnsParseErrors(t *testing.T) {
+	_, err := Format([]byte("digraph G {\n  a [shape=box\n}\n"))
+	var list ErrorList
+	if err == nil || !errors.As(err, &list) {
+		t.Fatalf("expected an ErrorList, got %v", err)
+	}
+}
+
+// TestFormat_RepoGraphs formats every DOT file in the repository and checks
+// the result is stable and parses to the same graph.
+func TestFormat_RepoGraphs(t *testing.T) {
+	root := filepath.Join("..", "..", "..")
+	var files []string
+	_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".dot") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if len(files) == 0 {
+		t.Skip("no .dot files found")
+	}
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Parse(src); err != nil {
+			continue
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			once, err := Format(src)
+			if err != nil {
+				t.Fatalf("Format: %v", err)
+			}
+			twice, err := Format(once)
+			if err != nil {
+				t.Fatalf("Format (second pass): %v", err)
+			}
+			if string(once) != string(twice) {
+				t.Fatalf("formatting is not stable:\n%s", twice)
+			}
+			assertSameGraph(t, src, once)
+		})
+	}
+}
+
+// assertSameGraph checks that before and after parse to the same nodes,
+// edges and graph attributes. Stylesheets are compared by their rules.
+func assertSameGraph(t *testing.T, before, after []byte) {
+	t.Helper()
+	g1, err := Parse(before)
+	if err != nil {
+		t.Fatalf("parse before: %v", err)
+	}
+	g2, err := Parse(after)
+	if err != nil {
+		t.Fatalf("parse formatted: %v\n%s", err, after)
+	}
+	if !reflect.DeepEqual(graphAttrs(t, g1), graphAttrs(t, g2)) {
+		t.Errorf("graph attrs differ:\n%v\n%v", g1.Attrs, g2.Attrs)
+	}
+	if len(g1.Nodes) != len(g2.Nodes) {
+		t.Fatalf("node count: %d vs %d", len(g1.Nodes), len(g2.Nodes))
+	}
+	for id, n1 := range g1.Nodes {
+		n2 := g2.Nodes[id]
+		if n2 == nil || n1.Order != n2.Order || !reflect.DeepEqual(n1.Attrs, n2.Attrs) || !reflect.DeepEqual(n1.Classes, n2.Classes) {
+			t.Errorf("node %s differs:\n%+v\n%+v", id, n1, n2)
+		}
+	}
+	if len(g1.Edges) != len(g2.Edges) {
+		t.Fatalf("edge count: %d vs %d", len(g1.Edges), len(g2.Edges))
+	}
+	for i, e1 := range g1.Edges {
+		e2 := g2.Edges[i]
+		if e1.From != e2.From || e1.To != e2.To || !reflect.DeepEqual(e1.Attrs, e2.Attrs) {
+			t.Errorf("edge %d differs: %s->%s %v vs %s->%s %v", i, e1.From, e1.To, e1.Attrs, e2.From, e2.To, e2.Attrs)
+		}
+	}
+}
+
+func graphAttrs(t *testing.T, g *model.Graph) map[string]any {
+	t.Helper()
+	out := map[string]any{}
+	for k, v := range g.Attrs {
+		out[k] = v
+		if k != "model_stylesheet" {
+			continue
+		}
+		if rules, err := style.ParseStylesheet(v); err == nil && len(rules) > 0 {
+			out[k] = rules
+		}
+	}
+	return out
+}
@@ -3,6 +3,7 @@ package dot
 import (
 	"fmt"
 	"strings"
+	"unicode/utf8"
 )
 
 type tokenType int
@@ -18,6 +19,7 @@ type token struct {
 	typ tokenType
 	lit string
 	pos int // byte offset in source (for diagnostics)
+	end int // byte offset just past the token
 }
 
 type lexer struct {
@@ -32,7 +34,7 @@ func newLexer(src []byte) *lexer {
 func (l *lexer) next() (token, error) {
 	l.skipSpace()
 	if l.i >= len(l.src) {
-		return token{typ: tokenEOF, pos: l.i}, nil
+		return token{typ: tokenEOF, pos: l.i, end: l.i}, nil
 	}
 
 	ch := l.src[l.i]
@@ -41,17 +43,17 @@ func (l *lexer) next() (token, error) {
 	switch ch {
 	case '{', '}', '[', ']', ',', ';', '=', '.', ':', '/':
 		l.i++
-		return token{typ: tokenSymbol, lit: string(ch), pos: l.i - 1}, nil
+		return token{typ: tokenSymbol, lit: string(ch), pos: l.i - 1, end: l.i}, nil
 	case '-':
 		// Could be "->" or a negative number/duration.
 		if l.i+1 < len(l.src) && l.src[l.i+1] == '>' {
 			l.i += 2
-			return token{typ: tokenSymbol, lit: "->", pos: l.i - 2}, nil
+			return token{typ: tokenSymbol, lit: "->", pos: l.i - 2, end: l.i}, nil
 		}
 		// Treat '-' as a symbol so we can accept unquoted values like "claude-opus-4-6"
 		// and also negative numbers (assembled by the parser).
 		l.i++
-		return token{typ: tokenSymbol, lit: "-", pos: l.i - 1}, nil
+		return token{typ: tokenSymbol, lit: "-", pos: l.i - 1, end: l.i}, nil
 	case '"':
 		return l.lexString()
 	}
@@ -64,7 +66,10 @@ func (l *lexer) next() (token, error) {
 		return l.lexBareNumberish()
 	}
 
-	return token{}, fmt.Errorf("dot lexer: unexpected character %q at %d", ch, l.i)
+	// Skip the whole character so the parser can resume after reporting it.
+	r, size := utf8.DecodeRune(l.src[l.i:])
+	l.i += size
+	return token{}, &offsetError{pos: l.i - size, msg: fmt.Sprintf("unexpected character %q", r)}
 }
 
 func (l *lexer) skipSpace() {
@@ -89,7 +94,7 @@ func (l *lexer) lexIdent() (token, error) {
 		}
 		break
 	}
-	return token{typ: tokenIdent, lit: string(l.src[start:l.i]), pos: start}, nil
+	return token{typ: tokenIdent, lit: string(l.src[start:l.i]), pos: start, end: l.i}, nil
 }
 
 func (l *lexer) lexBareNumberish() (token, error) {
@@ -101,7 +106,7 @@ func (l *lexer) lexBareNumberish() (token, error) {
 	if l.i < len(l.src) && l.src[l.i] == '.' {
 		l.i++
 		if l.i >= len(l.src) || !isDigit(l.src[l.i]) {
-			return token{}, fmt.Errorf("dot lexer: malformed float at %d", start)
+			return token{}, &offsetError{pos: start, msg: "malformed number"}
 		}
 		for l.i < len(l.src) && isDigit(l.src[l.i]) {
 			l.i++
@@ -110,7 +115,7 @@ func (l *lexer) lexBareNumberish() (token, error) {
 	for l.i < len(l.src) && isAlpha(l.src[l.i]) {
 		l.i++
 	}
-	return token{typ: tokenIdent, lit: string(l.src[start:l.i]), pos: start}, nil
+	return token{typ: tokenIdent, lit: string(l.src[start:l.i]), pos: start, end: l.i}, nil
 }
 
 func (l *lexer) lexString() (token, error) {
@@ -122,11 +127,11 @@ func (l *lexer) lexString() (token, error) {
 		ch := l.src[l.i]
 		l.i++
 		if ch == '"' {
-			return token{typ: tokenString, lit: sb.String(), pos: start}, nil
+			return token{typ: tokenString, lit: sb.String(), pos: start, end: l.i}, nil
 		}
 		if ch == '\\' {
 			if l.i >= len(l.src) {
-				return token{}, fmt.Errorf("dot lexer: unterminated escape at %d", l.i)
+				return token{}, &offsetError{pos: start, msg: "unterminated string"}
 			}
 			esc := l.src[l.i]
 			l.i++
@@ -148,7 +153,7 @@ func (l *lexer) lexString() (token, error) {
 		}
 		sb.WriteByte(ch)
 	}
-	return token{}, fmt.Errorf("dot lexer: unterminated string starting at %d", start)
+	return token{}, &offsetError{pos: start, msg: "unterminated string"}
 }
 
 func isIdentStart(r rune) bool {
@@ -1,6 +1,7 @@
 package dot
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -10,24 +11,61 @@ import (
 // Parse parses a constrained DOT digraph into the Attractor graph model.
 // It strips comments, flattens subgraphs, applies scoped node/edge defaults,
 // expands chained edges, and derives CSS-like classes from subgraph labels.
+// Nodes, edges and attributes carry their source spans. Syntax errors are
+// returned as an ErrorList holding every error found (up to a limit), each
+// with its position.
 func Parse(dotSource []byte) (*model.Graph, error) {
+	lines := newLineIndex(dotSource)
 	clean, err := stripComments(dotSource)
 	if err != nil {
+		var oe *offsetError
+		if errors.As(err, &oe) {
+			return nil, ErrorList{{Span: lines.span(oe.pos, oe.pos+1), Msg: oe.msg}}
+		}
 		return nil, err
 	}
 	p := &parser{
-		lx: newLexer(clean),
+		lx:    newLexer(clean),
+		lines: lines,
 	}
-	if err := p.read(); err != nil {
-		return nil, err
+	g, err := p.parseGraph()
+	if err != nil && err != errStop {
+		p.addError(err)
 	}
-	return p.parseGraph()
+	if len(p.errs) > 0 {
+		return nil, p.errs
+	}
+	return g, nil
 }
 
 type parser struct {
-	lx   *lexer
-	peek token
-	has  bool
+	lx    *lexer
+	lines lineIndex
+	peek  token
+	has   bool
+
+	lastEnd  int // end offset of the last consumed token
+	brackets int // depth of open attribute blocks, for error recovery
+	errs     ErrorList
+}
+
+// errAt returns a syntax error located at tok.
+func (p *parser) errAt(tok token, format string, args ...any) error {
+	return &SyntaxError{Span: p.lines.span(tok.pos, tok.end), Msg: fmt.Sprintf(format, args...)}
+}
+
+// addError records err, converting lexer offsets into positions.
+func (p *parser) addError(err error) {
+	var se *SyntaxError
+	var oe *offsetError
+	switch {
+	case errors.As(err, &se):
+	case errors.As(err, &oe):
+		se = &SyntaxError{Span: p.lines.span(oe.pos, oe.pos+1), Msg: oe.msg}
+	default:
+		se = &SyntaxError{Span: p.lines.span(p.lastEnd, p.lastEnd), Msg: err.Error()}
+	}
+	p.errs = append(p.errs, se)
 }
 
 func (p *parser) read() error {
@@ -49,34 +87,101 @@ func (p *parser) next() (token, error) {
 	}
 	tok := p.peek
 	p.has = false
+	p.lastEnd = tok.end
+	if tok.typ == tokenSymbol {
+		switch tok.lit {
+		case "[":
+			p.brackets++
+		case "]":
+			if p.brackets > 0 {
+				p.brackets--
+			}
+		}
+	}
 	return tok, nil
 }
 
+// recover records a statement error and skips to the start of the next
+// statement: past a ';', before the '}' closing the scope, or before an
+// identifier on a later line than the error, outside attribute blocks and
+// nested braces. It reports false when parsing should stop.
+func (p *parser) recover(err error) bool {
+	p.addError(err)
+	if len(p.errs) >= maxSyntaxErrors {
+		return false
+	}
+	errLine := p.errs[len(p.errs)-1].Span.Start.Line
+	braces := 0
+	for {
+		if err := p.read(); err != nil {
+			p.addError(err)
+			if len(p.errs) >= maxSyntaxErrors {
+				return false
+			}
+			continue
+		}
+		tok := p.peek
+		if tok.typ == tokenEOF {
+			return true
+		}
+		if p.brackets == 0 && braces == 0 {
+			if tok.typ == tokenSymbol && tok.lit == "}" {
+				return true
+			}
+			if tok.typ == tokenIdent && p.lines.position(tok.pos).Line > errLine {
+				return true
+			}
+		}
+		_, _ = p.next()
+		if tok.typ == tokenSymbol {
+			switch tok.lit {
+			case "{":
+				braces++
+			case "}":
+				braces--
+			case ";":
+				if p.brackets == 0 && braces == 0 {
+					return true
+				}
+			}
+		}
+	}
+}
+
 func (p *parser) expectSymbol(sym string) error {
 	tok, err := p.next()
 	if err != nil {
 		return err
 	}
 	if tok.typ != tokenSymbol || tok.lit != sym {
-		return fmt.Errorf("dot parse: expected %q, got %q at %d", sym, tok.lit, tok.pos)
+		return p.errAt(tok, "expected %q, got %s", sym, describe(tok))
 	}
 	return nil
 }
 
-func (p *parser) expectIdent(lit string) error {
+func (p *parser) expectIdent(lit string) (token, error) {
 	tok, err := p.next()
 	if err != nil {
-		return err
+		return tok, err
 	}
 	if tok.typ != tokenIdent || tok.lit != lit {
-		return fmt.Errorf("dot parse: expected %q, got %q at %d", lit, tok.lit, tok.pos)
+		return tok, p.errAt(tok, "expected %q, got %s", lit, describe(tok))
 	}
-	return nil
+	return tok, nil
+}
+
+// describe names a token for error messages.
+func describe(tok token) string {
+	if tok.typ == tokenEOF {
+		return "end of file"
+	}
+	return fmt.Sprintf("%q", tok.lit)
 }
 
 func (p *parser) parseGraph() (*model.Graph, error) {
 	// digraph <Identifier> { ... }
-	if err := p.expectIdent("digraph"); err != nil {
+	kw, err := p.expectIdent("digraph")
+	if err != nil {
 		return nil, err
 	}
 	nameTok, err := p.next()
@@ -84,9 +189,10 @@ func (p *parser) parseGraph() (*model.Graph, error) {
 		return nil, err
 	}
 	if nameTok.typ != tokenIdent {
-		return nil, fmt.Errorf("dot parse: expected graph identifier, got %q at %d", nameTok.lit, nameTok.pos)
+		return nil, p.errAt(nameTok, "expected graph identifier, got %s", describe(nameTok))
 	}
 	g := model.NewGraph(nameTok.lit)
+	g.Span = p.lines.span(kw.pos, nameTok.end)
 	if err := p.expectSymbol("{"); err != nil {
 		return nil, err
 	}
@@ -105,7 +211,7 @@ func (p *parser) parseGraph() (*model.Graph, error) {
 		return nil, err
 	}
 	if p.peek.typ != tokenEOF {
-		return nil, fmt.Errorf("dot parse: trailing tokens after graph end at %d", p.peek.pos)
+		return nil, p.errAt(p.peek, "trailing tokens after graph end")
 	}
 	return g, nil
 }
@@ -114,6 +220,8 @@ type scope struct {
 	parent       *scope
 	nodeDefaults map[string]string
 	edgeDefaults map[string]string
+	nodeSpans    map[string]model.Span
+	edgeSpans    map[string]model.Span
 
 	subgraphLabel string
 	nodeIDs       map[string]struct{} // nodes declared within this subgraph (including nested)
@@ -124,6 +232,8 @@ func newScope(parent *scope) *scope {
 		parent:       parent,
 		nodeDefaults: map[string]string{},
 		edgeDefaults: map[string]string{},
+		nodeSpans:    map[string]model.Span{},
+		edgeSpans:    map[string]model.Span{},
 		nodeIDs:      map[string]struct{}{},
 	}
 	if parent != nil {
@@ -133,6 +243,12 @@ func newScope(parent *scope) *scope {
 		for k, v := range parent.edgeDefaults {
 			s.edgeDefaults[k] = v
 		}
+		for k, v := range parent.nodeSpans {
+			s.nodeSpans[k] = v
+		}
+		for k, v := range parent.edgeSpans {
+			s.edgeSpans[k] = v
+		}
 	}
 	return s
 }
@@ -143,13 +259,21 @@ func (s *scope) recordNode(id string) {
 	}
 }
 
+// parseStatements parses statements up to the '}' closing sc. Statement
+// errors are recorded and parsing resumes at the next statement; only errors
+// that leave no way to continue are returned.
 func (p *parser) parseStatements(g *model.Graph, sc *scope) error {
 	for {
 		if err := p.read(); err != nil {
-			return err
+			if !p.recover(err) {
+				return errStop
+			}
+			continue
 		}
 		if p.peek.typ == tokenEOF {
-			return fmt.Errorf("dot parse: unexpected EOF (missing '}')")
+			// Nothing follows, so no further errors can be found.
+			p.addError(p.errAt(p.peek, "unexpected end of file (missing '}')"))
+			return errStop
 		}
 		if p.peek.typ == tokenSymbol && p.peek.lit == "}" {
 			// end of this scope
@@ -158,178 +282,205 @@ func (p *parser) parseStatements(g *model.Graph, sc *scope) error {
 			}
 			return nil
 		}
+		startPos := p.peek.pos
+		if err := p.parseStatement(g, sc); err != nil {
+			if err == errStop || !p.recover(err) {
+				return errStop
+			}
+			// Always make progress, even when the error token starts the
+			// next statement.
+			if p.has && p.peek.pos == startPos && p.peek.typ != tokenEOF && !(p.peek.typ == tokenSymbol && p.peek.lit == "}") {
+				_, _ = p.next()
+			}
+		}
+	}
+}
 
-		tok, err := p.next()
+// errStop aborts parsing after too many errors; the errors are already
+// recorded.
+var errStop = errors.New("dot parse: too many errors")
+
+func (p *parser) parseStatement(g *model.Graph, sc *scope) error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	if tok.typ != tokenIdent {
+		return p.errAt(tok, "expected identifier, got %s", describe(tok))
+	}
+
+	switch tok.lit {
+	case "graph":
+		attrs, spans, err := p.parseAttrBlock()
 		if err != nil {
 			return err
 		}
-
-		if tok.typ != tokenIdent {
-			return fmt.Errorf("dot parse: expected identifier, got %q at %d", tok.lit, tok.pos)
+		for k, v := range attrs {
+			g.Attrs[k] = v
+			g.AttrSpans[k] = spans[k]
 		}
-
-		switch tok.lit {
-		case "graph":
-			attrs, err := p.parseAttrBlock()
-			if err != nil {
+		_ = p.consumeOptionalSemicolon()
+		return nil
+	case "node":
+		attrs, spans, err := p.parseAttrBlock()
+		if err != nil {
+			return err
+		}
+		for k, v := range attrs {
+			sc.nodeDefaults[k] = v
+			sc.nodeSpans[k] = spans[k]
+		}
+		_ = p.consumeOptionalSemicolon()
+		return nil
+	case "edge":
+		attrs, spans, err := p.parseAttrBlock()
+		if err != nil {
+			return err
+		}
+		for k, v := range attrs {
+			sc.edgeDefaults[k] = v
+			sc.edgeSpans[k] = spans[k]
+		}
+		_ = p.consumeOptionalSemicolon()
+		return nil
+	case "subgraph":
+		// subgraph <Identifier>? { ... }
+		if err := p.read(); err != nil {
+			return err
+		}
+		if p.peek.typ == tokenIdent {
+			// subgraph id (ignored, optional)
+			if _, err := p.next(); err != nil {
 				return err
 			}
-			for k, v := range attrs {
-				g.Attrs[k] = v
-			}
-			_ = p.consumeOptionalSemicolon()
-			continue
-		case "node":
-			attrs, err := p.parseAttrBlock()
-			if err != nil {
+		}
+		if err := p.expectSymbol("{"); err != nil {
+			return err
+		}
+		sub := newScope(sc)
+		if err := p.parseStatements(g, sub); err != nil {
+			return err
+		}
+		if err := p.expectSymbol("}"); err != nil {
+			return err
+		}
+		p.applySubgraphLabelClass(g, sub)
+		return nil
+	}
+
+	// Could be:
+	// - Graph attr decl: key = value
+	// - Node stmt: id [attrs]
+	// - Edge stmt: id -> id (-> id)* [attrs]
+	if err := p.read(); err != nil {
+		return err
+	}
+	if p.peek.typ == tokenSymbol && p.peek.lit == "=" {
+		// graph attr decl
+		if _, err := p.next(); err != nil {
+			return err
+		}
+		val, err := p.parseTopLevelValue()
+		if err != nil {
+			return err
+		}
+		// Special case: label inside subgraph scope becomes a derived class source.
+		if sc.parent != nil && tok.lit == "label" {
+			sc.subgraphLabel = val
+		} else {
+			g.Attrs[tok.lit] = val
+			g.AttrSpans[tok.lit] = p.lines.span(tok.pos, p.lastEnd)
+		}
+		_ = p.consumeOptionalSemicolon()
+		return nil
+	}
+
+	if p.peek.typ == tokenSymbol && p.peek.lit == "->" {
+		// Edge statement.
+		chain := []token{tok}
+		for {
+			// consume ->
+			if _, err := p.next(); err != nil {
 				return err
 			}
-			for k, v := range attrs {
-				sc.nodeDefaults[k] = v
-			}
-			_ = p.consumeOptionalSemicolon()
-			continue
-		case "edge":
-			attrs, err := p.parseAttrBlock()
+			toTok, err := p.next()
 			if err != nil {
 				return err
 			}
-			for k, v := range attrs {
-				sc.edgeDefaults[k] = v
+			if toTok.typ != tokenIdent {
+				return p.errAt(toTok, "expected edge target identifier, got %s", describe(toTok))
 			}
-			_ = p.consumeOptionalSemicolon()
-			continue
-		case "subgraph":
-			// subgraph <Identifier>? { ... }
+			chain = append(chain, toTok)
+
 			if err := p.read(); err != nil {
 				return err
 			}
-			if p.peek.typ == tokenIdent {
-				// subgraph id (ignored, optional)
-				if _, err := p.next(); err != nil {
-					return err
-				}
+			if !(p.peek.typ == tokenSymbol && p.peek.lit == "->") {
+				break
 			}
-			if err := p.expectSymbol("{"); err != nil {
+		}
+
+		attrs := map[string]string{}
+		spans := map[string]model.Span{}
+		if p.peek.typ == tokenSymbol && p.peek.lit == "[" {
+			var err error
+			attrs, spans, err = p.parseAttrBlock()
+			if err != nil {
 				return err
 			}
-			sub := newScope(sc)
-			if err := p.parseStatements(g, sub); err != nil {
-				return err
+		}
+
+		for i := 0; i+1 < len(chain); i++ {
+			from, to := chain[i], chain[i+1]
+			e := model.NewEdge(from.lit, to.lit)
+			e.Span = p.lines.span(from.pos, to.end)
+			e.ToSpan = p.lines.span(to.pos, to.end)
+			// Defaults first, then explicit attrs.
+			for k, v := range sc.edgeDefaults {
+				e.Attrs[k] = v
+				e.AttrSpans[k] = sc.edgeSpans[k]
 			}
-			if err := p.expectSymbol("}"); err != nil {
-				return err
+			for k, v := range attrs {
+				e.Attrs[k] = v
+				e.AttrSpans[k] = spans[k]
 			}
-			p.applySubgraphLabelClass(g, sub)
-			continue
-		default:
-			// Could be:
-			// - Graph attr decl: key = value
-			// - Node stmt: id [attrs]
-			// - Edge stmt: id -> id (-> id)* [attrs]
-			if err := p.read(); err != nil {
+			if err := g.AddEdge(e); err != nil {
 				return err
 			}
-			if p.peek.typ == tokenSymbol && p.peek.lit == "=" {
-				// graph attr decl
-				if _, err := p.next(); err != nil {
-					return err
-				}
-				val, err := p.parseTopLevelValue()
-				if err != nil {
-					return err
-				}
-				// Special case: label inside subgraph scope becomes a derived class source.
-				if sc.parent != nil && tok.lit == "label" {
-					sc.subgraphLabel = val
-				} else {
-					g.Attrs[tok.lit] = val
-				}
-				_ = p.consumeOptionalSemicolon()
-				continue
-			}
-
-			if p.peek.typ == tokenSymbol && p.peek.lit == "->" {
-				// Edge statement.
-				from := tok.lit
-				chain := []string{from}
-				for {
-					// consume ->
-					if _, err := p.next(); err != nil {
-						return err
-					}
-					toTok, err := p.next()
-					if err != nil {
-						return err
-					}
-					if toTok.typ != tokenIdent {
-						return fmt.Errorf("dot parse: expected edge target identifier, got %q at %d", toTok.lit, toTok.pos)
-					}
-					chain = append(chain, toTok.lit)
-
-					if err := p.read(); err != nil {
-						return err
-					}
-					if !(p.peek.typ == tokenSymbol && p.peek.lit == "->") {
-						break
-					}
-				}
-
-				attrs := map[string]string{}
-				if err := p.read(); err != nil {
-					return err
-				}
-				if p.peek.typ == tokenSymbol && p.peek.lit == "[" {
-					var err error
-					attrs, err = p.parseAttrBlock()
-					if err != nil {
-						return err
-					}
-				}
-
-				for i := 0; i+1 < len(chain); i++ {
-					e := model.NewEdge(chain[i], chain[i+1])
-					// Defaults first, then explicit attrs.
-					for k, v := range sc.edgeDefaults {
-						e.Attrs[k] = v
-					}
-					for k, v := range attrs {
-						e.Attrs[k] = v
-					}
-					if err := g.AddEdge(e); err != nil {
-						return err
-					}
-				}
-
-				_ = p.consumeOptionalSemicolon()
-				continue
-			}
+		}
 
-			// Node statement.
-			nodeAttrs := map[string]string{}
-			if p.peek.typ == tokenSymbol && p.peek.lit == "[" {
-				var err error
-				nodeAttrs, err = p.parseAttrBlock()
-				if err != nil {
-					return err
-				}
-			}
+		_ = p.consumeOptionalSemicolon()
+		return nil
+	}
 
-			n := model.NewNode(tok.lit)
-			n.Order = len(g.Nodes)
-			for k, v := range sc.nodeDefaults {
-				n.Attrs[k] = v
-			}
-			for k, v := range nodeAttrs {
-				n.Attrs[k] = v
-			}
-			if err := g.AddNode(n); err != nil {
-				return err
-			}
-			sc.recordNode(n.ID)
-			_ = p.consumeOptionalSemicolon()
+	// Node statement.
+	nodeAttrs := map[string]string{}
+	nodeSpans := map[string]model.Span{}
+	if p.peek.typ == tokenSymbol && p.peek.lit == "[" {
+		var err error
+		nodeAttrs, nodeSpans, err = p.parseAttrBlock()
+		if err != nil {
+			return err
 		}
 	}
+
+	n := model.NewNode(tok.lit)
+	n.Order = len(g.Nodes)
+	n.Span = p.lines.span(tok.pos, p.lastEnd)
+	for k, v := range sc.nodeDefaults {
+		n.Attrs[k] = v
+		n.AttrSpans[k] = sc.nodeSpans[k]
+	}
+	for k, v := range nodeAttrs {
+		n.Attrs[k] = v
+		n.AttrSpans[k] = nodeSpans[k]
+	}
+	if err := g.AddNode(n); err != nil {
+		return err
+	}
+	sc.recordNode(n.ID)
+	_ = p.consumeOptionalSemicolon()
+	return nil
 }
 
 func (p *parser) consumeOptionalSemicolon() error {
@@ -343,36 +494,41 @@ func (p *parser) consumeOptionalSemicolon() error {
 	return nil
 }
 
-func (p *parser) parseAttrBlock() (map[string]string, error) {
+// parseAttrBlock parses [k=v, ...] and returns the attributes with the span
+// of each "k=v".
+func (p *parser) parseAttrBlock() (map[string]string, map[string]model.Span, error) {
 	if err := p.expectSymbol("["); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	attrs := map[string]string{}
+	spans := map[string]model.Span{}
 	for {
 		if err := p.read(); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if p.peek.typ == tokenSymbol && p.peek.lit == "]" {
 			_, _ = p.next()
-			return attrs, nil
+			return attrs, spans, nil
 		}
 
+		keyStart := p.peek.pos
 		key, err := p.parseQualifiedKey()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if err := p.expectSymbol("="); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		val, err := p.parseAttrValue()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		attrs[key] = val
+		spans[key] = p.lines.span(keyStart, p.lastEnd)
 
 		// Next: ',' or ']'
 		if err := p.read(); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if p.peek.typ == tokenSymbol && p.peek.lit == "," {
 			_, _ = p.next()
@@ -383,7 +539,7 @@ func (p *parser) parseAttrBlock() (map[string]string, error) {
 			continue
 		}
 		// Anything else is a syntax error.
-		return nil, fmt.Errorf("dot parse: expected ',' or ']', got %q at %d", p.peek.lit, p.peek.pos)
+		return nil, nil, p.errAt(p.peek, "expected ',' or ']', got %s", describe(p.peek))
 	}
 }
 
@@ -407,6 +563,13 @@ func (p *parser) parseAttrValue() (string, error) {
 		if p.peek.typ == tokenSymbol && (p.peek.lit == "," || p.peek.lit == "]") {
 			break
 		}
+		if p.peek.typ == tokenEOF {
+			return "", p.errAt(p.peek, "unexpected end of file in attribute value")
+		}
+		if len(parts) > 0 && p.peek.pos > p.lastEnd {
+			// Unquoted values cannot contain spaces; this is the next attribute.
+			return "", p.errAt(p.peek, "expected ',' or ']', got %s", describe(p.peek))
+		}
 		tok, err := p.next()
 		if err != nil {
 			return "", err
@@ -419,15 +582,15 @@ func (p *parser) parseAttrValue() (string, error) {
 			case "-", ".", ":", "/":
 				parts = append(parts, tok.lit)
 			default:
-				return "", fmt.Errorf("dot parse: unexpected token in value: %q at %d", tok.lit, tok.pos)
+				return "", p.errAt(tok, "unexpected token in value: %q", tok.lit)
 			}
 		default:
-			return "", fmt.Errorf("dot parse: unexpected token in value: %q at %d", tok.lit, tok.pos)
+			return "", p.errAt(tok, "unexpected token in value: %q", tok.lit)
 		}
 	}
 	val := strings.TrimSpace(strings.Join(parts, ""))
 	if val == "" {
-		return "", fmt.Errorf("dot parse: empty attr value")
+		return "", p.errAt(p.peek, "empty attr value")
 	}
 	return val, nil
 }
@@ -457,7 +620,7 @@ func (p *parser) parseTopLevelValue() (string, error) {
 			return "", err
 		}
 		if numTok.typ != tokenIdent {
-			return "", fmt.Errorf("dot parse: expected number after '-', got %q at %d", numTok.lit, numTok.pos)
+			return "", p.errAt(numTok, "expected number after '-', got %s", describe(numTok))
 		}
 		return neg.lit + numTok.lit, nil
 	}
@@ -468,7 +631,7 @@ func (p *parser) parseTopLevelValue() (string, error) {
 		}
 		return tok.lit, nil
 	}
-	return "", fmt.Errorf("dot parse: expected value after '=', got %q at %d", p.peek.lit, p.peek.pos)
+	return "", p.errAt(p.peek, "expected value after '=', got %s", describe(p.peek))
 }
 
 func (p *parser) parseQualifiedKey() (string, error) {
@@ -478,7 +641,7 @@ func (p *parser) parseQualifiedKey() (string, error) {
 		return "", err
 	}
 	if first.typ != tokenIdent {
-		return "", fmt.Errorf("dot parse: expected identifier key, got %q at %d", first.lit, first.pos)
+		return "", p.errAt(first, "expected identifier key, got %s", describe(first))
 	}
 	key := first.lit
 	for {
@@ -493,7 +656,7 @@ func (p *parser) parseQualifiedKey() (string, error) {
 				return "", err
 			}
 			if part.typ != tokenIdent {
-				return "", fmt.Errorf("dot parse: expected identifier after '.', got %q at %d", part.lit, part.pos)
+				return "", p.errAt(part, "expected identifier after '.', got %s", describe(part))
 			}
 			key += "." + part.lit
 			continue
@@ -155,3 +155,40 @@ func contains(xs []string, want string) bool {
 }
 
 var _ = model.Graph{} // keep the import honest as the package evolves
+
+func TestParse_RecordsSourceSpans(t *testing.T) {
+	src := []byte(`// leading comment
+digraph G {
+  node [shape=box]
+  graph [goal="ship"]
+  start [shape=Mdiamond]
+  impl  [prompt="do it",
+         max_retries=2]
+  start -> impl -> exit [condition="outcome=success"]
+}
+`)
+	g, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	at := func(sp model.Span) string {
+		return sp.Start.String() + "-" + sp.End.String() + " " + string(src[sp.Start.Offset:sp.End.Offset])
+	}
+	for _, tc := range []struct {
+		got  model.Span
+		want string
+	}{
+		{g.Span, "2:1-2:10 digraph G"},
+		{g.AttrSpans["goal"], `4:10-4:21 goal="ship"`},
+		{g.Nodes["impl"].Span, "6:3-7:24 impl  [prompt=\"do it\",\n         max_retries=2]"},
+		{g.Nodes["impl"].AttrSpans["max_retries"], "7:10-7:23 max_retries=2"},
+		{g.Nodes["impl"].AttrSpan("shape"), "3:9-3:18 shape=box"},
+		{g.Edges[1].Span, "8:12-8:24 impl -> exit"},
+		{g.Edges[1].ToSpan, "8:20-8:24 exit"},
+		{g.Edges[0].AttrSpan("condition"), `8:26-8:53 condition="outcome=success"`},
+	} {
+		if got := at(tc.got); got != tc.want {
+			t.Errorf("span: got %q want %q", got, tc.want)
+		}
+	}
+}
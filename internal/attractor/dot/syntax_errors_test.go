@@ -1,6 +1,10 @@
 package dot
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+)
 
 func TestParse_RejectsMissingCommasBetweenAttrs(t *testing.T) {
 	_, err := Parse([]byte(`
@@ -28,3 +32,47 @@ digraph G {
 		t.Fatalf("expected error, got nil")
 	}
 }
+
+func TestParse_ReportsEverySyntaxErrorWithPosition(t *testing.T) {
+	_, err := Parse([]byte(`digraph G {
+  start [shape=Mdiamond]
+  a [label="A" prompt="missing comma"]
+  b [shape=]
+  /* a comment keeps offsets */ c -> [label=x]
+  exit [shape=Msquare]
+  start -> a -> exit
+}
+`))
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("expected ErrorList, got %T: %v", err, err)
+	}
+	got := make([]string, 0, len(list))
+	for _, e := range list {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`dot parse: 3:16: expected ',' or ']', got "prompt"`,
+		`dot parse: 4:12: empty attr value`,
+		`dot parse: 5:38: expected edge target identifier, got "["`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParse_LexerErrorsHavePositions(t *testing.T) {
+	_, err := Parse([]byte("digraph G {\n  café [shape=box]\n  x [label=\"open\n}\n"))
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 1 {
+		t.Fatalf("expected one error, got %v", err)
+	}
+	if list[0].Span.Start.Line != 3 || list[0].Msg != "unterminated string" {
+		t.Fatalf("error: %+v", list[0])
+	}
+
+	_, err = Parse([]byte("digraph G {\n  café [shape=box]\n}\n"))
+	if !errors.As(err, &list) || list[0].Error() != `dot parse: 2:6: unexpected character 'é'` {
+		t.Fatalf("error: %v", err)
+	}
+}
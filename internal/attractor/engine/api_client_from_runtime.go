@@ -22,7 +22,7 @@ func newAPIClientFromProviderRuntimes(runtimes map[string]ProviderRuntime) (*llm
 			continue
 		}
 		apiKey := strings.TrimSpace(os.Getenv(rt.API.DefaultAPIKeyEnv))
-		if apiKey == "" {
+		if apiKey == "" && !rt.API.APIKeyOptional {
 			continue
 		}
 		switch rt.API.Protocol {
@@ -41,6 +41,16 @@ func newAPIClientFromProviderRuntimes(runtimes map[string]ProviderRuntime) (*llm
 				OptionsKey:   rt.API.ProviderOptionsKey,
 				ExtraHeaders: rt.APIHeaders(),
 			}))
+		case providerspec.ProtocolAzureOpenAI:
+			baseURL := resolveBuiltInBaseURLOverride(key, rt.API.DefaultBaseURL)
+			if baseURL == "" {
+				return nil, fmt.Errorf("provider %s: azure_openai requires llm.providers.%s.api.base_url (or AZURE_OPENAI_ENDPOINT) set to the resource endpoint", key, key)
+			}
+			c.Register(openai.NewAzure(key, apiKey, baseURL, openai.AzureConfig{
+				Path:        rt.API.DefaultPath,
+				APIVersion:  rt.API.APIVersion,
+				Deployments: rt.APIDeployments,
+			}))
 		default:
 			return nil, fmt.Errorf("unsupported api protocol %q for provider %s", rt.API.Protocol, key)
 		}
@@ -70,6 +80,10 @@ func resolveBuiltInBaseURLOverride(providerKey, defaultBaseURL string) string {
 				return env
 			}
 		}
+	case "azure":
+		if env := strings.TrimSpace(os.Getenv("AZURE_OPENAI_ENDPOINT")); env != "" && normalized == "" {
+			return env
+		}
 	case "minimax":
 		if env := strings.TrimSpace(os.Getenv("MINIMAX_BASE_URL")); env != "" {
 			if normalized == "" || normalized == "https://api.minimax.io" {
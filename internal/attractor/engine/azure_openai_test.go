@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+func TestRunWithConfig_AzureOpenAIRoutesToDeployment(t *testing.T) {
+	t.Setenv("KILROY_PREFLIGHT_PROMPT_PROBES", "off")
+	t.Setenv("AZURE_OPENAI_API_KEY", "azkey")
+	repo := initTestRepo(t)
+
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.Unmarshal(b, &body)
+		mu.Lock()
+		seen = append(seen, fmt.Sprintf("%s?%s key=%s model=%s", r.URL.Path, r.URL.RawQuery, r.Header.Get("api-key"), body.Model))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","model":"` + body.Model + `","output":[{"type":"message","content":[{"type":"output_text","text":"Done."}]}],"usage":{"input_tokens":1,"output_tokens":2,"total_tokens":3}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.LLM.Providers = map[string]ProviderConfig{
+		"azure": {Backend: BackendAPI, API: ProviderAPIConfig{
+			BaseURL:     srv.URL,
+			APIVersion:  "2024-10-21",
+			Deployments: map[string]string{"gpt-5.2": "corp-gpt52"},
+		}},
+	}
+	cfg.ModelDB.OpenRouterModelInfoPath = writeCatalogForPreflight(t, `{"data":[{"id":"openai/gpt-5.2"}]}`)
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Git.RunBranchPrefix = "attractor/run"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	logsRoot := t.TempDir()
+	res, err := RunWithConfig(ctx, singleProviderDot("azure", "gpt-5.2"), cfg, RunOptions{RunID: "azure-deployment", LogsRoot: logsRoot, DisableCXDB: true})
+	if err != nil {
+		t.Fatalf("RunWithConfig: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: %+v", res)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) == 0 {
+		t.Fatalf("azure endpoint was not called")
+	}
+	for _, s := range seen {
+		if s != "/openai/responses?api-version=2024-10-21 key=azkey model=corp-gpt52" {
+			t.Fatalf("azure request: %s", s)
+		}
+	}
+	report, _ := os.ReadFile(filepath.Join(logsRoot, "preflight_report.json"))
+	if !strings.Contains(string(report), "AZURE_OPENAI_API_KEY") {
+		t.Fatalf("preflight report should check the azure key env:\n%s", report)
+	}
+}
+
+func TestNewAPIClientFromProviderRuntimes_AzureRequiresEndpoint(t *testing.T) {
+	t.Setenv("AZURE_OPENAI_API_KEY", "azkey")
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "")
+	cfg := &RunConfigFile{}
+	cfg.LLM.Providers = map[string]ProviderConfig{"azure_openai": {Backend: BackendAPI}}
+	runtimes, err := resolveProviderRuntimes(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newAPIClientFromProviderRuntimes(runtimes); err == nil || !strings.Contains(err.Error(), "AZURE_OPENAI_ENDPOINT") {
+		t.Fatalf("expected a missing endpoint error, got %v", err)
+	}
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "https://corp.openai.azure.com")
+	if _, err := newAPIClientFromProviderRuntimes(runtimes); err != nil {
+		t.Fatalf("endpoint from env: %v", err)
+	}
+}
+
+func TestClassifyAPIError_AzureFailureShapes(t *testing.T) {
+	cases := []struct {
+		err       error
+		wantClass string
+		wantSig   string
+	}{
+		{llm.ErrorFromHTTPStatus("azure", 400, "map[error:map[code:content_filter innererror:map[code:ResponsibleAIPolicyViolation]]]", nil, nil), failureClassDeterministic, "api_deterministic|azure|content_filter"},
+		{llm.ErrorFromHTTPStatus("azure", 429, "map[error:map[code:insufficient_quota]]", nil, nil), failureClassDeterministic, "api_deterministic|azure|quota_exceeded"},
+		{llm.ErrorFromHTTPStatus("azure", 400, "map[error:map[code:context_length_exceeded]]", nil, nil), failureClassDeterministic, "api_deterministic|azure|context_length"},
+		{llm.ErrorFromHTTPStatus("azure", 404, "map[error:map[code:DeploymentNotFound]]", nil, nil), failureClassDeterministic, "api_deterministic|azure|not_found"},
+		{llm.ErrorFromHTTPStatus("azure", 429, "exceeded token rate limit", nil, nil), failureClassTransientInfra, "api_transient|azure|rate_limited"},
+	}
+	for _, tc := range cases {
+		class, sig := classifyAPIError(tc.err)
+		if class != tc.wantClass || sig != tc.wantSig {
+			t.Fatalf("classifyAPIError(%v) = %q %q, want %q %q", tc.err, class, sig, tc.wantClass, tc.wantSig)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Parses Codex CLI `exec --json` JSONL output into CXDB turns.
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// codexStreamEvent is one line of `codex exec --json` output.
+type codexStreamEvent struct {
+	Type  string     `json:"type"`
+	Item  *codexItem `json:"item,omitempty"`
+	Usage *cliUsage  `json:"usage,omitempty"`
+}
+
+// codexItem is the payload of item.started / item.completed events. Older
+// Codex builds name the kind item_type instead of type.
+type codexItem struct {
+	ID               string          `json:"id"`
+	Type             string          `json:"type"`
+	ItemType         string          `json:"item_type"`
+	Text             string          `json:"text,omitempty"`
+	Command          string          `json:"command,omitempty"`
+	AggregatedOutput string          `json:"aggregated_output,omitempty"`
+	ExitCode         *int            `json:"exit_code,omitempty"`
+	Status           string          `json:"status,omitempty"`
+	Changes          json.RawMessage `json:"changes,omitempty"`
+	Server           string          `json:"server,omitempty"`
+	Tool             string          `json:"tool,omitempty"`
+	Arguments        json.RawMessage `json:"arguments,omitempty"`
+	Result           json.RawMessage `json:"result,omitempty"`
+	Error            *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+	Query string `json:"query,omitempty"`
+}
+
+func (it *codexItem) kind() string {
+	if it.Type != "" {
+		return it.Type
+	}
+	return it.ItemType
+}
+
+// toolCall maps a tool-like item to a cliToolCall. ok is false for items that
+// are not tool invocations (messages, reasoning, todo lists).
+func (it *codexItem) toolCall() (call cliToolCall, ok bool) {
+	var name string
+	var args any
+	switch it.kind() {
+	case "command_execution":
+		name, args = "shell", map[string]any{"command": it.Command}
+	case "file_change":
+		name, args = "apply_patch", map[string]any{"changes": it.Changes}
+	case "mcp_tool_call":
+		name, args = it.Server+"."+it.Tool, it.Arguments
+	case "web_search":
+		name, args = "web_search", map[string]any{"query": it.Query}
+	default:
+		return cliToolCall{}, false
+	}
+	b, _ := json.Marshal(args)
+	return cliToolCall{ID: it.ID, Name: name, InputJSON: string(b)}, true
+}
+
+// toolResult summarizes a completed tool item.
+func (it *codexItem) toolResult() cliToolResult {
+	res := cliToolResult{ToolUseID: it.ID, IsError: it.Status == "failed"}
+	switch it.kind() {
+	case "command_execution":
+		res.Content = it.AggregatedOutput
+		if it.ExitCode != nil && *it.ExitCode != 0 {
+			res.IsError = true
+			if res.Content == "" {
+				res.Content = fmt.Sprintf("exit code %d", *it.ExitCode)
+			}
+		}
+	case "file_change":
+		res.Content = string(it.Changes)
+	case "mcp_tool_call":
+		res.Content = string(it.Result)
+	}
+	if it.Error != nil && it.Error.Message != "" {
+		res.IsError = true
+		res.Content = it.Error.Message
+	}
+	return res
+}
+
+func parseCodexStreamLine(line []byte) (*codexStreamEvent, error) {
+	var ev codexStreamEvent
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// parseCodexOutputStream reads `codex exec --json` events from r and emits
+// CXDB turns: agent messages become AssistantMessage turns, and command,
+// file-change, MCP and web-search items become ToolCall/ToolResult pairs.
+// Token usage from turn.completed is attached to the turn's last message.
+func parseCodexOutputStream(ctx context.Context, eng *Engine, nodeID string, r io.Reader) {
+	buf := newCLITurnBuffer(ctx, eng, nodeID)
+	started := map[string]bool{}
+	scanCLIStreamLines(r, func(line []byte) {
+		ev, err := parseCodexStreamLine(line)
+		if err != nil {
+			return
+		}
+		switch ev.Type {
+		case "item.started":
+			if ev.Item == nil {
+				return
+			}
+			if call, ok := ev.Item.toolCall(); ok {
+				started[call.ID] = true
+				buf.addCall(call)
+			}
+		case "item.completed":
+			if ev.Item == nil {
+				return
+			}
+			switch ev.Item.kind() {
+			case "agent_message", "assistant_message":
+				buf.addText(strings.TrimSpace(ev.Item.Text), "\n")
+				return
+			}
+			call, ok := ev.Item.toolCall()
+			if !ok {
+				return
+			}
+			// Some items (file changes) only ever report completion.
+			if !started[call.ID] {
+				buf.addCall(call)
+			}
+			delete(started, call.ID)
+			buf.addResult(ev.Item.toolResult())
+		case "turn.completed":
+			buf.flush(ev.Usage)
+		case "turn.failed", "error":
+			buf.flush(nil)
+		}
+	})
+	buf.flush(nil)
+}
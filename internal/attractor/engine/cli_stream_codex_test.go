@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// turnSummary renders turns as "type:detail" strings for compact assertions.
+func turnSummary(turns []map[string]any) []string {
+	out := make([]string, 0, len(turns))
+	for _, turn := range turns {
+		typeID := strings.TrimPrefix(turn["type_id"].(string), "com.kilroy.attractor.")
+		p := turn["payload"].(map[string]any)
+		switch typeID {
+		case "AssistantMessage":
+			out = append(out, typeID+":"+p["text"].(string))
+		case "ToolCall":
+			out = append(out, typeID+":"+p["tool_name"].(string))
+		case "ToolResult":
+			out = append(out, typeID+":"+p["tool_name"].(string)+":"+strings.TrimSpace(p["output"].(string)))
+		default:
+			out = append(out, typeID)
+		}
+	}
+	return out
+}
+
+func TestParseCodexOutputStream_DecomposesItems(t *testing.T) {
+	srv := newCXDBTestServer(t)
+	eng := newTestEngineWithCXDB(t, srv)
+
+	stream := strings.Join([]string{
+		`{"type":"thread.started","thread_id":"th_1"}`,
+		`{"type":"turn.started"}`,
+		`{"type":"item.completed","item":{"id":"item_0","type":"reasoning","text":"**Inspecting repo**"}}`,
+		`{"type":"item.completed","item":{"id":"item_1","type":"agent_message","text":"Listing files first."}}`,
+		`{"type":"item.started","item":{"id":"item_2","type":"command_execution","command":"bash -lc ls","aggregated_output":"","exit_code":null,"status":"in_progress"}}`,
+		`{"type":"item.completed","item":{"id":"item_2","type":"command_execution","command":"bash -lc ls","aggregated_output":"README.md\n","exit_code":0,"status":"completed"}}`,
+		`{"type":"item.completed","item":{"id":"item_3","type":"file_change","changes":[{"path":"README.md","kind":"update"}],"status":"completed"}}`,
+		`{"type":"item.started","item":{"id":"item_4","type":"command_execution","command":"bash -lc 'go test ./...'","status":"in_progress"}}`,
+		`{"type":"item.completed","item":{"id":"item_4","type":"command_execution","command":"bash -lc 'go test ./...'","aggregated_output":"FAIL\n","exit_code":1,"status":"failed"}}`,
+		`not json`,
+		`{"type":"item.completed","item":{"id":"item_5","type":"agent_message","text":"Updated the README."}}`,
+		`{"type":"turn.completed","usage":{"input_tokens":1200,"cached_input_tokens":800,"output_tokens":90}}`,
+	}, "\n")
+	parseCodexOutputStream(context.Background(), eng, "impl", strings.NewReader(stream))
+
+	turns := srv.Turns(eng.CXDB.ContextID)
+	got := turnSummary(turns)
+	want := []string{
+		"AssistantMessage:Listing files first.",
+		"ToolCall:shell",
+		"ToolResult:shell:README.md",
+		"AssistantMessage:[tool_use: apply_patch]",
+		"ToolCall:apply_patch",
+		`ToolResult:apply_patch:[{"path":"README.md","kind":"update"}]`,
+		"AssistantMessage:[tool_use: shell]",
+		"ToolCall:shell",
+		"ToolResult:shell:FAIL",
+		"AssistantMessage:Updated the README.",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("turns:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if turns[8]["payload"].(map[string]any)["is_error"] != true {
+		t.Fatalf("failed command should be an error result: %v", turns[8]["payload"])
+	}
+	last := turns[len(turns)-1]["payload"].(map[string]any)
+	if last["input_tokens"] != float64(1200) || last["output_tokens"] != float64(90) {
+		t.Fatalf("usage not attached to final message: %v", last)
+	}
+}
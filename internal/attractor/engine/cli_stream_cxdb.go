@@ -15,83 +15,154 @@ func emitCXDBCLIStreamEvent(ctx context.Context, eng *Engine, nodeID string, ev
 	if eng == nil || eng.CXDB == nil || ev == nil {
 		return
 	}
-	runID := eng.Options.RunID
 
 	switch ev.Type {
 	case "assistant":
 		if ev.Message == nil {
 			return
 		}
-		text := extractAssistantText(ev.Message)
-		calls := extractToolCalls(ev.Message)
-
-		// For tool-only messages (no text), synthesize a descriptive label.
-		if strings.TrimSpace(text) == "" && len(calls) > 0 {
-			names := make([]string, len(calls))
-			for i, c := range calls {
-				names[i] = c.Name
-			}
-			text = "[tool_use: " + strings.Join(names, ", ") + "]"
+		appendCLIAssistantTurns(ctx, eng, nodeID, extractAssistantText(ev.Message), ev.Message.Model, ev.Message.Usage, extractToolCalls(ev.Message), callMap)
+
+	case "user":
+		if ev.Message == nil {
+			return
+		}
+		for _, result := range extractToolResults(ev.Message) {
+			appendCLIToolResultTurn(ctx, eng, nodeID, result, callMap)
 		}
 
-		var inputTokens, outputTokens uint64
-		if ev.Message.Usage != nil {
-			inputTokens = uint64(ev.Message.Usage.InputTokens)
-			outputTokens = uint64(ev.Message.Usage.OutputTokens)
+	default:
+		// system, result, etc. — skip silently
+	}
+}
+
+// appendCLIAssistantTurns appends one AssistantMessage turn followed by a
+// ToolCall turn per call. Every stream format funnels through here so the
+// CXDB shape does not depend on which CLI ran the stage.
+func appendCLIAssistantTurns(ctx context.Context, eng *Engine, nodeID string, text string, model string, usage *cliUsage, calls []cliToolCall, callMap map[string]string) {
+	if eng == nil || eng.CXDB == nil {
+		return
+	}
+	runID := eng.Options.RunID
+
+	// For tool-only messages (no text), synthesize a descriptive label.
+	if strings.TrimSpace(text) == "" && len(calls) > 0 {
+		names := make([]string, len(calls))
+		for i, c := range calls {
+			names[i] = c.Name
 		}
+		text = "[tool_use: " + strings.Join(names, ", ") + "]"
+	}
+
+	var inputTokens, outputTokens uint64
+	if usage != nil {
+		inputTokens = uint64(usage.InputTokens)
+		outputTokens = uint64(usage.OutputTokens)
+	}
+
+	if _, _, err := eng.CXDB.Append(ctx, "com.kilroy.attractor.AssistantMessage", 1, map[string]any{
+		"run_id":         runID,
+		"node_id":        nodeID,
+		"text":           truncate(text, 8_000),
+		"model":          model,
+		"input_tokens":   inputTokens,
+		"output_tokens":  outputTokens,
+		"tool_use_count": uint32(len(calls)),
+		"timestamp_ms":   nowMS(),
+	}); err != nil {
+		eng.Warn(fmt.Sprintf("cxdb append AssistantMessage failed (node=%s): %v", nodeID, err))
+	}
 
-		if _, _, err := eng.CXDB.Append(ctx, "com.kilroy.attractor.AssistantMessage", 1, map[string]any{
+	// Emit a ToolCall turn for each tool_use block.
+	for _, call := range calls {
+		if callMap != nil {
+			callMap[call.ID] = call.Name
+		}
+		if _, _, err := eng.CXDB.Append(ctx, "com.kilroy.attractor.ToolCall", 1, map[string]any{
 			"run_id":         runID,
 			"node_id":        nodeID,
-			"text":           truncate(text, 8_000),
-			"model":          ev.Message.Model,
-			"input_tokens":   inputTokens,
-			"output_tokens":  outputTokens,
-			"tool_use_count": uint32(len(calls)),
-			"timestamp_ms":   nowMS(),
+			"tool_name":      call.Name,
+			"call_id":        call.ID,
+			"arguments_json": truncate(call.InputJSON, 8_000),
 		}); err != nil {
-			eng.Warn(fmt.Sprintf("cxdb append AssistantMessage failed (node=%s): %v", nodeID, err))
+			eng.Warn(fmt.Sprintf("cxdb append ToolCall failed (node=%s tool=%s call_id=%s): %v", nodeID, call.Name, call.ID, err))
 		}
+	}
+}
 
-		// Emit a ToolCall turn for each tool_use block.
-		for _, call := range calls {
-			if callMap != nil {
-				callMap[call.ID] = call.Name
-			}
-			if _, _, err := eng.CXDB.Append(ctx, "com.kilroy.attractor.ToolCall", 1, map[string]any{
-				"run_id":         runID,
-				"node_id":        nodeID,
-				"tool_name":      call.Name,
-				"call_id":        call.ID,
-				"arguments_json": truncate(call.InputJSON, 8_000),
-			}); err != nil {
-				eng.Warn(fmt.Sprintf("cxdb append ToolCall failed (node=%s tool=%s call_id=%s): %v", nodeID, call.Name, call.ID, err))
-			}
-		}
+// appendCLIToolResultTurn appends a ToolResult turn, naming the tool from
+// callMap since results only carry the call ID.
+func appendCLIToolResultTurn(ctx context.Context, eng *Engine, nodeID string, result cliToolResult, callMap map[string]string) {
+	if eng == nil || eng.CXDB == nil {
+		return
+	}
+	toolName := ""
+	if callMap != nil {
+		toolName = callMap[result.ToolUseID]
+	}
+	if _, _, err := eng.CXDB.Append(ctx, "com.kilroy.attractor.ToolResult", 1, map[string]any{
+		"run_id":    eng.Options.RunID,
+		"node_id":   nodeID,
+		"tool_name": toolName,
+		"call_id":   result.ToolUseID,
+		"output":    truncate(result.Content, 8_000),
+		"is_error":  result.IsError,
+	}); err != nil {
+		eng.Warn(fmt.Sprintf("cxdb append ToolResult failed (node=%s call_id=%s): %v", nodeID, result.ToolUseID, err))
+	}
+}
 
-	case "user":
-		if ev.Message == nil {
-			return
-		}
-		results := extractToolResults(ev.Message)
-		for _, result := range results {
-			toolName := ""
-			if callMap != nil {
-				toolName = callMap[result.ToolUseID]
-			}
-			if _, _, err := eng.CXDB.Append(ctx, "com.kilroy.attractor.ToolResult", 1, map[string]any{
-				"run_id":    runID,
-				"node_id":   nodeID,
-				"tool_name": toolName,
-				"call_id":   result.ToolUseID,
-				"output":    truncate(result.Content, 8_000),
-				"is_error":  result.IsError,
-			}); err != nil {
-				eng.Warn(fmt.Sprintf("cxdb append ToolResult failed (node=%s call_id=%s): %v", nodeID, result.ToolUseID, err))
-			}
-		}
+// cliTurnBuffer assembles assistant turns for stream formats that emit text,
+// tool calls and tool results as separate events (Codex, Gemini). Buffered
+// text and calls are flushed as one AssistantMessage plus its ToolCall turns,
+// the same shape a Claude assistant event produces.
+type cliTurnBuffer struct {
+	ctx     context.Context
+	eng     *Engine
+	nodeID  string
+	model   string
+	text    strings.Builder
+	calls   []cliToolCall
+	callMap map[string]string
+}
 
-	default:
-		// system, result, etc. — skip silently
+func newCLITurnBuffer(ctx context.Context, eng *Engine, nodeID string) *cliTurnBuffer {
+	return &cliTurnBuffer{ctx: ctx, eng: eng, nodeID: nodeID, callMap: map[string]string{}}
+}
+
+// addText appends assistant text, separated from earlier text by sep. Text
+// after buffered tool calls starts a new message.
+func (b *cliTurnBuffer) addText(text, sep string) {
+	if text == "" {
+		return
+	}
+	if len(b.calls) > 0 {
+		b.flush(nil)
+	}
+	if b.text.Len() > 0 {
+		b.text.WriteString(sep)
+	}
+	b.text.WriteString(text)
+}
+
+func (b *cliTurnBuffer) addCall(call cliToolCall) {
+	b.calls = append(b.calls, call)
+}
+
+// addResult flushes the pending message so its ToolCall turns precede the
+// result.
+func (b *cliTurnBuffer) addResult(result cliToolResult) {
+	b.flush(nil)
+	appendCLIToolResultTurn(b.ctx, b.eng, b.nodeID, result, b.callMap)
+}
+
+// flush emits the pending message. usage, reported by these CLIs per turn or
+// per run rather than per message, is attached to the message that ends it.
+func (b *cliTurnBuffer) flush(usage *cliUsage) {
+	if b.text.Len() == 0 && len(b.calls) == 0 && usage == nil {
+		return
 	}
+	appendCLIAssistantTurns(b.ctx, b.eng, b.nodeID, b.text.String(), b.model, usage, b.calls, b.callMap)
+	b.text.Reset()
+	b.calls = nil
 }
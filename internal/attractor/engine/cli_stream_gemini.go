@@ -0,0 +1,80 @@
+// Parses Gemini CLI `--output-format stream-json` output into CXDB turns.
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// geminiStreamEvent is one line of Gemini CLI stream-json output. Fields are
+// populated according to Type (init, message, tool_use, tool_result, result).
+type geminiStreamEvent struct {
+	Type       string          `json:"type"`
+	Model      string          `json:"model,omitempty"`
+	Role       string          `json:"role,omitempty"`
+	Content    string          `json:"content,omitempty"`
+	Delta      bool            `json:"delta,omitempty"`
+	ToolName   string          `json:"tool_name,omitempty"`
+	ToolID     string          `json:"tool_id,omitempty"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	Output     string          `json:"output,omitempty"`
+	Error      *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+	Stats *cliUsage `json:"stats,omitempty"`
+}
+
+func parseGeminiStreamLine(line []byte) (*geminiStreamEvent, error) {
+	var ev geminiStreamEvent
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// parseGeminiOutputStream reads Gemini stream-json events from r and emits
+// CXDB turns. Assistant deltas are joined into one AssistantMessage per
+// stretch of text; tool_use/tool_result events become ToolCall/ToolResult
+// turns. Token stats from the final result event are attached to the last
+// message.
+func parseGeminiOutputStream(ctx context.Context, eng *Engine, nodeID string, r io.Reader) {
+	buf := newCLITurnBuffer(ctx, eng, nodeID)
+	scanCLIStreamLines(r, func(line []byte) {
+		ev, err := parseGeminiStreamLine(line)
+		if err != nil {
+			return
+		}
+		switch ev.Type {
+		case "init":
+			buf.model = ev.Model
+		case "message":
+			if ev.Role != "assistant" {
+				return
+			}
+			sep := "\n"
+			if ev.Delta {
+				sep = ""
+			}
+			buf.addText(ev.Content, sep)
+		case "tool_use":
+			args := string(ev.Parameters)
+			if args == "" {
+				args = "{}"
+			}
+			buf.addCall(cliToolCall{ID: ev.ToolID, Name: ev.ToolName, InputJSON: args})
+		case "tool_result":
+			res := cliToolResult{ToolUseID: ev.ToolID, Content: ev.Output, IsError: ev.Status != "" && ev.Status != "success"}
+			if ev.Error != nil && ev.Error.Message != "" {
+				res.IsError = true
+				res.Content = ev.Error.Message
+			}
+			buf.addResult(res)
+		case "result":
+			buf.flush(ev.Stats)
+		}
+	})
+	buf.flush(nil)
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseGeminiOutputStream_DecomposesEvents(t *testing.T) {
+	srv := newCXDBTestServer(t)
+	eng := newTestEngineWithCXDB(t, srv)
+
+	stream := strings.Join([]string{
+		`{"type":"init","timestamp":"2026-01-01T00:00:00Z","session_id":"s1","model":"gemini-2.5-pro"}`,
+		`{"type":"message","role":"user","content":"fix the README"}`,
+		`{"type":"message","role":"assistant","content":"Let me ","delta":true}`,
+		`{"type":"message","role":"assistant","content":"look.","delta":true}`,
+		`{"type":"tool_use","tool_name":"read_file","tool_id":"read_file-1","parameters":{"file_path":"README.md"}}`,
+		`{"type":"tool_result","tool_id":"read_file-1","status":"success","output":"# Hello"}`,
+		`{"type":"tool_use","tool_name":"run_shell_command","tool_id":"shell-2","parameters":{"command":"false"}}`,
+		`{"type":"tool_result","tool_id":"shell-2","status":"error","error":{"type":"exit","message":"exit status 1"}}`,
+		`{"type":"message","role":"assistant","content":"Done.","delta":true}`,
+		`{"type":"result","status":"success","stats":{"total_tokens":700,"input_tokens":600,"output_tokens":100,"duration_ms":1200,"tool_calls":2}}`,
+	}, "\n")
+	parseGeminiOutputStream(context.Background(), eng, "impl", strings.NewReader(stream))
+
+	turns := srv.Turns(eng.CXDB.ContextID)
+	got := turnSummary(turns)
+	want := []string{
+		"AssistantMessage:Let me look.",
+		"ToolCall:read_file",
+		"ToolResult:read_file:# Hello",
+		"AssistantMessage:[tool_use: run_shell_command]",
+		"ToolCall:run_shell_command",
+		"ToolResult:run_shell_command:exit status 1",
+		"AssistantMessage:Done.",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("turns:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if p := turns[1]["payload"].(map[string]any); p["arguments_json"] != `{"file_path":"README.md"}` {
+		t.Fatalf("tool arguments: %v", p)
+	}
+	if turns[5]["payload"].(map[string]any)["is_error"] != true {
+		t.Fatalf("errored tool should be an error result: %v", turns[5]["payload"])
+	}
+	last := turns[len(turns)-1]["payload"].(map[string]any)
+	if last["model"] != "gemini-2.5-pro" || last["input_tokens"] != float64(600) || last["output_tokens"] != float64(100) {
+		t.Fatalf("final message: %v", last)
+	}
+}
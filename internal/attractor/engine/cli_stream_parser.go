@@ -1,5 +1,6 @@
 // Parses Claude CLI stream-json NDJSON output into structured events
-// for decomposition into individual CXDB turns.
+// for decomposition into individual CXDB turns. Codex and Gemini output
+// have their own parsers in cli_stream_codex.go and cli_stream_gemini.go.
 package engine
 
 import (
@@ -8,8 +9,30 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"sort"
 )
 
+// cliStreamParserFunc decomposes a CLI agent's stdout into CXDB events.
+type cliStreamParserFunc func(ctx context.Context, eng *Engine, nodeID string, r io.Reader)
+
+// cliStreamParsers are the values accepted by llm.providers.<name>.cli.stream_parser.
+// "none" keeps stdout as an artifact without emitting per-turn events.
+var cliStreamParsers = map[string]cliStreamParserFunc{
+	"claude": parseCLIOutputStream,
+	"codex":  parseCodexOutputStream,
+	"gemini": parseGeminiOutputStream,
+	"none":   nil,
+}
+
+func cliStreamParserNames() []string {
+	names := make([]string, 0, len(cliStreamParsers))
+	for name := range cliStreamParsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // cliStreamEvent represents a single NDJSON line from Claude CLI --output-format stream-json.
 type cliStreamEvent struct {
 	Type    string      `json:"type"`
@@ -162,6 +185,18 @@ func extractToolCalls(msg *cliMessage) []cliToolCall {
 // assistant/user message. Designed to run as a goroutine; returns when r is closed.
 func parseCLIOutputStream(ctx context.Context, eng *Engine, nodeID string, r io.Reader) {
 	callMap := map[string]string{}
+	scanCLIStreamLines(r, func(line []byte) {
+		ev, err := parseCLIStreamLine(line)
+		if err != nil || ev == nil {
+			return
+		}
+		emitCXDBCLIStreamEvent(ctx, eng, nodeID, ev, callMap)
+	})
+}
+
+// scanCLIStreamLines calls fn for each non-blank line of r until r is closed.
+// Lines may be large (tool output), so the buffer grows to 4 MiB.
+func scanCLIStreamLines(r io.Reader, fn func(line []byte)) {
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 256*1024), 4*1024*1024)
 	for scanner.Scan() {
@@ -169,15 +204,11 @@ func parseCLIOutputStream(ctx context.Context, eng *Engine, nodeID string, r io.
 		if len(bytes.TrimSpace(line)) == 0 {
 			continue
 		}
-		ev, err := parseCLIStreamLine(line)
-		if err != nil {
-			continue
-		}
-		if ev == nil {
-			continue
-		}
-		emitCXDBCLIStreamEvent(ctx, eng, nodeID, ev, callMap)
+		fn(line)
 	}
+	// Drain anything after an oversized line so the CLI never blocks on a
+	// full pipe.
+	_, _ = io.Copy(io.Discard, r)
 }
 
 // extractToolResults returns all tool_result blocks from a user message.
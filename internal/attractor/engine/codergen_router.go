@@ -24,6 +24,7 @@ import (
 	"github.com/danshapiro/kilroy/internal/llm"
 	"github.com/danshapiro/kilroy/internal/llmclient"
 	"github.com/danshapiro/kilroy/internal/modelmeta"
+	"github.com/danshapiro/kilroy/internal/providerspec"
 )
 
 type CodergenRouter struct {
@@ -36,6 +37,11 @@ type CodergenRouter struct {
 	apiOnce   sync.Once
 	apiClient *llm.Client
 	apiErr    error
+
+	// cassette records or replays API traffic (see RunOptions.RecordLLM/ReplayFrom).
+	cassette *llm.Cassette
+
+	mcp *mcpPool
 }
 
 func NewCodergenRouter(cfg *RunConfigFile, catalog *modeldb.Catalog) *CodergenRouter {
@@ -48,6 +54,7 @@ func NewCodergenRouterWithRuntimes(cfg *RunConfigFile, catalog *modeldb.Catalog,
 		catalog:          catalog,
 		providerRuntimes: cloneProviderRuntimeMap(runtimes),
 		apiClientFactory: newAPIClientFromProviderRuntimes,
+		mcp:              newMCPPool(cfg),
 	}
 }
 
@@ -67,8 +74,6 @@ func cloneProviderRuntimeMap(in map[string]ProviderRuntime) map[string]ProviderR
 }
 
 func (r *CodergenRouter) Run(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
-	_ = r.catalog // used later for context window + pricing metadata
-
 	prov := normalizeProviderKey(node.Attr("llm_provider", ""))
 	if prov == "" {
 		return "", nil, fmt.Errorf("missing llm_provider on node %s", node.ID)
@@ -93,6 +98,13 @@ func (r *CodergenRouter) Run(ctx context.Context, exec *Execution, node *model.N
 	if backend == "" {
 		return "", nil, fmt.Errorf("no backend configured for provider %s", prov)
 	}
+	if exec != nil && exec.Engine != nil {
+		if err := exec.Engine.checkCostBudget(node); err != nil {
+			exec.Engine.noteCostBudgetExceeded(err)
+			return "", nil, err
+		}
+		ctx = withCostScope(ctx, exec, node)
+	}
 
 	// CLI-only model override: models like gpt-5.3-codex-spark have no API
 	// endpoint. Force CLI backend regardless of provider configuration.
@@ -133,6 +145,11 @@ func (r *CodergenRouter) backendForProvider(provider string) BackendKind {
 
 func (r *CodergenRouter) ensureAPIClient() (*llm.Client, error) {
 	r.apiOnce.Do(func() {
+		if r.cassette != nil && r.cassette.Mode == llm.CassetteReplay {
+			r.apiClient = newReplayAPIClient(r.providerRuntimes)
+			r.useMiddleware(r.apiClient)
+			return
+		}
 		if len(r.providerRuntimes) > 0 && r.apiClientFactory != nil {
 			client, err := r.apiClientFactory(r.providerRuntimes)
 			if err != nil {
@@ -140,15 +157,28 @@ func (r *CodergenRouter) ensureAPIClient() (*llm.Client, error) {
 				return
 			}
 			if len(client.ProviderNames()) > 0 {
+				r.useMiddleware(client)
 				r.apiClient = client
 				return
 			}
 		}
 		r.apiClient, r.apiErr = llmclient.NewFromEnv()
+		if r.apiClient != nil {
+			r.useMiddleware(r.apiClient)
+		}
 	})
 	return r.apiClient, r.apiErr
 }
 
+// useMiddleware installs cost tracking outermost so replayed responses still
+// count toward the budget, then the cassette when one is configured.
+func (r *CodergenRouter) useMiddleware(client *llm.Client) {
+	client.Use(costTrackingMiddleware(r.catalog))
+	if r.cassette != nil {
+		client.Use(r.cassette)
+	}
+}
+
 func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *model.Node, provider string, modelID string, prompt string) (string, *runtime.Outcome, error) {
 	client, err := r.ensureAPIClient()
 	if err != nil {
@@ -157,7 +187,9 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 	contract := buildStageStatusContract(execCtx.WorktreeDir)
 	mode := strings.ToLower(strings.TrimSpace(node.Attr("codergen_mode", "")))
 	if mode == "" {
-		mode = "agent_loop" // metaspec default for API backend
+		// metaspec default for API backend is agent_loop; discovered models
+		// without tool calling fall back to one_shot.
+		mode = defaultCodergenMode(r.catalog, r.providerRuntimes[normalizeProviderKey(provider)], modelID)
 	}
 
 	stageDir := filepath.Join(execCtx.LogsRoot, node.ID)
@@ -223,11 +255,18 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 		}
 		overrides := buildAgentLoopOverrides(artifactPolicyFromExecution(execCtx), stageEnv)
 		env := agent.NewLocalExecutionEnvironmentWithPolicy(execCtx.WorktreeDir, overrides, []string{"CLAUDECODE"})
+		mcpTools, err := r.mcp.toolsForNode(ctx, execCtx, node)
+		if err != nil {
+			return "", &runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+		}
+		// fidelity=full: nodes sharing a thread key continue one conversation.
+		threadKey := activeThreadKey(execCtx)
 		text, used, err := r.withFailoverText(ctx, execCtx, node, client, provider, modelID, func(prov string, mid string) (string, error) {
 			var profile agent.ProviderProfile
 			var profileErr error
 			if rt, ok := r.providerRuntimes[normalizeProviderKey(prov)]; ok {
 				profile, profileErr = profileForRuntimeProvider(rt, mid)
+				profile = sizeProfileForDiscoveredModel(profile, r.catalog, rt, mid)
 			} else {
 				profile, profileErr = profileForProvider(prov, mid)
 			}
@@ -262,6 +301,11 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 			if maxCommandTimeoutMS > 0 {
 				sessCfg.MaxCommandTimeoutMS = maxCommandTimeoutMS
 			}
+			compaction, err := resolveAgentLoopCompaction(execCtx, node)
+			if err != nil {
+				return "", err
+			}
+			sessCfg.Compaction = compaction
 			// Give lots of room for transient LLM errors before failing the stage.
 			policy := attractorLLMRetryPolicy(execCtx, node.ID, prov, mid)
 			sessCfg.LLMRetryPolicy = &policy
@@ -270,10 +314,16 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 			sessCfg.ToolCallFilter = func(toolName, callID, argsJSON string) string {
 				return runPreToolHook(ctx, execCtx, node, stageDir, toolName, callID, argsJSON)
 			}
+			sessCfg.ExtraTools = mcpTools
+			sessCfg.InitialHistory = seedThreadTurns(execCtx, node.ID, threadKey, prov, mid)
 			sess, err := agent.NewSession(client, profile, env, sessCfg)
 			if err != nil {
 				return "", err
 			}
+			// Inside a manager_loop child pipeline, let the manager steer this session.
+			if execCtx != nil && execCtx.Engine != nil {
+				defer execCtx.Engine.steering.register(node.ID, sess)()
+			}
 
 			eventsPath := filepath.Join(stageDir, "events.ndjson")
 			eventsJSONPath := filepath.Join(stageDir, "events.json")
@@ -307,6 +357,17 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 					if execCtx != nil && execCtx.Engine != nil {
 						executeToolHookForEvent(ctx, execCtx, node, ev, stageDir)
 					}
+					if ev.Kind == agent.EventContextCompaction && execCtx != nil && execCtx.Engine != nil {
+						execCtx.Engine.appendProgress(map[string]any{
+							"event":                "context_compaction",
+							"node_id":              node.ID,
+							"mode":                 ev.Data["mode"],
+							"trigger":              ev.Data["trigger"],
+							"turns_compacted":      ev.Data["turns_compacted"],
+							"approx_tokens_before": ev.Data["approx_tokens_before"],
+							"approx_tokens_after":  ev.Data["approx_tokens_after"],
+						})
+					}
 					eventsMu.Lock()
 					events = append(events, ev)
 					eventsMu.Unlock()
@@ -366,6 +427,7 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 			if runErr != nil {
 				return text, runErr
 			}
+			persistThreadTurns(execCtx, node.ID, threadKey, prov, mid, sess.History())
 			return text, nil
 		})
 		if err != nil {
@@ -532,6 +594,9 @@ func shouldFailoverLLMError(err error) bool {
 	if errors.Is(err, agent.ErrTurnLimit) {
 		return false
 	}
+	if isCostBudgetError(err) {
+		return false
+	}
 	if strings.Contains(strings.ToLower(err.Error()), "turn limit reached") {
 		return false
 	}
@@ -879,6 +944,34 @@ func resolveAgentLoopCommandTimeouts(execCtx *Execution, node *model.Node) (int,
 	return defaultCommandTimeoutMS, maxCommandTimeoutMS
 }
 
+// resolveAgentLoopCompaction reads context_compaction,
+// context_compaction_threshold and context_compaction_keep_turns from the node,
+// falling back to graph attributes of the same name.
+func resolveAgentLoopCompaction(execCtx *Execution, node *model.Node) (agent.CompactionPolicy, error) {
+	graphAttr := func(key string) string {
+		if execCtx == nil || execCtx.Graph == nil {
+			return ""
+		}
+		return execCtx.Graph.Attrs[key]
+	}
+	raw := strings.TrimSpace(node.Attr("context_compaction", ""))
+	if raw == "" {
+		raw = strings.TrimSpace(graphAttr("context_compaction"))
+	}
+	mode, err := agent.ParseCompactionMode(raw)
+	if err != nil {
+		return agent.CompactionPolicy{}, err
+	}
+	policy := agent.CompactionPolicy{Mode: mode}
+	if policy.ThresholdPercent = parsePositiveIntAttr(node, "context_compaction_threshold"); policy.ThresholdPercent == 0 {
+		policy.ThresholdPercent = parseInt(graphAttr("context_compaction_threshold"), 0)
+	}
+	if policy.KeepRecentTurns = parsePositiveIntAttr(node, "context_compaction_keep_turns"); policy.KeepRecentTurns == 0 {
+		policy.KeepRecentTurns = parseInt(graphAttr("context_compaction_keep_turns"), 0)
+	}
+	return policy, nil
+}
+
 func parsePositiveIntAttr(node *model.Node, key string) int {
 	if node == nil {
 		return 0
@@ -944,6 +1037,8 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 		stageEnv[k] = v
 	}
 	providerKey := normalizeProviderKey(provider)
+	spec := cliSpecForProvider(r.cfg, provider)
+	customContract := providerCLIConfigFor(r.cfg, provider) != nil
 	stderrPath := filepath.Join(stageDir, toolStderrFileName)
 	readStderr := func() string {
 		b, err := os.ReadFile(stderrPath)
@@ -953,7 +1048,7 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 		return string(b)
 	}
 	classifiedFailure := func(runErr error, stderr string) *runtime.Outcome {
-		c := classifyProviderCLIError(providerKey, stderr, runErr)
+		c := classifyProviderCLIErrorWithSpec(providerKey, spec, stderr, runErr)
 		return &runtime.Outcome{
 			Status:        runtime.StatusFail,
 			FailureReason: c.FailureReason,
@@ -970,7 +1065,7 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 		return "", classifiedFailure(err, ""), nil
 	}
 
-	defaultExe, args := defaultCLIInvocation(provider, modelID, execCtx.WorktreeDir)
+	defaultExe, args := cliInvocationFromSpec(spec, provider, modelID, execCtx.WorktreeDir, customContract)
 	if defaultExe == "" {
 		return "", classifiedFailure(fmt.Errorf("no cli invocation mapping for provider %s", provider), ""), nil
 	}
@@ -1023,12 +1118,18 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 	actualArgs := args
 	recordedArgs := args
 	promptMode := "stdin"
-	switch normalizeProviderKey(provider) {
-	case "anthropic", "google":
+	if spec.PromptMode == "arg" {
 		promptMode = "arg"
-		actualArgs = insertPromptArg(args, prompt)
-		recordedArgs = insertPromptArg(args, "<prompt>")
+		if customContract {
+			actualArgs = substitutePromptArg(args, prompt)
+			recordedArgs = substitutePromptArg(args, "<prompt>")
+		} else {
+			actualArgs = insertPromptArg(args, prompt)
+			recordedArgs = insertPromptArg(args, "<prompt>")
+		}
 	}
+	streamParser := cliStreamParserFor(r.cfg, provider, codexSemantics)
+	idleTimeout := cliIdleTimeoutFor(r.cfg, provider, codexSemantics)
 
 	inv := map[string]any{
 		"provider":     provider,
@@ -1039,6 +1140,11 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 		"prompt_mode":  promptMode,
 		"prompt_bytes": len(prompt),
 	}
+	if customContract {
+		inv["cli_contract"] = "config"
+		inv["stream_parser"] = streamParser
+		inv["idle_timeout_seconds"] = int(idleTimeout.Seconds())
+	}
 	// Metaspec: capture how env was populated so the invocation is replayable.
 	if codexSemantics {
 		inv["env_mode"] = "isolated"
@@ -1102,6 +1208,10 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 		} else {
 			scrubbed := scrubConflictingProviderEnvKeys(baseEnv, providerKey)
 			cmd.Env = mergeEnvWithOverrides(scrubbed, stageEnv)
+			if customContract {
+				// Let the idle watchdog reap the agent's whole process tree.
+				setProcessGroupAttr(cmd)
+			}
 		}
 		if promptMode == "stdin" {
 			cmd.Stdin = strings.NewReader(prompt)
@@ -1123,13 +1233,13 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 		// turns into individual CXDB events in real time.
 		var streamPW *io.PipeWriter
 		var streamDone chan struct{}
-		if !codexSemantics && execCtx != nil && execCtx.Engine != nil && execCtx.Engine.CXDB != nil {
+		if parse := cliStreamParsers[streamParser]; parse != nil && execCtx != nil && execCtx.Engine != nil && execCtx.Engine.CXDB != nil {
 			pr, pw := io.Pipe()
 			streamPW = pw
 			streamDone = make(chan struct{})
 			go func() {
 				defer close(streamDone)
-				parseCLIOutputStream(ctx, execCtx.Engine, node.ID, pr)
+				parse(ctx, execCtx.Engine, node.ID, pr)
 			}()
 			cmd.Stdout = io.MultiWriter(stdoutFile, pw)
 		} else {
@@ -1185,10 +1295,8 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 			}
 		}()
 
-		idleTimeout := time.Duration(0)
 		killGrace := time.Duration(0)
-		if codexSemantics {
-			idleTimeout = codexIdleTimeout()
+		if idleTimeout > 0 {
 			killGrace = codexKillGrace()
 		}
 		var idleTimedOut bool
@@ -1376,6 +1484,13 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 	} else {
 		outStr = string(outBytes)
 	}
+	if execCtx != nil && execCtx.Engine != nil {
+		if c, ok := cliReportedCost(outStr); ok {
+			execCtx.Engine.recordCost(node.ID, c)
+		} else {
+			execCtx.Engine.recordCost(node.ID, runtime.CostSummary{Calls: 1, UnpricedCalls: 1})
+		}
+	}
 	if runErr != nil {
 		// Codex CLI reports stream disconnects as a generic "exit status 1", but
 		// the actual disconnect evidence appears in stdout's NDJSON event stream
@@ -1879,6 +1994,20 @@ func emitCXDBToolTurns(ctx context.Context, eng *Engine, nodeID string, ev agent
 		}); err != nil {
 			eng.Warn(fmt.Sprintf("cxdb append ToolResult failed (node=%s tool=%s call_id=%s): %v", nodeID, toolName, callID, err))
 		}
+	case agent.EventContextCompaction:
+		if _, _, err := eng.CXDB.Append(ctx, "com.kilroy.attractor.ContextCompacted", 1, map[string]any{
+			"run_id":               runID,
+			"node_id":              nodeID,
+			"timestamp_ms":         nowMS(),
+			"mode":                 fmt.Sprint(ev.Data["mode"]),
+			"trigger":              fmt.Sprint(ev.Data["trigger"]),
+			"turns_compacted":      ev.Data["turns_compacted"],
+			"approx_tokens_before": ev.Data["approx_tokens_before"],
+			"approx_tokens_after":  ev.Data["approx_tokens_after"],
+			"context_window_size":  ev.Data["context_window_size"],
+		}); err != nil {
+			eng.Warn(fmt.Sprintf("cxdb append ContextCompacted failed (node=%s): %v", nodeID, err))
+		}
 	}
 }
 
@@ -1891,7 +2020,13 @@ func usesCodexCLISemantics(providerKey string, exe string) bool {
 }
 
 func defaultCLIInvocation(provider string, modelID string, worktreeDir string) (exe string, args []string) {
-	spec := defaultCLISpecForProvider(provider)
+	return cliInvocationFromSpec(defaultCLISpecForProvider(provider), provider, modelID, worktreeDir, false)
+}
+
+// cliInvocationFromSpec materializes spec for one stage. User-defined
+// contracts keep a literal {{prompt}} token for substitutePromptArg, since
+// they place the prompt where their template says rather than after -p.
+func cliInvocationFromSpec(spec *providerspec.CLISpec, provider string, modelID string, worktreeDir string, custom bool) (exe string, args []string) {
 	if spec == nil {
 		return "", nil
 	}
@@ -1899,10 +2034,35 @@ func defaultCLIInvocation(provider string, modelID string, worktreeDir string) (
 	// by this provider's CLI binary: strip "provider/" prefix and (for
 	// anthropic) convert digit.digit version separators to digit-digit.
 	modelID = modelmeta.NativeModelID(normalizeProviderKey(provider), modelID)
-	exe, args = materializeCLIInvocation(*spec, modelID, worktreeDir, "")
+	prompt := ""
+	if custom {
+		prompt = "{{prompt}}"
+	}
+	exe, args = materializeCLIInvocation(*spec, modelID, worktreeDir, prompt)
 	return exe, args
 }
 
+// substitutePromptArg replaces the {{prompt}} token with prompt, appending
+// the prompt when the template has no token.
+func substitutePromptArg(args []string, prompt string) []string {
+	out := make([]string, 0, len(args)+1)
+	placed := false
+	for _, a := range args {
+		if a == "{{prompt}}" {
+			if !placed {
+				out = append(out, prompt)
+				placed = true
+			}
+			continue
+		}
+		out = append(out, a)
+	}
+	if !placed {
+		out = append(out, prompt)
+	}
+	return out
+}
+
 func hasArg(args []string, want string) bool {
 	for _, a := range args {
 		if a == want {
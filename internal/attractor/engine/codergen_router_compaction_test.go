@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+func TestResolveAgentLoopCompaction_NodeAttrsOverrideGraph(t *testing.T) {
+	g := model.NewGraph("g")
+	g.Attrs["context_compaction"] = "elide"
+	g.Attrs["context_compaction_threshold"] = "60"
+	g.Attrs["context_compaction_keep_turns"] = "10"
+	node := model.NewNode("n")
+	node.Attrs["context_compaction"] = "summarize"
+	node.Attrs["context_compaction_keep_turns"] = "30"
+
+	got, err := resolveAgentLoopCompaction(&Execution{Graph: g}, node)
+	if err != nil {
+		t.Fatalf("resolveAgentLoopCompaction: %v", err)
+	}
+	want := agent.CompactionPolicy{Mode: agent.CompactionSummarize, ThresholdPercent: 60, KeepRecentTurns: 30}
+	if got != want {
+		t.Fatalf("policy=%+v want %+v", got, want)
+	}
+}
+
+func TestResolveAgentLoopCompaction_DefaultsOffAndRejectsUnknownMode(t *testing.T) {
+	got, err := resolveAgentLoopCompaction(&Execution{Graph: model.NewGraph("g")}, model.NewNode("n"))
+	if err != nil || got.Mode != agent.CompactionOff {
+		t.Fatalf("policy=%+v err=%v; want compaction off", got, err)
+	}
+	node := model.NewNode("n")
+	node.Attrs["context_compaction"] = "truncate"
+	if _, err := resolveAgentLoopCompaction(&Execution{}, node); err == nil {
+		t.Fatalf("expected error for unknown context_compaction")
+	}
+}
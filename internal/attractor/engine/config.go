@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/danshapiro/kilroy/internal/providerspec"
@@ -14,6 +16,9 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// mcpServerNameRE keeps server names usable inside tool names (mcp__<server>__<tool>).
+var mcpServerNameRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
 type BackendKind string
 
 const (
@@ -29,6 +34,10 @@ type ProviderAPIConfig struct {
 	ProviderOptionsKey string            `json:"provider_options_key,omitempty" yaml:"provider_options_key,omitempty"`
 	ProfileFamily      string            `json:"profile_family,omitempty" yaml:"profile_family,omitempty"`
 	Headers            map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// APIVersion and Deployments apply to protocol azure_openai: the
+	// api-version query parameter and a model id -> deployment name map.
+	APIVersion  string            `json:"api_version,omitempty" yaml:"api_version,omitempty"`
+	Deployments map[string]string `json:"deployments,omitempty" yaml:"deployments,omitempty"`
 }
 
 type ProviderConfig struct {
@@ -36,6 +45,25 @@ type ProviderConfig struct {
 	Executable string            `json:"executable,omitempty" yaml:"executable,omitempty"`
 	API        ProviderAPIConfig `json:"api,omitempty" yaml:"api,omitempty"`
 	Failover   []string          `json:"failover,omitempty" yaml:"failover,omitempty"`
+	// CLI declares the CLI agent contract for backend=cli. It is required for
+	// providers without a builtin contract and replaces the builtin otherwise.
+	CLI *ProviderCLIConfig `json:"cli,omitempty" yaml:"cli,omitempty"`
+}
+
+// ProviderCLIConfig is a user-defined CLI agent contract. Args is the
+// invocation template; {{model}}, {{worktree}} and {{prompt}} are substituted
+// per stage.
+type ProviderCLIConfig struct {
+	Executable      string     `json:"executable" yaml:"executable"`
+	Args            []string   `json:"args,omitempty" yaml:"args,omitempty"`
+	PromptMode      string     `json:"prompt_mode,omitempty" yaml:"prompt_mode,omitempty"` // stdin (default) | arg
+	HelpProbeArgs   []string   `json:"help_probe_args,omitempty" yaml:"help_probe_args,omitempty"`
+	CapabilityAll   []string   `json:"capability_all,omitempty" yaml:"capability_all,omitempty"`
+	CapabilityAnyOf [][]string `json:"capability_any_of,omitempty" yaml:"capability_any_of,omitempty"`
+	StreamParser    string     `json:"stream_parser,omitempty" yaml:"stream_parser,omitempty"` // none (default) | claude | codex | gemini
+	// IdleTimeoutMS kills the agent after this long without stdout/stderr
+	// output. Unset uses the codex default (5m); 0 disables the watchdog.
+	IdleTimeoutMS *int `json:"idle_timeout_ms,omitempty" yaml:"idle_timeout_ms,omitempty"`
 }
 
 type RuntimePolicyConfig struct {
@@ -43,6 +71,8 @@ type RuntimePolicyConfig struct {
 	StallTimeoutMS       *int `json:"stall_timeout_ms,omitempty" yaml:"stall_timeout_ms,omitempty"`
 	StallCheckIntervalMS *int `json:"stall_check_interval_ms,omitempty" yaml:"stall_check_interval_ms,omitempty"`
 	MaxLLMRetries        *int `json:"max_llm_retries,omitempty" yaml:"max_llm_retries,omitempty"`
+	// MaxCostUSD caps total LLM spend for the run. Unset or 0 disables the budget.
+	MaxCostUSD *float64 `json:"max_cost_usd,omitempty" yaml:"max_cost_usd,omitempty"`
 }
 
 type PromptProbeConfig struct {
@@ -72,6 +102,31 @@ type InputConfig struct {
 	Materialize InputMaterializationConfig `json:"materialize,omitempty" yaml:"materialize,omitempty"`
 }
 
+type FidelitySummaryConfig struct {
+	Enabled     *bool  `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	LLMProvider string `json:"llm_provider,omitempty" yaml:"llm_provider,omitempty"`
+	LLMModel    string `json:"llm_model,omitempty" yaml:"llm_model,omitempty"`
+}
+
+type FidelityConfig struct {
+	Summary FidelitySummaryConfig `json:"summary,omitempty" yaml:"summary,omitempty"`
+}
+
+// MCPServerConfig declares one MCP tool server: a stdio command or an HTTP URL.
+// Values in env and headers are expanded against the process environment.
+type MCPServerConfig struct {
+	Command   []string          `json:"command,omitempty" yaml:"command,omitempty"`
+	Env       map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Dir       string            `json:"dir,omitempty" yaml:"dir,omitempty"`
+	URL       string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	TimeoutMS int               `json:"timeout_ms,omitempty" yaml:"timeout_ms,omitempty"`
+}
+
+type MCPConfig struct {
+	Servers map[string]MCPServerConfig `json:"servers,omitempty" yaml:"servers,omitempty"`
+}
+
 type RunConfigFile struct {
 	Version int `json:"version" yaml:"version"`
 	// Graph and Task are optional operator metadata fields used by wrappers/UI.
@@ -129,6 +184,8 @@ type RunConfigFile struct {
 	RuntimePolicy RuntimePolicyConfig `json:"runtime_policy,omitempty" yaml:"runtime_policy,omitempty"`
 	Preflight     PreflightConfig     `json:"preflight,omitempty" yaml:"preflight,omitempty"`
 	Inputs        InputConfig         `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Fidelity      FidelityConfig      `json:"fidelity,omitempty" yaml:"fidelity,omitempty"`
+	MCP           MCPConfig           `json:"mcp,omitempty" yaml:"mcp,omitempty"`
 }
 
 func LoadRunConfigFile(path string) (*RunConfigFile, error) {
@@ -286,6 +343,20 @@ func applyConfigDefaults(cfg *RunConfigFile) {
 	if len(cfg.Inputs.Materialize.DefaultInclude) == 0 {
 		cfg.Inputs.Materialize.DefaultInclude = []string{".ai/*.md"}
 	}
+	cfg.Fidelity.Summary.LLMProvider = strings.TrimSpace(cfg.Fidelity.Summary.LLMProvider)
+	cfg.Fidelity.Summary.LLMModel = strings.TrimSpace(cfg.Fidelity.Summary.LLMModel)
+	if cfg.Fidelity.Summary.Enabled == nil {
+		v := false
+		cfg.Fidelity.Summary.Enabled = &v
+	}
+	for name, sc := range cfg.MCP.Servers {
+		sc.Command = trimNonEmpty(sc.Command)
+		sc.URL = strings.TrimSpace(sc.URL)
+		if sc.TimeoutMS == 0 {
+			sc.TimeoutMS = 60000
+		}
+		cfg.MCP.Servers[name] = sc
+	}
 }
 
 func validateConfig(cfg *RunConfigFile) error {
@@ -341,8 +412,8 @@ func validateConfig(cfg *RunConfigFile) error {
 				return fmt.Errorf("llm.providers.%s.api.protocol is required for api backend", prov)
 			}
 		case BackendCLI:
-			if !hasBuiltin || builtin.CLI == nil {
-				return fmt.Errorf("llm.providers.%s backend=cli requires builtin provider with cli contract", prov)
+			if pc.CLI == nil && (!hasBuiltin || builtin.CLI == nil) {
+				return fmt.Errorf("llm.providers.%s backend=cli requires a builtin cli contract or an llm.providers.%s.cli block", prov, prov)
 			}
 		default:
 			return fmt.Errorf("invalid backend for provider %q: %q (want api|cli)", prov, pc.Backend)
@@ -350,6 +421,11 @@ func validateConfig(cfg *RunConfigFile) error {
 		if strings.EqualFold(cfg.LLM.CLIProfile, "real") && strings.TrimSpace(pc.Executable) != "" {
 			return fmt.Errorf("llm.providers.%s.executable is only allowed when llm.cli_profile=test_shim", prov)
 		}
+		if pc.CLI != nil {
+			if err := validateProviderCLIConfig(prov, pc.CLI); err != nil {
+				return err
+			}
+		}
 	}
 	if cfg.RuntimePolicy.StageTimeoutMS != nil && *cfg.RuntimePolicy.StageTimeoutMS < 0 {
 		return fmt.Errorf("runtime_policy.stage_timeout_ms must be >= 0")
@@ -363,6 +439,9 @@ func validateConfig(cfg *RunConfigFile) error {
 	if cfg.RuntimePolicy.MaxLLMRetries != nil && *cfg.RuntimePolicy.MaxLLMRetries < 0 {
 		return fmt.Errorf("runtime_policy.max_llm_retries must be >= 0")
 	}
+	if cfg.RuntimePolicy.MaxCostUSD != nil && *cfg.RuntimePolicy.MaxCostUSD < 0 {
+		return fmt.Errorf("runtime_policy.max_cost_usd must be >= 0")
+	}
 	if cfg.RuntimePolicy.StallTimeoutMS != nil && cfg.RuntimePolicy.StallCheckIntervalMS != nil {
 		if *cfg.RuntimePolicy.StallTimeoutMS > 0 && *cfg.RuntimePolicy.StallCheckIntervalMS == 0 {
 			return fmt.Errorf("runtime_policy.stall_check_interval_ms must be > 0 when stall_timeout_ms > 0")
@@ -404,6 +483,69 @@ func validateConfig(cfg *RunConfigFile) error {
 			return fmt.Errorf("inputs.materialize.llm_model is required when inputs.materialize.infer_with_llm=true")
 		}
 	}
+	if cfg.Fidelity.Summary.Enabled != nil && *cfg.Fidelity.Summary.Enabled {
+		if strings.TrimSpace(cfg.Fidelity.Summary.LLMProvider) == "" {
+			return fmt.Errorf("fidelity.summary.llm_provider is required when fidelity.summary.enabled=true")
+		}
+		if strings.TrimSpace(cfg.Fidelity.Summary.LLMModel) == "" {
+			return fmt.Errorf("fidelity.summary.llm_model is required when fidelity.summary.enabled=true")
+		}
+	}
+	for name, sc := range cfg.MCP.Servers {
+		if !mcpServerNameRE.MatchString(name) {
+			return fmt.Errorf("invalid mcp server name %q (want letters, digits and _, starting with a letter)", name)
+		}
+		switch {
+		case len(sc.Command) > 0 && sc.URL != "":
+			return fmt.Errorf("mcp.servers.%s: set command or url, not both", name)
+		case len(sc.Command) == 0 && sc.URL == "":
+			return fmt.Errorf("mcp.servers.%s: command or url is required", name)
+		case sc.URL != "":
+			u, err := url.Parse(sc.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("mcp.servers.%s.url must be an http(s) URL: %q", name, sc.URL)
+			}
+		}
+		if sc.TimeoutMS < 0 {
+			return fmt.Errorf("mcp.servers.%s.timeout_ms must be >= 0", name)
+		}
+	}
+	return nil
+}
+
+func validateProviderCLIConfig(prov string, c *ProviderCLIConfig) error {
+	if strings.TrimSpace(c.Executable) == "" {
+		return fmt.Errorf("llm.providers.%s.cli.executable is required", prov)
+	}
+	mode := strings.ToLower(strings.TrimSpace(c.PromptMode))
+	switch mode {
+	case "", "stdin", "arg":
+		// ok
+	default:
+		return fmt.Errorf("invalid llm.providers.%s.cli.prompt_mode: %q (want stdin|arg)", prov, c.PromptMode)
+	}
+	hasPromptToken := false
+	for _, a := range c.Args {
+		if a == "{{prompt}}" {
+			hasPromptToken = true
+		}
+	}
+	if hasPromptToken && mode != "arg" {
+		return fmt.Errorf("llm.providers.%s.cli.args uses {{prompt}} but prompt_mode is not arg", prov)
+	}
+	if p := strings.ToLower(strings.TrimSpace(c.StreamParser)); p != "" {
+		if _, ok := cliStreamParsers[p]; !ok {
+			return fmt.Errorf("invalid llm.providers.%s.cli.stream_parser: %q (want %s)", prov, c.StreamParser, strings.Join(cliStreamParserNames(), "|"))
+		}
+	}
+	for _, set := range c.CapabilityAnyOf {
+		if len(set) == 0 {
+			return fmt.Errorf("llm.providers.%s.cli.capability_any_of entries must not be empty", prov)
+		}
+	}
+	if c.IdleTimeoutMS != nil && *c.IdleTimeoutMS < 0 {
+		return fmt.Errorf("llm.providers.%s.cli.idle_timeout_ms must be >= 0", prov)
+	}
 	return nil
 }
 
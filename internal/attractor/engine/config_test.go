@@ -692,3 +692,188 @@ preflight:
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestLoadRunConfigFile_FidelitySummaryConfig(t *testing.T) {
+	base := `
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+llm:
+  providers:
+    openai:
+      backend: api
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+`
+	t.Run("defaults_disabled", func(t *testing.T) {
+		cfg, err := loadRunConfigFromBytesForTest(t, []byte(base))
+		if err != nil {
+			t.Fatalf("LoadRunConfigFile: %v", err)
+		}
+		if cfg.Fidelity.Summary.Enabled == nil || *cfg.Fidelity.Summary.Enabled {
+			t.Fatal("fidelity.summary.enabled default: expected false")
+		}
+	})
+	t.Run("enabled", func(t *testing.T) {
+		cfg, err := loadRunConfigFromBytesForTest(t, []byte(base+`
+fidelity:
+  summary:
+    enabled: true
+    llm_provider: openai
+    llm_model: gpt-5-mini
+`))
+		if err != nil {
+			t.Fatalf("LoadRunConfigFile: %v", err)
+		}
+		s := cfg.Fidelity.Summary
+		if s.Enabled == nil || !*s.Enabled || s.LLMProvider != "openai" || s.LLMModel != "gpt-5-mini" {
+			t.Fatalf("fidelity.summary: %+v", s)
+		}
+	})
+	t.Run("enabled_requires_model", func(t *testing.T) {
+		_, err := loadRunConfigFromBytesForTest(t, []byte(base+`
+fidelity:
+  summary:
+    enabled: true
+    llm_provider: openai
+`))
+		if err == nil || !strings.Contains(err.Error(), "fidelity.summary.llm_model") {
+			t.Fatalf("expected llm_model validation error, got: %v", err)
+		}
+	})
+}
+
+func TestLoadRunConfigFile_RuntimePolicyMaxCostUSD(t *testing.T) {
+	base := `
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+llm:
+  providers:
+    openai:
+      backend: api
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+`
+	cfg, err := loadRunConfigFromBytesForTest(t, []byte(base+`
+runtime_policy:
+  max_cost_usd: 12.5
+`))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	if cfg.RuntimePolicy.MaxCostUSD == nil || *cfg.RuntimePolicy.MaxCostUSD != 12.5 {
+		t.Fatalf("runtime_policy.max_cost_usd: %v", cfg.RuntimePolicy.MaxCostUSD)
+	}
+	if _, err := loadRunConfigFromBytesForTest(t, []byte(base+`
+runtime_policy:
+  max_cost_usd: -1
+`)); err == nil || !strings.Contains(err.Error(), "max_cost_usd") {
+		t.Fatalf("expected max_cost_usd validation error, got %v", err)
+	}
+}
+
+func TestLoadRunConfigFile_MCPServers(t *testing.T) {
+	base := `
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+llm:
+  providers:
+    openai:
+      backend: api
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+`
+	cfg, err := loadRunConfigFromBytesForTest(t, []byte(base+`
+mcp:
+  servers:
+    tickets:
+      command: ["tickets-mcp", "--stdio"]
+      env:
+        TICKETS_TOKEN: ${TICKETS_TOKEN}
+    docs:
+      url: http://127.0.0.1:7777/mcp
+      timeout_ms: 5000
+`))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	if got := cfg.MCP.Servers["tickets"]; len(got.Command) != 2 || got.TimeoutMS != 60000 {
+		t.Fatalf("tickets: %+v", got)
+	}
+	if got := cfg.MCP.Servers["docs"]; got.URL != "http://127.0.0.1:7777/mcp" || got.TimeoutMS != 5000 {
+		t.Fatalf("docs: %+v", got)
+	}
+
+	for _, tc := range []struct{ yaml, want string }{
+		{"mcp:\n  servers:\n    x:\n      url: http://h/mcp\n      command: [\"a\"]\n", "not both"},
+		{"mcp:\n  servers:\n    x: {}\n", "command or url is required"},
+		{"mcp:\n  servers:\n    x:\n      url: ftp://h/mcp\n", "http(s) URL"},
+		{"mcp:\n  servers:\n    bad-name:\n      url: http://h/mcp\n", "invalid mcp server name"},
+	} {
+		if _, err := loadRunConfigFromBytesForTest(t, []byte(base+tc.yaml)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%q: expected %q error, got %v", tc.yaml, tc.want, err)
+		}
+	}
+}
+
+func TestLoadRunConfigFile_CustomCLIContract(t *testing.T) {
+	base := `
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+llm:
+  providers:
+`
+	cfg, err := loadRunConfigFromBytesForTest(t, []byte(base+`
+    aider:
+      backend: cli
+      cli:
+        executable: aider
+        args: ["--yes-always", "--model", "{{model}}", "--message", "{{prompt}}"]
+        prompt_mode: arg
+        help_probe_args: ["--help"]
+        capability_all: ["--message"]
+        stream_parser: none
+        idle_timeout_ms: 120000
+`))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	rts, err := resolveProviderRuntimes(cfg)
+	if err != nil {
+		t.Fatalf("resolveProviderRuntimes: %v", err)
+	}
+	rt := rts["aider"]
+	if rt.Backend != BackendCLI || rt.CLI == nil || rt.CLI.DefaultExecutable != "aider" || rt.CLI.PromptMode != "arg" || len(rt.CLI.InvocationTemplate) != 5 {
+		t.Fatalf("aider runtime: %+v cli=%+v", rt, rt.CLI)
+	}
+
+	for _, tc := range []struct{ yaml, want string }{
+		{"    aider:\n      backend: cli\n", "requires a builtin cli contract or an llm.providers.aider.cli block"},
+		{"    aider:\n      backend: cli\n      cli:\n        args: [\"run\"]\n", "cli.executable is required"},
+		{"    aider:\n      backend: cli\n      cli:\n        executable: aider\n        prompt_mode: file\n", "want stdin|arg"},
+		{"    aider:\n      backend: cli\n      cli:\n        executable: aider\n        args: [\"{{prompt}}\"]\n", "prompt_mode is not arg"},
+		{"    aider:\n      backend: cli\n      cli:\n        executable: aider\n        stream_parser: xml\n", "invalid llm.providers.aider.cli.stream_parser"},
+		{"    aider:\n      backend: cli\n      cli:\n        executable: aider\n        idle_timeout_ms: -1\n", "idle_timeout_ms must be >= 0"},
+	} {
+		if _, err := loadRunConfigFromBytesForTest(t, []byte(base+tc.yaml)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%q: expected %q error, got %v", tc.yaml, tc.want, err)
+		}
+	}
+}
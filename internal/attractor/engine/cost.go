@@ -0,0 +1,340 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// costLedger totals LLM spend for a run. It is shared by parallel branch
+// engines and survives loop restarts; on resume it is reloaded from cost.json.
+type costLedger struct {
+	path string // {base_logs_root}/cost.json
+
+	mu       sync.Mutex
+	run      runtime.CostSummary
+	nodes    map[string]runtime.CostSummary // cumulative per node across visits
+	attempts map[string]runtime.CostSummary // current attempt per node
+}
+
+// costLedgerDoc is persisted to {base_logs_root}/cost.json.
+type costLedgerDoc struct {
+	Run       runtime.CostSummary            `json:"run"`
+	Nodes     map[string]runtime.CostSummary `json:"nodes,omitempty"`
+	UpdatedAt time.Time                      `json:"updated_at"`
+}
+
+func newCostLedger(logsRoot string) *costLedger {
+	return &costLedger{
+		path:     costLedgerPath(logsRoot),
+		nodes:    map[string]runtime.CostSummary{},
+		attempts: map[string]runtime.CostSummary{},
+	}
+}
+
+func costLedgerPath(logsRoot string) string {
+	if strings.TrimSpace(logsRoot) == "" {
+		return ""
+	}
+	return filepath.Join(logsRoot, "cost.json")
+}
+
+// loadCostLedger restores a ledger from cost.json, or returns an empty one.
+func loadCostLedger(logsRoot string) *costLedger {
+	l := newCostLedger(logsRoot)
+	b, err := os.ReadFile(l.path)
+	if err != nil {
+		return l
+	}
+	var doc costLedgerDoc
+	if json.Unmarshal(b, &doc) != nil {
+		return l
+	}
+	l.run = doc.Run
+	for k, v := range doc.Nodes {
+		l.nodes[k] = v
+	}
+	return l
+}
+
+func (l *costLedger) save() error {
+	if l == nil || strings.TrimSpace(l.path) == "" {
+		return nil
+	}
+	l.mu.Lock()
+	doc := costLedgerDoc{Run: l.run, Nodes: make(map[string]runtime.CostSummary, len(l.nodes)), UpdatedAt: time.Now().UTC()}
+	for k, v := range l.nodes {
+		doc.Nodes[k] = v
+	}
+	l.mu.Unlock()
+	return writeJSON(l.path, doc)
+}
+
+func (l *costLedger) beginAttempt(nodeID string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	delete(l.attempts, nodeID)
+	l.mu.Unlock()
+}
+
+func (l *costLedger) record(nodeID string, delta runtime.CostSummary) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.run = l.run.Add(delta)
+	l.nodes[nodeID] = l.nodes[nodeID].Add(delta)
+	l.attempts[nodeID] = l.attempts[nodeID].Add(delta)
+	l.mu.Unlock()
+}
+
+func (l *costLedger) runTotal() runtime.CostSummary {
+	if l == nil {
+		return runtime.CostSummary{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.run
+}
+
+func (l *costLedger) attempt(nodeID string) (runtime.CostSummary, bool) {
+	if l == nil {
+		return runtime.CostSummary{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.attempts[nodeID]
+	return c, ok
+}
+
+// costBudgetError is returned instead of making an LLM call once a budget is
+// spent. It is a non-retryable llm.Error so retries and failover stop too.
+type costBudgetError struct {
+	Scope    string // "run" or "node"
+	NodeID   string
+	SpentUSD float64
+	LimitUSD float64
+}
+
+func (e *costBudgetError) Error() string {
+	if e.Scope == "node" {
+		return fmt.Sprintf("cost budget exceeded: node %s spent $%.4f of max_cost_usd $%.4f", e.NodeID, e.SpentUSD, e.LimitUSD)
+	}
+	return fmt.Sprintf("cost budget exceeded: run spent $%.4f of runtime_policy.max_cost_usd $%.4f", e.SpentUSD, e.LimitUSD)
+}
+func (e *costBudgetError) Provider() string           { return "" }
+func (e *costBudgetError) StatusCode() int            { return 0 }
+func (e *costBudgetError) Retryable() bool            { return false }
+func (e *costBudgetError) RetryAfter() *time.Duration { return nil }
+
+func isCostBudgetError(err error) bool {
+	var cbe *costBudgetError
+	return errors.As(err, &cbe)
+}
+
+func nodeMaxCostUSD(node *model.Node) float64 {
+	if node == nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(node.Attr("max_cost_usd", "")), 64)
+	if err != nil || v <= 0 {
+		return 0
+	}
+	return v
+}
+
+// checkRunCostBudget reports whether the run-wide budget is spent.
+func (e *Engine) checkRunCostBudget() error {
+	if e == nil || e.Options.MaxCostUSD <= 0 {
+		return nil
+	}
+	if spent := e.costs.runTotal().USD; spent >= e.Options.MaxCostUSD {
+		return &costBudgetError{Scope: "run", SpentUSD: spent, LimitUSD: e.Options.MaxCostUSD}
+	}
+	return nil
+}
+
+// checkCostBudget reports whether the run budget or the node's per-attempt
+// max_cost_usd budget is spent.
+func (e *Engine) checkCostBudget(node *model.Node) error {
+	if err := e.checkRunCostBudget(); err != nil {
+		return err
+	}
+	if e == nil || node == nil {
+		return nil
+	}
+	limit := nodeMaxCostUSD(node)
+	if limit <= 0 {
+		return nil
+	}
+	spent, _ := e.costs.attempt(node.ID)
+	if spent.USD >= limit {
+		return &costBudgetError{Scope: "node", NodeID: node.ID, SpentUSD: spent.USD, LimitUSD: limit}
+	}
+	return nil
+}
+
+func (e *Engine) recordCost(nodeID string, delta runtime.CostSummary) {
+	if e == nil || e.costs == nil {
+		return
+	}
+	e.costs.record(nodeID, delta)
+}
+
+func (e *Engine) noteCostBudgetExceeded(err error) {
+	var cbe *costBudgetError
+	if e == nil || !errors.As(err, &cbe) {
+		return
+	}
+	e.appendProgress(map[string]any{
+		"event":     "cost_budget_exceeded",
+		"scope":     cbe.Scope,
+		"node_id":   cbe.NodeID,
+		"spent_usd": cbe.SpentUSD,
+		"limit_usd": cbe.LimitUSD,
+	})
+}
+
+// usageCost prices one response from per-token catalog pricing. Calls to
+// models without catalog pricing are counted as unpriced.
+func usageCost(catalog *modeldb.Catalog, provider string, modelID string, u llm.Usage) runtime.CostSummary {
+	c := runtime.CostSummary{InputTokens: u.InputTokens, OutputTokens: u.OutputTokens, Calls: 1}
+	entry, ok := modeldb.LookupModelEntry(catalog, provider, modelID)
+	if !ok || entry.InputCostPerToken == nil || entry.OutputCostPerToken == nil {
+		c.UnpricedCalls = 1
+		return c
+	}
+	c.USD = float64(u.InputTokens)**entry.InputCostPerToken + float64(u.OutputTokens)**entry.OutputCostPerToken
+	return c
+}
+
+type costScopeKey struct{}
+
+type costScope struct {
+	eng  *Engine
+	node *model.Node
+}
+
+// withCostScope attributes LLM calls made with ctx to node.
+func withCostScope(ctx context.Context, exec *Execution, node *model.Node) context.Context {
+	if exec == nil || exec.Engine == nil || node == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, costScopeKey{}, costScope{eng: exec.Engine, node: node})
+}
+
+// costTrackingMiddleware records usage for calls made inside a cost scope and
+// refuses new calls once a budget is spent.
+func costTrackingMiddleware(catalog *modeldb.Catalog) llm.Middleware {
+	return llm.MiddlewareFunc{
+		Complete: func(ctx context.Context, req llm.Request, next llm.CompleteFunc) (llm.Response, error) {
+			scope, ok := ctx.Value(costScopeKey{}).(costScope)
+			if !ok {
+				return next(ctx, req)
+			}
+			eng := scope.eng
+			if err := eng.checkCostBudget(scope.node); err != nil {
+				eng.noteCostBudgetExceeded(err)
+				return llm.Response{}, err
+			}
+			resp, err := next(ctx, req)
+			if err != nil {
+				return resp, err
+			}
+			eng.recordCost(scope.node.ID, usageCost(catalog, req.Provider, req.Model, resp.Usage))
+			return resp, nil
+		},
+		Stream: func(ctx context.Context, req llm.Request, next llm.StreamFunc) (llm.Stream, error) {
+			scope, ok := ctx.Value(costScopeKey{}).(costScope)
+			if !ok {
+				return next(ctx, req)
+			}
+			eng := scope.eng
+			if err := eng.checkCostBudget(scope.node); err != nil {
+				eng.noteCostBudgetExceeded(err)
+				return nil, err
+			}
+			inner, err := next(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			return recordStreamCost(inner, func(u llm.Usage) {
+				eng.recordCost(scope.node.ID, usageCost(catalog, req.Provider, req.Model, u))
+			}), nil
+		},
+	}
+}
+
+// recordStreamCost forwards inner's events and hands the usage reported by its
+// FINISH event to record.
+func recordStreamCost(inner llm.Stream, record func(llm.Usage)) llm.Stream {
+	// Closing the inner stream asynchronously keeps Close from deadlocking when the
+	// forwarder below is blocked handing an event to the consumer.
+	out := llm.NewChanStream(func() { go inner.Close() })
+	go func() {
+		defer out.CloseSend()
+		for ev := range inner.Events() {
+			if ev.Type == llm.StreamEventFinish {
+				switch {
+				case ev.Usage != nil:
+					record(*ev.Usage)
+				case ev.Response != nil:
+					record(ev.Response.Usage)
+				}
+			}
+			out.Send(ev)
+		}
+		_ = inner.Close()
+	}()
+	return out
+}
+
+// cliReportedCost extracts the cost a CLI reported on its own stdout. Only the
+// Claude CLI stream-json "result" event carries one (total_cost_usd).
+func cliReportedCost(stdout string) (runtime.CostSummary, bool) {
+	var out runtime.CostSummary
+	found := false
+	sc := bufio.NewScanner(strings.NewReader(stdout))
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if !strings.HasPrefix(line, "{") || !strings.Contains(line, `"total_cost_usd"`) {
+			continue
+		}
+		var ev struct {
+			Type         string   `json:"type"`
+			TotalCostUSD *float64 `json:"total_cost_usd"`
+			NumTurns     int      `json:"num_turns"`
+			Usage        struct {
+				InputTokens  int `json:"input_tokens"`
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		}
+		if json.Unmarshal([]byte(line), &ev) != nil || ev.Type != "result" || ev.TotalCostUSD == nil {
+			continue
+		}
+		out = runtime.CostSummary{
+			USD:          *ev.TotalCostUSD,
+			InputTokens:  ev.Usage.InputTokens,
+			OutputTokens: ev.Usage.OutputTokens,
+			Calls:        max(ev.NumTurns, 1),
+		}
+		found = true
+	}
+	return out, found
+}
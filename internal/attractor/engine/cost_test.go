@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+type usageAdapter struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (a *usageAdapter) Name() string { return "openai" }
+func (a *usageAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	_ = ctx
+	a.mu.Lock()
+	a.calls++
+	a.mu.Unlock()
+	return llm.Response{
+		Provider: "openai",
+		Model:    req.Model,
+		Message:  llm.Assistant("ok"),
+		Usage:    llm.Usage{InputTokens: 1000, OutputTokens: 500, TotalTokens: 1500},
+	}, nil
+}
+func (a *usageAdapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	_ = ctx
+	a.mu.Lock()
+	a.calls++
+	a.mu.Unlock()
+	usage := llm.Usage{InputTokens: 1000, OutputTokens: 500, TotalTokens: 1500}
+	s := llm.NewChanStream(nil)
+	go func() {
+		defer s.CloseSend()
+		s.Send(llm.StreamEvent{Type: llm.StreamEventTextDelta, Delta: "ok"})
+		s.Send(llm.StreamEvent{
+			Type:     llm.StreamEventFinish,
+			Usage:    &usage,
+			Response: &llm.Response{Provider: "openai", Model: req.Model, Message: llm.Assistant("ok"), Usage: usage},
+		})
+	}()
+	return s, nil
+}
+
+func pricedTestCatalog() *modeldb.Catalog {
+	in, out := 2e-6, 8e-6
+	return &modeldb.Catalog{
+		Models: map[string]modeldb.ModelEntry{
+			"openai/gpt-5.2": {Provider: "openai", InputCostPerToken: &in, OutputCostPerToken: &out},
+		},
+		CoveredProviders: map[string]bool{"openai": true},
+	}
+}
+
+func TestCodergenRouter_TracksCostAndEnforcesNodeBudget(t *testing.T) {
+	adapter := &usageAdapter{}
+	r := newThreadTestRouter(t, adapter)
+	r.catalog = pricedTestCatalog()
+
+	logsRoot := t.TempDir()
+	eng := &Engine{LogsRoot: logsRoot, costs: newCostLedger(logsRoot)}
+	execCtx := &Execution{Context: runtime.NewContext(), LogsRoot: logsRoot, WorktreeDir: t.TempDir(), Engine: eng}
+	node := model.NewNode("impl")
+	node.Attrs["llm_provider"] = "openai"
+	node.Attrs["llm_model"] = "gpt-5.2"
+	node.Attrs["codergen_mode"] = "one_shot"
+	node.Attrs["max_cost_usd"] = "0.005"
+
+	if _, _, err := r.Run(context.Background(), execCtx, node, "do it"); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+	// 1000 input tokens * $2/M + 500 output tokens * $8/M = $0.006.
+	got := eng.costs.runTotal()
+	if math.Abs(got.USD-0.006) > 1e-9 || got.InputTokens != 1000 || got.OutputTokens != 500 || got.Calls != 1 {
+		t.Fatalf("run cost: %+v", got)
+	}
+
+	_, _, err := r.Run(context.Background(), execCtx, node, "do it again")
+	if err == nil || !isCostBudgetError(err) {
+		t.Fatalf("second Run: expected cost budget error, got %v", err)
+	}
+	if fc, _ := classifyAPIError(err); fc != failureClassDeterministic {
+		t.Fatalf("failure class: got %q want %q", fc, failureClassDeterministic)
+	}
+	if adapter.calls != 1 {
+		t.Fatalf("provider calls: got %d want 1 (budget should block the second call)", adapter.calls)
+	}
+}
+
+func TestCostTrackingMiddleware_RecordsStreamUsage(t *testing.T) {
+	client := llm.NewClient()
+	client.Register(&usageAdapter{})
+	client.Use(costTrackingMiddleware(pricedTestCatalog()))
+
+	logsRoot := t.TempDir()
+	eng := &Engine{LogsRoot: logsRoot, costs: newCostLedger(logsRoot)}
+	execCtx := &Execution{Context: runtime.NewContext(), LogsRoot: logsRoot, WorktreeDir: t.TempDir(), Engine: eng}
+	ctx := withCostScope(context.Background(), execCtx, model.NewNode("impl"))
+
+	st, err := client.Stream(ctx, llm.Request{Provider: "openai", Model: "gpt-5.2", Messages: []llm.Message{llm.User("do it")}})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	var text string
+	for ev := range st.Events() {
+		text += ev.Delta
+	}
+	_ = st.Close()
+	if text != "ok" {
+		t.Fatalf("forwarded text: got %q want %q", text, "ok")
+	}
+	got := eng.costs.runTotal()
+	if math.Abs(got.USD-0.006) > 1e-9 || got.InputTokens != 1000 || got.OutputTokens != 500 || got.Calls != 1 {
+		t.Fatalf("stream cost: %+v", got)
+	}
+}
+
+func TestUsageCost_UnpricedModelCountsCall(t *testing.T) {
+	c := usageCost(pricedTestCatalog(), "openai", "gpt-unknown", llm.Usage{InputTokens: 10, OutputTokens: 5})
+	if c.USD != 0 || c.UnpricedCalls != 1 || c.Calls != 1 || c.InputTokens != 10 {
+		t.Fatalf("unpriced cost: %+v", c)
+	}
+}
+
+func TestRun_MaxCostUSD_AbortsRunAndRecordsCostInFinal(t *testing.T) {
+	dot := []byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="x"]
+  start -> a -> exit
+}
+`)
+	repo := initTestRepo(t)
+	opts := RunOptions{RepoPath: repo, RunID: "cost-test", LogsRoot: t.TempDir(), MaxCostUSD: 1}
+	if err := opts.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults: %v", err)
+	}
+	g, _, err := Prepare(dot)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	eng := newBaseEngine(g, dot, opts)
+	eng.CodergenBackend = &SimulatedCodergenBackend{}
+	eng.costs.record("earlier", runtime.CostSummary{USD: 2, Calls: 3})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := eng.run(ctx); err == nil || !strings.Contains(err.Error(), "cost budget exceeded") {
+		t.Fatalf("run: expected cost budget error, got %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(opts.LogsRoot, "final.json"))
+	if err != nil {
+		t.Fatalf("read final.json: %v", err)
+	}
+	var final runtime.FinalOutcome
+	if err := json.Unmarshal(b, &final); err != nil {
+		t.Fatalf("decode final.json: %v", err)
+	}
+	if final.Status != runtime.FinalFail || final.Cost == nil || final.Cost.USD != 2 {
+		t.Fatalf("final.json: status=%q cost=%+v", final.Status, final.Cost)
+	}
+	if loaded := loadCostLedger(opts.LogsRoot).runTotal(); loaded.USD != 2 || loaded.Calls != 3 {
+		t.Fatalf("cost.json run total: %+v", loaded)
+	}
+	progress, err := os.ReadFile(filepath.Join(opts.LogsRoot, "progress.ndjson"))
+	if err != nil {
+		t.Fatalf("read progress.ndjson: %v", err)
+	}
+	if !strings.Contains(string(progress), `"cost_budget_exceeded"`) {
+		t.Fatalf("expected cost_budget_exceeded progress event")
+	}
+}
+
+func TestCLIReportedCost_ParsesClaudeResultEvent(t *testing.T) {
+	stdout := `{"type":"assistant","message":{"content":[]}}
+{"type":"result","subtype":"success","total_cost_usd":0.125,"num_turns":4,"usage":{"input_tokens":300,"output_tokens":40}}
+`
+	c, ok := cliReportedCost(stdout)
+	if !ok {
+		t.Fatal("expected a reported cost")
+	}
+	if c.USD != 0.125 || c.Calls != 4 || c.InputTokens != 300 || c.OutputTokens != 40 {
+		t.Fatalf("cost: %+v", c)
+	}
+	if _, ok := cliReportedCost(`{"type":"turn.completed"}`); ok {
+		t.Fatal("did not expect a cost without a result event")
+	}
+}
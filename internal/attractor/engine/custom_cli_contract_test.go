@@ -0,0 +1,152 @@
+//go:build !windows
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func writeCustomAgentCLI(t *testing.T, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "aider")
+	script := `#!/usr/bin/env bash
+set -euo pipefail
+if [[ "${1:-}" == "--help" ]]; then
+echo "Usage: aider [--yes-always] [--model MODEL] [--message MESSAGE]"
+exit 0
+fi
+` + body
+	if err := os.WriteFile(p, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func customAgentConfig(repo, catalog, cxdbBinary, cxdbHTTP, exe string) *RunConfigFile {
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.CXDB.BinaryAddr = cxdbBinary
+	cfg.CXDB.HTTPBaseURL = cxdbHTTP
+	cfg.LLM.CLIProfile = "real"
+	cfg.LLM.Providers = map[string]ProviderConfig{
+		"aider": {Backend: BackendCLI, CLI: &ProviderCLIConfig{
+			Executable:    exe,
+			Args:          []string{"--yes-always", "--model", "{{model}}", "--message", "{{prompt}}"},
+			PromptMode:    "arg",
+			HelpProbeArgs: []string{"--help"},
+			CapabilityAll: []string{"--message"},
+		}},
+	}
+	cfg.ModelDB.OpenRouterModelInfoPath = catalog
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Git.RunBranchPrefix = "attractor/run"
+	return cfg
+}
+
+func TestCustomCLIContract_RunsAgentFromRunConfig(t *testing.T) {
+	// The prompt probe would run the fake agent inside the repo itself.
+	t.Setenv("KILROY_PREFLIGHT_PROMPT_PROBES", "off")
+	repo := initTestRepo(t)
+	logsRoot := t.TempDir()
+	catalog := writeCatalogForPreflight(t, `{"data": [{"id": "anthropic/claude-sonnet-4-20250514"}]}`)
+	cxdbSrv := newCXDBTestServer(t)
+	cli := writeCustomAgentCLI(t, `
+[[ "$1" == "--yes-always" && "$2" == "--model" && "$4" == "--message" && -n "$5" ]] || { echo "bad argv: $*" >&2; exit 2; }
+cat > status.json <<'JSON'
+{"status":"success","notes":"ok"}
+JSON
+echo "applied edits for model $3"
+`)
+	cfg := customAgentConfig(repo, catalog, cxdbSrv.BinaryAddr(), cxdbSrv.URL(), cli)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := RunWithConfig(ctx, singleProviderDot("aider", "sonnet"), cfg, RunOptions{RunID: "custom-cli-ok", LogsRoot: logsRoot})
+	if err != nil {
+		t.Fatalf("RunWithConfig: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: %+v", res)
+	}
+
+	b, err := os.ReadFile(filepath.Join(res.LogsRoot, "a", "cli_invocation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inv map[string]any
+	if err := json.Unmarshal(b, &inv); err != nil {
+		t.Fatal(err)
+	}
+	if inv["cli_contract"] != "config" || inv["prompt_mode"] != "arg" || inv["stream_parser"] != "none" || inv["executable"] != cli {
+		t.Fatalf("invocation: %v", inv)
+	}
+	if got := fmt.Sprint(inv["argv"]); got != "[--yes-always --model sonnet --message <prompt>]" {
+		t.Fatalf("argv: %s", got)
+	}
+
+	preflight, err := os.ReadFile(filepath.Join(res.LogsRoot, "preflight_report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(preflight), "required capabilities detected") {
+		t.Fatalf("expected capability probe in preflight report:\n%s", preflight)
+	}
+}
+
+func TestCustomCLIContract_PreflightChecksCapabilities(t *testing.T) {
+	repo := initTestRepo(t)
+	catalog := writeCatalogForPreflight(t, `{"data": [{"id": "anthropic/claude-sonnet-4-20250514"}]}`)
+	cli := writeCustomAgentCLI(t, "echo ok\n")
+	cfg := customAgentConfig(repo, catalog, "127.0.0.1:1", "http://127.0.0.1:1", cli)
+	cfg.LLM.Providers["aider"].CLI.CapabilityAll = []string{"--message", "--auto-commits"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := RunWithConfig(ctx, singleProviderDot("aider", "sonnet"), cfg, RunOptions{RunID: "custom-cli-caps", LogsRoot: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "missing required tokens: --auto-commits") {
+		t.Fatalf("expected capability preflight failure, got %v", err)
+	}
+}
+
+func TestCustomCLIContract_IdleWatchdogKillsSilentAgent(t *testing.T) {
+	t.Setenv("KILROY_CODEX_KILL_GRACE", "100ms")
+	cli := writeCustomAgentCLI(t, "sleep 30\n")
+	idle := 300
+	cfg := customAgentConfig("", "", "", "", cli)
+	cfg.LLM.Providers["aider"].CLI.IdleTimeoutMS = &idle
+
+	router := NewCodergenRouterWithRuntimes(cfg, nil, nil)
+	execCtx := &Execution{LogsRoot: t.TempDir(), WorktreeDir: t.TempDir(), Engine: &Engine{}}
+	node := model.NewNode("a")
+
+	start := time.Now()
+	_, out, err := router.runCLI(context.Background(), execCtx, node, "aider", "sonnet", "do the thing")
+	if err != nil {
+		t.Fatalf("runCLI: %v", err)
+	}
+	if out == nil || out.Status != runtime.StatusFail {
+		t.Fatalf("expected failed outcome, got %+v", out)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("watchdog did not stop the agent promptly: %s", elapsed)
+	}
+	b, err := os.ReadFile(filepath.Join(execCtx.LogsRoot, "a", "cli_invocation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inv map[string]any
+	_ = json.Unmarshal(b, &inv)
+	if inv["failure_trigger"] != "idle_timeout" {
+		t.Fatalf("invocation: %v", inv)
+	}
+}
@@ -331,3 +331,19 @@ func (e *Engine) cxdbRunFailed(ctx context.Context, nodeID string, sha string, r
 	})
 	return turnID, err
 }
+
+// cxdbManagerSteer emits a ManagerSteer event when a manager_loop node steers
+// its child pipeline.
+func (e *Engine) cxdbManagerSteer(ctx context.Context, nodeID string, source string, message string, deliveredTo []string) {
+	if e == nil || e.CXDB == nil {
+		return
+	}
+	_, _, _ = e.CXDB.Append(ctx, "com.kilroy.attractor.ManagerSteer", 1, map[string]any{
+		"run_id":       e.Options.RunID,
+		"node_id":      nodeID,
+		"timestamp_ms": nowMS(),
+		"source":       source,
+		"message":      message,
+		"delivered_to": deliveredTo,
+	})
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -58,6 +59,10 @@ type RunOptions struct {
 	// membership validation for that provider.
 	ForceModels map[string]string
 
+	// Params are values for the graph's declared parameters (name -> value),
+	// recorded in manifest.json so resume expands the graph the same way.
+	Params map[string]string
+
 	// Optional global stage timeout cap. When > 0, each stage attempt uses the
 	// smaller positive timeout from node timeout and this global cap.
 	StageTimeout time.Duration
@@ -70,6 +75,9 @@ type RunOptions struct {
 	// Pointer preserves explicit zero versus unset semantics from config.
 	MaxLLMRetries *int
 
+	// Optional run-wide LLM spend cap in USD. 0 disables the budget.
+	MaxCostUSD float64
+
 	// Optional callback invoked for every progress event (same data written to
 	// progress.ndjson). The map is a deep-copied snapshot safe for concurrent
 	// use by the caller. Used by the HTTP server to fan events to SSE clients.
@@ -84,6 +92,16 @@ type RunOptions struct {
 	// reference for context inspection, etc.
 	OnEngineReady func(e *Engine)
 
+	// When true, API backend traffic is recorded to {LogsRoot}/llm_cassette
+	// for later replay.
+	RecordLLM bool
+
+	// When set, API backend calls are answered from the llm_cassette recorded
+	// under this earlier run's logs_root instead of reaching providers. A
+	// request the cassette has not seen fails the call. CLI backends are not
+	// replayed.
+	ReplayFrom string
+
 	// Arbitrary key/value metadata written to manifest.json under "labels".
 	// Use to fingerprint runs for later querying or pruning (e.g. source=test).
 	Labels map[string]string
@@ -176,6 +194,35 @@ type Engine struct {
 	InputSourceTargetMap       map[string]string
 	currentInputManifestPath   string
 
+	// Optional LLM summarizer for summary:<level> fidelity preambles.
+	StageSummarizer StageSummarizer
+
+	// Optional LLM evaluator for manager_loop steering (manager.steer_prompt).
+	// When nil, the API client of the codergen router is used.
+	ManagerSteerer ManagerSteerer
+
+	// Optional LLM judge for fan_in_strategy=llm. When nil, the API client of
+	// the codergen router is used.
+	FanInJudge FanInJudge
+
+	// Set on engines running a manager_loop child pipeline: live agent
+	// sessions register here so the manager can steer them.
+	steering *steerHub
+
+	// LLM spend ledger, shared with parallel branch engines.
+	costs *costLedger
+
+	// Git checkpoints, branch worktrees and retry pacing; see effects().
+	sideEffects runEffects
+
+	// stack.call_dotfile of every stack.call this engine runs inside,
+	// outermost first. Parallel branch engines inherit it.
+	callStack []string
+
+	// Set on parallel branch engines: the logs roots of the executions the
+	// branch was fanned out from, innermost first.
+	parentLogsRoots []string
+
 	warningsMu sync.Mutex
 	Warnings   []string
 
@@ -256,6 +303,39 @@ type PrepareOptions struct {
 	// checks (stylesheet_unknown_model, stylesheet_noncanonical_model_id) are
 	// enabled. When nil, those checks are silently skipped.
 	Catalog *modeldb.Catalog
+	// CallRoot is the directory stack.call_dotfile paths resolve against when
+	// called graphs are validated. Defaults to RepoPath; when both are empty
+	// called graphs are not checked.
+	CallRoot string
+	// Params are values for the parameters the graph declares in its params
+	// attribute; declared defaults fill the rest. RequireParams makes a
+	// required parameter without a value an error (run and resume set it,
+	// validation alone does not).
+	Params        map[string]string
+	RequireParams bool
+	// IgnoreUnknownParams drops Params the graph does not declare instead
+	// of reporting them; stack.call hands the run's values to called graphs
+	// this way.
+	IgnoreUnknownParams bool
+}
+
+// syntaxDiagnostics reports each DOT syntax error as an error diagnostic.
+func syntaxDiagnostics(err error) []validate.Diagnostic {
+	var list dot.ErrorList
+	if !errors.As(err, &list) {
+		return nil
+	}
+	diags := make([]validate.Diagnostic, 0, len(list))
+	for _, se := range list {
+		sp := se.Span
+		diags = append(diags, validate.Diagnostic{
+			Rule:     "dot_syntax",
+			Severity: validate.SeverityError,
+			Message:  se.Msg,
+			Range:    &sp,
+		})
+	}
+	return diags
 }
 
 // Prepare parses/transforms/validates a graph.
@@ -272,10 +352,19 @@ func PrepareWithRegistry(dotSource []byte, reg *TransformRegistry) (*model.Graph
 }
 
 func PrepareWithOptions(dotSource []byte, opts PrepareOptions) (*model.Graph, []validate.Diagnostic, error) {
+	return prepareGraph(dotSource, opts, nil)
+}
+
+// prepareGraph is PrepareWithOptions for a graph reached through the
+// stack.call chain callStack (absolute paths, outermost first).
+func prepareGraph(dotSource []byte, opts PrepareOptions, callStack []string) (*model.Graph, []validate.Diagnostic, error) {
 	g, err := dot.Parse(dotSource)
 	if err != nil {
-		return nil, nil, err
+		return nil, syntaxDiagnostics(err), err
 	}
+	// Parameters expand first so they can shape prompt_file paths, the goal
+	// and stylesheet-targeted attributes.
+	paramDiags := applyParams(g, opts)
 
 	// Built-in transforms: prompt_file resolution, stylesheet, $goal expansion.
 	// prompt_file runs first so loaded content gets stylesheet defaults and $goal expansion.
@@ -289,9 +378,11 @@ func PrepareWithOptions(dotSource []byte, opts PrepareOptions) (*model.Graph, []
 		if err != nil {
 			diags := []validate.Diagnostic{{
 				Rule:     "stylesheet_syntax",
+				Attr:     "model_stylesheet",
 				Severity: validate.SeverityError,
 				Message:  err.Error(),
 			}}
+			diags[0].Range = validate.Locate(g, diags[0])
 			return g, diags, fmt.Errorf("stylesheet parse: %w", err)
 		}
 		_ = style.ApplyStylesheet(g, rules)
@@ -315,6 +406,9 @@ func PrepareWithOptions(dotSource []byte, opts PrepareOptions) (*model.Graph, []
 		extraRules = append(extraRules, validate.NewTypeKnownRule(opts.KnownTypes))
 	}
 	diags := validate.ValidateWithOptions(g, validate.ValidateOptions{Catalog: opts.Catalog}, extraRules...)
+	diags = append(diags, paramDiags...)
+	diags = append(diags, checkPromptTemplates(g)...)
+	diags = append(diags, validateCalledGraphs(g, opts, callStack)...)
 	var errs []string
 	for _, d := range diags {
 		if d.Severity == validate.SeverityError {
@@ -334,8 +428,10 @@ func Run(ctx context.Context, dotSource []byte, opts RunOptions) (*Result, error
 	}
 	reg := NewDefaultRegistry()
 	g, _, err := PrepareWithOptions(dotSource, PrepareOptions{
-		RepoPath:   opts.RepoPath,
-		KnownTypes: reg.KnownTypes(),
+		RepoPath:      opts.RepoPath,
+		KnownTypes:    reg.KnownTypes(),
+		Params:        opts.Params,
+		RequireParams: true,
 	})
 	if err != nil {
 		return nil, err
@@ -468,6 +564,14 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 		if node == nil {
 			return nil, fmt.Errorf("missing node: %s", current)
 		}
+		// Cost budget: stop before starting another stage once the run-wide
+		// max_cost_usd is spent. The exit node costs nothing and still runs.
+		if !isTerminal(node) {
+			if err := e.checkRunCostBudget(); err != nil {
+				e.noteCostBudgetExceeded(err)
+				return nil, fmt.Errorf("run aborted before node %q: %w", current, err)
+			}
+		}
 
 		// Stuck-cycle detection: count how many times each node has been
 		// visited in this iteration. When max_node_visits is set (>0) and a
@@ -648,7 +752,7 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 
 		// Kilroy v1: explicit parallel nodes control the next hop via context.
 		isExplicitParallel := false
-		if t := strings.TrimSpace(node.TypeOverride()); t == "parallel" || (t == "" && shapeToType(node.Shape()) == "parallel") {
+		if t := strings.TrimSpace(node.TypeOverride()); t == "parallel" || t == "parallel.foreach" || (t == "" && shapeToType(node.Shape()) == "parallel") {
 			isExplicitParallel = true
 			join := strings.TrimSpace(e.Context.GetString("parallel.join_node", ""))
 			if join == "" {
@@ -677,7 +781,7 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 						Engine:      e,
 						Artifacts:   e.Artifacts,
 					}
-					results, baseSHA, dispatchErr := dispatchParallelBranches(ctx, exec, node.ID, allEdges, joinID)
+					results, baseSHA, dispatchErr := dispatchParallelBranches(ctx, exec, node.ID, edgeBranches(allEdges), joinID)
 					if dispatchErr != nil {
 						return nil, dispatchErr
 					}
@@ -767,6 +871,7 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 			}, nil
 		}
 		next := nextHop.Edge
+		e.effects().traversed(next)
 		e.appendProgress(map[string]any{
 			"event":      "edge_selected",
 			"from_node":  node.ID,
@@ -974,6 +1079,7 @@ func (e *Engine) executeNode(ctx context.Context, node *model.Node) (runtime.Out
 	// attempt left a status.json behind and the handler doesn't write a new one, we'd incorrectly
 	// treat the stale file as authoritative. Clear it before each attempt.
 	_ = os.Remove(filepath.Join(stageDir, "status.json"))
+	e.costs.beginAttempt(node.ID)
 	if err := e.materializeStageInputs(ctx, node.ID); err != nil {
 		out := inputFailureOutcomeFromMaterializationError(err)
 		_ = writeJSON(filepath.Join(stageDir, "status.json"), out)
@@ -1068,8 +1174,16 @@ func (e *Engine) executeNode(ctx context.Context, node *model.Node) (runtime.Out
 		}
 	}
 
+	if c, ok := e.costs.attempt(node.ID); ok {
+		out.Cost = &c
+		if err := e.costs.save(); err != nil {
+			e.Warn(fmt.Sprintf("write cost.json: %v", err))
+		}
+	}
+
 	// Write status.json (canonical metaspec shape).
 	_ = writeJSON(filepath.Join(stageDir, "status.json"), out)
+	e.effects().visited(e, node, out)
 	return out, nil
 }
 
@@ -1242,7 +1356,7 @@ func (e *Engine) executeWithRetry(ctx context.Context, node *model.Node, retries
 			retries[node.ID]++
 			// Spec §5.1: update built-in context key internal.retry_count.<node_id> on each retry.
 			e.Context.Set(fmt.Sprintf("internal.retry_count.%s", node.ID), retries[node.ID])
-			delay := backoffDelayForNode(e.Options.RunID, e.Graph, node, attempt)
+			delay := e.effects().retryDelay(backoffDelayForNode(e.Options.RunID, e.Graph, node, attempt))
 			// Spec §9.6: emit StageRetrying CXDB event.
 			e.cxdbStageRetrying(ctx, node, attempt+1, delay.Milliseconds())
 			e.appendProgress(map[string]any{
@@ -1380,11 +1494,13 @@ func (e *Engine) checkpoint(nodeID string, out runtime.Outcome, completed []stri
 	}
 	if sha == "" {
 		var err error
-		sha, err = gitutil.CommitAllowEmptyWithExcludes(e.WorktreeDir, msg, e.checkpointExcludeGlobs())
+		sha, err = e.effects().commit(e.WorktreeDir, msg, e.checkpointExcludeGlobs())
 		if err != nil {
 			return "", err
 		}
 	} else {
+		// A handler-provided sha is one that effects().commit returned, so
+		// it is never set under a simulation and HEAD is real git here.
 		head, err := gitutil.HeadSHA(e.WorktreeDir)
 		if err != nil {
 			return "", err
@@ -1393,6 +1509,7 @@ func (e *Engine) checkpoint(nodeID string, out runtime.Outcome, completed []stri
 			return "", fmt.Errorf("handler-provided checkpoint sha does not match HEAD (head=%s meta=%s)", head, sha)
 		}
 	}
+	e.recordStageMemo(nodeID, out, sha)
 	cp := runtime.NewCheckpoint()
 	cp.Timestamp = time.Now().UTC()
 	cp.CurrentNode = nodeID
@@ -1477,6 +1594,9 @@ func (e *Engine) writeManifest(baseSHA string) error {
 	if len(e.Options.ForceModels) > 0 {
 		manifest["force_models"] = copyStringStringMap(e.Options.ForceModels)
 	}
+	if len(e.Options.Params) > 0 {
+		manifest["params"] = copyStringStringMap(e.Options.Params)
+	}
 	if len(e.Options.Labels) > 0 {
 		manifest["labels"] = copyStringStringMap(e.Options.Labels)
 	}
@@ -1537,6 +1657,13 @@ func (e *Engine) persistTerminalOutcome(ctx context.Context, final runtime.Final
 	if strings.TrimSpace(final.CXDBHeadTurnID) == "" && e.CXDB != nil {
 		final.CXDBHeadTurnID = strings.TrimSpace(e.CXDB.HeadTurnID)
 	}
+	if final.Cost == nil && e.costs != nil {
+		total := e.costs.runTotal()
+		final.Cost = &total
+		if err := e.costs.save(); err != nil {
+			e.Warn(fmt.Sprintf("write cost.json: %v", err))
+		}
+	}
 
 	primaryPath := ""
 	for _, p := range e.finalOutcomePaths() {
@@ -16,6 +16,8 @@ func newBaseEngine(g *model.Graph, dotSource []byte, opts RunOptions) *Engine {
 		Registry:    NewDefaultRegistry(),
 		Interviewer: &AutoApproveInterviewer{},
 		Artifacts:   NewArtifactStore(opts.LogsRoot, DefaultFileBackingThreshold),
+		costs:       newCostLedger(opts.LogsRoot),
+		sideEffects: gitEffects{},
 	}
 	if opts.ProgressSink != nil {
 		e.progressSink = opts.ProgressSink
@@ -118,3 +118,18 @@ func TestRun_TimeoutOutcomeIncludesMetadata(t *testing.T) {
 		t.Fatalf("partial_status.json: expected harvested=true, got %v", partial["harvested"])
 	}
 }
+
+func TestParseDuration_UnitSuffixes(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"45":    45 * time.Second,
+		"250ms": 250 * time.Millisecond,
+		"15m":   15 * time.Minute,
+		"2h":    2 * time.Hour,
+		"1d":    24 * time.Hour,
+		"bogus": time.Minute,
+	} {
+		if got := parseDuration(in, time.Minute); got != want {
+			t.Fatalf("parseDuration(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,472 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// Fan-in strategies, selected with the fan_in_strategy node attribute.
+const (
+	fanInStrategyHeuristic = "heuristic"
+	fanInStrategyLLM       = "llm"
+	fanInStrategyCommand   = "command"
+	fanInStrategyMerge     = "merge"
+)
+
+const (
+	fanInJudgeMaxDiffChars     = 20_000
+	fanInJudgeMaxResponseChars = 4_000
+	fanInJudgementFileName     = "fan_in.json"
+)
+
+// FanInStrategies lists the accepted fan_in_strategy values.
+var FanInStrategies = []string{fanInStrategyHeuristic, fanInStrategyLLM, fanInStrategyCommand, fanInStrategyMerge}
+
+func fanInStrategy(node *model.Node) string {
+	s := strings.ToLower(strings.TrimSpace(node.Attr("fan_in_strategy", "")))
+	if s == "" {
+		return fanInStrategyHeuristic
+	}
+	return s
+}
+
+// fanInJudgement is written to <stage>/fan_in.json and explains the choice.
+type fanInJudgement struct {
+	Strategy  string          `json:"strategy"`
+	Winner    string          `json:"winner,omitempty"`
+	Rationale string          `json:"rationale,omitempty"`
+	Fallback  string          `json:"fallback,omitempty"` // why the heuristic winner was kept
+	Scores    []fanInScore    `json:"scores,omitempty"`
+	Merged    []string        `json:"merged,omitempty"`
+	Conflicts []fanInConflict `json:"conflicts,omitempty"`
+}
+
+type fanInScore struct {
+	BranchKey  string  `json:"branch_key"`
+	Score      float64 `json:"score"`
+	ExitCode   int     `json:"exit_code"`
+	Passed     bool    `json:"passed"`
+	TimedOut   bool    `json:"timed_out,omitempty"`
+	DurationMS int64   `json:"duration_ms"`
+	Log        string  `json:"log,omitempty"`
+}
+
+type fanInConflict struct {
+	BranchKey string   `json:"branch_key"`
+	Files     []string `json:"files,omitempty"`
+	Error     string   `json:"error"`
+}
+
+// fanInCandidates returns the non-fail branches in heuristic order.
+func fanInCandidates(results []parallelBranchResult) []parallelBranchResult {
+	var out []parallelBranchResult
+	rest := results
+	for {
+		w, ok := selectHeuristicWinner(rest)
+		if !ok {
+			return out
+		}
+		out = append(out, w)
+		next := make([]parallelBranchResult, 0, len(rest))
+		removed := false
+		for _, r := range rest {
+			if !removed && r.BranchKey == w.BranchKey && r.HeadSHA == w.HeadSHA {
+				removed = true
+				continue
+			}
+			next = append(next, r)
+		}
+		rest = next
+	}
+}
+
+// FanInCandidate is one branch as shown to a FanInJudge.
+type FanInCandidate struct {
+	BranchKey string `json:"branch_key"`
+	Status    string `json:"status"`
+	Notes     string `json:"notes,omitempty"`
+	Diff      string `json:"diff,omitempty"`     // changes since the branch forked
+	Response  string `json:"response,omitempty"` // last response.md written in the branch
+}
+
+// FanInReview is what an LLM fan-in judge compares.
+type FanInReview struct {
+	Goal         string           `json:"goal,omitempty"`
+	Instructions string           `json:"instructions,omitempty"`
+	Candidates   []FanInCandidate `json:"candidates"`
+}
+
+// FanInVerdict names the winning branch.
+type FanInVerdict struct {
+	Winner    string `json:"winner"`
+	Rationale string `json:"rationale,omitempty"`
+}
+
+type FanInJudge interface {
+	Judge(ctx context.Context, node *model.Node, review FanInReview) (FanInVerdict, error)
+}
+
+type llmFanInJudge struct {
+	client *llm.Client
+}
+
+func (j *llmFanInJudge) Judge(ctx context.Context, node *model.Node, review FanInReview) (FanInVerdict, error) {
+	provider := normalizeProviderKey(node.Attr("llm_provider", ""))
+	modelID := strings.TrimSpace(node.Attr("llm_model", ""))
+	if provider == "" || modelID == "" {
+		return FanInVerdict{}, fmt.Errorf("fan_in_strategy=llm requires llm_provider and llm_model on node %s", node.ID)
+	}
+	resp, err := j.client.Complete(ctx, llm.Request{
+		Provider: provider,
+		Model:    modelID,
+		Messages: []llm.Message{
+			llm.System("You judge competing implementations of the same task produced by parallel coding agents. " +
+				"Pick the one branch that best achieves the goal: correct, complete, and no larger than necessary. " +
+				`Reply with only a JSON object: {"winner": "<branch_key>", "rationale": "<one or two sentences>"}.`),
+			llm.User(buildFanInJudgePrompt(review)),
+		},
+	})
+	if err != nil {
+		return FanInVerdict{}, err
+	}
+	return parseFanInVerdict(resp.Text())
+}
+
+func buildFanInJudgePrompt(review FanInReview) string {
+	var b strings.Builder
+	if goal := strings.TrimSpace(review.Goal); goal != "" {
+		b.WriteString("Pipeline goal: ")
+		b.WriteString(goal)
+		b.WriteString("\n")
+	}
+	if instr := strings.TrimSpace(review.Instructions); instr != "" {
+		b.WriteString("\n### Judging instructions\n")
+		b.WriteString(instr)
+		b.WriteString("\n")
+	}
+	for _, c := range review.Candidates {
+		fmt.Fprintf(&b, "\n## Branch %s (status: %s)\n", c.BranchKey, c.Status)
+		if c.Notes != "" {
+			b.WriteString("Notes: ")
+			b.WriteString(c.Notes)
+			b.WriteString("\n")
+		}
+		if c.Response != "" {
+			b.WriteString("\n### response.md\n")
+			b.WriteString(c.Response)
+			b.WriteString("\n")
+		}
+		b.WriteString("\n### Diff\n")
+		if c.Diff == "" {
+			b.WriteString("(no changes)\n")
+		} else {
+			b.WriteString("```diff\n")
+			b.WriteString(c.Diff)
+			b.WriteString("\n```\n")
+		}
+	}
+	return b.String()
+}
+
+// parseFanInVerdict reads the JSON object from a judge reply, tolerating
+// surrounding prose or code fences.
+func parseFanInVerdict(text string) (FanInVerdict, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return FanInVerdict{}, fmt.Errorf("fan-in judge reply has no JSON object: %q", truncate(text, 200))
+	}
+	var v FanInVerdict
+	if err := json.Unmarshal([]byte(text[start:end+1]), &v); err != nil {
+		return FanInVerdict{}, fmt.Errorf("decode fan-in judge reply: %w", err)
+	}
+	v.Winner = strings.TrimSpace(v.Winner)
+	v.Rationale = strings.TrimSpace(v.Rationale)
+	return v, nil
+}
+
+// fanInJudge returns the configured FanInJudge, falling back to the codergen
+// router's API client.
+func (e *Engine) fanInJudge() (FanInJudge, error) {
+	if e == nil {
+		return nil, fmt.Errorf("fan_in_strategy=llm requires an engine")
+	}
+	if e.FanInJudge != nil {
+		return e.FanInJudge, nil
+	}
+	r, ok := e.CodergenBackend.(*CodergenRouter)
+	if !ok {
+		return nil, fmt.Errorf("fan_in_strategy=llm requires the API codergen backend")
+	}
+	client, err := r.ensureAPIClient()
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("fan_in_strategy=llm requires an API client")
+	}
+	return &llmFanInJudge{client: client}, nil
+}
+
+// fanInCandidate collects a branch's diff and final response.md.
+func fanInCandidate(worktreeDir string, r parallelBranchResult) FanInCandidate {
+	c := FanInCandidate{
+		BranchKey: r.BranchKey,
+		Status:    string(r.Outcome.Status),
+		Notes:     strings.TrimSpace(r.Outcome.Notes),
+	}
+	if strings.TrimSpace(r.HeadSHA) != "" && strings.TrimSpace(worktreeDir) != "" {
+		if diff, err := gitutil.DiffPatch(worktreeDir, "HEAD", r.HeadSHA); err == nil {
+			c.Diff = truncateMiddle(strings.TrimSpace(diff), fanInJudgeMaxDiffChars)
+		}
+	}
+	if r.LogsRoot != "" {
+		for i := len(r.Completed) - 1; i >= 0; i-- {
+			b, err := os.ReadFile(filepath.Join(r.LogsRoot, r.Completed[i], "response.md"))
+			if err == nil {
+				c.Response = truncateMiddle(strings.TrimSpace(string(b)), fanInJudgeMaxResponseChars)
+				break
+			}
+		}
+	}
+	return c
+}
+
+// judgeByLLM asks the FanInJudge to pick among cands. On any failure the
+// heuristic winner (cands[0]) is kept and the reason recorded.
+func judgeByLLM(ctx context.Context, exec *Execution, node *model.Node, cands []parallelBranchResult) (parallelBranchResult, fanInJudgement) {
+	j := fanInJudgement{Strategy: fanInStrategyLLM, Winner: cands[0].BranchKey}
+	if len(cands) == 1 {
+		j.Fallback = "single candidate"
+		return cands[0], j
+	}
+	judge, err := exec.Engine.fanInJudge()
+	if err != nil {
+		j.Fallback = err.Error()
+		return cands[0], j
+	}
+	review := FanInReview{Instructions: strings.TrimSpace(node.Prompt())}
+	if exec.Graph != nil {
+		review.Goal = exec.Graph.Attrs["goal"]
+	}
+	for _, r := range cands {
+		review.Candidates = append(review.Candidates, fanInCandidate(exec.WorktreeDir, r))
+	}
+	verdict, err := judge.Judge(withCostScope(ctx, exec, node), node, review)
+	if err != nil {
+		j.Fallback = "judge failed: " + err.Error()
+		return cands[0], j
+	}
+	for _, r := range cands {
+		if r.BranchKey == verdict.Winner {
+			j.Winner = r.BranchKey
+			j.Rationale = verdict.Rationale
+			return r, j
+		}
+	}
+	j.Fallback = fmt.Sprintf("judge picked unknown branch %q", verdict.Winner)
+	return cands[0], j
+}
+
+// judgeByCommand runs fan_in_command in every candidate worktree. Branches
+// whose command exits 0 rank first; within those, a number on the last line
+// of stdout is the score (higher wins, default 1). Ties keep heuristic order.
+func judgeByCommand(ctx context.Context, exec *Execution, node *model.Node, cands []parallelBranchResult) (parallelBranchResult, fanInJudgement) {
+	j := fanInJudgement{Strategy: fanInStrategyCommand}
+	cmdStr := strings.TrimSpace(node.Attr("fan_in_command", ""))
+	timeout := parseDuration(node.Attr("fan_in_command_timeout", ""), 10*time.Minute)
+	logDir := filepath.Join(exec.LogsRoot, node.ID, "fan_in")
+	_ = os.MkdirAll(logDir, 0o755)
+	for _, r := range cands {
+		j.Scores = append(j.Scores, runFanInCommand(ctx, exec, cmdStr, timeout, r, logDir))
+	}
+	order := make([]int, len(cands))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		sa, sb := j.Scores[order[a]], j.Scores[order[b]]
+		if sa.Passed != sb.Passed {
+			return sa.Passed
+		}
+		return sa.Score > sb.Score
+	})
+	best := order[0]
+	j.Winner = cands[best].BranchKey
+	if !j.Scores[best].Passed {
+		j.Rationale = "fan_in_command failed in every branch"
+	}
+	return cands[best], j
+}
+
+func runFanInCommand(ctx context.Context, execCtx *Execution, cmdStr string, timeout time.Duration, r parallelBranchResult, logDir string) fanInScore {
+	s := fanInScore{BranchKey: r.BranchKey, ExitCode: -1, Log: filepath.Join(logDir, sanitizeRefComponent(r.BranchKey)+".log")}
+	if cmdStr == "" || strings.TrimSpace(r.WorktreeDir) == "" {
+		return s
+	}
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(cctx, "bash", "-c", cmdStr)
+	cmd.Dir = r.WorktreeDir
+	cmd.Env = append(buildBaseNodeEnv(artifactPolicyFromExecution(execCtx)), "KILROY_BRANCH_KEY="+r.BranchKey)
+	cmd.Stdin = strings.NewReader("")
+	start := time.Now()
+	out, _ := cmd.CombinedOutput()
+	s.DurationMS = time.Since(start).Milliseconds()
+	_ = os.WriteFile(s.Log, out, 0o644)
+	if cmd.ProcessState != nil {
+		s.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	s.TimedOut = cctx.Err() == context.DeadlineExceeded
+	s.Passed = s.ExitCode == 0 && !s.TimedOut
+	if !s.Passed {
+		return s
+	}
+	s.Score = 1
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if f, err := strconv.ParseFloat(strings.TrimSpace(lines[len(lines)-1]), 64); err == nil {
+		s.Score = f
+	}
+	return s
+}
+
+// mergeFanIn fast-forwards the run branch to the first candidate and merges
+// the rest on top. A branch that conflicts is skipped (its merge aborted) and
+// reported; the outcome is PARTIAL_SUCCESS when any branch could not be merged.
+func mergeFanIn(exec *Execution, node *model.Node, cands []parallelBranchResult, results []parallelBranchResult) (runtime.Outcome, fanInJudgement) {
+	j := fanInJudgement{Strategy: fanInStrategyMerge}
+	runID := ""
+	if exec.Engine != nil {
+		runID = exec.Engine.Options.RunID
+	}
+	for _, r := range cands {
+		if strings.TrimSpace(r.HeadSHA) == "" {
+			j.Conflicts = append(j.Conflicts, fanInConflict{BranchKey: r.BranchKey, Error: "branch has no head commit"})
+			continue
+		}
+		if len(j.Merged) == 0 {
+			if err := gitutil.FastForwardFFOnly(exec.WorktreeDir, r.HeadSHA); err == nil {
+				j.Merged = append(j.Merged, r.BranchKey)
+				continue
+			}
+		}
+		msg := fmt.Sprintf("attractor(%s): %s merge %s", runID, node.ID, r.BranchKey)
+		files, err := gitutil.MergeNoFF(exec.WorktreeDir, r.HeadSHA, msg)
+		if err != nil {
+			j.Conflicts = append(j.Conflicts, fanInConflict{BranchKey: r.BranchKey, Files: files, Error: err.Error()})
+			continue
+		}
+		j.Merged = append(j.Merged, r.BranchKey)
+	}
+	if len(j.Merged) == 0 {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "fan-in merge: no branch could be merged"}, j
+	}
+	j.Winner = j.Merged[0]
+	head, err := gitutil.HeadSHA(exec.WorktreeDir)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, j
+	}
+
+	merged := map[string]bool{}
+	for _, k := range j.Merged {
+		merged[k] = true
+	}
+	var first parallelBranchResult
+	losers := []map[string]any{}
+	for _, r := range results {
+		if r.BranchKey == j.Winner && first.BranchKey == "" {
+			first = r
+		}
+		if merged[r.BranchKey] {
+			continue
+		}
+		losers = append(losers, fanInLoser(r))
+	}
+	conflicts := make([]map[string]any, 0, len(j.Conflicts))
+	for _, c := range j.Conflicts {
+		conflicts = append(conflicts, map[string]any{"branch_key": c.BranchKey, "files": c.Files, "error": c.Error})
+	}
+
+	out := runtime.Outcome{
+		Status: runtime.StatusSuccess,
+		Notes:  fmt.Sprintf("fan-in merged %s", strings.Join(j.Merged, ", ")),
+		ContextUpdates: map[string]any{
+			"parallel.fan_in.strategy":               fanInStrategyMerge,
+			"parallel.fan_in.best_id":                first.BranchKey,
+			"parallel.fan_in.best_outcome":           first.Outcome,
+			"parallel.fan_in.best_head_sha":          head,
+			"parallel.fan_in.best_cxdb_context_id":   first.CXDBContextID,
+			"parallel.fan_in.best_cxdb_head_turn_id": first.CXDBHeadTurnID,
+			"parallel.fan_in.losers":                 losers,
+			"parallel.fan_in.merged":                 j.Merged,
+			"parallel.fan_in.conflicts":              conflicts,
+		},
+	}
+	if len(j.Conflicts) > 0 {
+		keys := make([]string, 0, len(j.Conflicts))
+		for _, c := range j.Conflicts {
+			keys = append(keys, c.BranchKey)
+		}
+		out.Status = runtime.StatusPartialSuccess
+		out.Notes += fmt.Sprintf("; could not merge %s", strings.Join(keys, ", "))
+	}
+	return out, j
+}
+
+func fanInLoser(r parallelBranchResult) map[string]any {
+	return map[string]any{
+		"branch_key":        r.BranchKey,
+		"branch_name":       r.BranchName,
+		"head_sha":          r.HeadSHA,
+		"status":            string(r.Outcome.Status),
+		"logs_root":         r.LogsRoot,
+		"cxdb_context_id":   r.CXDBContextID,
+		"cxdb_head_turn_id": r.CXDBHeadTurnID,
+	}
+}
+
+// recordFanInJudgement writes fan_in.json and emits a fan_in_selected event.
+func recordFanInJudgement(exec *Execution, node *model.Node, j fanInJudgement) {
+	if exec.LogsRoot != "" {
+		stageDir := filepath.Join(exec.LogsRoot, node.ID)
+		_ = os.MkdirAll(stageDir, 0o755)
+		if err := writeJSON(filepath.Join(stageDir, fanInJudgementFileName), j); err != nil {
+			warnEngine(exec, fmt.Sprintf("write %s: %v", fanInJudgementFileName, err))
+		}
+	}
+	if j.Fallback != "" && j.Strategy != fanInStrategyHeuristic {
+		warnEngine(exec, fmt.Sprintf("fan-in node %s: %s strategy kept the heuristic winner: %s", node.ID, j.Strategy, j.Fallback))
+	}
+	if exec.Engine == nil {
+		return
+	}
+	ev := map[string]any{
+		"event":    "fan_in_selected",
+		"node_id":  node.ID,
+		"strategy": j.Strategy,
+		"winner":   j.Winner,
+	}
+	if j.Fallback != "" {
+		ev["fallback"] = j.Fallback
+	}
+	if len(j.Merged) > 0 {
+		ev["merged"] = j.Merged
+	}
+	if len(j.Conflicts) > 0 {
+		ev["conflicts"] = len(j.Conflicts)
+	}
+	exec.Engine.appendProgress(ev)
+}
@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// addFanInTestBranch creates a worktree for key off the repo HEAD, writes
+// files there, commits, and returns a successful branch result.
+func addFanInTestBranch(t *testing.T, repo string, key string, files map[string]string, response string) parallelBranchResult {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), key)
+	wt := filepath.Join(root, "worktree")
+	runCmd(t, repo, "git", "worktree", "add", "-b", "par-"+key, wt, "HEAD")
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(wt, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runCmd(t, wt, "git", "add", "-A")
+	runCmd(t, wt, "git", "commit", "-m", "branch "+key)
+	res := parallelBranchResult{
+		BranchKey:   key,
+		HeadSHA:     strings.TrimSpace(runCmdOut(t, wt, "git", "rev-parse", "HEAD")),
+		Outcome:     runtime.Outcome{Status: runtime.StatusSuccess},
+		Completed:   []string{"impl"},
+		LogsRoot:    root,
+		WorktreeDir: wt,
+	}
+	if response != "" {
+		_ = os.MkdirAll(filepath.Join(root, "impl"), 0o755)
+		if err := os.WriteFile(filepath.Join(root, "impl", "response.md"), []byte(response), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res
+}
+
+func newFanInTestExecution(t *testing.T, repo string, results []parallelBranchResult) *Execution {
+	t.Helper()
+	logsRoot := t.TempDir()
+	graph := &model.Graph{Nodes: map[string]*model.Node{}, Attrs: map[string]string{"goal": "add a greeting"}}
+	eng := &Engine{Graph: graph, Options: RunOptions{RunID: "fan-in-test"}, Context: runtime.NewContext(), LogsRoot: logsRoot}
+	eng.Context.Set("parallel.results", results)
+	return &Execution{Engine: eng, Graph: graph, Context: eng.Context, WorktreeDir: repo, LogsRoot: logsRoot}
+}
+
+type fakeFanInJudge struct {
+	winner string
+	review FanInReview
+}
+
+func (j *fakeFanInJudge) Judge(ctx context.Context, node *model.Node, review FanInReview) (FanInVerdict, error) {
+	_ = ctx
+	_ = node
+	j.review = review
+	return FanInVerdict{Winner: j.winner, Rationale: "b is smaller"}, nil
+}
+
+func TestFanIn_LLMStrategy_FastForwardsToJudgedBranch(t *testing.T) {
+	repo := initTestRepo(t)
+	a := addFanInTestBranch(t, repo, "a", map[string]string{"a.txt": "hello from a\n"}, "Implemented in a.txt")
+	b := addFanInTestBranch(t, repo, "b", map[string]string{"b.txt": "hello from b\n"}, "Implemented in b.txt")
+	exec := newFanInTestExecution(t, repo, []parallelBranchResult{a, b})
+	judge := &fakeFanInJudge{winner: "b"}
+	exec.Engine.FanInJudge = judge
+	node := &model.Node{ID: "join", Attrs: map[string]string{"fan_in_strategy": "llm", "prompt": "Prefer the smaller change."}}
+
+	out, err := (&FanInHandler{}).Execute(context.Background(), exec, node)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if out.Status != runtime.StatusSuccess || out.ContextUpdates["parallel.fan_in.best_id"] != "b" {
+		t.Fatalf("outcome: %+v", out)
+	}
+	if out.ContextUpdates["parallel.fan_in.rationale"] != "b is smaller" {
+		t.Fatalf("rationale: %v", out.ContextUpdates["parallel.fan_in.rationale"])
+	}
+	if head := strings.TrimSpace(runCmdOut(t, repo, "git", "rev-parse", "HEAD")); head != b.HeadSHA {
+		t.Fatalf("HEAD = %s, want branch b %s", head, b.HeadSHA)
+	}
+
+	r := judge.review
+	if r.Goal != "add a greeting" || r.Instructions != "Prefer the smaller change." || len(r.Candidates) != 2 {
+		t.Fatalf("review: %+v", r)
+	}
+	if !strings.Contains(r.Candidates[0].Diff, "+hello from a") || r.Candidates[0].Response != "Implemented in a.txt" {
+		t.Fatalf("candidate a: %+v", r.Candidates[0])
+	}
+	if _, err := os.Stat(filepath.Join(exec.LogsRoot, "join", fanInJudgementFileName)); err != nil {
+		t.Fatalf("expected fan_in.json: %v", err)
+	}
+	if !hasProgressEventForNode(t, filepath.Join(exec.LogsRoot, "progress.ndjson"), "fan_in_selected", "join") {
+		t.Fatalf("expected fan_in_selected progress event")
+	}
+}
+
+func TestFanIn_LLMStrategy_UnknownWinnerKeepsHeuristic(t *testing.T) {
+	repo := initTestRepo(t)
+	a := addFanInTestBranch(t, repo, "a", map[string]string{"a.txt": "a\n"}, "")
+	b := addFanInTestBranch(t, repo, "b", map[string]string{"b.txt": "b\n"}, "")
+	exec := newFanInTestExecution(t, repo, []parallelBranchResult{a, b})
+	exec.Engine.FanInJudge = &fakeFanInJudge{winner: "zzz"}
+	node := &model.Node{ID: "join", Attrs: map[string]string{"fan_in_strategy": "llm"}}
+
+	out, err := (&FanInHandler{}).Execute(context.Background(), exec, node)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if out.ContextUpdates["parallel.fan_in.best_id"] != "a" {
+		t.Fatalf("best_id: %v", out.ContextUpdates["parallel.fan_in.best_id"])
+	}
+	if len(exec.Engine.Warnings) == 0 {
+		t.Fatalf("expected a warning about the fallback")
+	}
+}
+
+func TestFanIn_CommandStrategy_PicksHighestScore(t *testing.T) {
+	repo := initTestRepo(t)
+	a := addFanInTestBranch(t, repo, "a", map[string]string{"score.txt": "3\n"}, "")
+	b := addFanInTestBranch(t, repo, "b", map[string]string{"score.txt": "7\n"}, "")
+	c := addFanInTestBranch(t, repo, "c", map[string]string{"score.txt": "fail\n"}, "")
+	exec := newFanInTestExecution(t, repo, []parallelBranchResult{a, b, c})
+	node := &model.Node{ID: "join", Attrs: map[string]string{
+		"fan_in_strategy": "command",
+		"fan_in_command":  `s=$(cat score.txt); [ "$s" != fail ] || exit 1; echo "running $KILROY_BRANCH_KEY"; echo "$s"`,
+	}}
+
+	out, err := (&FanInHandler{}).Execute(context.Background(), exec, node)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if out.Status != runtime.StatusSuccess || out.ContextUpdates["parallel.fan_in.best_id"] != "b" {
+		t.Fatalf("outcome: %+v", out)
+	}
+	if out.ContextUpdates["parallel.fan_in.best_score"] != float64(7) {
+		t.Fatalf("best_score: %v", out.ContextUpdates["parallel.fan_in.best_score"])
+	}
+	log, err := os.ReadFile(filepath.Join(exec.LogsRoot, "join", "fan_in", "b.log"))
+	if err != nil || !strings.Contains(string(log), "running b") {
+		t.Fatalf("b.log: %q err=%v", log, err)
+	}
+}
+
+func TestFanIn_MergeStrategy_MergesCleanBranchesAndReportsConflicts(t *testing.T) {
+	repo := initTestRepo(t)
+	a := addFanInTestBranch(t, repo, "a", map[string]string{"a.txt": "a\n", "README.md": "from a\n"}, "")
+	b := addFanInTestBranch(t, repo, "b", map[string]string{"b.txt": "b\n"}, "")
+	c := addFanInTestBranch(t, repo, "c", map[string]string{"README.md": "from c\n"}, "")
+	exec := newFanInTestExecution(t, repo, []parallelBranchResult{a, b, c})
+	node := &model.Node{ID: "join", Attrs: map[string]string{"fan_in_strategy": "merge"}}
+
+	out, err := (&FanInHandler{}).Execute(context.Background(), exec, node)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if out.Status != runtime.StatusPartialSuccess {
+		t.Fatalf("status: got %s want partial_success (%s)", out.Status, out.Notes)
+	}
+	merged, _ := out.ContextUpdates["parallel.fan_in.merged"].([]string)
+	if strings.Join(merged, ",") != "a,b" {
+		t.Fatalf("merged: %v", out.ContextUpdates["parallel.fan_in.merged"])
+	}
+	conflicts, _ := out.ContextUpdates["parallel.fan_in.conflicts"].([]map[string]any)
+	if len(conflicts) != 1 || conflicts[0]["branch_key"] != "c" {
+		t.Fatalf("conflicts: %+v", conflicts)
+	}
+	if files, _ := conflicts[0]["files"].([]string); len(files) != 1 || files[0] != "README.md" {
+		t.Fatalf("conflict files: %v", conflicts[0]["files"])
+	}
+	for _, f := range []string{"a.txt", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(repo, f)); err != nil {
+			t.Fatalf("expected %s in merged worktree: %v", f, err)
+		}
+	}
+	if status := strings.TrimSpace(runCmdOut(t, repo, "git", "status", "--porcelain")); status != "" {
+		t.Fatalf("worktree not clean after merge: %s", status)
+	}
+	head := strings.TrimSpace(runCmdOut(t, repo, "git", "rev-parse", "HEAD"))
+	if out.ContextUpdates["parallel.fan_in.best_head_sha"] != head {
+		t.Fatalf("best_head_sha: %v want %s", out.ContextUpdates["parallel.fan_in.best_head_sha"], head)
+	}
+}
+
+func TestParseFanInVerdict(t *testing.T) {
+	v, err := parseFanInVerdict("Here you go:\n```json\n{\"winner\": \" b \", \"rationale\": \"passes tests\"}\n```")
+	if err != nil || v.Winner != "b" || v.Rationale != "passes tests" {
+		t.Fatalf("verdict: %+v err=%v", v, err)
+	}
+	if _, err := parseFanInVerdict("branch b"); err == nil {
+		t.Fatal("expected an error without a JSON object")
+	}
+}
@@ -0,0 +1,330 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// Word budgets per summary:<level> fidelity mode. Each prior stage is
+// summarized independently so summaries can be cached per stage.
+var summaryLevelWordBudget = map[string]int{
+	"low":    60,
+	"medium": 150,
+	"high":   400,
+}
+
+const (
+	summaryMaxPriorStages   = 20
+	summaryMaxResponseChars = 12000
+	summaryMaxDiffChars     = 8000
+)
+
+// StageDigest is the raw material an LLM summarizer condenses for one completed stage.
+type StageDigest struct {
+	NodeID        string `json:"node_id"`
+	Status        string `json:"status,omitempty"`
+	Notes         string `json:"notes,omitempty"`
+	FailureReason string `json:"failure_reason,omitempty"`
+	Response      string `json:"response,omitempty"`
+	Diff          string `json:"diff,omitempty"`
+}
+
+type StageSummaryOptions struct {
+	Goal  string `json:"goal"`
+	Level string `json:"level"`
+}
+
+type StageSummarizer interface {
+	Summarize(ctx context.Context, stage StageDigest, opts StageSummaryOptions) (string, error)
+}
+
+type llmStageSummarizer struct {
+	client   *llm.Client
+	provider string
+	model    string
+}
+
+func newStageSummarizerFromRuntimes(runtimes map[string]ProviderRuntime, provider string, model string) (StageSummarizer, error) {
+	if strings.TrimSpace(provider) == "" || strings.TrimSpace(model) == "" {
+		return nil, fmt.Errorf("stage summarizer requires provider and model")
+	}
+	client, err := newAPIClientFromProviderRuntimes(runtimes)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("stage summarizer requires an API client")
+	}
+	return &llmStageSummarizer{client: client, provider: normalizeProviderKey(provider), model: strings.TrimSpace(model)}, nil
+}
+
+// newStageSummarizerFromConfig returns nil (no summarizer) unless
+// fidelity.summary.enabled is set.
+func newStageSummarizerFromConfig(cfg *RunConfigFile, runtimes map[string]ProviderRuntime) (StageSummarizer, error) {
+	if cfg == nil || cfg.Fidelity.Summary.Enabled == nil || !*cfg.Fidelity.Summary.Enabled {
+		return nil, nil
+	}
+	return newStageSummarizerFromRuntimes(runtimes, cfg.Fidelity.Summary.LLMProvider, cfg.Fidelity.Summary.LLMModel)
+}
+
+func (s *llmStageSummarizer) Summarize(ctx context.Context, stage StageDigest, opts StageSummaryOptions) (string, error) {
+	if s == nil || s.client == nil {
+		return "", fmt.Errorf("stage summarizer is not configured")
+	}
+	words, ok := summaryLevelWordBudget[opts.Level]
+	if !ok {
+		return "", fmt.Errorf("unknown summary level: %q", opts.Level)
+	}
+	req := llm.Request{
+		Provider: s.provider,
+		Model:    s.model,
+		Messages: []llm.Message{
+			llm.System(fmt.Sprintf("You summarize one completed stage of an automated software pipeline for the agent running the next stage. "+
+				"State what the stage did, what it decided or produced, which files changed, and any open problems. "+
+				"Be factual; do not speculate. Reply in plain prose or terse bullets, at most %d words.", words)),
+			llm.User(buildStageSummaryPrompt(stage, opts)),
+		},
+	}
+	resp, err := s.client.Complete(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Text()), nil
+}
+
+func buildStageSummaryPrompt(stage StageDigest, opts StageSummaryOptions) string {
+	var b strings.Builder
+	if goal := strings.TrimSpace(opts.Goal); goal != "" {
+		b.WriteString("Pipeline goal: ")
+		b.WriteString(goal)
+		b.WriteString("\n")
+	}
+	b.WriteString("Stage: ")
+	b.WriteString(stage.NodeID)
+	b.WriteString("\n")
+	if stage.Status != "" {
+		b.WriteString("Status: ")
+		b.WriteString(stage.Status)
+		b.WriteString("\n")
+	}
+	if stage.FailureReason != "" {
+		b.WriteString("Failure reason: ")
+		b.WriteString(stage.FailureReason)
+		b.WriteString("\n")
+	}
+	if stage.Notes != "" {
+		b.WriteString("Notes: ")
+		b.WriteString(stage.Notes)
+		b.WriteString("\n")
+	}
+	if stage.Response != "" {
+		b.WriteString("\n### Agent response\n")
+		b.WriteString(stage.Response)
+		b.WriteString("\n")
+	}
+	if stage.Diff != "" {
+		b.WriteString("\n### Git diff\n")
+		b.WriteString(stage.Diff)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// stageSummaryCache is persisted to {logs_root}/{node}/summary_<level>.json.
+// InputSHA256 ties the cached summary to the stage artifacts it was built from,
+// so a revisited node (loop, retry target) is re-summarized.
+type stageSummaryCache struct {
+	NodeID      string    `json:"node_id"`
+	Level       string    `json:"level"`
+	InputSHA256 string    `json:"input_sha256"`
+	Summary     string    `json:"summary"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func stageSummaryCachePath(logsRoot string, nodeID string, level string) string {
+	return filepath.Join(logsRoot, nodeID, "summary_"+level+".json")
+}
+
+func stageDigestSHA256(stage StageDigest, opts StageSummaryOptions) string {
+	b, _ := json.Marshal(struct {
+		Stage StageDigest         `json:"stage"`
+		Opts  StageSummaryOptions `json:"opts"`
+	}{stage, opts})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// collectStageDigest gathers status.json, response.md and the stage's checkpoint
+// diff. ok is false when the stage left nothing worth summarizing.
+func (e *Engine) collectStageDigest(nodeID string) (StageDigest, bool) {
+	stageDir := filepath.Join(e.LogsRoot, nodeID)
+	d := StageDigest{NodeID: nodeID}
+	if b, err := os.ReadFile(filepath.Join(stageDir, "status.json")); err == nil {
+		if out, err := runtime.DecodeOutcomeJSON(b); err == nil {
+			d.Status = string(out.Status)
+			d.Notes = strings.TrimSpace(out.Notes)
+			d.FailureReason = strings.TrimSpace(out.FailureReason)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(stageDir, "response.md")); err == nil {
+		d.Response = truncateMiddle(strings.TrimSpace(string(b)), summaryMaxResponseChars)
+	}
+	d.Diff = truncateMiddle(stageCheckpointDiff(e.WorktreeDir, e.Options.RunID, nodeID), summaryMaxDiffChars)
+	if d.Status == "" && d.Response == "" && d.Diff == "" {
+		return d, false
+	}
+	return d, true
+}
+
+// stageCheckpointDiff returns the patch of the most recent checkpoint commit for nodeID.
+func stageCheckpointDiff(worktreeDir string, runID string, nodeID string) string {
+	if strings.TrimSpace(worktreeDir) == "" {
+		return ""
+	}
+	cctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	subject := fmt.Sprintf("attractor(%s): %s (", runID, nodeID)
+	shaOut, err := exec.CommandContext(cctx, "git", "-C", worktreeDir, "log", "-1", "--format=%H", "--fixed-strings", "--grep", subject).Output()
+	if err != nil {
+		return ""
+	}
+	sha := strings.TrimSpace(string(shaOut))
+	if sha == "" {
+		return ""
+	}
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(cctx, "git", "-C", worktreeDir, "show", "--stat", "--patch", "--format=", sha)
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// truncateMiddle keeps about n bytes of s, split between its start and end
+// on rune boundaries.
+func truncateMiddle(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+	head, tail := n/2, len(s)-n/2
+	for head > 0 && !utf8.RuneStart(s[head]) {
+		head--
+	}
+	for tail < len(s) && !utf8.RuneStart(s[tail]) {
+		tail++
+	}
+	return s[:head] + fmt.Sprintf("\n... (%d chars elided) ...\n", utf8.RuneCountInString(s[head:tail])) + s[tail:]
+}
+
+// priorStageSummaries renders a "Prior stages" block for summary:<level>
+// fidelity. It returns "" when no summarizer is configured so callers fall back
+// to the plain context preamble.
+func (e *Engine) priorStageSummaries(ctx context.Context, currentNodeID string, level string, goal string, completed []string) string {
+	if e == nil || e.StageSummarizer == nil {
+		return ""
+	}
+	if _, ok := summaryLevelWordBudget[level]; !ok {
+		return ""
+	}
+	stages := priorStageIDs(e, currentNodeID, completed)
+	if len(stages) == 0 {
+		return ""
+	}
+	opts := StageSummaryOptions{Goal: strings.TrimSpace(goal), Level: level}
+	lines := []string{"Prior stages:"}
+	for _, id := range stages {
+		digest, ok := e.collectStageDigest(id)
+		if !ok {
+			continue
+		}
+		summary, cached, err := e.stageSummary(ctx, digest, opts)
+		if err != nil {
+			e.Warn(fmt.Sprintf("fidelity summary for stage %s failed: %v", id, err))
+			continue
+		}
+		e.appendProgress(map[string]any{
+			"event":   "fidelity_summary",
+			"node_id": currentNodeID,
+			"stage":   id,
+			"level":   level,
+			"cached":  cached,
+		})
+		if summary == "" {
+			continue
+		}
+		header := fmt.Sprintf("## %s", id)
+		if digest.Status != "" {
+			header += fmt.Sprintf(" (%s)", digest.Status)
+		}
+		lines = append(lines, header, summary)
+	}
+	if len(lines) == 1 {
+		return ""
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *Engine) stageSummary(ctx context.Context, digest StageDigest, opts StageSummaryOptions) (summary string, cached bool, err error) {
+	inputSHA := stageDigestSHA256(digest, opts)
+	cachePath := stageSummaryCachePath(e.LogsRoot, digest.NodeID, opts.Level)
+	if b, readErr := os.ReadFile(cachePath); readErr == nil {
+		var c stageSummaryCache
+		if json.Unmarshal(b, &c) == nil && c.InputSHA256 == inputSHA {
+			return c.Summary, true, nil
+		}
+	}
+	summary, err = e.StageSummarizer.Summarize(ctx, digest, opts)
+	if err != nil {
+		return "", false, err
+	}
+	if writeErr := writeJSON(cachePath, stageSummaryCache{
+		NodeID:      digest.NodeID,
+		Level:       opts.Level,
+		InputSHA256: inputSHA,
+		Summary:     summary,
+		CreatedAt:   time.Now().UTC(),
+	}); writeErr != nil {
+		e.Warn(fmt.Sprintf("write %s: %v", cachePath, writeErr))
+	}
+	return summary, false, nil
+}
+
+// priorStageIDs returns completed stage IDs in order of their latest visit,
+// excluding the current node and start/exit nodes, capped to the most recent
+// summaryMaxPriorStages.
+func priorStageIDs(e *Engine, currentNodeID string, completed []string) []string {
+	lastIdx := map[string]int{}
+	for i, id := range completed {
+		lastIdx[id] = i
+	}
+	out := make([]string, 0, len(lastIdx))
+	for i, id := range completed {
+		if lastIdx[id] != i || id == currentNodeID {
+			continue
+		}
+		if e.Graph != nil {
+			if n := e.Graph.Nodes[id]; n != nil && (isTerminal(n) || id == findStartNodeID(e.Graph)) {
+				continue
+			}
+		}
+		out = append(out, id)
+	}
+	if len(out) > summaryMaxPriorStages {
+		out = out[len(out)-summaryMaxPriorStages:]
+	}
+	return out
+}
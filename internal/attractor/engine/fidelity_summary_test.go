@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+type fakeStageSummarizer struct {
+	mu    sync.Mutex
+	calls []StageSummaryOptions
+	nodes []string
+}
+
+func (f *fakeStageSummarizer) Summarize(ctx context.Context, stage StageDigest, opts StageSummaryOptions) (string, error) {
+	_ = ctx
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, opts)
+	f.nodes = append(f.nodes, stage.NodeID)
+	return fmt.Sprintf("summary of %s at %s", stage.NodeID, opts.Level), nil
+}
+
+func runWithStageSummarizerForTest(t *testing.T, dot []byte, summarizer StageSummarizer) *Result {
+	t.Helper()
+	repo := initTestRepo(t)
+	opts := RunOptions{RepoPath: repo, RunID: "summary-test", LogsRoot: t.TempDir()}
+	if err := opts.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults: %v", err)
+	}
+	g, _, err := Prepare(dot)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	eng := newBaseEngine(g, dot, opts)
+	eng.CodergenBackend = &SimulatedCodergenBackend{}
+	eng.StageSummarizer = summarizer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	res, err := eng.run(ctx)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return res
+}
+
+func TestSummaryFidelity_PrependsLLMStageSummaries(t *testing.T) {
+	dot := []byte(`
+digraph G {
+  graph [goal="ship it"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="plan"]
+  b [shape=box, llm_provider=openai, llm_model=gpt-5.2, fidelity="summary:medium", prompt="implement"]
+  start -> a -> b -> exit
+}
+`)
+	fake := &fakeStageSummarizer{}
+	res := runWithStageSummarizerForTest(t, dot, fake)
+
+	prompt, err := os.ReadFile(filepath.Join(res.LogsRoot, "b", "prompt.md"))
+	if err != nil {
+		t.Fatalf("read b/prompt.md: %v", err)
+	}
+	for _, want := range []string{"Prior stages:", "## a (success)", "summary of a at medium"} {
+		if !strings.Contains(string(prompt), want) {
+			t.Fatalf("b/prompt.md missing %q:\n%s", want, prompt)
+		}
+	}
+	if len(fake.nodes) != 1 || fake.nodes[0] != "a" {
+		t.Fatalf("summarized nodes: got %v want [a]", fake.nodes)
+	}
+	if fake.calls[0].Goal != "ship it" {
+		t.Fatalf("summary goal: got %q", fake.calls[0].Goal)
+	}
+	if _, err := os.Stat(stageSummaryCachePath(res.LogsRoot, "a", "medium")); err != nil {
+		t.Fatalf("expected cached summary for stage a: %v", err)
+	}
+}
+
+func TestSummaryFidelity_WithoutSummarizerKeepsContextPreamble(t *testing.T) {
+	dot := []byte(`
+digraph G {
+  graph [goal="ship it"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="plan"]
+  b [shape=box, llm_provider=openai, llm_model=gpt-5.2, fidelity="summary:high", prompt="implement"]
+  start -> a -> b -> exit
+}
+`)
+	res := runWithStageSummarizerForTest(t, dot, nil)
+	prompt, err := os.ReadFile(filepath.Join(res.LogsRoot, "b", "prompt.md"))
+	if err != nil {
+		t.Fatalf("read b/prompt.md: %v", err)
+	}
+	if strings.Contains(string(prompt), "Prior stages:") {
+		t.Fatalf("did not expect stage summaries without a summarizer:\n%s", prompt)
+	}
+	if !strings.Contains(string(prompt), "Fidelity: summary:high") {
+		t.Fatalf("expected context preamble:\n%s", prompt)
+	}
+}
+
+func TestStageSummary_CachesByStageInputs(t *testing.T) {
+	logsRoot := t.TempDir()
+	fake := &fakeStageSummarizer{}
+	eng := &Engine{LogsRoot: logsRoot, StageSummarizer: fake}
+	opts := StageSummaryOptions{Goal: "g", Level: "low"}
+	digest := StageDigest{NodeID: "a", Status: "success", Response: "did things"}
+
+	if _, cached, err := eng.stageSummary(context.Background(), digest, opts); err != nil || cached {
+		t.Fatalf("first stageSummary: cached=%v err=%v", cached, err)
+	}
+	if _, cached, err := eng.stageSummary(context.Background(), digest, opts); err != nil || !cached {
+		t.Fatalf("second stageSummary: cached=%v err=%v", cached, err)
+	}
+	digest.Response = "did other things"
+	if _, cached, err := eng.stageSummary(context.Background(), digest, opts); err != nil || cached {
+		t.Fatalf("changed inputs should miss cache: cached=%v err=%v", cached, err)
+	}
+	if len(fake.nodes) != 2 {
+		t.Fatalf("summarizer calls: got %d want 2", len(fake.nodes))
+	}
+}
+
+func TestTruncateMiddle_KeepsRunesWhole(t *testing.T) {
+	got := truncateMiddle("ééééé", 4)
+	if want := "é\n... (3 chars elided) ...\né"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	if !utf8.ValidString(got) {
+		t.Fatalf("invalid UTF-8: %q", got)
+	}
+	if got := truncateMiddle("short", 10); got != "short" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+)
+
+// threadHistory is the persisted agent conversation for a fidelity=full thread.
+// Nodes that resolve to the same thread key continue this conversation instead
+// of starting a fresh agent session. It lives under logs_root so resume can
+// pick the thread back up.
+type threadHistory struct {
+	ThreadKey string       `json:"thread_key"`
+	Provider  string       `json:"provider"`
+	Model     string       `json:"model"`
+	Nodes     []string     `json:"nodes,omitempty"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Turns     []agent.Turn `json:"turns"`
+}
+
+func threadHistoryPath(logsRoot string, threadKey string) string {
+	return filepath.Join(logsRoot, "threads", safePathToken(threadKey)+".json")
+}
+
+// loadThreadHistory returns the persisted thread, or nil when none exists yet.
+func loadThreadHistory(logsRoot string, threadKey string) (*threadHistory, error) {
+	if strings.TrimSpace(logsRoot) == "" || strings.TrimSpace(threadKey) == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(threadHistoryPath(logsRoot, threadKey))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var th threadHistory
+	if err := json.Unmarshal(b, &th); err != nil {
+		return nil, fmt.Errorf("decode thread %q: %w", threadKey, err)
+	}
+	return &th, nil
+}
+
+func saveThreadHistory(logsRoot string, th *threadHistory) error {
+	if th == nil || strings.TrimSpace(logsRoot) == "" || strings.TrimSpace(th.ThreadKey) == "" {
+		return nil
+	}
+	th.UpdatedAt = time.Now().UTC()
+	return writeJSON(threadHistoryPath(logsRoot, th.ThreadKey), th)
+}
+
+func threadHistoryExists(logsRoot string, threadKey string) bool {
+	if strings.TrimSpace(logsRoot) == "" || strings.TrimSpace(threadKey) == "" {
+		return false
+	}
+	_, err := os.Stat(threadHistoryPath(logsRoot, threadKey))
+	return err == nil
+}
+
+// activeThreadKey returns the thread key for the node currently executing when
+// it resolved to fidelity=full, or "" otherwise.
+func activeThreadKey(execCtx *Execution) string {
+	if execCtx == nil || execCtx.Engine == nil {
+		return ""
+	}
+	if strings.TrimSpace(execCtx.Engine.lastResolvedFidelity) != "full" {
+		return ""
+	}
+	return strings.TrimSpace(execCtx.Engine.lastResolvedThreadKey)
+}
+
+// seedThreadTurns loads prior turns for threadKey that can be replayed to the
+// given provider/model. Conversations are not portable across providers
+// (thinking signatures, tool-call IDs), so a provider mismatch starts fresh.
+func seedThreadTurns(execCtx *Execution, nodeID string, threadKey string, provider string, modelID string) []agent.Turn {
+	if threadKey == "" {
+		return nil
+	}
+	th, err := loadThreadHistory(execCtx.LogsRoot, threadKey)
+	if err != nil {
+		warnEngine(execCtx, fmt.Sprintf("thread %q: %v (starting fresh session)", threadKey, err))
+		return nil
+	}
+	if th == nil || len(th.Turns) == 0 {
+		return nil
+	}
+	if normalizeProviderKey(th.Provider) != normalizeProviderKey(provider) {
+		warnEngine(execCtx, fmt.Sprintf("thread %q: provider changed (%s -> %s); node %s starts a fresh session", threadKey, th.Provider, provider, nodeID))
+		return nil
+	}
+	if execCtx.Engine != nil {
+		execCtx.Engine.appendProgress(map[string]any{
+			"event":       "thread_resumed",
+			"node_id":     nodeID,
+			"thread_key":  threadKey,
+			"turns":       len(th.Turns),
+			"prior_nodes": append([]string{}, th.Nodes...),
+			"provider":    provider,
+			"model":       modelID,
+		})
+	}
+	return th.Turns
+}
+
+// persistThreadTurns records the session history for threadKey after a
+// successful node so later nodes on the same thread can continue it.
+func persistThreadTurns(execCtx *Execution, nodeID string, threadKey string, provider string, modelID string, turns []agent.Turn) {
+	if threadKey == "" {
+		return
+	}
+	var nodes []string
+	if prev, err := loadThreadHistory(execCtx.LogsRoot, threadKey); err == nil && prev != nil {
+		nodes = append(nodes, prev.Nodes...)
+	}
+	nodes = append(nodes, nodeID)
+	th := &threadHistory{
+		ThreadKey: threadKey,
+		Provider:  provider,
+		Model:     modelID,
+		Nodes:     nodes,
+		Turns:     turns,
+	}
+	if err := saveThreadHistory(execCtx.LogsRoot, th); err != nil {
+		warnEngine(execCtx, fmt.Sprintf("persist thread %q: %v", threadKey, err))
+	}
+}
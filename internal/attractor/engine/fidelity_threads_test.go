@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+	"github.com/danshapiro/kilroy/internal/providerspec"
+)
+
+type recordingAdapter struct {
+	name string
+
+	mu       sync.Mutex
+	requests []llm.Request
+}
+
+func (a *recordingAdapter) Name() string { return a.name }
+func (a *recordingAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	_ = ctx
+	a.mu.Lock()
+	a.requests = append(a.requests, req)
+	n := len(a.requests)
+	a.mu.Unlock()
+	return llm.Response{Provider: a.name, Model: req.Model, Message: llm.Assistant(fmt.Sprintf("answer-%d", n))}, nil
+}
+func (a *recordingAdapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	_ = ctx
+	_ = req
+	return nil, fmt.Errorf("stream not implemented")
+}
+
+func newThreadTestRouter(t *testing.T, adapter llm.ProviderAdapter) *CodergenRouter {
+	t.Helper()
+	r := NewCodergenRouterWithRuntimes(&RunConfigFile{}, nil, map[string]ProviderRuntime{
+		"openai": {
+			Key:     "openai",
+			Backend: BackendAPI,
+			API:     providerspec.APISpec{Protocol: providerspec.ProtocolOpenAIResponses},
+		},
+	})
+	r.apiClientFactory = func(map[string]ProviderRuntime) (*llm.Client, error) {
+		c := llm.NewClient()
+		c.Register(adapter)
+		return c, nil
+	}
+	return r
+}
+
+func TestRunAPI_FullFidelityThread_ReusesConversationAcrossNodes(t *testing.T) {
+	adapter := &recordingAdapter{name: "openai"}
+	r := newThreadTestRouter(t, adapter)
+
+	logsRoot := t.TempDir()
+	eng := &Engine{LogsRoot: logsRoot, lastResolvedFidelity: "full", lastResolvedThreadKey: "impl"}
+	execCtx := &Execution{
+		Context:     runtime.NewContext(),
+		LogsRoot:    logsRoot,
+		WorktreeDir: t.TempDir(),
+		Engine:      eng,
+	}
+
+	plan := model.NewNode("plan")
+	if _, _, err := r.runAPI(context.Background(), execCtx, plan, "openai", "gpt-5.2", "make a plan"); err != nil {
+		t.Fatalf("runAPI(plan): %v", err)
+	}
+	implement := model.NewNode("implement")
+	if _, _, err := r.runAPI(context.Background(), execCtx, implement, "openai", "gpt-5.2", "implement the plan"); err != nil {
+		t.Fatalf("runAPI(implement): %v", err)
+	}
+
+	adapter.mu.Lock()
+	reqs := append([]llm.Request{}, adapter.requests...)
+	adapter.mu.Unlock()
+	if len(reqs) != 2 {
+		t.Fatalf("requests: got %d want 2", len(reqs))
+	}
+	// Second request: system + plan input + plan answer + implement input.
+	msgs := reqs[1].Messages
+	if len(msgs) != 4 {
+		t.Fatalf("second request messages: got %d want 4: %+v", len(msgs), msgs)
+	}
+	if msgs[1].Text() != "make a plan" || msgs[2].Text() != "answer-1" || msgs[3].Text() != "implement the plan" {
+		t.Fatalf("second request did not continue the thread: %+v", msgs)
+	}
+
+	th, err := loadThreadHistory(logsRoot, "impl")
+	if err != nil || th == nil {
+		t.Fatalf("loadThreadHistory: th=%v err=%v", th, err)
+	}
+	if len(th.Turns) != 4 {
+		t.Fatalf("persisted turns: got %d want 4", len(th.Turns))
+	}
+	if len(th.Nodes) != 2 || th.Nodes[0] != "plan" || th.Nodes[1] != "implement" {
+		t.Fatalf("persisted nodes: %v", th.Nodes)
+	}
+}
+
+func TestRunAPI_NonFullFidelity_DoesNotPersistThread(t *testing.T) {
+	adapter := &recordingAdapter{name: "openai"}
+	r := newThreadTestRouter(t, adapter)
+
+	logsRoot := t.TempDir()
+	eng := &Engine{LogsRoot: logsRoot, lastResolvedFidelity: "compact"}
+	execCtx := &Execution{
+		Context:     runtime.NewContext(),
+		LogsRoot:    logsRoot,
+		WorktreeDir: t.TempDir(),
+		Engine:      eng,
+	}
+	if _, _, err := r.runAPI(context.Background(), execCtx, model.NewNode("a"), "openai", "gpt-5.2", "hello"); err != nil {
+		t.Fatalf("runAPI: %v", err)
+	}
+	if _, err := os.Stat(threadHistoryPath(logsRoot, "a")); !os.IsNotExist(err) {
+		t.Fatalf("expected no thread history for compact fidelity, stat err=%v", err)
+	}
+}
+
+func TestSeedThreadTurns_ProviderMismatchStartsFresh(t *testing.T) {
+	logsRoot := t.TempDir()
+	if err := saveThreadHistory(logsRoot, &threadHistory{
+		ThreadKey: "impl",
+		Provider:  "anthropic",
+		Model:     "claude-opus-4-6",
+		Turns:     []agent.Turn{{Kind: agent.TurnUserInput, Message: llm.User("hi")}},
+	}); err != nil {
+		t.Fatalf("saveThreadHistory: %v", err)
+	}
+	execCtx := &Execution{LogsRoot: logsRoot, Engine: &Engine{LogsRoot: logsRoot}}
+	if got := seedThreadTurns(execCtx, "n", "impl", "openai", "gpt-5.2"); len(got) != 0 {
+		t.Fatalf("expected no seeded turns across providers, got %d", len(got))
+	}
+	if !threadHistoryExists(logsRoot, "impl") {
+		t.Fatalf("threadHistoryExists: want true")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -72,9 +73,11 @@ func NewDefaultRegistry() *HandlerRegistry {
 	reg.Register("conditional", &ConditionalHandler{})
 	reg.Register("wait.human", &WaitHumanHandler{})
 	reg.Register("parallel", &ParallelHandler{})
+	reg.Register("parallel.foreach", &ForEachHandler{})
 	reg.Register("parallel.fan_in", &FanInHandler{})
 	reg.Register("tool", &ToolHandler{})
 	reg.Register("stack.manager_loop", &ManagerLoopHandler{})
+	reg.Register("stack.call", &StackCallHandler{})
 	reg.defaultHandler = &CodergenHandler{}
 	reg.Register("codergen", reg.defaultHandler)
 	return reg
@@ -271,6 +274,16 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 	if basePrompt == "" {
 		basePrompt = node.Label()
 	}
+	if exec != nil {
+		basePrompt = expandItemVars(basePrompt, exec.Context)
+		if isPromptTemplate(node) {
+			rendered, err := renderPromptTemplate(exec, node, basePrompt)
+			if err != nil {
+				return runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("prompt template: %v", err)}, nil
+			}
+			basePrompt = strings.TrimSpace(rendered)
+		}
+	}
 
 	// Fidelity preamble (attractor-spec context fidelity): when fidelity is not `full`, synthesize
 	// a context carryover preamble at execution time.
@@ -295,7 +308,15 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 		if exec != nil && exec.Context != nil {
 			prevNode = exec.Context.GetString("previous_node", "")
 		}
-		preamble := buildFidelityPreamble(exec.Context, runID, goal, fidelity, prevNode, decodeCompletedNodes(exec.Context))
+		completed := decodeCompletedNodes(exec.Context)
+		preamble := buildFidelityPreamble(exec.Context, runID, goal, fidelity, prevNode, completed)
+		// summary:<level> fidelity: prepend LLM-written summaries of prior stages
+		// when a summarizer is configured (fidelity.summary in run.yaml).
+		if level, ok := strings.CutPrefix(fidelity, "summary:"); ok && exec != nil && exec.Engine != nil {
+			if summaries := exec.Engine.priorStageSummaries(ctx, node.ID, level, goal, completed); summaries != "" {
+				preamble = strings.TrimSpace(preamble) + "\n\n" + summaries
+			}
+		}
 		promptText = strings.TrimSpace(preamble) + "\n\n" + basePrompt
 	}
 	if preamble := strings.TrimSpace(contract.PromptPreamble); preamble != "" {
@@ -348,6 +369,9 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 	}
 	if exec.Engine != nil {
 		exec.Engine.cxdbPrompt(ctx, node.ID, promptText)
+		if out, ok := exec.Engine.memoizedStage(node, promptText, fidelity); ok {
+			return out, nil
+		}
 	}
 
 	backend := exec.Engine.CodergenBackend
@@ -594,7 +618,7 @@ func (h *ToolHandler) Execute(ctx context.Context, execCtx *Execution, node *mod
 	defer cancel()
 	cmd := exec.CommandContext(cctx, "bash", "-c", cmdStr)
 	cmd.Dir = execCtx.WorktreeDir
-	cmd.Env = buildBaseNodeEnv(artifactPolicyFromExecution(execCtx))
+	cmd.Env = mergeEnvWithOverrides(buildBaseNodeEnv(artifactPolicyFromExecution(execCtx)), buildStageRuntimeEnv(execCtx, node.ID))
 	// Avoid hanging on interactive reads; tool_command doesn't provide a way to supply stdin.
 	cmd.Stdin = strings.NewReader("")
 	stdoutPath := filepath.Join(stageDir, "stdout.log")
@@ -732,13 +756,12 @@ func parseDuration(s string, def time.Duration) time.Duration {
 	// DOT durations are like "900s", "15m", "250ms", "2h", "1d".
 	// Support 'd' as 24h.
 	if strings.HasSuffix(s, "d") {
-		base, ok := parseIntPrefix(strings.TrimSuffix(s, "d"))
-		if ok {
+		if base, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
 			return time.Duration(base) * 24 * time.Hour
 		}
 	}
 	// Common shorthand in DOT specs: bare integers mean seconds.
-	if base, ok := parseIntPrefix(s); ok {
+	if base, err := strconv.Atoi(s); err == nil {
 		return time.Duration(base) * time.Second
 	}
 	d, err := time.ParseDuration(s)
@@ -748,15 +771,6 @@ func parseDuration(s string, def time.Duration) time.Duration {
 	return d
 }
 
-func parseIntPrefix(s string) (int, bool) {
-	var n int
-	_, err := fmt.Sscanf(s, "%d", &n)
-	if err != nil {
-		return 0, false
-	}
-	return n, true
-}
-
 type Interviewer interface {
 	Ask(question Question) Answer
 	AskMultiple(questions []Question) []Answer
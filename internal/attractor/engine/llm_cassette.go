@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// llmCassetteDirName is the logs_root subdirectory holding recorded API traffic.
+const llmCassetteDirName = "llm_cassette"
+
+var cassetteTodayRE = regexp.MustCompile(`Today's date: \d{4}-\d{2}-\d{2}`)
+
+// newRunCassette returns the cassette for a run: replay from another run's
+// logs_root when ReplayFrom is set, record into this run's logs_root when
+// RecordLLM is set, otherwise nil.
+//
+// Run-specific strings (worktree, logs_root, run id) are swapped for
+// placeholders before hashing and storing, and swapped back on replay, so a
+// rerun with fresh paths still matches the recorded requests.
+func newRunCassette(opts RunOptions) (*llm.Cassette, error) {
+	var c *llm.Cassette
+	var err error
+	switch {
+	case strings.TrimSpace(opts.ReplayFrom) != "":
+		c, err = llm.NewCassette(filepath.Join(opts.ReplayFrom, llmCassetteDirName), llm.CassetteReplay)
+	case opts.RecordLLM:
+		c, err = llm.NewCassette(filepath.Join(opts.LogsRoot, llmCassetteDirName), llm.CassetteRecord)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Longest first: the worktree normally lives under logs_root, which contains the run id.
+	pairs := [][2]string{
+		{opts.WorktreeDir, "{{kilroy.worktree}}"},
+		{opts.LogsRoot, "{{kilroy.logs_root}}"},
+		{opts.RunID, "{{kilroy.run_id}}"},
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return len(pairs[i][0]) > len(pairs[j][0]) })
+	var norm, expand []string
+	for _, p := range pairs {
+		if strings.TrimSpace(p[0]) == "" {
+			continue
+		}
+		norm = append(norm, p[0], p[1])
+		expand = append(expand, p[1], p[0])
+	}
+	normalizer := strings.NewReplacer(norm...)
+	expander := strings.NewReplacer(expand...)
+	c.Normalize = func(s string) string {
+		return cassetteTodayRE.ReplaceAllString(normalizer.Replace(s), "Today's date: {{kilroy.today}}")
+	}
+	c.Expand = expander.Replace
+	return c, nil
+}
+
+// newReplayAPIClient builds a client with a placeholder adapter per API
+// provider so requests route to the cassette without credentials. The
+// adapters are only reached on a cassette miss, which the cassette reports
+// first.
+func newReplayAPIClient(runtimes map[string]ProviderRuntime) *llm.Client {
+	c := llm.NewClient()
+	for _, key := range sortedKeys(runtimes) {
+		if runtimes[key].Backend != BackendAPI {
+			continue
+		}
+		c.Register(replayOnlyAdapter{name: key})
+	}
+	return c
+}
+
+type replayOnlyAdapter struct{ name string }
+
+func (a replayOnlyAdapter) Name() string { return a.name }
+
+func (a replayOnlyAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	return llm.Response{}, &llm.ConfigurationError{Message: fmt.Sprintf("provider %s is offline during replay", a.name)}
+}
+
+func (a replayOnlyAdapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	return nil, &llm.ConfigurationError{Message: fmt.Sprintf("provider %s is offline during replay", a.name)}
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func cassetteTestConfig(t *testing.T, repo string) *RunConfigFile {
+	t.Helper()
+	pinned := filepath.Join(t.TempDir(), "pinned.json")
+	if err := os.WriteFile(pinned, []byte(`{"data":[{"id":"openai/gpt-5.2","supported_parameters":["tools"],"context_length":64000}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.LLM.Providers = map[string]ProviderConfig{
+		"openai": {Backend: BackendAPI, Failover: []string{}},
+	}
+	cfg.ModelDB.OpenRouterModelInfoPath = pinned
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Git.RunBranchPrefix = "attractor/run"
+	return cfg
+}
+
+func cassetteTestDot(prompt string) []byte {
+	return []byte(`
+digraph G {
+  graph [goal="test"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="` + prompt + `"]
+  start -> a -> exit
+}
+`)
+}
+
+func TestRunWithConfig_RecordThenReplayLLMTraffic(t *testing.T) {
+	t.Setenv("KILROY_PREFLIGHT_PROMPT_PROBES", "off")
+	repo := initTestRepo(t)
+
+	var calls atomic.Int32
+	openaiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+  "id": "resp_1",
+  "model": "gpt-5.2",
+  "output": [{"type": "message", "content": [{"type":"output_text", "text":"Done."}]}],
+  "usage": {"input_tokens": 1, "output_tokens": 2, "total_tokens": 3}
+}`))
+	}))
+	t.Cleanup(openaiSrv.Close)
+	t.Setenv("OPENAI_API_KEY", "k")
+	t.Setenv("OPENAI_BASE_URL", openaiSrv.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	recorded := t.TempDir()
+	res, err := RunWithConfig(ctx, cassetteTestDot("say hi"), cassetteTestConfig(t, repo), RunOptions{
+		RunID:       "cassette-record",
+		LogsRoot:    recorded,
+		DisableCXDB: true,
+		RecordLLM:   true,
+	})
+	if err != nil {
+		t.Fatalf("record run: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("record run status: %+v", res)
+	}
+	recordedCalls := calls.Load()
+	entries, _ := filepath.Glob(filepath.Join(recorded, llmCassetteDirName, "*.json"))
+	if recordedCalls == 0 || len(entries) != int(recordedCalls) {
+		t.Fatalf("expected one cassette entry per provider call, got %d entries for %d calls", len(entries), recordedCalls)
+	}
+	b, _ := os.ReadFile(entries[0])
+	if strings.Contains(string(b), recorded) || !strings.Contains(string(b), "{{kilroy.worktree}}") {
+		t.Fatalf("cassette entry should mask run-specific paths:\n%s", b)
+	}
+
+	// Replay offline: no key, and any provider call is a failure.
+	t.Setenv("OPENAI_API_KEY", "")
+	res, err = RunWithConfig(ctx, cassetteTestDot("say hi"), cassetteTestConfig(t, repo), RunOptions{
+		RunID:       "cassette-replay",
+		LogsRoot:    t.TempDir(),
+		DisableCXDB: true,
+		ReplayFrom:  recorded,
+	})
+	if err != nil {
+		t.Fatalf("replay run: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("replay run status: %+v", res)
+	}
+	if got := calls.Load(); got != recordedCalls {
+		t.Fatalf("replay reached the provider: %d calls after recording %d", got, recordedCalls)
+	}
+
+	// A changed prompt is a cassette miss and must not fall through to the network.
+	missLogs := t.TempDir()
+	if _, err := RunWithConfig(ctx, cassetteTestDot("say bye"), cassetteTestConfig(t, repo), RunOptions{
+		RunID:       "cassette-miss",
+		LogsRoot:    missLogs,
+		DisableCXDB: true,
+		ReplayFrom:  recorded,
+	}); err != nil {
+		t.Fatalf("miss run: %v", err)
+	}
+	if got := calls.Load(); got != recordedCalls {
+		t.Fatalf("cassette miss reached the provider: %d calls", got)
+	}
+	status, _ := os.ReadFile(filepath.Join(missLogs, "a", "status.json"))
+	if !strings.Contains(string(status), "cassette miss") {
+		t.Fatalf("expected the stage failure to name the cassette miss, got:\n%s", status)
+	}
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+)
+
+const localModelDiscoveryTimeout = 10 * time.Second
+
+// discoveredModelsSnapshotPath is where a run keeps the models discovered for
+// provider, next to the OpenRouter catalog snapshot.
+func discoveredModelsSnapshotPath(logsRoot, provider string) string {
+	return filepath.Join(logsRoot, "modeldb", provider+"_models.json")
+}
+
+// discoverProviderModels lists the models served by each API provider with a
+// models endpoint (the local provider), snapshots them under logs_root and
+// merges them into catalog with zero pricing. Unlike hosted catalogs the
+// listing is authoritative, so a graph model the server does not serve fails
+// preflight. Replays reuse the recorded run's snapshot instead of the network.
+func discoverProviderModels(ctx context.Context, g *model.Graph, runtimes map[string]ProviderRuntime, catalog *modeldb.Catalog, opts RunOptions) ([]providerPreflightCheck, error) {
+	var checks []providerPreflightCheck
+	for _, provider := range usedAPIProviders(g, runtimes) {
+		rt := runtimes[provider]
+		if strings.TrimSpace(rt.API.ModelsPath) == "" {
+			continue
+		}
+		baseURL := resolveBuiltInBaseURLOverride(provider, rt.API.DefaultBaseURL)
+		snapshot := discoveredModelsSnapshotPath(opts.LogsRoot, provider)
+		var payload []byte
+		var served []string
+		if replay := strings.TrimSpace(opts.ReplayFrom); replay != "" {
+			b, err := os.ReadFile(discoveredModelsSnapshotPath(replay, provider))
+			if err != nil {
+				checks = append(checks, providerPreflightCheck{
+					Name:     "provider_model_discovery",
+					Provider: provider,
+					Status:   preflightStatusWarn,
+					Message:  fmt.Sprintf("model discovery skipped during replay: %v", err),
+				})
+				continue
+			}
+			payload = b
+		} else {
+			models, err := modeldb.DiscoverLocalModels(ctx, baseURL, rt.API.ModelsPath, strings.TrimSpace(os.Getenv(rt.API.DefaultAPIKeyEnv)), localModelDiscoveryTimeout)
+			if err != nil {
+				checks = append(checks, providerPreflightCheck{
+					Name:     "provider_model_discovery",
+					Provider: provider,
+					Status:   preflightStatusFail,
+					Message:  fmt.Sprintf("model discovery at %s%s failed: %v", baseURL, rt.API.ModelsPath, err),
+				})
+				return checks, fmt.Errorf("preflight: provider %s model discovery at %s failed (is the server running?): %w", provider, baseURL, err)
+			}
+			if payload, err = modeldb.LocalModelsCatalogJSON(provider, models); err != nil {
+				return checks, err
+			}
+			for _, m := range models {
+				served = append(served, m.ID)
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(snapshot), 0o755); err != nil {
+			return checks, err
+		}
+		if err := os.WriteFile(snapshot, payload, 0o644); err != nil {
+			return checks, err
+		}
+		if err := mergeDiscoveredModels(catalog, snapshot); err != nil {
+			return checks, err
+		}
+		checks = append(checks, providerPreflightCheck{
+			Name:     "provider_model_discovery",
+			Provider: provider,
+			Status:   preflightStatusPass,
+			Message:  fmt.Sprintf("discovered models at %s", baseURL),
+			Details: map[string]any{
+				"snapshot": snapshot,
+				"models":   served,
+			},
+		})
+		for _, modelID := range usedModelsForProviderBackend(g, runtimes, provider, BackendAPI, opts) {
+			if modeldb.CatalogHasProviderModel(catalog, provider, modelID) {
+				continue
+			}
+			checks = append(checks, providerPreflightCheck{
+				Name:     "provider_model_discovery",
+				Provider: provider,
+				Status:   preflightStatusFail,
+				Message:  fmt.Sprintf("model %s is not served at %s", modelID, baseURL),
+				Details: map[string]any{
+					"model":  modelID,
+					"models": served,
+				},
+			})
+			return checks, fmt.Errorf("preflight: provider %s does not serve model %s (available: %s)", provider, modelID, strings.Join(served, ", "))
+		}
+	}
+	return checks, nil
+}
+
+// mergeDiscoveredModels merges a discovered-models snapshot into catalog.
+func mergeDiscoveredModels(catalog *modeldb.Catalog, path string) error {
+	discovered, err := modeldb.LoadCatalogFromOpenRouterJSON(path)
+	if err != nil {
+		return fmt.Errorf("load discovered models %s: %w", path, err)
+	}
+	modeldb.MergeCatalog(catalog, discovered)
+	return nil
+}
+
+// mergeDiscoveredModelSnapshots restores discovered models on resume.
+func mergeDiscoveredModelSnapshots(catalog *modeldb.Catalog, logsRoot string, runtimes map[string]ProviderRuntime) error {
+	for key, rt := range runtimes {
+		if strings.TrimSpace(rt.API.ModelsPath) == "" {
+			continue
+		}
+		path := discoveredModelsSnapshotPath(logsRoot, key)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := mergeDiscoveredModels(catalog, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultCodergenMode is the API codergen mode for nodes that do not set
+// codergen_mode: agent_loop, except for discovered models whose server reports
+// no native tool calling, which fall back to one_shot.
+func defaultCodergenMode(catalog *modeldb.Catalog, rt ProviderRuntime, modelID string) string {
+	if strings.TrimSpace(rt.API.ModelsPath) != "" {
+		if e, ok := modeldb.LookupModelEntry(catalog, rt.Key, modelID); ok && !e.SupportsTools {
+			return "one_shot"
+		}
+	}
+	return "agent_loop"
+}
+
+// sizeProfileForDiscoveredModel applies the served context window to the
+// agent profile of a discovered model.
+func sizeProfileForDiscoveredModel(profile agent.ProviderProfile, catalog *modeldb.Catalog, rt ProviderRuntime, modelID string) agent.ProviderProfile {
+	if strings.TrimSpace(rt.API.ModelsPath) == "" {
+		return profile
+	}
+	if e, ok := modeldb.LookupModelEntry(catalog, rt.Key, modelID); ok {
+		return agent.WithContextWindow(profile, e.ContextWindow)
+	}
+	return profile
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// newFakeOllama serves an Ollama-style model listing, /api/show capabilities
+// and chat completions. It records the tools sent with each chat request.
+func newFakeOllama(t *testing.T) (*httptest.Server, func() map[string]int) {
+	t.Helper()
+	var mu sync.Mutex
+	toolsByModel := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("keyless local provider sent Authorization: %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/v1/models":
+			_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"qwen2.5-coder:7b"},{"id":"gemma:2b"}]}`))
+		case "/api/show":
+			var req struct{ Model string }
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.Model == "gemma:2b" {
+				_, _ = w.Write([]byte(`{"capabilities":["completion"],"model_info":{"gemma.context_length":8192}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"capabilities":["completion","tools"],"model_info":{"qwen2.context_length":32768}}`))
+		case "/v1/chat/completions":
+			b, _ := io.ReadAll(r.Body)
+			var req struct {
+				Model string           `json:"model"`
+				Tools []map[string]any `json:"tools"`
+			}
+			_ = json.Unmarshal(b, &req)
+			mu.Lock()
+			toolsByModel[req.Model] = len(req.Tools)
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"c1","model":"` + req.Model + `","choices":[{"index":0,"message":{"role":"assistant","content":"Done."},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		out := map[string]int{}
+		for k, v := range toolsByModel {
+			out[k] = v
+		}
+		return out
+	}
+}
+
+func localProviderConfig(t *testing.T, repo, baseURL string) *RunConfigFile {
+	t.Helper()
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.LLM.Providers = map[string]ProviderConfig{
+		"ollama": {Backend: BackendAPI, API: ProviderAPIConfig{BaseURL: baseURL}},
+	}
+	cfg.ModelDB.OpenRouterModelInfoPath = writeCatalogForPreflight(t, `{"data":[{"id":"openai/gpt-5.2"}]}`)
+	cfg.ModelDB.OpenRouterModelInfoUpdatePolicy = "pinned"
+	cfg.Git.RunBranchPrefix = "attractor/run"
+	return cfg
+}
+
+func TestRunWithConfig_LocalProviderDiscoversModels(t *testing.T) {
+	t.Setenv("KILROY_PREFLIGHT_PROMPT_PROBES", "off")
+	t.Setenv("LOCAL_LLM_API_KEY", "")
+	repo := initTestRepo(t)
+	srv, toolsSent := newFakeOllama(t)
+	logsRoot := t.TempDir()
+
+	dot := []byte(`
+digraph G {
+  graph [goal="test"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  triage    [shape=box, llm_provider=local, llm_model="gemma:2b", prompt="classify"]
+  implement [shape=box, llm_provider=local, llm_model="qwen2.5-coder:7b", prompt="implement"]
+  start -> triage -> implement -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := RunWithConfig(ctx, dot, localProviderConfig(t, repo, srv.URL), RunOptions{RunID: "local-discovery", LogsRoot: logsRoot, DisableCXDB: true})
+	if err != nil {
+		t.Fatalf("RunWithConfig: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: %+v", res)
+	}
+
+	cat, err := modeldb.LoadCatalogFromOpenRouterJSON(filepath.Join(logsRoot, "modeldb", "local_models.json"))
+	if err != nil {
+		t.Fatalf("discovered snapshot: %v", err)
+	}
+	if e, ok := modeldb.LookupModelEntry(cat, "local", "qwen2.5-coder:7b"); !ok || e.ContextWindow != 32768 || !e.SupportsTools || *e.OutputCostPerToken != 0 {
+		t.Fatalf("qwen entry: %+v ok=%v", e, ok)
+	}
+
+	// gemma reports no tool calling, so it runs one_shot; qwen runs the agent loop.
+	for node, want := range map[string]string{"triage": "one_shot", "implement": "agent_loop"} {
+		b, err := os.ReadFile(filepath.Join(logsRoot, node, "provider_used.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), `"mode": "`+want+`"`) {
+			t.Fatalf("%s provider_used.json: %s", node, b)
+		}
+	}
+	sent := toolsSent()
+	if sent["gemma:2b"] != 0 || sent["qwen2.5-coder:7b"] != 6 {
+		t.Fatalf("tools sent per model: %v", sent)
+	}
+
+	report, _ := os.ReadFile(filepath.Join(logsRoot, "preflight_report.json"))
+	if !strings.Contains(string(report), "provider_model_discovery") || !strings.Contains(string(report), "api key not required") {
+		t.Fatalf("preflight report:\n%s", report)
+	}
+}
+
+func TestRunWithConfig_LocalProviderRejectsUnservedModel(t *testing.T) {
+	t.Setenv("KILROY_PREFLIGHT_PROMPT_PROBES", "off")
+	repo := initTestRepo(t)
+	srv, _ := newFakeOllama(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := RunWithConfig(ctx, singleProviderDot("local", "llama3:70b"), localProviderConfig(t, repo, srv.URL), RunOptions{RunID: "local-missing", LogsRoot: t.TempDir(), DisableCXDB: true})
+	if err == nil || !strings.Contains(err.Error(), "does not serve model llama3:70b") || !strings.Contains(err.Error(), "gemma:2b") {
+		t.Fatalf("expected unserved model preflight error, got %v", err)
+	}
+}
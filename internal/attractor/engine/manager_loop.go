@@ -20,9 +20,8 @@ type childResult struct {
 }
 
 // Execute implements the ManagerLoopHandler per spec §4.11.
-// It runs an observe/wait loop that monitors a child pipeline and evaluates
-// stop conditions each cycle. The steer action is logged but not yet
-// implemented (deferred to v2).
+// It runs an observe/steer/wait loop that monitors a child pipeline, steers
+// its running agent sessions, and evaluates stop conditions each cycle.
 func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
 	if exec == nil || exec.Engine == nil || exec.Graph == nil {
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "manager loop missing execution context"}, nil
@@ -58,6 +57,17 @@ func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node
 		}, nil
 	}
 
+	var steering *managerSteering
+	var hub *steerHub
+	if actions["steer"] {
+		hub = newSteerHub()
+		steering = newManagerSteering(exec, node, hub)
+		if !steering.configured() {
+			exec.Engine.Warn(fmt.Sprintf("manager_loop node %s: 'steer' action needs manager.steer_condition with manager.steer_message, or manager.steer_prompt", node.ID))
+			steering = nil
+		}
+	}
+
 	var childCancel context.CancelFunc
 	childDone := make(chan childResult, 1)
 
@@ -65,7 +75,7 @@ func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node
 		var childCtx context.Context
 		childCtx, childCancel = context.WithCancel(ctx)
 		go func() {
-			result := runChildPipeline(childCtx, exec, childDotfile, node.ID)
+			result := runChildPipeline(childCtx, exec, childDotfile, node.ID, hub)
 			childDone <- result
 		}()
 	}
@@ -76,11 +86,6 @@ func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node
 		}
 	}()
 
-	// Log steer action as deferred to v2.
-	if actions["steer"] {
-		exec.Engine.Warn(fmt.Sprintf("manager_loop node %s: 'steer' action is not yet implemented (v2)", node.ID))
-	}
-
 	// Observation loop per spec §4.11 pseudocode.
 	for cycle := 1; cycle <= maxCycles; cycle++ {
 		if err := ctx.Err(); err != nil {
@@ -122,6 +127,17 @@ func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node
 			}
 		}
 
+		// Steer: inject guidance into the child's running agent sessions.
+		if steering != nil {
+			if err := steering.cycle(ctx, exec, node, cycle); err != nil {
+				exec.Engine.Warn(fmt.Sprintf("manager_loop node %s: %v", node.ID, err))
+				if childCancel != nil {
+					childCancel()
+				}
+				return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+			}
+		}
+
 		// Evaluate stop condition (spec §4.11 pseudocode line: IF stop_condition is not empty).
 		if stopCondition != "" {
 			ok, err := cond.Evaluate(stopCondition, runtime.Outcome{Status: runtime.StatusSuccess}, exec.Context)
@@ -181,38 +197,12 @@ func parseManagerActions(s string) map[string]bool {
 // runChildPipeline loads and executes a child DOT pipeline, returning the result.
 // This reuses the sub-pipeline execution infrastructure (Prepare, runSubgraphUntil)
 // already built for parallel branches.
-func runChildPipeline(ctx context.Context, exec *Execution, childDotfile string, managerNodeID string) childResult {
-	// Resolve child dotfile path relative to the active run worktree (not the
-	// source repo). Earlier stages may generate or modify child dotfiles in the
-	// worktree, so reading from Options.RepoPath would see stale/missing content.
-	dotPath := childDotfile
-	if !filepath.IsAbs(dotPath) && exec.WorktreeDir != "" {
-		dotPath = filepath.Join(exec.WorktreeDir, dotPath)
-	} else if !filepath.IsAbs(dotPath) && exec.Engine.Options.RepoPath != "" {
-		// Fallback to repo path only if worktree dir is not available.
-		dotPath = filepath.Join(exec.Engine.Options.RepoPath, dotPath)
-	}
-
-	dotSource, err := os.ReadFile(dotPath)
+// Agent sessions in the child register with hub (nil when not steering).
+func runChildPipeline(ctx context.Context, exec *Execution, childDotfile string, managerNodeID string, hub *steerHub) childResult {
+	childGraph, dotSource, err := loadChildGraph(exec, childDotfile, PrepareOptions{})
 	if err != nil {
 		return childResult{
-			Outcome: runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("read child dotfile: %v", err)},
-			Error:   err,
-		}
-	}
-
-	// Use PrepareWithOptions so prompt_file attributes in the child graph resolve
-	// relative to the worktree (the active execution context), not the source repo.
-	repoPath := exec.WorktreeDir
-	if repoPath == "" {
-		repoPath = exec.Engine.Options.RepoPath
-	}
-	childGraph, _, err := PrepareWithOptions(dotSource, PrepareOptions{
-		RepoPath: repoPath,
-	})
-	if err != nil {
-		return childResult{
-			Outcome: runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("prepare child graph: %v", err)},
+			Outcome: runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()},
 			Error:   err,
 		}
 	}
@@ -229,7 +219,7 @@ func runChildPipeline(ctx context.Context, exec *Execution, childDotfile string,
 	exitID := findExitNodeID(childGraph)
 
 	// Create a child engine using the same infrastructure as parallel branches.
-	childLogsRoot := filepath.Join(exec.LogsRoot, managerNodeID, "child")
+	childLogsRoot := managerChildLogsRoot(exec, managerNodeID)
 	_ = os.MkdirAll(childLogsRoot, 0o755)
 
 	childEng := &Engine{
@@ -245,7 +235,13 @@ func runChildPipeline(ctx context.Context, exec *Execution, childDotfile string,
 		ModelCatalogSHA:    exec.Engine.ModelCatalogSHA,
 		ModelCatalogSource: exec.Engine.ModelCatalogSource,
 		ModelCatalogPath:   exec.Engine.ModelCatalogPath,
+		ManagerSteerer:     exec.Engine.ManagerSteerer,
+		FanInJudge:         exec.Engine.FanInJudge,
+		steering:           hub,
+		costs:              exec.Engine.costs,
+		sideEffects:        exec.Engine.sideEffects,
 	}
+	hub.attachContext(childEng.Context)
 
 	res, err := runSubgraphUntil(ctx, childEng, startID, exitID)
 	if err != nil {
@@ -260,6 +256,43 @@ func runChildPipeline(ctx context.Context, exec *Execution, childDotfile string,
 	}
 }
 
+// loadChildGraph reads and prepares a pipeline referenced from a node.
+// Relative paths resolve against the active run worktree (not the source
+// repo): earlier stages may generate or modify child dotfiles in the
+// worktree, so reading from Options.RepoPath would see stale/missing content.
+// opts supplies everything but RepoPath, which is set here.
+func loadChildGraph(exec *Execution, dotfile string, opts PrepareOptions) (*model.Graph, []byte, error) {
+	dotPath := dotfile
+	if !filepath.IsAbs(dotPath) && exec.WorktreeDir != "" {
+		dotPath = filepath.Join(exec.WorktreeDir, dotPath)
+	} else if !filepath.IsAbs(dotPath) && exec.Engine.Options.RepoPath != "" {
+		// Fallback to repo path only if worktree dir is not available.
+		dotPath = filepath.Join(exec.Engine.Options.RepoPath, dotPath)
+	}
+
+	dotSource, err := os.ReadFile(dotPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read child dotfile: %w", err)
+	}
+
+	// Use PrepareWithOptions so prompt_file attributes in the child graph resolve
+	// relative to the worktree (the active execution context), not the source repo.
+	repoPath := exec.WorktreeDir
+	if repoPath == "" {
+		repoPath = exec.Engine.Options.RepoPath
+	}
+	opts.RepoPath = repoPath
+	g, _, err := PrepareWithOptions(dotSource, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("prepare child graph: %w", err)
+	}
+	return g, dotSource, nil
+}
+
+func managerChildLogsRoot(exec *Execution, managerNodeID string) string {
+	return filepath.Join(exec.LogsRoot, managerNodeID, "child")
+}
+
 // findExitNodeID locates a terminal node in the graph (for use as a stop boundary).
 // Returns empty string if no terminal node is found, which means the subgraph
 // will run until it runs out of edges.
@@ -0,0 +1,351 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/cond"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+const (
+	managerSteerProgressLines     = 20
+	managerSteerProgressLineChars = 500
+)
+
+// steerHub connects a manager_loop node to the agent sessions running in its
+// child pipeline. Child agent_loop stages register their session while it
+// runs; guidance that arrives while none is running is queued for the next.
+type steerHub struct {
+	mu       sync.Mutex
+	sessions map[string]*agent.Session // keyed by node ID
+	pending  []string
+	context  *runtime.Context // child pipeline context
+}
+
+func newSteerHub() *steerHub {
+	return &steerHub{sessions: map[string]*agent.Session{}}
+}
+
+func (h *steerHub) attachContext(c *runtime.Context) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.context = c
+	h.mu.Unlock()
+}
+
+func (h *steerHub) childContext() *runtime.Context {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.context
+}
+
+// register tracks sess as the live session for nodeID and hands it any queued
+// guidance. The returned func unregisters it.
+func (h *steerHub) register(nodeID string, sess *agent.Session) func() {
+	if h == nil || sess == nil {
+		return func() {}
+	}
+	h.mu.Lock()
+	h.sessions[nodeID] = sess
+	pending := h.pending
+	h.pending = nil
+	h.mu.Unlock()
+	for _, msg := range pending {
+		sess.Steer(msg)
+	}
+	return func() {
+		h.mu.Lock()
+		if h.sessions[nodeID] == sess {
+			delete(h.sessions, nodeID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// deliver steers every live session, or queues msg when none is running. The
+// latest guidance is also written to the child context as
+// stack.manager.guidance so non-agent stages and conditions can see it.
+// It returns the node IDs whose sessions received msg.
+func (h *steerHub) deliver(msg string) []string {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids := make([]string, 0, len(h.sessions))
+	for id := range h.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		h.sessions[id].Steer(msg)
+	}
+	if len(ids) == 0 {
+		h.pending = append(h.pending, msg)
+	}
+	if h.context != nil {
+		h.context.Set("stack.manager.guidance", msg)
+	}
+	return ids
+}
+
+func (h *steerHub) activeNodes() []string {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids := make([]string, 0, len(h.sessions))
+	for id := range h.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ManagerObservation is what a manager_loop node's LLM sees when deciding
+// whether to steer its child pipeline.
+type ManagerObservation struct {
+	Goal           string   `json:"goal,omitempty"`
+	Instructions   string   `json:"instructions"`
+	Cycle          int      `json:"cycle"`
+	ActiveNodes    []string `json:"active_nodes,omitempty"`
+	RecentProgress []string `json:"recent_progress,omitempty"`
+}
+
+type ManagerSteerer interface {
+	// Evaluate returns guidance to inject into the child, or "" (or NONE) to
+	// leave it alone.
+	Evaluate(ctx context.Context, node *model.Node, obs ManagerObservation) (string, error)
+}
+
+type llmManagerSteerer struct {
+	client *llm.Client
+}
+
+func (s *llmManagerSteerer) Evaluate(ctx context.Context, node *model.Node, obs ManagerObservation) (string, error) {
+	provider := normalizeProviderKey(node.Attr("llm_provider", ""))
+	modelID := strings.TrimSpace(node.Attr("llm_model", ""))
+	if provider == "" || modelID == "" {
+		return "", fmt.Errorf("manager.steer_prompt requires llm_provider and llm_model on node %s", node.ID)
+	}
+	resp, err := s.client.Complete(ctx, llm.Request{
+		Provider: provider,
+		Model:    modelID,
+		Messages: []llm.Message{
+			llm.System("You supervise a child pipeline of coding agents. Decide whether the child needs a course correction. " +
+				"If it does, reply with the guidance to send to the running agent, addressed to it directly and at most a few sentences. " +
+				"If the child is on track, reply with exactly NONE."),
+			llm.User(buildManagerSteerPrompt(obs)),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text(), nil
+}
+
+func buildManagerSteerPrompt(obs ManagerObservation) string {
+	var b strings.Builder
+	if goal := strings.TrimSpace(obs.Goal); goal != "" {
+		b.WriteString("Pipeline goal: ")
+		b.WriteString(goal)
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "Supervision cycle: %d\n", obs.Cycle)
+	if len(obs.ActiveNodes) > 0 {
+		b.WriteString("Running stages: ")
+		b.WriteString(strings.Join(obs.ActiveNodes, ", "))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n### Supervisor instructions\n")
+	b.WriteString(strings.TrimSpace(obs.Instructions))
+	b.WriteString("\n")
+	if len(obs.RecentProgress) > 0 {
+		b.WriteString("\n### Recent child progress events\n")
+		for _, line := range obs.RecentProgress {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func parseManagerSteerReply(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.EqualFold(strings.Trim(text, ".` "), "none") {
+		return ""
+	}
+	return text
+}
+
+// managerSteerer returns the configured ManagerSteerer, falling back to the
+// codergen router's API client.
+func (e *Engine) managerSteerer() (ManagerSteerer, error) {
+	if e.ManagerSteerer != nil {
+		return e.ManagerSteerer, nil
+	}
+	r, ok := e.CodergenBackend.(*CodergenRouter)
+	if !ok {
+		return nil, fmt.Errorf("manager.steer_prompt requires the API codergen backend")
+	}
+	client, err := r.ensureAPIClient()
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("manager.steer_prompt requires an API client")
+	}
+	return &llmManagerSteerer{client: client}, nil
+}
+
+// managerSteering holds a manager_loop node's steer configuration and state
+// across observation cycles.
+type managerSteering struct {
+	hub       *steerHub
+	condition string        // manager.steer_condition
+	message   string        // manager.steer_message
+	prompt    string        // manager.steer_prompt
+	cooldown  time.Duration // manager.steer_cooldown
+	progress  string        // child progress.ndjson
+
+	lastSteer      time.Time
+	conditionFired bool
+	evaluated      bool
+	progressSize   int64 // child progress size at the last LLM evaluation
+	llmDisabled    bool
+}
+
+func newManagerSteering(exec *Execution, node *model.Node, hub *steerHub) *managerSteering {
+	return &managerSteering{
+		hub:       hub,
+		condition: strings.TrimSpace(node.Attr("manager.steer_condition", "")),
+		message:   strings.TrimSpace(node.Attr("manager.steer_message", "")),
+		prompt:    strings.TrimSpace(node.Attr("manager.steer_prompt", "")),
+		cooldown:  parseDuration(node.Attr("manager.steer_cooldown", "5m"), 5*time.Minute),
+		progress:  filepath.Join(managerChildLogsRoot(exec, node.ID), "progress.ndjson"),
+	}
+}
+
+func (s *managerSteering) configured() bool {
+	return (s.condition != "" && s.message != "") || s.prompt != ""
+}
+
+func (s *managerSteering) cooledDown() bool {
+	return s.lastSteer.IsZero() || time.Since(s.lastSteer) >= s.cooldown
+}
+
+// cycle runs one steer pass. A steer_condition fires once each time it becomes
+// true; the LLM is consulted only when the child has made progress since the
+// last evaluation. Only an invalid steer_condition is returned as an error.
+func (s *managerSteering) cycle(ctx context.Context, exec *Execution, node *model.Node, cycle int) error {
+	if s.condition != "" && s.message != "" {
+		c := s.hub.childContext()
+		if c == nil {
+			c = exec.Context
+		}
+		ok, err := cond.Evaluate(s.condition, runtime.Outcome{Status: runtime.StatusSuccess}, c)
+		if err != nil {
+			return fmt.Errorf("invalid steer_condition %q: %v", s.condition, err)
+		}
+		if !ok {
+			s.conditionFired = false
+		} else if !s.conditionFired && s.cooledDown() {
+			s.conditionFired = true
+			s.steer(ctx, exec, node, cycle, "condition", s.message)
+			return nil
+		}
+	}
+	if s.prompt == "" || s.llmDisabled || !s.cooledDown() {
+		return nil
+	}
+	recent, size := tailProgress(s.progress, managerSteerProgressLines)
+	if s.evaluated && size == s.progressSize {
+		return nil
+	}
+	s.evaluated = true
+	s.progressSize = size
+	steerer, err := exec.Engine.managerSteerer()
+	if err != nil {
+		s.llmDisabled = true
+		exec.Engine.Warn(fmt.Sprintf("manager_loop node %s: LLM steering disabled: %v", node.ID, err))
+		return nil
+	}
+	guidance, err := steerer.Evaluate(withCostScope(ctx, exec, node), node, ManagerObservation{
+		Goal:           exec.Graph.Attrs["goal"],
+		Instructions:   s.prompt,
+		Cycle:          cycle,
+		ActiveNodes:    s.hub.activeNodes(),
+		RecentProgress: recent,
+	})
+	if err != nil {
+		exec.Engine.Warn(fmt.Sprintf("manager_loop node %s: steer evaluation failed: %v", node.ID, err))
+		return nil
+	}
+	if guidance = parseManagerSteerReply(guidance); guidance != "" {
+		s.steer(ctx, exec, node, cycle, "llm", guidance)
+	}
+	return nil
+}
+
+func (s *managerSteering) steer(ctx context.Context, exec *Execution, node *model.Node, cycle int, source string, msg string) {
+	deliveredTo := s.hub.deliver(msg)
+	s.lastSteer = time.Now()
+	exec.Engine.appendProgress(map[string]any{
+		"event":        "manager_steer",
+		"node_id":      node.ID,
+		"cycle":        cycle,
+		"source":       source,
+		"message":      msg,
+		"delivered_to": deliveredTo,
+		"queued":       len(deliveredTo) == 0,
+	})
+	exec.Engine.cxdbManagerSteer(ctx, node.ID, source, msg, deliveredTo)
+}
+
+// tailProgress returns the last n lines of a progress.ndjson file (each
+// truncated) and the file size, or -1 when it cannot be read.
+func tailProgress(path string, n int) ([]string, int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, -1
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, -1
+	}
+	var lines []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if len(line) > managerSteerProgressLineChars {
+			line = line[:managerSteerProgressLineChars] + "..."
+		}
+		lines = append(lines, line)
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return lines, info.Size()
+}
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// gatedToolAdapter answers the first request with a read_file tool call once
+// release is closed, then answers "done".
+type gatedToolAdapter struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu       sync.Mutex
+	requests []llm.Request
+}
+
+func (a *gatedToolAdapter) Name() string { return "openai" }
+func (a *gatedToolAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	a.mu.Lock()
+	a.requests = append(a.requests, req)
+	n := len(a.requests)
+	a.mu.Unlock()
+	if n > 1 {
+		return llm.Response{Provider: "openai", Model: req.Model, Message: llm.Assistant("done")}, nil
+	}
+	close(a.started)
+	select {
+	case <-a.release:
+	case <-ctx.Done():
+		return llm.Response{}, ctx.Err()
+	}
+	call := llm.ToolCallData{ID: "c1", Name: "read_file", Arguments: json.RawMessage(`{"file_path":"missing.txt"}`), Type: "function"}
+	return llm.Response{Provider: "openai", Model: req.Model, Message: llm.Message{
+		Role:    llm.RoleAssistant,
+		Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: &call}},
+	}}, nil
+}
+func (a *gatedToolAdapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	_ = ctx
+	_ = req
+	return nil, fmt.Errorf("stream not implemented")
+}
+
+func TestSteerHub_SteersRunningAgentSession(t *testing.T) {
+	adapter := &gatedToolAdapter{started: make(chan struct{}), release: make(chan struct{})}
+	r := newThreadTestRouter(t, adapter)
+	hub := newSteerHub()
+	logsRoot := t.TempDir()
+	eng := &Engine{LogsRoot: logsRoot, steering: hub}
+	execCtx := &Execution{Context: runtime.NewContext(), LogsRoot: logsRoot, WorktreeDir: t.TempDir(), Engine: eng}
+	hub.attachContext(execCtx.Context)
+	node := model.NewNode("impl")
+	node.Attrs["llm_provider"] = "openai"
+	node.Attrs["llm_model"] = "gpt-5.2"
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := r.Run(context.Background(), execCtx, node, "do it")
+		errCh <- err
+	}()
+
+	select {
+	case <-adapter.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent session did not start")
+	}
+	if got := hub.deliver("switch to the smaller fix"); len(got) != 1 || got[0] != "impl" {
+		t.Fatalf("delivered to: %v", got)
+	}
+	close(adapter.release)
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	adapter.mu.Lock()
+	defer adapter.mu.Unlock()
+	if len(adapter.requests) != 2 {
+		t.Fatalf("requests: got %d want 2", len(adapter.requests))
+	}
+	b, _ := json.Marshal(adapter.requests[1].Messages)
+	if !strings.Contains(string(b), "switch to the smaller fix") {
+		t.Fatalf("expected steering message in the next model request")
+	}
+	if got := execCtx.Context.GetString("stack.manager.guidance", ""); got != "switch to the smaller fix" {
+		t.Fatalf("stack.manager.guidance: %q", got)
+	}
+	if len(hub.activeNodes()) != 0 {
+		t.Fatalf("expected session to unregister after the stage")
+	}
+}
+
+func newSteerTestExecution(t *testing.T, node *model.Node) *Execution {
+	t.Helper()
+	graph := &model.Graph{Nodes: map[string]*model.Node{node.ID: node}, Attrs: map[string]string{}}
+	eng := &Engine{Graph: graph, Options: RunOptions{RunID: "test-run"}, Context: runtime.NewContext(), LogsRoot: t.TempDir()}
+	return &Execution{Engine: eng, Graph: graph, Context: eng.Context, WorktreeDir: t.TempDir(), LogsRoot: eng.LogsRoot}
+}
+
+func TestManagerLoop_SteerCondition_FiresOncePerActivation(t *testing.T) {
+	node := &model.Node{
+		ID: "manager",
+		Attrs: map[string]string{
+			"manager.max_cycles":      "4",
+			"manager.poll_interval":   "1ms",
+			"manager.actions":         "steer,wait",
+			"manager.steer_condition": "context.tests=failing",
+			"manager.steer_message":   "fix the failing tests before adding features",
+			"stack.child_autostart":   "false",
+		},
+	}
+	exec := newSteerTestExecution(t, node)
+	exec.Context.Set("tests", "failing")
+
+	out, err := (&ManagerLoopHandler{}).Execute(context.Background(), exec, node)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if out.Status != runtime.StatusFail {
+		t.Fatalf("expected max-cycles FAIL, got %s", out.Status)
+	}
+	var steers []map[string]any
+	for _, ev := range mustReadProgressEventsFile(t, filepath.Join(exec.LogsRoot, "progress.ndjson")) {
+		if ev["event"] == "manager_steer" {
+			steers = append(steers, ev)
+		}
+	}
+	if len(steers) != 1 {
+		t.Fatalf("manager_steer events: got %d want 1", len(steers))
+	}
+	if steers[0]["source"] != "condition" || steers[0]["queued"] != true || steers[0]["message"] != "fix the failing tests before adding features" {
+		t.Fatalf("manager_steer event: %+v", steers[0])
+	}
+}
+
+type scriptedSteerer struct {
+	progressPath string
+	replies      []string
+	obs          []ManagerObservation
+}
+
+func (s *scriptedSteerer) Evaluate(ctx context.Context, node *model.Node, obs ManagerObservation) (string, error) {
+	_ = ctx
+	_ = node
+	s.obs = append(s.obs, obs)
+	// Simulate child progress so the next cycle is evaluated again.
+	_ = os.MkdirAll(filepath.Dir(s.progressPath), 0o755)
+	f, err := os.OpenFile(s.progressPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	_, _ = fmt.Fprintf(f, "{\"event\":\"stage_attempt_start\",\"cycle\":%d}\n", obs.Cycle)
+	_ = f.Close()
+	if len(s.obs) > len(s.replies) {
+		return "", nil
+	}
+	return s.replies[len(s.obs)-1], nil
+}
+
+func TestManagerLoop_SteerPrompt_AsksManagerSteererAndHonorsCooldown(t *testing.T) {
+	node := &model.Node{
+		ID: "manager",
+		Attrs: map[string]string{
+			"manager.max_cycles":     "4",
+			"manager.poll_interval":  "1ms",
+			"manager.actions":        "steer,wait",
+			"manager.steer_prompt":   "Keep the child focused on the parser.",
+			"manager.steer_cooldown": "1h",
+			"stack.child_autostart":  "false",
+		},
+	}
+	exec := newSteerTestExecution(t, node)
+	steerer := &scriptedSteerer{
+		progressPath: filepath.Join(managerChildLogsRoot(exec, node.ID), "progress.ndjson"),
+		replies:      []string{"NONE", "Stop refactoring the lexer; finish the parser."},
+	}
+	exec.Engine.ManagerSteerer = steerer
+
+	if _, err := (&ManagerLoopHandler{}).Execute(context.Background(), exec, node); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	// Cycle 1 declines, cycle 2 steers, cycles 3-4 are inside the cooldown.
+	if len(steerer.obs) != 2 {
+		t.Fatalf("steerer calls: got %d want 2", len(steerer.obs))
+	}
+	if steerer.obs[1].Instructions != "Keep the child focused on the parser." || len(steerer.obs[1].RecentProgress) != 1 {
+		t.Fatalf("observation: %+v", steerer.obs[1])
+	}
+	progress := filepath.Join(exec.LogsRoot, "progress.ndjson")
+	if n := countProgressEventsForNode(t, progress, "manager_steer", node.ID); n != 1 {
+		t.Fatalf("manager_steer events: got %d want 1", n)
+	}
+}
+
+func TestParseManagerSteerReply(t *testing.T) {
+	for in, want := range map[string]string{"NONE": "", " none. ": "", "": "", "Run the tests.": "Run the tests."} {
+		if got := parseManagerSteerReply(in); got != want {
+			t.Fatalf("parseManagerSteerReply(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/jsonschemautil"
+	"github.com/danshapiro/kilroy/internal/llm"
+	"github.com/danshapiro/kilroy/internal/mcp"
+)
+
+// mcpToolPrefix namespaces MCP tools so they cannot collide with the core
+// agent tools: mcp__<server>__<tool>.
+const mcpToolPrefix = "mcp__"
+
+var mcpToolNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// mcpPool owns the MCP server connections for one run. Servers are started
+// lazily on first use and shared by every agent_loop stage that selects them.
+type mcpPool struct {
+	servers map[string]MCPServerConfig
+
+	mu      sync.Mutex
+	clients map[string]*mcpServerConn
+}
+
+type mcpServerConn struct {
+	client *mcp.Client
+	tools  []agent.RegisteredTool
+}
+
+func newMCPPool(cfg *RunConfigFile) *mcpPool {
+	if cfg == nil || len(cfg.MCP.Servers) == 0 {
+		return nil
+	}
+	return &mcpPool{servers: cfg.MCP.Servers, clients: map[string]*mcpServerConn{}}
+}
+
+// selectMCPServers resolves the node's mcp_servers attribute against the
+// configured servers. Absent means every server; "none" disables MCP tools.
+func selectMCPServers(servers map[string]MCPServerConfig, node *model.Node) ([]string, error) {
+	raw := ""
+	if node != nil {
+		raw = strings.TrimSpace(node.Attr("mcp_servers", ""))
+	}
+	if strings.EqualFold(raw, "none") {
+		return nil, nil
+	}
+	if raw == "" {
+		names := make([]string, 0, len(servers))
+		for name := range servers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := servers[name]; !ok {
+			return nil, fmt.Errorf("mcp_servers: unknown server %q (not declared under mcp.servers in run config)", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// toolsForNode returns the agent tools exposed by the servers the node selects.
+func (p *mcpPool) toolsForNode(ctx context.Context, execCtx *Execution, node *model.Node) ([]agent.RegisteredTool, error) {
+	var servers map[string]MCPServerConfig
+	if p != nil {
+		servers = p.servers
+	}
+	names, err := selectMCPServers(servers, node)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	var out []agent.RegisteredTool
+	for _, name := range names {
+		conn, err := p.connect(ctx, execCtx, name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, conn.tools...)
+	}
+	if execCtx != nil && execCtx.Engine != nil {
+		toolNames := make([]string, 0, len(out))
+		for _, t := range out {
+			toolNames = append(toolNames, t.Definition.Name)
+		}
+		execCtx.Engine.appendProgress(map[string]any{
+			"event":   "mcp_tools_registered",
+			"node_id": node.ID,
+			"servers": names,
+			"tools":   toolNames,
+		})
+	}
+	return out, nil
+}
+
+func (p *mcpPool) connect(ctx context.Context, execCtx *Execution, name string) (*mcpServerConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conn, ok := p.clients[name]; ok {
+		return conn, nil
+	}
+	sc := p.servers[name]
+	timeout := time.Duration(sc.TimeoutMS) * time.Millisecond
+	cfg := mcp.ServerConfig{
+		Name:    name,
+		Command: sc.Command,
+		Dir:     sc.Dir,
+		URL:     sc.URL,
+	}
+	if cfg.Dir == "" && execCtx != nil {
+		cfg.Dir = execCtx.WorktreeDir
+	}
+	for k, v := range sc.Env {
+		cfg.Env = append(cfg.Env, k+"="+os.ExpandEnv(v))
+	}
+	if len(sc.Headers) > 0 {
+		cfg.Headers = map[string]string{}
+		for k, v := range sc.Headers {
+			cfg.Headers[k] = os.ExpandEnv(v)
+		}
+	}
+
+	cctx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		cctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	client, err := mcp.Connect(cctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := client.ListTools(cctx)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	conn := &mcpServerConn{client: client}
+	for _, tool := range listed {
+		rt, err := mcpRegisteredTool(client, name, tool, timeout)
+		if err != nil {
+			warnEngine(execCtx, fmt.Sprintf("mcp server %s: skipping tool %q: %v", name, tool.Name, err))
+			continue
+		}
+		conn.tools = append(conn.tools, rt)
+	}
+	p.clients[name] = conn
+	return conn, nil
+}
+
+func mcpToolName(server, tool string) string {
+	return mcpToolPrefix + server + "__" + mcpToolNameUnsafe.ReplaceAllString(tool, "_")
+}
+
+// mcpRegisteredTool adapts one MCP tool to the agent tool registry. Arguments
+// are validated against the server's input schema before the call is sent.
+func mcpRegisteredTool(client *mcp.Client, server string, tool mcp.Tool, timeout time.Duration) (agent.RegisteredTool, error) {
+	name := mcpToolName(server, tool.Name)
+	if err := llm.ValidateToolName(name); err != nil {
+		return agent.RegisteredTool{}, err
+	}
+	params := tool.InputSchema
+	if params == nil {
+		params = map[string]any{"type": "object"}
+	}
+	schema, err := jsonschemautil.CompileMapSchema(params, nil)
+	if err != nil {
+		return agent.RegisteredTool{}, fmt.Errorf("input schema: %w", err)
+	}
+	desc := strings.TrimSpace(tool.Description)
+	if desc == "" {
+		desc = strings.TrimSpace(tool.Title)
+	}
+	remote := tool.Name
+	return agent.RegisteredTool{
+		Definition: llm.ToolDefinition{
+			Name:        name,
+			Description: fmt.Sprintf("[MCP %s] %s", server, desc),
+			Parameters:  params,
+		},
+		Schema: schema,
+		Exec: func(ctx context.Context, env agent.ExecutionEnvironment, args map[string]any) (any, error) {
+			_ = env
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			res, err := client.CallTool(ctx, remote, args)
+			if err != nil {
+				return nil, err
+			}
+			text := res.Text()
+			if res.IsError {
+				if strings.TrimSpace(text) == "" {
+					text = "tool reported an error"
+				}
+				return text, fmt.Errorf("mcp tool %s failed", name)
+			}
+			return text, nil
+		},
+	}, nil
+}
+
+func (p *mcpPool) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, conn := range p.clients {
+		_ = conn.client.Close()
+		delete(p.clients, name)
+	}
+}
+
+// closeMCPServers shuts down any MCP servers the backend started.
+func closeMCPServers(backend CodergenBackend) {
+	if r, ok := backend.(*CodergenRouter); ok && r != nil {
+		r.mcp.close()
+	}
+}
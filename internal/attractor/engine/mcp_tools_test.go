@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// newFakeMCPServer serves a single get_ticket tool over streamable HTTP.
+func newFakeMCPServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Name      string         `json:"name"`
+				Arguments map[string]any `json:"arguments"`
+			} `json:"params"`
+		}
+		_ = json.Unmarshal(body, &req)
+		if len(req.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		var result any
+		switch req.Method {
+		case "initialize":
+			result = map[string]any{"protocolVersion": "2025-06-18", "capabilities": map[string]any{}, "serverInfo": map[string]any{"name": "tickets"}}
+		case "tools/list":
+			result = map[string]any{"tools": []any{map[string]any{
+				"name":        "get_ticket",
+				"description": "Fetch a ticket by id",
+				"inputSchema": map[string]any{"type": "object", "properties": map[string]any{"id": map[string]any{"type": "string"}}, "required": []any{"id"}},
+			}}}
+		case "tools/call":
+			result = map[string]any{"content": []any{map[string]any{"type": "text", "text": fmt.Sprintf("ticket %v: fix login", req.Params.Arguments["id"])}}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// mcpToolAdapter calls the MCP tool on the first turn and finishes on the second.
+type mcpToolAdapter struct {
+	mu       sync.Mutex
+	requests []llm.Request
+}
+
+func (a *mcpToolAdapter) Name() string { return "openai" }
+func (a *mcpToolAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	_ = ctx
+	a.mu.Lock()
+	a.requests = append(a.requests, req)
+	n := len(a.requests)
+	a.mu.Unlock()
+	if n > 1 {
+		return llm.Response{Provider: "openai", Model: req.Model, Message: llm.Assistant("done")}, nil
+	}
+	call := llm.ToolCallData{ID: "c1", Name: "mcp__tickets__get_ticket", Arguments: json.RawMessage(`{"id":"T-7"}`), Type: "function"}
+	return llm.Response{Provider: "openai", Model: req.Model, Message: llm.Message{
+		Role:    llm.RoleAssistant,
+		Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: &call}},
+	}}, nil
+}
+func (a *mcpToolAdapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	_ = ctx
+	_ = req
+	return nil, fmt.Errorf("stream not implemented")
+}
+
+func TestRunAPI_AgentLoop_CallsMCPTool(t *testing.T) {
+	srv := newFakeMCPServer(t)
+	adapter := &mcpToolAdapter{}
+	r := newThreadTestRouter(t, adapter)
+	cfg := &RunConfigFile{}
+	cfg.MCP.Servers = map[string]MCPServerConfig{"tickets": {URL: srv.URL, TimeoutMS: 5000}}
+	r.mcp = newMCPPool(cfg)
+	defer closeMCPServers(r)
+
+	logsRoot := t.TempDir()
+	eng := &Engine{LogsRoot: logsRoot}
+	execCtx := &Execution{Context: runtime.NewContext(), LogsRoot: logsRoot, WorktreeDir: t.TempDir(), Engine: eng}
+	text, out, err := r.runAPI(context.Background(), execCtx, model.NewNode("triage"), "openai", "gpt-5.2", "look up T-7")
+	if err != nil || out != nil {
+		t.Fatalf("runAPI: out=%+v err=%v", out, err)
+	}
+	if text != "done" {
+		t.Fatalf("text: %q", text)
+	}
+
+	adapter.mu.Lock()
+	reqs := append([]llm.Request{}, adapter.requests...)
+	adapter.mu.Unlock()
+	if len(reqs) != 2 {
+		t.Fatalf("requests: got %d want 2", len(reqs))
+	}
+	advertised := false
+	for _, td := range reqs[0].Tools {
+		if td.Name == "mcp__tickets__get_ticket" {
+			advertised = true
+		}
+	}
+	if !advertised {
+		t.Fatalf("MCP tool not advertised: %+v", reqs[0].Tools)
+	}
+	b, _ := json.Marshal(reqs[1].Messages)
+	if !strings.Contains(string(b), "ticket T-7: fix login") {
+		t.Fatalf("tool result not sent back to the model: %s", b)
+	}
+	if !hasProgressEventForNode(t, filepath.Join(logsRoot, "progress.ndjson"), "mcp_tools_registered", "triage") {
+		t.Fatal("expected mcp_tools_registered progress event")
+	}
+}
+
+func TestRunAPI_AgentLoop_UnknownMCPServerFailsStage(t *testing.T) {
+	r := newThreadTestRouter(t, &mcpToolAdapter{})
+	logsRoot := t.TempDir()
+	execCtx := &Execution{Context: runtime.NewContext(), LogsRoot: logsRoot, WorktreeDir: t.TempDir(), Engine: &Engine{LogsRoot: logsRoot}}
+	node := model.NewNode("triage")
+	node.Attrs["mcp_servers"] = "tickets"
+	_, out, err := r.runAPI(context.Background(), execCtx, node, "openai", "gpt-5.2", "look up T-7")
+	if err != nil {
+		t.Fatalf("runAPI: %v", err)
+	}
+	if out == nil || out.Status != runtime.StatusFail || !strings.Contains(out.FailureReason, `unknown server "tickets"`) {
+		t.Fatalf("outcome: %+v", out)
+	}
+}
+
+func TestSelectMCPServers(t *testing.T) {
+	servers := map[string]MCPServerConfig{"b": {}, "a": {}}
+	node := model.NewNode("n")
+	if got, _ := selectMCPServers(servers, node); strings.Join(got, ",") != "a,b" {
+		t.Fatalf("default: %v", got)
+	}
+	node.Attrs["mcp_servers"] = "none"
+	if got, _ := selectMCPServers(servers, node); len(got) != 0 {
+		t.Fatalf("none: %v", got)
+	}
+	node.Attrs["mcp_servers"] = "b, b"
+	if got, _ := selectMCPServers(servers, node); strings.Join(got, ",") != "b" {
+		t.Fatalf("list: %v", got)
+	}
+	node.Attrs["mcp_servers"] = "c"
+	if _, err := selectMCPServers(servers, node); err == nil {
+		t.Fatal("expected unknown server error")
+	}
+}
+
+func TestMCPToolName_SanitizesRemoteName(t *testing.T) {
+	if got := mcpToolName("docs", "search.pages-v2"); got != "mcp__docs__search_pages_v2" {
+		t.Fatalf("got %q", got)
+	}
+}
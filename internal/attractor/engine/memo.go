@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// Stage memoization (cache=true on a node, or on the graph for every node).
+// A cached LLM stage records its key in {logs_root}/{node}/memo.json; once
+// the stage checkpoints successfully the outcome and the checkpoint's diff
+// (memo.patch) are added, and memo/<key>.json next to the runs directory is
+// pointed at that stage directory. A later run whose stage computes the same
+// key replays that outcome and diff instead of calling the model.
+const (
+	memoFileName      = "memo.json"
+	memoPatchFileName = "memo.patch"
+	memoKeyVersion    = 1
+)
+
+// memoIndexEntry points a memo key at the stage directory holding it.
+type memoIndexEntry struct {
+	RunID string `json:"run_id"`
+	Dir   string `json:"dir"`
+}
+
+type stageMemo struct {
+	Key    string `json:"key"`
+	RunID  string `json:"run_id"`
+	NodeID string `json:"node_id"`
+	// BaseSHA is the commit the stage started from; the recorded patch
+	// takes it to the stage's checkpoint.
+	BaseSHA string `json:"base_sha"`
+	// Outcome is nil until the stage has checkpointed.
+	Outcome *runtime.Outcome `json:"outcome,omitempty"`
+}
+
+func (e *Engine) memoEnabled(node *model.Node) bool {
+	if e == nil || strings.TrimSpace(e.WorktreeDir) == "" {
+		return false
+	}
+	raw := node.Attr("cache", "")
+	if strings.TrimSpace(raw) == "" && e.Graph != nil {
+		raw = e.Graph.Attrs["cache"]
+	}
+	v, err := strconv.ParseBool(strings.TrimSpace(raw))
+	return err == nil && v
+}
+
+// stageMemoKey hashes what decides a stage's result: its attributes (model
+// and provider included), the prompt as sent with its context preamble, the
+// fidelity mode and the tree of the worktree entering it. It also returns the
+// entering commit.
+func (e *Engine) stageMemoKey(node *model.Node, prompt, fidelity string) (key string, baseSHA string, err error) {
+	baseSHA, err = gitutil.HeadSHA(e.WorktreeDir)
+	if err != nil {
+		return "", "", err
+	}
+	tree, err := gitutil.TreeSHA(e.WorktreeDir, baseSHA)
+	if err != nil {
+		return "", "", err
+	}
+	b, err := json.Marshal(struct {
+		Version     int               `json:"version"`
+		NodeID      string            `json:"node_id"`
+		Attrs       map[string]string `json:"attrs"`
+		Prompt      string            `json:"prompt"`
+		Fidelity    string            `json:"fidelity"`
+		ForceModels map[string]string `json:"force_models,omitempty"`
+		Tree        string            `json:"tree"`
+	}{memoKeyVersion, node.ID, node.Attrs, e.memoPromptText(prompt), fidelity, e.Options.ForceModels, tree})
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), baseSHA, nil
+}
+
+// memoPromptText replaces what differs between otherwise identical runs in a
+// prompt (the run ID and the run's own paths) with fixed placeholders.
+func (e *Engine) memoPromptText(prompt string) string {
+	for _, r := range []struct{ from, to string }{
+		{e.WorktreeDir, "<worktree>"},
+		{e.LogsRoot, "<logs_root>"},
+		{e.baseLogsRoot, "<logs_root>"},
+		{e.Options.RunID, "<run_id>"},
+	} {
+		if strings.TrimSpace(r.from) != "" {
+			prompt = strings.ReplaceAll(prompt, r.from, r.to)
+		}
+	}
+	return prompt
+}
+
+// memoIndexDir holds one pointer file per memo key, beside the runs directory
+// so run listings do not see it.
+func memoIndexDir() string {
+	return filepath.Join(filepath.Dir(DefaultRunsBaseDir()), "memo")
+}
+
+// memoizedStage looks the stage up in earlier runs and replays a hit. On a
+// miss it leaves a pending memo.json for checkpoint to complete, and ok is
+// false so the caller runs the stage.
+func (e *Engine) memoizedStage(node *model.Node, prompt, fidelity string) (out runtime.Outcome, ok bool) {
+	if !e.memoEnabled(node) {
+		return runtime.Outcome{}, false
+	}
+	stageDir := filepath.Join(e.LogsRoot, node.ID)
+	_ = os.Remove(filepath.Join(stageDir, memoFileName))
+	_ = os.Remove(filepath.Join(stageDir, memoPatchFileName))
+	key, baseSHA, err := e.stageMemoKey(node, prompt, fidelity)
+	if err != nil {
+		e.Warn(fmt.Sprintf("stage memo %s: %v", node.ID, err))
+		return runtime.Outcome{}, false
+	}
+	pending := stageMemo{Key: key, RunID: e.Options.RunID, NodeID: node.ID, BaseSHA: baseSHA}
+	defer func() { _ = writeJSON(filepath.Join(stageDir, memoFileName), pending) }()
+
+	hit, hitDir, found := e.lookupStageMemo(key)
+	if !found {
+		e.appendProgress(map[string]any{
+			"event":    "stage_memo_miss",
+			"node_id":  node.ID,
+			"memo_key": key,
+		})
+		return runtime.Outcome{}, false
+	}
+	patch, err := os.ReadFile(filepath.Join(hitDir, memoPatchFileName))
+	if err == nil && len(patch) > 0 {
+		err = gitutil.ApplyPatch(e.WorktreeDir, filepath.Join(hitDir, memoPatchFileName))
+	}
+	if err != nil {
+		e.Warn(fmt.Sprintf("stage memo %s: replaying run %s: %v; running the stage", node.ID, hit.RunID, err))
+		_ = gitutil.ResetHard(e.WorktreeDir, baseSHA)
+		return runtime.Outcome{}, false
+	}
+	// The replayed memo is complete as it stands, so this run can serve it
+	// to later ones even after the source run is pruned.
+	_ = os.WriteFile(filepath.Join(stageDir, memoPatchFileName), patch, 0o644)
+	pending.Outcome = hit.Outcome
+	e.indexStageMemo(key, stageDir)
+	if b, err := os.ReadFile(filepath.Join(hitDir, "response.md")); err == nil {
+		_ = os.WriteFile(filepath.Join(stageDir, "response.md"), b, 0o644)
+	}
+
+	out = *hit.Outcome
+	out.Cost = nil
+	meta := map[string]any{}
+	for k, v := range out.Meta {
+		meta[k] = v
+	}
+	meta["memoized"] = map[string]any{
+		"memo_key":      key,
+		"source_run_id": hit.RunID,
+		"source_dir":    hitDir,
+	}
+	out.Meta = meta
+	note := fmt.Sprintf("memoized: replayed from run %s", hit.RunID)
+	if strings.TrimSpace(out.Notes) != "" {
+		note += "; " + out.Notes
+	}
+	out.Notes = note
+	e.appendProgress(map[string]any{
+		"event":         "stage_memo_hit",
+		"node_id":       node.ID,
+		"memo_key":      key,
+		"source_run_id": hit.RunID,
+		"status":        string(out.Status),
+	})
+	return out, true
+}
+
+// lookupStageMemo follows the index entry for key to a completed memo left
+// by an earlier run. The current run's own memos are not reused.
+func (e *Engine) lookupStageMemo(key string) (*stageMemo, string, bool) {
+	var entry memoIndexEntry
+	b, err := os.ReadFile(filepath.Join(memoIndexDir(), key+".json"))
+	if err != nil || json.Unmarshal(b, &entry) != nil || entry.RunID == e.Options.RunID {
+		return nil, "", false
+	}
+	b, err = os.ReadFile(filepath.Join(entry.Dir, memoFileName))
+	if err != nil {
+		return nil, "", false
+	}
+	var m stageMemo
+	if json.Unmarshal(b, &m) != nil || m.Key != key || m.Outcome == nil {
+		return nil, "", false
+	}
+	if _, err := os.Stat(filepath.Join(entry.Dir, memoPatchFileName)); err != nil {
+		return nil, "", false
+	}
+	return &m, entry.Dir, true
+}
+
+func (e *Engine) indexStageMemo(key, stageDir string) {
+	if err := os.MkdirAll(memoIndexDir(), 0o755); err != nil {
+		e.Warn(fmt.Sprintf("stage memo index: %v", err))
+		return
+	}
+	entry := memoIndexEntry{RunID: e.Options.RunID, Dir: stageDir}
+	if err := writeJSON(filepath.Join(memoIndexDir(), key+".json"), entry); err != nil {
+		e.Warn(fmt.Sprintf("stage memo index: %v", err))
+	}
+}
+
+// recordStageMemo completes a pending memo once its stage has checkpointed
+// at sha. Only successful stages are worth replaying; other outcomes drop
+// the pending memo.
+func (e *Engine) recordStageMemo(nodeID string, out runtime.Outcome, sha string) {
+	path := filepath.Join(e.LogsRoot, nodeID, memoFileName)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var m stageMemo
+	if json.Unmarshal(b, &m) != nil || m.Outcome != nil {
+		return
+	}
+	if out.Status != runtime.StatusSuccess && out.Status != runtime.StatusPartialSuccess {
+		_ = os.Remove(path)
+		return
+	}
+	patch, err := gitutil.BinaryDiff(e.WorktreeDir, m.BaseSHA, sha)
+	if err != nil {
+		e.Warn(fmt.Sprintf("stage memo %s: %v", nodeID, err))
+		_ = os.Remove(path)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(e.LogsRoot, nodeID, memoPatchFileName), []byte(patch), 0o644); err != nil {
+		e.Warn(fmt.Sprintf("stage memo %s: %v", nodeID, err))
+		return
+	}
+	out.Cost = nil
+	m.Outcome = &out
+	if err := writeJSON(path, m); err == nil {
+		e.indexStageMemo(m.Key, filepath.Dir(path))
+	}
+}
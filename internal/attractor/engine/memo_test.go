@@ -0,0 +1,211 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// fileWritingBackend writes <node>.txt into the worktree and counts its calls.
+type fileWritingBackend struct {
+	calls atomic.Int32
+}
+
+func (b *fileWritingBackend) Run(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
+	_ = ctx
+	_ = prompt
+	b.calls.Add(1)
+	if err := os.WriteFile(filepath.Join(exec.WorktreeDir, node.ID+".txt"), []byte("implemented by "+node.ID+"\n"), 0o644); err != nil {
+		return "", nil, err
+	}
+	out := runtime.Outcome{
+		Status:         runtime.StatusSuccess,
+		Notes:          "wrote " + node.ID + ".txt",
+		ContextUpdates: map[string]any{"impl.done": "yes"},
+	}
+	return "implemented", &out, nil
+}
+
+func runWithBackendForTest(t *testing.T, repo string, dot []byte, backend CodergenBackend) *Result {
+	t.Helper()
+	runID, err := NewRunID()
+	if err != nil {
+		t.Fatalf("NewRunID: %v", err)
+	}
+	opts := RunOptions{RepoPath: repo, RunID: runID, LogsRoot: defaultLogsRoot(runID)}
+	if err := opts.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults: %v", err)
+	}
+	g, _, err := Prepare(dot)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	eng := newBaseEngine(g, dot, opts)
+	eng.CodergenBackend = backend
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	res, err := eng.run(ctx)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: got %q want success", res.FinalStatus)
+	}
+	return res
+}
+
+const memoDot = `
+digraph G {
+  graph [goal="ship it", cache=true]
+  start [shape=Mdiamond]
+  impl  [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="implement it"]
+  check [shape=parallelogram, tool_command="test -f impl.txt"]
+  exit  [shape=Msquare]
+  start -> impl -> check -> exit
+}
+`
+
+func TestRun_StageMemo_ReplaysUnchangedStage(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	repo := initTestRepo(t)
+	backend := &fileWritingBackend{}
+
+	first := runWithBackendForTest(t, repo, []byte(memoDot), backend)
+	if got := backend.calls.Load(); got != 1 {
+		t.Fatalf("first run backend calls: got %d want 1", got)
+	}
+	assertExists(t, filepath.Join(first.LogsRoot, "impl", memoPatchFileName))
+
+	second := runWithBackendForTest(t, repo, []byte(memoDot), backend)
+	if got := backend.calls.Load(); got != 1 {
+		t.Fatalf("second run called the backend again: %d calls", got)
+	}
+	b, err := os.ReadFile(filepath.Join(second.LogsRoot, "impl", "status.json"))
+	if err != nil {
+		t.Fatalf("read status.json: %v", err)
+	}
+	out, err := runtime.DecodeOutcomeJSON(b)
+	if err != nil {
+		t.Fatalf("decode status.json: %v", err)
+	}
+	memo, _ := out.Meta["memoized"].(map[string]any)
+	if memo == nil || memo["source_run_id"] != first.RunID {
+		t.Fatalf("status.json not marked as memoized from %s: %+v", first.RunID, out.Meta)
+	}
+	if got := runCmdOut(t, repo, "git", "show", second.RunBranch+":impl.txt"); got != "implemented by impl\n" {
+		t.Fatalf("replayed impl.txt: got %q", got)
+	}
+	if resp, _ := os.ReadFile(filepath.Join(second.LogsRoot, "impl", "response.md")); string(resp) != "implemented" {
+		t.Fatalf("replayed response.md: got %q", resp)
+	}
+	cp, err := runtime.LoadCheckpoint(filepath.Join(second.LogsRoot, "checkpoint.json"))
+	if err != nil {
+		t.Fatalf("load checkpoint: %v", err)
+	}
+	if cp.ContextValues["impl.done"] != "yes" {
+		t.Fatalf("replayed context update missing: %v", cp.ContextValues["impl.done"])
+	}
+	progress, err := os.ReadFile(filepath.Join(second.LogsRoot, "progress.ndjson"))
+	if err != nil {
+		t.Fatalf("read progress.ndjson: %v", err)
+	}
+	if !strings.Contains(string(progress), `"stage_memo_hit"`) {
+		t.Fatalf("progress.ndjson has no stage_memo_hit event")
+	}
+
+	// A different prompt is a different key.
+	changed := strings.Replace(memoDot, "implement it", "implement it carefully", 1)
+	runWithBackendForTest(t, repo, []byte(changed), backend)
+	if got := backend.calls.Load(); got != 2 {
+		t.Fatalf("changed prompt should miss the memo: %d calls", got)
+	}
+}
+
+func TestRun_StageMemo_UpstreamContextChangeMisses(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	repo := initTestRepo(t)
+	backend := &fileWritingBackend{}
+	dotFor := func(task string) []byte {
+		return []byte(`
+digraph G {
+  graph [goal="ship it", cache=true]
+  start [shape=Mdiamond]
+  seed  [shape=parallelogram, tool_command="printf '%s' '{\"status\":\"success\",\"context_updates\":{\"plan.task\":\"` + task + `\"}}' > \"$KILROY_STAGE_LOGS_DIR/status.json\""]
+  impl  [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="implement it"]
+  exit  [shape=Msquare]
+  start -> seed -> impl -> exit
+}
+`)
+	}
+
+	runWithBackendForTest(t, repo, dotFor("a"), backend)
+	runWithBackendForTest(t, repo, dotFor("a"), backend)
+	if got := backend.calls.Load(); got != 1 {
+		t.Fatalf("unchanged context should replay: %d calls", got)
+	}
+	// The prompt text is the same, but the context carried into it is not.
+	runWithBackendForTest(t, repo, dotFor("b"), backend)
+	if got := backend.calls.Load(); got != 2 {
+		t.Fatalf("changed upstream context should miss the memo: %d calls", got)
+	}
+}
+
+func TestRun_StageMemo_ReplaysParallelBranchStages(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	repo := initTestRepo(t)
+	backend := &fileWritingBackend{}
+	dot := []byte(`
+digraph G {
+  graph [goal="ship it", cache=true]
+  start [shape=Mdiamond]
+  fan   [shape=component]
+  a     [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="do a"]
+  b     [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="do b"]
+  join  [shape=tripleoctagon]
+  exit  [shape=Msquare]
+  start -> fan
+  fan -> a -> join
+  fan -> b -> join
+  join -> exit
+}
+`)
+	runWithBackendForTest(t, repo, dot, backend)
+	if got := backend.calls.Load(); got != 2 {
+		t.Fatalf("first run backend calls: got %d want 2", got)
+	}
+	second := runWithBackendForTest(t, repo, dot, backend)
+	if got := backend.calls.Load(); got != 2 {
+		t.Fatalf("branch stages were not replayed: %d calls", got)
+	}
+	progress, err := os.ReadFile(filepath.Join(second.LogsRoot, "progress.ndjson"))
+	if err != nil {
+		t.Fatalf("read progress.ndjson: %v", err)
+	}
+	if n := strings.Count(string(progress), `"stage_memo_hit"`); n != 2 {
+		t.Fatalf("stage_memo_hit events: got %d want 2", n)
+	}
+}
+
+func TestRun_StageMemo_OffByDefault(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	repo := initTestRepo(t)
+	backend := &fileWritingBackend{}
+	dot := []byte(strings.Replace(memoDot, ", cache=true", "", 1))
+
+	first := runWithBackendForTest(t, repo, dot, backend)
+	runWithBackendForTest(t, repo, dot, backend)
+	if got := backend.calls.Load(); got != 2 {
+		t.Fatalf("backend calls: got %d want 2", got)
+	}
+	if _, err := os.Stat(filepath.Join(first.LogsRoot, "impl", memoFileName)); err == nil {
+		t.Fatalf("memo.json written without cache=true")
+	}
+}
@@ -13,6 +13,8 @@ const (
 	stageLogsDirEnvKey   = "KILROY_STAGE_LOGS_DIR"
 	worktreeDirEnvKey    = "KILROY_WORKTREE_DIR"
 	inputsManifestEnvKey = "KILROY_INPUTS_MANIFEST_PATH"
+	itemEnvKey           = "KILROY_ITEM"
+	itemIndexEnvKey      = "KILROY_ITEM_INDEX"
 )
 
 // buildBaseNodeEnv constructs the base environment for any node execution.
@@ -70,6 +72,12 @@ func buildStageRuntimeEnv(execCtx *Execution, nodeID string) map[string]string {
 	if worktree := strings.TrimSpace(execCtx.WorktreeDir); worktree != "" {
 		out[worktreeDirEnvKey] = worktree
 	}
+	if execCtx.Context != nil {
+		if item, ok := execCtx.Context.Get(foreachItemKey); ok {
+			out[itemEnvKey] = foreachItemString(item)
+			out[itemIndexEnvKey] = execCtx.Context.GetString(foreachIndexKey, "")
+		}
+	}
 	if execCtx.Engine != nil && execCtx.Engine.inputMaterializationEnabled() {
 		manifestPath := strings.TrimSpace(execCtx.Engine.currentInputManifestPath)
 		if manifestPath == "" && strings.TrimSpace(execCtx.LogsRoot) != "" && strings.TrimSpace(nodeID) != "" {
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// ForEachHandler fans out over a list read from the run context
+// (type=parallel.foreach). The node's single outgoing edge enters the branch
+// subgraph, which runs once per item in its own worktree until the nearest
+// parallel.fan_in node. max_parallel, join_policy and error_policy work as
+// they do for the static parallel handler.
+type ForEachHandler struct{}
+
+// Context keys set in each foreach branch.
+const (
+	foreachItemKey  = "item"
+	foreachIndexKey = "foreach.index"
+	foreachCountKey = "foreach.count"
+)
+
+func (h *ForEachHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
+	if exec == nil || exec.Engine == nil || exec.Graph == nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "parallel.foreach handler missing execution context"}, nil
+	}
+	fail := func(format string, args ...any) (runtime.Outcome, error) {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf(format, args...)}, nil
+	}
+
+	edges := exec.Graph.Outgoing(node.ID)
+	if len(edges) != 1 {
+		return fail("parallel.foreach node must have exactly one outgoing edge (the branch entry), has %d", len(edges))
+	}
+	joinID, err := findJoinFanInNode(exec.Graph, edges)
+	if err != nil {
+		return fail("parallel.foreach: no parallel.fan_in node reachable from %s", edges[0].To)
+	}
+
+	key := strings.TrimPrefix(strings.TrimSpace(node.Attr("foreach_key", "")), "context.")
+	if key == "" {
+		return fail("parallel.foreach node requires foreach_key")
+	}
+	raw, ok := exec.Context.Get(key)
+	if !ok || raw == nil {
+		return fail("parallel.foreach: context key %q is not set", key)
+	}
+	items, err := foreachItems(raw)
+	if err != nil {
+		return fail("parallel.foreach: context key %q: %v", key, err)
+	}
+	if len(items) == 0 {
+		return fail("parallel.foreach: context key %q is an empty list", key)
+	}
+
+	width := len(fmt.Sprint(len(items)))
+	if width < 2 {
+		width = 2
+	}
+	branches := make([]parallelBranch, 0, len(items))
+	for i, item := range items {
+		branches = append(branches, parallelBranch{
+			Edge:    edges[0],
+			Key:     fmt.Sprintf("item-%0*d", width, i+1),
+			Context: foreachItemContext(item, i, len(items)),
+		})
+	}
+	exec.Engine.appendProgress(map[string]any{
+		"event":       "foreach_fan_out",
+		"node_id":     node.ID,
+		"foreach_key": key,
+		"items":       len(items),
+		"join_node":   joinID,
+	})
+	return runParallelFanOut(ctx, exec, node, branches, joinID)
+}
+
+// foreachItems decodes a context value into a list. Values set through
+// context_updates arrive as JSON arrays; a string holding a JSON array is
+// accepted too, since stages often write lists that way.
+func foreachItems(raw any) ([]any, error) {
+	if s, ok := raw.(string); ok {
+		var items []any
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s)), &items); err != nil {
+			return nil, fmt.Errorf("not a list (got a string that is not a JSON array)")
+		}
+		return items, nil
+	}
+	if items, ok := raw.([]any); ok {
+		return items, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var items []any
+	if err := json.Unmarshal(b, &items); err != nil {
+		return nil, fmt.Errorf("not a list (got %T)", raw)
+	}
+	return items, nil
+}
+
+// foreachItemContext is the context a branch starts with: the item itself,
+// its fields as item.<field> when it is an object, and its position.
+func foreachItemContext(item any, index, count int) map[string]any {
+	out := map[string]any{
+		foreachItemKey:  item,
+		foreachIndexKey: index,
+		foreachCountKey: count,
+	}
+	if fields, ok := item.(map[string]any); ok {
+		for k, v := range fields {
+			out[foreachItemKey+"."+k] = v
+		}
+	}
+	return out
+}
+
+var itemVarRe = regexp.MustCompile(`\$item((?:\.[A-Za-z0-9_]+)*)\b`)
+
+// expandItemVars replaces $item and $item.<field> in text with the current
+// foreach item from c. Outside a foreach branch text is returned unchanged.
+func expandItemVars(text string, c *runtime.Context) string {
+	if c == nil || !strings.Contains(text, "$item") {
+		return text
+	}
+	if _, ok := c.Get(foreachItemKey); !ok {
+		return text
+	}
+	return itemVarRe.ReplaceAllStringFunc(text, func(m string) string {
+		v, ok := c.Get(strings.TrimPrefix(m, "$"))
+		if !ok {
+			return m
+		}
+		return foreachItemString(v)
+	})
+}
+
+// foreachItemString renders an item value for prompts and the environment:
+// strings as they are, anything else as JSON.
+func foreachItemString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestRun_ParallelForEach_FansOutOverContextList(t *testing.T) {
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	_ = os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\n"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+
+	dot := []byte(`
+digraph P {
+  graph [goal="test"]
+  start [shape=Mdiamond]
+  plan [shape=parallelogram, tool_command="printf '%s' '{\"status\":\"success\",\"context_updates\":{\"modules\":[{\"name\":\"alpha\"},{\"name\":\"beta\"},{\"name\":\"gamma\"}]}}' > \"$KILROY_STAGE_LOGS_DIR/status.json\""]
+  each [shape=component, type="parallel.foreach", foreach_key="context.modules", max_parallel=2]
+  port [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="Port the $item.name module."]
+  record [shape=parallelogram, tool_command="printf '%s' \"$KILROY_ITEM\" > \"item-$KILROY_ITEM_INDEX.json\""]
+  join [shape=tripleoctagon]
+  exit [shape=Msquare]
+
+  start -> plan -> each
+  each -> port -> record -> join
+  join -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: got %q want success", res.FinalStatus)
+	}
+
+	b, err := os.ReadFile(filepath.Join(res.LogsRoot, "each", "parallel_results.json"))
+	if err != nil {
+		t.Fatalf("read parallel_results.json: %v", err)
+	}
+	var results []parallelBranchResult
+	if err := json.Unmarshal(b, &results); err != nil {
+		t.Fatalf("decode parallel_results.json: %v", err)
+	}
+	var keys []string
+	for _, r := range results {
+		keys = append(keys, r.BranchKey)
+	}
+	sort.Strings(keys)
+	if want := []string{"item-01", "item-02", "item-03"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("branch keys: got %v want %v", keys, want)
+	}
+
+	for i, name := range []string{"alpha", "beta", "gamma"} {
+		branchRoot := filepath.Join(res.LogsRoot, "parallel", "each", keys[i][len("item-"):]+"-"+keys[i])
+		prompt, err := os.ReadFile(filepath.Join(branchRoot, "port", "prompt.md"))
+		if err != nil {
+			t.Fatalf("read %s prompt.md: %v", keys[i], err)
+		}
+		if !strings.Contains(string(prompt), "Port the "+name+" module.") {
+			t.Fatalf("%s prompt not expanded:\n%s", keys[i], prompt)
+		}
+		item, err := os.ReadFile(filepath.Join(branchRoot, "worktree", "item-"+string(rune('0'+i))+".json"))
+		if err != nil {
+			t.Fatalf("read %s item file: %v", keys[i], err)
+		}
+		if got, want := string(item), `{"name":"`+name+`"}`; got != want {
+			t.Fatalf("%s KILROY_ITEM: got %s want %s", keys[i], got, want)
+		}
+	}
+	assertExists(t, filepath.Join(res.LogsRoot, "join", "status.json"))
+}
+
+func TestRun_ParallelForEach_EmptyListFails(t *testing.T) {
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	_ = os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\n"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+
+	dot := []byte(`
+digraph P {
+  graph [goal="test"]
+  start [shape=Mdiamond]
+  plan [shape=parallelogram, tool_command="printf '%s' '{\"status\":\"success\",\"context_updates\":{\"modules\":[]}}' > \"$KILROY_STAGE_LOGS_DIR/status.json\""]
+  each [shape=component, type="parallel.foreach", foreach_key="modules"]
+  port [shape=parallelogram, tool_command="true"]
+  join [shape=tripleoctagon]
+  exit [shape=Msquare]
+
+  start -> plan -> each
+  each -> port -> join
+  join -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, _ := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if res != nil && res.FinalStatus == runtime.FinalSuccess {
+		t.Fatalf("expected the run to fail on an empty foreach list")
+	}
+}
+
+func TestForEachItems(t *testing.T) {
+	cases := []struct {
+		in      any
+		want    []any
+		wantErr bool
+	}{
+		{in: []any{"a", "b"}, want: []any{"a", "b"}},
+		{in: `["a", {"n": 1}]`, want: []any{"a", map[string]any{"n": float64(1)}}},
+		{in: []string{"x"}, want: []any{"x"}},
+		{in: "a,b", wantErr: true},
+		{in: map[string]any{"a": 1}, wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := foreachItems(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("foreachItems(%#v) err=%v wantErr=%v", tc.in, err, tc.wantErr)
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("foreachItems(%#v) = %#v, want %#v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestExpandItemVars(t *testing.T) {
+	c := runtime.NewContext()
+	if got := expandItemVars("Port $item.name", c); got != "Port $item.name" {
+		t.Fatalf("outside foreach: got %q", got)
+	}
+	c.ApplyUpdates(foreachItemContext(map[string]any{"name": "alpha", "tags": []any{"x"}}, 0, 1))
+	got := expandItemVars("Port $item.name ($item.tags); raw=$item; $item.missing; $itemized", c)
+	want := `Port alpha (["x"]); raw={"name":"alpha","tags":["x"]}; $item.missing; $itemized`
+	if got != want {
+		t.Fatalf("expandItemVars:\n got %q\nwant %q", got, want)
+	}
+}
@@ -99,7 +99,13 @@ func (h *ParallelHandler) Execute(ctx context.Context, exec *Execution, node *mo
 	if err != nil {
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
 	}
+	return runParallelFanOut(ctx, exec, node, edgeBranches(branches), joinID)
+}
 
+// runParallelFanOut dispatches branches under the node's join_policy and
+// error_policy and reports the aggregate outcome. The engine continues at
+// joinID, which it reads back from parallel.join_node.
+func runParallelFanOut(ctx context.Context, exec *Execution, node *model.Node, branches []parallelBranch, joinID string) (runtime.Outcome, error) {
 	// Spec §4.8: read join_policy and error_policy from node attributes.
 	jp, ep := parallelPolicies(node)
 
@@ -153,6 +159,26 @@ func (h *ParallelHandler) Execute(ctx context.Context, exec *Execution, node *mo
 	}, nil
 }
 
+// parallelBranch is one branch of a fan-out: the edge into its subgraph and,
+// for parallel.foreach, the branch key and the item's context entries.
+type parallelBranch struct {
+	Edge *model.Edge
+	// Key names the branch's git branch and logs directory. Empty derives it
+	// from the edge target.
+	Key string
+	// Context is applied to the branch's copy of the run context.
+	Context map[string]any
+}
+
+// edgeBranches makes one branch per outgoing edge.
+func edgeBranches(edges []*model.Edge) []parallelBranch {
+	out := make([]parallelBranch, 0, len(edges))
+	for _, e := range edges {
+		out = append(out, parallelBranch{Edge: e})
+	}
+	return out
+}
+
 // dispatchParallelBranches runs branches in parallel and returns the results.
 // It creates a checkpoint commit, spawns worktrees for each branch, runs subgraphs,
 // and collects results. This is the shared core used by both explicit ParallelHandler
@@ -161,7 +187,7 @@ func dispatchParallelBranches(
 	ctx context.Context,
 	exec *Execution,
 	sourceNodeID string,
-	branches []*model.Edge,
+	branches []parallelBranch,
 	joinID string,
 ) ([]parallelBranchResult, string, error) {
 	if exec == nil || exec.Engine == nil || exec.Graph == nil {
@@ -179,8 +205,7 @@ func dispatchParallelBranches(
 	}
 
 	// Kilroy git model: create the checkpoint commit FIRST so branch work is a descendant.
-	msg := fmt.Sprintf("attractor(%s): %s (%s)", exec.Engine.Options.RunID, sourceNodeID, runtime.StatusSuccess)
-	baseSHA, err := gitutil.CommitAllowEmpty(exec.WorktreeDir, msg)
+	baseSHA, err := parallelBaseCommit(exec, sourceNodeID)
 	if err != nil {
 		return nil, "", err
 	}
@@ -189,14 +214,15 @@ func dispatchParallelBranches(
 	if maxParallel <= 0 {
 		maxParallel = 4
 	}
+	maxParallel = exec.Engine.effects().maxParallel(maxParallel)
 
 	// git ref/worktree mutations are not concurrency-safe. Serialize setup operations,
 	// then run branch execution concurrently.
 	var gitMu sync.Mutex
 
 	type job struct {
-		idx  int
-		edge *model.Edge
+		idx    int
+		branch parallelBranch
 	}
 
 	h := &ParallelHandler{}
@@ -207,11 +233,10 @@ func dispatchParallelBranches(
 	worker := func() {
 		defer wg.Done()
 		for j := range jobs {
-			e := j.edge
-			if e == nil {
+			if j.branch.Edge == nil {
 				continue
 			}
-			res := h.runBranch(ctx, exec, sourceNode, baseSHA, joinID, j.idx, e, &gitMu)
+			res := h.runBranch(ctx, exec, sourceNode, baseSHA, joinID, j.idx, j.branch, &gitMu)
 			results[j.idx] = res
 		}
 	}
@@ -224,8 +249,8 @@ func dispatchParallelBranches(
 	for i := 0; i < workers; i++ {
 		go worker()
 	}
-	for idx, e := range branches {
-		jobs <- job{idx: idx, edge: e}
+	for idx, b := range branches {
+		jobs <- job{idx: idx, branch: b}
 	}
 	close(jobs)
 	wg.Wait()
@@ -241,8 +266,12 @@ func dispatchParallelBranches(
 	return results, baseSHA, nil
 }
 
-func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parallelNode *model.Node, baseSHA, joinID string, idx int, edge *model.Edge, gitMu *sync.Mutex) parallelBranchResult {
-	key := sanitizeRefComponent(edge.To)
+func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parallelNode *model.Node, baseSHA, joinID string, idx int, branch parallelBranch, gitMu *sync.Mutex) parallelBranchResult {
+	edge := branch.Edge
+	key := branch.Key
+	if key == "" {
+		key = sanitizeRefComponent(edge.To)
+	}
 	if key == "" {
 		key = fmt.Sprintf("branch-%d", idx+1)
 	}
@@ -342,30 +371,16 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 	// Prepare branch git worktree rooted at the parallel node checkpoint commit.
 	emitBranchProgress("branch_setup_start", nil)
 	_ = os.MkdirAll(branchRoot, 0o755)
+	exec.Engine.effects().traversed(edge)
 	if gitMu != nil {
 		gitMu.Lock()
 	}
 	emitBranchProgress("branch_setup_locked", nil)
-	_ = gitutil.RemoveWorktree(exec.Engine.Options.RepoPath, worktreeDir)
-	if err := gitutil.CreateBranchAt(exec.Engine.Options.RepoPath, branchName, baseSHA); err != nil {
-		if gitMu != nil {
-			gitMu.Unlock()
-		}
-		return parallelBranchResult{
-			BranchKey:   key,
-			BranchName:  branchName,
-			StartNodeID: edge.To,
-			StopNodeID:  joinID,
-			LogsRoot:    branchRoot,
-			WorktreeDir: worktreeDir,
-			Error:       err.Error(),
-			Outcome:     runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()},
-		}
+	wt, err := exec.Engine.effects().branchWorktree(exec, branchName, baseSHA, worktreeDir)
+	if gitMu != nil {
+		gitMu.Unlock()
 	}
-	if err := gitutil.AddWorktree(exec.Engine.Options.RepoPath, worktreeDir, branchName); err != nil {
-		if gitMu != nil {
-			gitMu.Unlock()
-		}
+	if err != nil {
 		return parallelBranchResult{
 			BranchKey:   key,
 			BranchName:  branchName,
@@ -377,10 +392,7 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 			Outcome:     runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()},
 		}
 	}
-	_ = gitutil.ResetHard(worktreeDir, baseSHA)
-	if gitMu != nil {
-		gitMu.Unlock()
-	}
+	worktreeDir = wt
 	emitBranchProgress("branch_setup_ready", nil)
 
 	branchEng := &Engine{
@@ -401,6 +413,17 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 		InputReferenceInferer:      exec.Engine.InputReferenceInferer,
 		InputInferenceCache:        copyInferredReferenceCache(exec.Engine.InputInferenceCache),
 		InputSourceTargetMap:       copyStringStringMap(exec.Engine.InputSourceTargetMap),
+		StageSummarizer:            exec.Engine.StageSummarizer,
+		ManagerSteerer:             exec.Engine.ManagerSteerer,
+		FanInJudge:                 exec.Engine.FanInJudge,
+		steering:                   exec.Engine.steering,
+		costs:                      exec.Engine.costs,
+		sideEffects:                exec.Engine.sideEffects,
+		callStack:                  exec.Engine.callStack,
+		parentLogsRoots:            append([]string{exec.LogsRoot}, exec.Engine.parentLogsRoots...),
+	}
+	if len(branch.Context) > 0 {
+		branchEng.Context.ApplyUpdates(branch.Context)
 	}
 	if exec.Engine.CXDB != nil {
 		if fork, err := exec.Engine.CXDB.ForkFromHead(ctx); err == nil {
@@ -515,7 +538,6 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 type FanInHandler struct{}
 
 func (h *FanInHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
-	_ = ctx
 	raw, ok := exec.Context.Get("parallel.results")
 	if !ok || raw == nil {
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "no parallel.results found in context"}, nil
@@ -529,8 +551,8 @@ func (h *FanInHandler) Execute(ctx context.Context, exec *Execution, node *model
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "no parallel results to evaluate"}, nil
 	}
 
-	winner, ok := selectHeuristicWinner(results)
-	if !ok {
+	cands := fanInCandidates(results)
+	if len(cands) == 0 {
 		failureClass := classifyParallelAllFailFailureClass(results)
 		return runtime.Outcome{
 			Status:        runtime.StatusFail,
@@ -545,6 +567,29 @@ func (h *FanInHandler) Execute(ctx context.Context, exec *Execution, node *model
 		}, nil
 	}
 
+	// Spec §4.9: fan_in_strategy picks how the winner is chosen.
+	strategy := fanInStrategy(node)
+	winner := cands[0]
+	judgement := fanInJudgement{Strategy: strategy, Winner: winner.BranchKey}
+	switch strategy {
+	case fanInStrategyHeuristic:
+	case fanInStrategyLLM:
+		winner, judgement = judgeByLLM(ctx, exec, node, cands)
+	case fanInStrategyCommand:
+		winner, judgement = judgeByCommand(ctx, exec, node, cands)
+	case fanInStrategyMerge:
+		var out runtime.Outcome
+		out, judgement = mergeFanIn(exec, node, cands, results)
+		recordFanInJudgement(exec, node, judgement)
+		return out, nil
+	default:
+		return runtime.Outcome{
+			Status:        runtime.StatusFail,
+			FailureReason: fmt.Sprintf("unknown fan_in_strategy %q (want one of %s)", strategy, strings.Join(FanInStrategies, ", ")),
+		}, nil
+	}
+	recordFanInJudgement(exec, node, judgement)
+
 	// Fast-forward the main run branch to the winner head.
 	if strings.TrimSpace(winner.HeadSHA) != "" {
 		if err := gitutil.FastForwardFFOnly(exec.WorktreeDir, winner.HeadSHA); err != nil {
@@ -557,28 +602,30 @@ func (h *FanInHandler) Execute(ctx context.Context, exec *Execution, node *model
 		if r.BranchKey == winner.BranchKey && r.HeadSHA == winner.HeadSHA {
 			continue
 		}
-		losers = append(losers, map[string]any{
-			"branch_key":        r.BranchKey,
-			"branch_name":       r.BranchName,
-			"head_sha":          r.HeadSHA,
-			"status":            string(r.Outcome.Status),
-			"logs_root":         r.LogsRoot,
-			"cxdb_context_id":   r.CXDBContextID,
-			"cxdb_head_turn_id": r.CXDBHeadTurnID,
-		})
+		losers = append(losers, fanInLoser(r))
 	}
 
+	updates := map[string]any{
+		"parallel.fan_in.strategy":               strategy,
+		"parallel.fan_in.best_id":                winner.BranchKey,
+		"parallel.fan_in.best_outcome":           winner.Outcome,
+		"parallel.fan_in.best_head_sha":          winner.HeadSHA,
+		"parallel.fan_in.best_cxdb_context_id":   winner.CXDBContextID,
+		"parallel.fan_in.best_cxdb_head_turn_id": winner.CXDBHeadTurnID,
+		"parallel.fan_in.losers":                 losers,
+	}
+	if judgement.Rationale != "" {
+		updates["parallel.fan_in.rationale"] = judgement.Rationale
+	}
+	for _, s := range judgement.Scores {
+		if s.BranchKey == winner.BranchKey {
+			updates["parallel.fan_in.best_score"] = s.Score
+		}
+	}
 	return runtime.Outcome{
-		Status: runtime.StatusSuccess,
-		Notes:  fmt.Sprintf("fan-in selected %s (%s)", winner.BranchKey, winner.Outcome.Status),
-		ContextUpdates: map[string]any{
-			"parallel.fan_in.best_id":                winner.BranchKey,
-			"parallel.fan_in.best_outcome":           winner.Outcome,
-			"parallel.fan_in.best_head_sha":          winner.HeadSHA,
-			"parallel.fan_in.best_cxdb_context_id":   winner.CXDBContextID,
-			"parallel.fan_in.best_cxdb_head_turn_id": winner.CXDBHeadTurnID,
-			"parallel.fan_in.losers":                 losers,
-		},
+		Status:         runtime.StatusSuccess,
+		Notes:          fmt.Sprintf("fan-in selected %s (%s)", winner.BranchKey, winner.Outcome.Status),
+		ContextUpdates: updates,
 	}, nil
 }
 
@@ -937,3 +984,10 @@ func copyInferredReferenceCache(in map[string][]InferredReference) map[string][]
 	}
 	return out
 }
+
+// parallelBaseCommit creates the checkpoint commit that parallel branches fork
+// from.
+func parallelBaseCommit(exec *Execution, sourceNodeID string) (string, error) {
+	msg := fmt.Sprintf("attractor(%s): %s (%s)", exec.Engine.Options.RunID, sourceNodeID, runtime.StatusSuccess)
+	return exec.Engine.effects().commit(exec.WorktreeDir, msg, nil)
+}
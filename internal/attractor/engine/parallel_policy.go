@@ -8,7 +8,6 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
 	"github.com/danshapiro/kilroy/internal/attractor/model"
 	"github.com/danshapiro/kilroy/internal/attractor/runtime"
 )
@@ -223,7 +222,7 @@ func dispatchParallelBranchesWithPolicy(
 	ctx context.Context,
 	exec *Execution,
 	sourceNodeID string,
-	branches []*model.Edge,
+	branches []parallelBranch,
 	joinID string,
 	jp joinPolicy,
 	ep errorPolicy,
@@ -250,7 +249,7 @@ func dispatchParallelBranchesStreaming(
 	ctx context.Context,
 	exec *Execution,
 	sourceNodeID string,
-	branches []*model.Edge,
+	branches []parallelBranch,
 	joinID string,
 	jp joinPolicy,
 	ep errorPolicy,
@@ -270,8 +269,7 @@ func dispatchParallelBranchesStreaming(
 		sourceNode = &model.Node{ID: sourceNodeID, Attrs: map[string]string{}}
 	}
 
-	msg := fmt.Sprintf("attractor(%s): %s (%s)", exec.Engine.Options.RunID, sourceNodeID, runtime.StatusSuccess)
-	baseSHA, err := gitutil.CommitAllowEmpty(exec.WorktreeDir, msg)
+	baseSHA, err := parallelBaseCommit(exec, sourceNodeID)
 	if err != nil {
 		return nil, "", err
 	}
@@ -280,6 +278,7 @@ func dispatchParallelBranchesStreaming(
 	if maxParallel <= 0 {
 		maxParallel = 4
 	}
+	maxParallel = exec.Engine.effects().maxParallel(maxParallel)
 
 	var gitMu sync.Mutex
 
@@ -297,8 +296,8 @@ func dispatchParallelBranchesStreaming(
 	results := make([]parallelBranchResult, len(branches))
 
 	type job struct {
-		idx  int
-		edge *model.Edge
+		idx    int
+		branch parallelBranch
 	}
 	jobs := make(chan job)
 	var wg sync.WaitGroup
@@ -306,11 +305,10 @@ func dispatchParallelBranchesStreaming(
 	worker := func() {
 		defer wg.Done()
 		for j := range jobs {
-			e := j.edge
-			if e == nil {
+			if j.branch.Edge == nil {
 				continue
 			}
-			res := h.runBranch(cancelCtx, exec, sourceNode, baseSHA, joinID, j.idx, e, &gitMu)
+			res := h.runBranch(cancelCtx, exec, sourceNode, baseSHA, joinID, j.idx, j.branch, &gitMu)
 			resultCh <- indexedResult{idx: j.idx, result: res}
 		}
 	}
@@ -327,9 +325,9 @@ func dispatchParallelBranchesStreaming(
 	// Feed jobs in a separate goroutine so we can read results concurrently.
 	go func() {
 		defer close(jobs)
-		for idx, e := range branches {
+		for idx, b := range branches {
 			select {
-			case jobs <- job{idx: idx, edge: e}:
+			case jobs <- job{idx: idx, branch: b}:
 			case <-cancelCtx.Done():
 				// Context cancelled — stop sending new jobs.
 				return
@@ -0,0 +1,222 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+// Graphs declare parameters in the params graph attribute: entries separated
+// by ";" or newlines, each name[:type][!][=default]. "!" marks the parameter
+// required. Types are string (the default), int, number and bool. References
+// to $param.<name> in graph, node and edge attributes expand to the value;
+// in attributes run by a shell (shellParamAttrs) the value is expanded as one
+// single-quoted shell word.
+//
+//	graph [params="module:string!; depth:int=2; dry_run:bool=false"]
+
+type paramDecl struct {
+	Name       string
+	Type       string
+	Default    string
+	HasDefault bool
+	Required   bool
+}
+
+var (
+	paramNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	paramRefRe  = regexp.MustCompile(`\$param\.([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// shellParamAttrs are the attributes the engine hands to a shell.
+var shellParamAttrs = map[string]bool{
+	"tool_command":    true,
+	"fan_in_command":  true,
+	"tool_hooks.pre":  true,
+	"tool_hooks.post": true,
+}
+
+func parseParamDecls(raw string) ([]paramDecl, error) {
+	var decls []paramDecl
+	seen := map[string]bool{}
+	for _, entry := range strings.FieldsFunc(raw, func(r rune) bool { return r == ';' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var d paramDecl
+		head, def, hasDef := strings.Cut(entry, "=")
+		head = strings.TrimSpace(head)
+		if strings.HasSuffix(head, "!") {
+			d.Required = true
+			head = strings.TrimSpace(strings.TrimSuffix(head, "!"))
+		}
+		name, typ, _ := strings.Cut(head, ":")
+		d.Name = strings.TrimSpace(name)
+		d.Type = strings.ToLower(strings.TrimSpace(typ))
+		if d.Type == "" {
+			d.Type = "string"
+		}
+		if !paramNameRe.MatchString(d.Name) {
+			return nil, fmt.Errorf("param %q: invalid name", entry)
+		}
+		if seen[d.Name] {
+			return nil, fmt.Errorf("param %s declared twice", d.Name)
+		}
+		seen[d.Name] = true
+		switch d.Type {
+		case "string", "int", "number", "bool":
+		default:
+			return nil, fmt.Errorf("param %s: unknown type %q (want string, int, number or bool)", d.Name, d.Type)
+		}
+		if hasDef {
+			if d.Required {
+				return nil, fmt.Errorf("param %s: a required param cannot have a default", d.Name)
+			}
+			d.Default, d.HasDefault = strings.TrimSpace(def), true
+			if err := checkParamValue(d, d.Default); err != nil {
+				return nil, fmt.Errorf("param %s default: %v", d.Name, err)
+			}
+		}
+		decls = append(decls, d)
+	}
+	return decls, nil
+}
+
+func checkParamValue(d paramDecl, v string) error {
+	var err error
+	switch d.Type {
+	case "int":
+		_, err = strconv.ParseInt(v, 10, 64)
+	case "number":
+		_, err = strconv.ParseFloat(v, 64)
+	case "bool":
+		_, err = strconv.ParseBool(v)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", v, d.Type)
+	}
+	return nil
+}
+
+// bindParams resolves supplied values against the declarations: supplied
+// values are type-checked, defaults fill the rest and optional params without
+// one bind to "". Missing required params are errors only when requireAll is
+// set; they stay unbound otherwise.
+func bindParams(decls []paramDecl, supplied map[string]string, requireAll bool) (map[string]string, []error) {
+	var errs []error
+	byName := map[string]paramDecl{}
+	for _, d := range decls {
+		byName[d.Name] = d
+	}
+	names := make([]string, 0, len(supplied))
+	for k := range supplied {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if _, ok := byName[k]; !ok {
+			errs = append(errs, fmt.Errorf("unknown param %q", k))
+		}
+	}
+
+	values := map[string]string{}
+	for _, d := range decls {
+		v, ok := supplied[d.Name]
+		switch {
+		case ok:
+			if err := checkParamValue(d, v); err != nil {
+				errs = append(errs, fmt.Errorf("param %s: %v", d.Name, err))
+				continue
+			}
+		case d.HasDefault:
+			v = d.Default
+		case d.Required:
+			if requireAll {
+				errs = append(errs, fmt.Errorf("missing required param %s (pass --param %s=<%s>)", d.Name, d.Name, d.Type))
+			}
+			continue
+		}
+		values[d.Name] = v
+	}
+	return values, errs
+}
+
+// applyParams binds the graph's declared parameters and expands $param
+// references in place. It reports declaration and binding problems and
+// references to undeclared parameters.
+func applyParams(g *model.Graph, opts PrepareOptions) []validate.Diagnostic {
+	var diags []validate.Diagnostic
+	report := func(d validate.Diagnostic, msg string) {
+		d.Rule, d.Severity, d.Message = "params", validate.SeverityError, msg
+		d.Range = validate.Locate(g, d)
+		diags = append(diags, d)
+	}
+	decls, err := parseParamDecls(g.Attrs["params"])
+	if err != nil {
+		report(validate.Diagnostic{Attr: "params"}, err.Error())
+		return diags
+	}
+	supplied := opts.Params
+	if opts.IgnoreUnknownParams {
+		supplied = map[string]string{}
+		for _, d := range decls {
+			if v, ok := opts.Params[d.Name]; ok {
+				supplied[d.Name] = v
+			}
+		}
+	}
+	values, errs := bindParams(decls, supplied, opts.RequireParams)
+	for _, err := range errs {
+		report(validate.Diagnostic{Attr: "params"}, err.Error())
+	}
+	declared := map[string]bool{}
+	for _, d := range decls {
+		declared[d.Name] = true
+	}
+
+	expand := func(at validate.Diagnostic, attrs map[string]string) {
+		reported := map[string]bool{}
+		for k, v := range attrs {
+			if k == "params" || !strings.Contains(v, "$param.") {
+				continue
+			}
+			attrs[k] = paramRefRe.ReplaceAllStringFunc(v, func(m string) string {
+				name := m[len("$param."):]
+				if val, ok := values[name]; ok {
+					if shellParamAttrs[k] {
+						return shellQuote(val)
+					}
+					return val
+				}
+				if !declared[name] && !reported[name] {
+					reported[name] = true
+					at.Attr = k
+					report(at, fmt.Sprintf("$param.%s refers to a param the graph does not declare", name))
+				}
+				return m
+			})
+		}
+	}
+	expand(validate.Diagnostic{}, g.Attrs)
+	for _, id := range g.AllNodeIDs() {
+		expand(validate.Diagnostic{NodeID: id}, g.Nodes[id].Attrs)
+	}
+	for _, e := range g.Edges {
+		if e != nil {
+			expand(validate.Diagnostic{EdgeFrom: e.From, EdgeTo: e.To}, e.Attrs)
+		}
+	}
+	return diags
+}
+
+// shellQuote makes s a single shell word, so a parameter value cannot break
+// out of the command it is expanded into.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestParseParamDecls(t *testing.T) {
+	got, err := parseParamDecls("module!; depth:int=2\n dry_run : bool = false ;ratio:number")
+	if err != nil {
+		t.Fatalf("parseParamDecls: %v", err)
+	}
+	want := []paramDecl{
+		{Name: "module", Type: "string", Required: true},
+		{Name: "depth", Type: "int", Default: "2", HasDefault: true},
+		{Name: "dry_run", Type: "bool", Default: "false", HasDefault: true},
+		{Name: "ratio", Type: "number"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+
+	for _, bad := range []string{
+		"a; a",
+		"a:list",
+		"a!=x",
+		"depth:int=two",
+		"1abc",
+	} {
+		if _, err := parseParamDecls(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	decls, err := parseParamDecls("module!; depth:int=2; note")
+	if err != nil {
+		t.Fatalf("parseParamDecls: %v", err)
+	}
+
+	got, errs := bindParams(decls, map[string]string{"module": "billing"}, true)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if want := map[string]string{"module": "billing", "depth": "2", "note": ""}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("values: got %v want %v", got, want)
+	}
+
+	if _, errs := bindParams(decls, nil, false); len(errs) != 0 {
+		t.Fatalf("missing required params should not fail without requireAll: %v", errs)
+	}
+	_, errs = bindParams(decls, map[string]string{"depth": "deep", "extra": "1"}, true)
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	joined := strings.Join(msgs, "\n")
+	for _, want := range []string{`unknown param "extra"`, `param depth: "deep" is not a valid int`, "missing required param module"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("errors missing %q:\n%s", want, joined)
+		}
+	}
+}
+
+const paramsDot = `
+digraph P {
+  graph [goal="Port $param.module", params="module!; depth:int=2"]
+  start [shape=Mdiamond]
+  plan [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="Port $param.module to depth $param.depth."]
+  record [shape=parallelogram, tool_command="printf '%s' $param.module > module.txt"]
+  exit [shape=Msquare]
+  start -> plan -> record -> exit
+}
+`
+
+func TestPrepare_ExpandsParams(t *testing.T) {
+	g, _, err := PrepareWithOptions([]byte(paramsDot), PrepareOptions{Params: map[string]string{"module": "billing"}, RequireParams: true})
+	if err != nil {
+		t.Fatalf("PrepareWithOptions: %v", err)
+	}
+	if got := g.Attrs["goal"]; got != "Port billing" {
+		t.Fatalf("goal: got %q", got)
+	}
+	if got := g.Nodes["plan"].Attrs["prompt"]; got != "Port billing to depth 2." {
+		t.Fatalf("prompt: got %q", got)
+	}
+	if got := g.Nodes["record"].Attrs["tool_command"]; got != "printf '%s' 'billing' > module.txt" {
+		t.Fatalf("tool_command: got %q", got)
+	}
+
+	// Values stay one shell word in tool_command, whatever they contain.
+	hostile := `x'; touch pwned; echo '$(touch pwned)`
+	g, _, err = PrepareWithOptions([]byte(paramsDot), PrepareOptions{Params: map[string]string{"module": hostile}, RequireParams: true})
+	if err != nil {
+		t.Fatalf("PrepareWithOptions: %v", err)
+	}
+	dir := t.TempDir()
+	runCmd(t, dir, "bash", "-c", g.Nodes["record"].Attrs["tool_command"])
+	if b, _ := os.ReadFile(filepath.Join(dir, "module.txt")); string(b) != hostile {
+		t.Fatalf("module.txt: got %q want %q", b, hostile)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+		t.Fatalf("param value was run as shell")
+	}
+
+	// Validation without values only checks declarations and references.
+	if _, _, err := PrepareWithOptions([]byte(paramsDot), PrepareOptions{}); err != nil {
+		t.Fatalf("PrepareWithOptions without params: %v", err)
+	}
+}
+
+func TestPrepare_ParamsErrors(t *testing.T) {
+	undeclared := strings.Replace(paramsDot, "$param.depth", "$param.level", 1)
+	cases := []struct {
+		name   string
+		dot    string
+		opts   PrepareOptions
+		want   string
+		nodeID string
+	}{
+		{name: "missing", dot: paramsDot, opts: PrepareOptions{RequireParams: true}, want: "missing required param module"},
+		{name: "type", dot: paramsDot, opts: PrepareOptions{Params: map[string]string{"module": "m", "depth": "x"}}, want: "not a valid int"},
+		{name: "undeclared", dot: undeclared, opts: PrepareOptions{}, want: "$param.level", nodeID: "plan"},
+	}
+	for _, tc := range cases {
+		_, diags, err := PrepareWithOptions([]byte(tc.dot), tc.opts)
+		if err == nil {
+			t.Fatalf("%s: expected an error", tc.name)
+		}
+		found := false
+		for _, d := range diags {
+			if d.Rule == "params" && d.NodeID == tc.nodeID && strings.Contains(d.Message, tc.want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("%s: no params diagnostic containing %q: %+v", tc.name, tc.want, diags)
+		}
+	}
+}
+
+func TestRun_Params_ExpandedAndRecordedInManifest(t *testing.T) {
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	_ = os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\n"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	params := map[string]string{"module": "billing"}
+	res, err := runForTest(t, ctx, []byte(paramsDot), RunOptions{RepoPath: repo, Params: params})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: got %q want success", res.FinalStatus)
+	}
+	if got := runCmdOut(t, repo, "git", "show", res.RunBranch+":module.txt"); got != "billing" {
+		t.Fatalf("module.txt: got %q", got)
+	}
+	prompt, err := os.ReadFile(filepath.Join(res.LogsRoot, "plan", "prompt.md"))
+	if err != nil {
+		t.Fatalf("read prompt.md: %v", err)
+	}
+	if !strings.Contains(string(prompt), "Port billing to depth 2.") {
+		t.Fatalf("prompt not expanded:\n%s", prompt)
+	}
+
+	b, err := os.ReadFile(filepath.Join(res.LogsRoot, "manifest.json"))
+	if err != nil {
+		t.Fatalf("read manifest.json: %v", err)
+	}
+	var m struct {
+		Params map[string]string `json:"params"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("decode manifest.json: %v", err)
+	}
+	if !reflect.DeepEqual(m.Params, params) {
+		t.Fatalf("manifest params: got %v want %v", m.Params, params)
+	}
+
+	if _, err := runForTest(t, ctx, []byte(paramsDot), RunOptions{RepoPath: repo}); err == nil || !strings.Contains(err.Error(), "missing required param module") {
+		t.Fatalf("expected a missing param error, got %v", err)
+	}
+}
+
+func TestRun_StackCall_PassesDeclaredParams(t *testing.T) {
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	_ = os.MkdirAll(filepath.Join(repo, "pipelines"), 0o755)
+	_ = os.WriteFile(filepath.Join(repo, "pipelines", "child.dot"), []byte(`
+digraph C {
+  graph [goal="child", params="module!"]
+  start [shape=Mdiamond]
+  record [shape=parallelogram, tool_command="printf '%s' $param.module > child_module.txt"]
+  exit [shape=Msquare]
+  start -> record -> exit
+}
+`), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+
+	dot := []byte(`
+digraph P {
+  graph [goal="parent", params="module!; depth:int=2"]
+  start [shape=Mdiamond]
+  call [shape=house, type="stack.call", stack.call_dotfile="pipelines/child.dot"]
+  exit [shape=Msquare]
+  start -> call -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	// depth is not declared by the called graph, so it is not passed down.
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo, Params: map[string]string{"module": "billing", "depth": "3"}})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: got %q want success", res.FinalStatus)
+	}
+	if got := runCmdOut(t, repo, "git", "show", res.RunBranch+":child_module.txt"); got != "billing" {
+		t.Fatalf("child_module.txt: got %q", got)
+	}
+}
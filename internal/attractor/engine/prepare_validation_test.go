@@ -1,6 +1,10 @@
 package engine
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
 
 func TestPrepare_ReturnsErrorOnValidationErrors(t *testing.T) {
 	_, _, err := Prepare([]byte(`digraph G { exit [shape=Msquare] }`))
@@ -8,3 +12,24 @@ func TestPrepare_ReturnsErrorOnValidationErrors(t *testing.T) {
 		t.Fatalf("expected error, got nil")
 	}
 }
+
+func TestPrepare_SyntaxErrorsBecomeLocatedDiagnostics(t *testing.T) {
+	_, diags, err := Prepare([]byte(`digraph G {
+  start [shape=Mdiamond]
+  a [label="A" prompt="x"]
+  b [shape=]
+}
+`))
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if len(diags) != 2 {
+		t.Fatalf("expected one diagnostic per syntax error, got %+v", diags)
+	}
+	for i, want := range []string{"3:16", "4:12"} {
+		d := diags[i]
+		if d.Rule != "dot_syntax" || d.Severity != validate.SeverityError || d.Range == nil || d.Range.Start.String() != want {
+			t.Fatalf("diagnostic %d: %+v", i, d)
+		}
+	}
+}
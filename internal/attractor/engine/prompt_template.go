@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+// Prompts of nodes with prompt_template=true (or loaded from a .tmpl
+// prompt_file) are Go text/template sources rendered just before the stage
+// runs. The data is a promptTemplateData; see promptTemplateFuncs for the
+// helpers.
+
+// promptTemplateFileMax caps what the file helper includes in a prompt.
+const promptTemplateFileMax = 32 * 1024
+
+type promptTemplateData struct {
+	Goal    string
+	RunID   string
+	NodeID  string
+	Context map[string]any
+	// Stages holds every stage that has written status.json under the
+	// current logs root, by node ID. Inside a parallel branch, stages that
+	// ran before the fan-out are found under the parent logs roots.
+	Stages map[string]*promptTemplateStage
+}
+
+// promptTemplateStage is a prior stage's status.json plus its response.md.
+type promptTemplateStage struct {
+	runtime.Outcome
+	Response string
+}
+
+func isPromptTemplate(n *model.Node) bool {
+	v, err := strconv.ParseBool(strings.TrimSpace(n.Attr("prompt_template", "false")))
+	return err == nil && v
+}
+
+// promptTemplateFuncs returns the helpers available to prompt templates.
+// Worktree paths are relative to worktreeDir and may not leave it.
+func promptTemplateFuncs(worktreeDir string) template.FuncMap {
+	resolve := func(path string) (string, error) {
+		if strings.TrimSpace(worktreeDir) == "" {
+			return "", fmt.Errorf("no worktree to read %s from", path)
+		}
+		p := filepath.Join(worktreeDir, filepath.Clean(path))
+		if filepath.IsAbs(path) || !pathWithin(p, worktreeDir) {
+			return "", fmt.Errorf("%s is outside the worktree", path)
+		}
+		return p, nil
+	}
+	return template.FuncMap{
+		// file includes a worktree file, cut to promptTemplateFileMax bytes.
+		"file": func(path string) (string, error) {
+			p, err := resolve(path)
+			if err != nil {
+				return "", err
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return "", err
+			}
+			return truncatePromptText(string(b), promptTemplateFileMax), nil
+		},
+		// exists reports whether a worktree file exists.
+		"exists": func(path string) bool {
+			p, err := resolve(path)
+			if err != nil {
+				return false
+			}
+			_, err = os.Stat(p)
+			return err == nil
+		},
+		// truncate cuts s to at most n bytes: {{ file "plan.md" | truncate 2000 }}.
+		"truncate": func(n int, s string) string {
+			return truncatePromptText(s, n)
+		},
+		"json": func(v any) (string, error) {
+			b, err := json.MarshalIndent(v, "", "  ")
+			return string(b), err
+		},
+	}
+}
+
+// truncatePromptText keeps the first n bytes of s, backing off to a rune
+// boundary, and notes how much was dropped.
+func truncatePromptText(s string, n int) string {
+	if n < 0 || len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("\n... (%d bytes truncated)", len(s)-cut)
+}
+
+func parsePromptTemplate(name, text, worktreeDir string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Funcs(promptTemplateFuncs(worktreeDir)).Parse(text)
+}
+
+// renderPromptTemplate renders a node's prompt template against the run
+// context, the prior stages' outputs and the worktree.
+func renderPromptTemplate(exec *Execution, node *model.Node, text string) (string, error) {
+	tmpl, err := parsePromptTemplate(node.ID, text, exec.WorktreeDir)
+	if err != nil {
+		return "", err
+	}
+	data := promptTemplateData{
+		NodeID:  node.ID,
+		Context: map[string]any{},
+		Stages:  map[string]*promptTemplateStage{},
+	}
+	if exec.Engine != nil {
+		data.RunID = exec.Engine.Options.RunID
+	}
+	if exec.Context != nil {
+		data.Context = exec.Context.SnapshotValues()
+		data.Goal = exec.Context.GetString("graph.goal", "")
+	}
+	if data.Goal == "" && exec.Graph != nil {
+		data.Goal = exec.Graph.Attrs["goal"]
+	}
+	if exec.Graph != nil {
+		roots := []string{exec.LogsRoot}
+		if exec.Engine != nil {
+			roots = append(roots, exec.Engine.parentLogsRoots...)
+		}
+		for _, id := range exec.Graph.AllNodeIDs() {
+			if id == node.ID {
+				continue
+			}
+			for _, root := range roots {
+				if st, ok := loadPromptTemplateStage(filepath.Join(root, id)); ok {
+					data.Stages[id] = st
+					break
+				}
+			}
+		}
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func loadPromptTemplateStage(stageDir string) (*promptTemplateStage, bool) {
+	b, err := os.ReadFile(filepath.Join(stageDir, "status.json"))
+	if err != nil {
+		return nil, false
+	}
+	out, err := runtime.DecodeOutcomeJSON(b)
+	if err != nil {
+		return nil, false
+	}
+	st := &promptTemplateStage{Outcome: out}
+	if b, err := os.ReadFile(filepath.Join(stageDir, "response.md")); err == nil {
+		st.Response = string(b)
+	}
+	return st, true
+}
+
+// checkPromptTemplates reports prompt templates that do not parse.
+func checkPromptTemplates(g *model.Graph) []validate.Diagnostic {
+	var diags []validate.Diagnostic
+	for _, id := range g.AllNodeIDs() {
+		n := g.Nodes[id]
+		if n == nil || !isPromptTemplate(n) {
+			continue
+		}
+		if _, err := parsePromptTemplate(id, n.Prompt(), ""); err != nil {
+			d := validate.Diagnostic{
+				Rule:     "prompt_template",
+				Attr:     n.PromptAttr(),
+				Severity: validate.SeverityError,
+				Message:  fmt.Sprintf("prompt template: %v", err),
+				NodeID:   id,
+				Fix:      "fix the text/template syntax or drop prompt_template",
+			}
+			d.Range = validate.Locate(g, d)
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestRenderPromptTemplate(t *testing.T) {
+	logsRoot := t.TempDir()
+	worktree := t.TempDir()
+	_ = os.WriteFile(filepath.Join(worktree, "plan.md"), []byte("1. do the thing\n"), 0o644)
+	_ = os.MkdirAll(filepath.Join(logsRoot, "plan"), 0o755)
+	_ = os.WriteFile(filepath.Join(logsRoot, "plan", "status.json"), []byte(`{"status":"success","notes":"planned"}`), 0o644)
+	_ = os.WriteFile(filepath.Join(logsRoot, "plan", "response.md"), []byte("the plan is ready"), 0o644)
+
+	g := model.NewGraph("test")
+	g.Attrs["goal"] = "ship it"
+	for _, id := range []string{"plan", "review", "implement"} {
+		_ = g.AddNode(model.NewNode(id))
+	}
+	c := runtime.NewContext()
+	c.Set("plan.task", "t-1")
+	exec := &Execution{Graph: g, Context: c, LogsRoot: logsRoot, WorktreeDir: worktree}
+
+	tmpl := `Goal: {{ .Goal }}
+Task: {{ index .Context "plan.task" }}
+Plan ({{ .Stages.plan.Status }}, {{ .Stages.plan.Notes }}): {{ .Stages.plan.Response }}
+{{ file "plan.md" | truncate 4 }}
+{{ if exists "plan.md" }}has plan{{ end }}{{ if exists "nope.md" }}has nope{{ end }}
+{{ with index .Stages "review" }}reviewed{{ else }}no review{{ end }}`
+	got, err := renderPromptTemplate(exec, g.Nodes["implement"], tmpl)
+	if err != nil {
+		t.Fatalf("renderPromptTemplate: %v", err)
+	}
+	want := `Goal: ship it
+Task: t-1
+Plan (success, planned): the plan is ready
+1. d
+... (12 bytes truncated)
+has plan
+no review`
+	if got != want {
+		t.Fatalf("rendered:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, bad := range []string{
+		`{{ file "../outside.md" }}`,
+		`{{ file "/etc/passwd" }}`,
+		`{{ .Stages.review.Response }}`,
+		`{{ file "missing.md" }}`,
+	} {
+		if _, err := renderPromptTemplate(exec, g.Nodes["implement"], bad); err == nil {
+			t.Fatalf("expected an error rendering %q", bad)
+		}
+	}
+}
+
+func TestTruncatePromptText_KeepsRunesWhole(t *testing.T) {
+	if got := truncatePromptText("héllo", 2); got != "h\n... (5 bytes truncated)" {
+		t.Fatalf("got %q", got)
+	}
+	if got := truncatePromptText("short", 10); got != "short" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestPrepare_PromptTemplateSyntaxError(t *testing.T) {
+	dot := []byte(`digraph P {
+  start [shape=Mdiamond]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt_template=true, prompt="{{ .Goal "]
+  exit [shape=Msquare]
+  start -> a -> exit
+}`)
+	_, diags, err := Prepare(dot)
+	if err == nil {
+		t.Fatalf("expected a validation error")
+	}
+	found := false
+	for _, d := range diags {
+		if d.Rule == "prompt_template" && d.NodeID == "a" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("no prompt_template diagnostic: %+v", diags)
+	}
+}
+
+func TestRun_PromptTemplate_RendersIntoPromptMD(t *testing.T) {
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	_ = os.MkdirAll(filepath.Join(repo, "prompts"), 0o755)
+	_ = os.WriteFile(filepath.Join(repo, "prompts", "implement.tmpl"), []byte(`Implement for {{ index .Context "plan.task" }}:
+{{ file "plan.md" }}
+Planner said: {{ .Stages.plan.Notes }}`), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+
+	dot := []byte(`
+digraph P {
+  graph [goal="test"]
+  start [shape=Mdiamond]
+  plan [shape=parallelogram, tool_command="echo 'step one' > plan.md && printf '%s' '{\"status\":\"success\",\"notes\":\"wrote plan.md\",\"context_updates\":{\"plan.task\":\"t-7\"}}' > \"$KILROY_STAGE_LOGS_DIR/status.json\""]
+  implement [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt_file="prompts/implement.tmpl"]
+  exit [shape=Msquare]
+  start -> plan -> implement -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: got %q want success", res.FinalStatus)
+	}
+	prompt, err := os.ReadFile(filepath.Join(res.LogsRoot, "implement", "prompt.md"))
+	if err != nil {
+		t.Fatalf("read prompt.md: %v", err)
+	}
+	if want := "Implement for t-7:\nstep one\n\nPlanner said: wrote plan.md"; !strings.Contains(string(prompt), want) {
+		t.Fatalf("prompt.md missing rendered template %q:\n%s", want, prompt)
+	}
+}
+
+func TestRun_PromptTemplate_BranchSeesStagesBeforeFanOut(t *testing.T) {
+	repo := initTestRepo(t)
+	dot := []byte(`
+digraph P {
+  graph [goal="test"]
+  start [shape=Mdiamond]
+  plan [shape=parallelogram, tool_command="printf '%s' '{\"status\":\"success\",\"notes\":\"planned\"}' > \"$KILROY_STAGE_LOGS_DIR/status.json\""]
+  fan  [shape=component]
+  a    [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt_template=true, prompt="a after {{ .Stages.plan.Notes }}"]
+  b    [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="do b"]
+  join [shape=tripleoctagon]
+  exit [shape=Msquare]
+  start -> plan -> fan
+  fan -> a -> join
+  fan -> b -> join
+  join -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: got %q want success", res.FinalStatus)
+	}
+	matches, _ := filepath.Glob(filepath.Join(res.LogsRoot, "parallel", "fan", "*", "a", "prompt.md"))
+	if len(matches) != 1 {
+		t.Fatalf("branch prompt.md for a: %v", matches)
+	}
+	prompt, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatalf("read prompt.md: %v", err)
+	}
+	if !strings.Contains(string(prompt), "a after planned") {
+		t.Fatalf("branch prompt.md missing the pre-fan-out stage:\n%s", prompt)
+	}
+}
@@ -30,6 +30,12 @@ type providerCLIContractError struct {
 }
 
 func classifyProviderCLIError(provider string, stderr string, runErr error) providerCLIClassifiedError {
+	return classifyProviderCLIErrorWithSpec(provider, defaultCLISpecForProvider(provider), stderr, runErr)
+}
+
+// classifyProviderCLIErrorWithSpec classifies against an explicit CLI
+// contract, such as a user-defined llm.providers.<name>.cli block.
+func classifyProviderCLIErrorWithSpec(provider string, spec *providerspec.CLISpec, stderr string, runErr error) providerCLIClassifiedError {
 	providerKey := normalizeProviderKey(provider)
 	if providerKey == "" {
 		providerKey = "unknown"
@@ -50,7 +56,7 @@ func classifyProviderCLIError(provider string, stderr string, runErr error) prov
 		reason = "provider cli invocation failed"
 	}
 
-	contract := classifyProviderCLIErrorWithContract(providerKey, defaultCLISpecForProvider(providerKey), stderrText, runErr)
+	contract := classifyProviderCLIErrorWithContract(providerKey, spec, stderrText, runErr)
 	switch contract.Kind {
 	case providerCLIErrorKindExecutableMissing:
 		return providerCLIClassifiedError{
@@ -226,6 +232,10 @@ func classifyAPIError(err error) (failureClass string, failureSignature string)
 		return failureClassCanceled, fmt.Sprintf("api_canceled|%s|abort", provider)
 	}
 
+	if isCostBudgetError(err) {
+		return failureClassDeterministic, "cost_budget|api|exceeded"
+	}
+
 	// Typed LLM errors carry structured retryability and provider info.
 	var llmErr llm.Error
 	if errors.As(err, &llmErr) {
@@ -246,7 +256,20 @@ func classifyAPIError(err error) (failureClass string, failureSignature string)
 			}
 			return failureClassTransientInfra, fmt.Sprintf("api_transient|%s|%s", provider, detail)
 		}
-		// Non-retryable typed error.
+		// Non-retryable typed error. Provider-specific failures tunneled through
+		// ambiguous statuses (Azure content_filter on 400, insufficient_quota on
+		// 429) are refined by their typed class first.
+		var contentFilterErr *llm.ContentFilterError
+		var quotaErr *llm.QuotaExceededError
+		var contextErr *llm.ContextLengthError
+		switch {
+		case errors.As(err, &contentFilterErr):
+			return failureClassDeterministic, fmt.Sprintf("api_deterministic|%s|content_filter", provider)
+		case errors.As(err, &quotaErr):
+			return failureClassDeterministic, fmt.Sprintf("api_deterministic|%s|quota_exceeded", provider)
+		case errors.As(err, &contextErr):
+			return failureClassDeterministic, fmt.Sprintf("api_deterministic|%s|context_length", provider)
+		}
 		switch llmErr.StatusCode() {
 		case 400, 422:
 			detail = "invalid_request"
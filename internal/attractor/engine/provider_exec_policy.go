@@ -5,6 +5,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/danshapiro/kilroy/internal/providerspec"
 )
@@ -29,7 +30,7 @@ func ResolveProviderExecutable(cfg *RunConfigFile, provider string, opts RunOpti
 }
 
 func resolveProviderExecutable(cfg *RunConfigFile, provider string, opts RunOptions) (providerExecutableResolution, error) {
-	defaultExe, _, ok := providerDefaultExecutable(provider)
+	defaultExe, _, ok := providerDefaultExecutable(cfg, provider)
 	if !ok {
 		return providerExecutableResolution{}, fmt.Errorf("no cli invocation mapping for provider %s", provider)
 	}
@@ -120,14 +121,81 @@ func configuredProviderPathOverrides() []string {
 	return set
 }
 
-func providerDefaultExecutable(provider string) (exe string, envKey string, ok bool) {
-	spec := defaultCLISpecForProvider(provider)
+func providerDefaultExecutable(cfg *RunConfigFile, provider string) (exe string, envKey string, ok bool) {
+	spec := cliSpecForProvider(cfg, provider)
 	if spec == nil {
 		return "", "", false
 	}
 	return strings.TrimSpace(spec.DefaultExecutable), providerPathOverrideEnvKey(provider), true
 }
 
+// cliSpecForProvider returns the CLI contract for provider: the run config's
+// llm.providers.<name>.cli block when present, else the builtin contract.
+func cliSpecForProvider(cfg *RunConfigFile, provider string) *providerspec.CLISpec {
+	if c := providerCLIConfigFor(cfg, provider); c != nil {
+		return c.spec()
+	}
+	return defaultCLISpecForProvider(provider)
+}
+
+func providerCLIConfigFor(cfg *RunConfigFile, provider string) *ProviderCLIConfig {
+	pc, _, ok := providerConfigFor(cfg, provider)
+	if !ok {
+		return nil
+	}
+	return pc.CLI
+}
+
+// spec converts a user-defined contract to the providerspec form shared with
+// the builtin providers.
+func (c *ProviderCLIConfig) spec() *providerspec.CLISpec {
+	mode := strings.ToLower(strings.TrimSpace(c.PromptMode))
+	if mode == "" {
+		mode = "stdin"
+	}
+	return cloneCLISpec(&providerspec.CLISpec{
+		DefaultExecutable:  strings.TrimSpace(c.Executable),
+		InvocationTemplate: c.Args,
+		PromptMode:         mode,
+		HelpProbeArgs:      c.HelpProbeArgs,
+		CapabilityAll:      c.CapabilityAll,
+		CapabilityAnyOf:    c.CapabilityAnyOf,
+	})
+}
+
+// cliStreamParserFor names the stream parser for provider's CLI output.
+// Builtin contracts use their own format's parser; user-defined contracts
+// default to none.
+func cliStreamParserFor(cfg *RunConfigFile, provider string, codexSemantics bool) string {
+	if c := providerCLIConfigFor(cfg, provider); c != nil {
+		if p := strings.ToLower(strings.TrimSpace(c.StreamParser)); p != "" {
+			return p
+		}
+		return "none"
+	}
+	switch {
+	case codexSemantics:
+		return "codex"
+	case normalizeProviderKey(provider) == "google":
+		return "gemini"
+	default:
+		return "claude"
+	}
+}
+
+// cliIdleTimeoutFor returns the output-idle watchdog timeout for provider.
+// Codex keeps its env-tunable default; user-defined contracts use
+// cli.idle_timeout_ms, falling back to the same default.
+func cliIdleTimeoutFor(cfg *RunConfigFile, provider string, codexSemantics bool) time.Duration {
+	if c := providerCLIConfigFor(cfg, provider); c != nil && c.IdleTimeoutMS != nil {
+		return time.Duration(*c.IdleTimeoutMS) * time.Millisecond
+	}
+	if codexSemantics || providerCLIConfigFor(cfg, provider) != nil {
+		return codexIdleTimeout()
+	}
+	return 0
+}
+
 func defaultCLISpecForProvider(provider string) *providerspec.CLISpec {
 	key := normalizeProviderKey(provider)
 	if key == "" {
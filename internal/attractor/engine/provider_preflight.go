@@ -167,6 +167,20 @@ func runProviderAPIPreflight(ctx context.Context, g *model.Graph, runtimes map[s
 		})
 		return nil
 	}
+	if strings.TrimSpace(opts.ReplayFrom) != "" {
+		for _, provider := range providers {
+			report.addCheck(providerPreflightCheck{
+				Name:     "provider_api_credentials",
+				Provider: provider,
+				Status:   preflightStatusPass,
+				Message:  "replaying recorded llm traffic; credentials and prompt probes skipped",
+				Details: map[string]any{
+					"replay_from": opts.ReplayFrom,
+				},
+			})
+		}
+		return nil
+	}
 
 	for _, provider := range providers {
 		rt, ok := runtimes[provider]
@@ -189,6 +203,18 @@ func runProviderAPIPreflight(ctx context.Context, g *model.Graph, runtimes map[s
 			})
 			return fmt.Errorf("preflight: provider %s api key env is not configured", provider)
 		}
+		if strings.TrimSpace(os.Getenv(keyEnv)) == "" && rt.API.APIKeyOptional {
+			report.addCheck(providerPreflightCheck{
+				Name:     "provider_api_credentials",
+				Provider: provider,
+				Status:   preflightStatusPass,
+				Message:  "api key not required",
+				Details: map[string]any{
+					"api_key_env": keyEnv,
+				},
+			})
+			continue
+		}
 		if strings.TrimSpace(os.Getenv(keyEnv)) == "" {
 			report.addCheck(providerPreflightCheck{
 				Name:     "provider_api_credentials",
@@ -744,7 +770,8 @@ func runProviderCLIPreflightChecks(ctx context.Context, g *model.Graph, runtimes
 				Message:  "capability probe disabled by KILROY_PREFLIGHT_CAPABILITY_PROBES=off",
 			})
 		} else {
-			output, probeErr := runProviderCapabilityProbe(ctx, provider, resolvedPath)
+			spec := cliSpecForProvider(cfg, provider)
+			output, probeErr := runProviderCapabilityProbeWithSpec(ctx, spec, resolvedPath)
 			if probeErr != nil {
 				status := preflightStatusWarn
 				if report.StrictCapabilities {
@@ -759,7 +786,7 @@ func runProviderCLIPreflightChecks(ctx context.Context, g *model.Graph, runtimes
 				if report.StrictCapabilities {
 					return fmt.Errorf("preflight: provider %s capability probe failed: %w", provider, probeErr)
 				}
-			} else if !probeOutputLooksLikeHelp(provider, output) {
+			} else if !probeOutputLooksLikeHelpFromSpec(spec, output) {
 				status := preflightStatusWarn
 				if report.StrictCapabilities {
 					status = preflightStatusFail
@@ -774,7 +801,7 @@ func runProviderCLIPreflightChecks(ctx context.Context, g *model.Graph, runtimes
 					return fmt.Errorf("preflight: provider %s capability probe output not parseable as help", provider)
 				}
 			} else {
-				missing := missingCapabilityTokens(provider, output)
+				missing := missingCapabilityTokensFromSpec(spec, output)
 				if len(missing) > 0 {
 					report.addCheck(providerPreflightCheck{
 						Name:     "provider_cli_capabilities",
@@ -1180,7 +1207,7 @@ func usedAPIProviders(g *model.Graph, runtimes map[string]ProviderRuntime) []str
 			}
 			// Only include failover targets that have credentials available.
 			// If DefaultAPIKeyEnv is empty (e.g. test runtimes without APISpec), include unconditionally.
-			if keyEnv := strings.TrimSpace(nextRT.API.DefaultAPIKeyEnv); keyEnv != "" && strings.TrimSpace(os.Getenv(keyEnv)) == "" {
+			if keyEnv := strings.TrimSpace(nextRT.API.DefaultAPIKeyEnv); keyEnv != "" && !nextRT.API.APIKeyOptional && strings.TrimSpace(os.Getenv(keyEnv)) == "" {
 				continue
 			}
 			seen[next] = true
@@ -1286,7 +1313,7 @@ func usedAPIPromptProbeTargetsForProvider(g *model.Graph, runtimes map[string]Pr
 
 		mode := strings.ToLower(strings.TrimSpace(n.Attr("codergen_mode", "")))
 		if mode == "" {
-			mode = "agent_loop"
+			mode = defaultCodergenMode(catalog, runtimes[provider], modelID)
 		}
 		if mode != "one_shot" && mode != "agent_loop" {
 			return nil, fmt.Errorf("invalid codergen_mode: %q (want one_shot|agent_loop)", mode)
@@ -1463,8 +1490,12 @@ func runProviderModelAccessProbe(ctx context.Context, provider string, exePath s
 }
 
 func runProviderCapabilityProbe(ctx context.Context, provider string, exePath string) (string, error) {
+	return runProviderCapabilityProbeWithSpec(ctx, defaultCLISpecForProvider(provider), exePath)
+}
+
+func runProviderCapabilityProbeWithSpec(ctx context.Context, spec *providerspec.CLISpec, exePath string) (string, error) {
 	argv := []string{"--help"}
-	if spec := defaultCLISpecForProvider(provider); spec != nil && len(spec.HelpProbeArgs) > 0 {
+	if spec != nil && len(spec.HelpProbeArgs) > 0 {
 		argv = append([]string{}, spec.HelpProbeArgs...)
 	}
 	help, err := runProviderProbe(ctx, exePath, argv, 3*time.Second)
@@ -1543,10 +1574,6 @@ func runProviderProbeWithOptions(ctx context.Context, exePath string, argv []str
 	}
 }
 
-func missingCapabilityTokens(provider string, helpOutput string) []string {
-	return missingCapabilityTokensFromSpec(defaultCLISpecForProvider(provider), helpOutput)
-}
-
 func missingCapabilityTokensFromSpec(spec *providerspec.CLISpec, helpOutput string) []string {
 	if spec == nil {
 		return nil
@@ -1575,10 +1602,6 @@ func missingCapabilityTokensFromSpec(spec *providerspec.CLISpec, helpOutput stri
 	return missing
 }
 
-func probeOutputLooksLikeHelp(provider string, output string) bool {
-	return probeOutputLooksLikeHelpFromSpec(defaultCLISpecForProvider(provider), output)
-}
-
 func probeOutputLooksLikeHelpFromSpec(spec *providerspec.CLISpec, output string) bool {
 	text := strings.ToLower(strings.TrimSpace(output))
 	if text == "" {
@@ -15,6 +15,7 @@ type ProviderRuntime struct {
 	API              providerspec.APISpec
 	CLI              *providerspec.CLISpec
 	APIHeadersMap    map[string]string
+	APIDeployments   map[string]string
 	Failover         []string
 	FailoverExplicit bool
 	ProfileFamily    string
@@ -53,6 +54,9 @@ func resolveProviderRuntimes(cfg *RunConfigFile) (map[string]ProviderRuntime, er
 			Executable: strings.TrimSpace(pc.Executable),
 			CLI:        cloneCLISpec(builtin.CLI),
 		}
+		if pc.CLI != nil {
+			rt.CLI = pc.CLI.spec()
+		}
 		if builtin.API != nil {
 			rt.API = *builtin.API
 		}
@@ -74,7 +78,11 @@ func resolveProviderRuntimes(cfg *RunConfigFile) (map[string]ProviderRuntime, er
 		if v := strings.TrimSpace(pc.API.ProfileFamily); v != "" {
 			rt.API.ProfileFamily = v
 		}
+		if v := strings.TrimSpace(pc.API.APIVersion); v != "" {
+			rt.API.APIVersion = v
+		}
 		rt.APIHeadersMap = cloneStringMap(pc.API.Headers)
+		rt.APIDeployments = cloneStringMap(pc.API.Deployments)
 		rt.ProfileFamily = rt.API.ProfileFamily
 		// Preserve explicit empty failover overrides:
 		// - failover: [] => no failover targets for this provider
@@ -541,10 +541,6 @@ func (h *deterministicCycleFixtureHandler) Execute(ctx context.Context, exec *Ex
 	}, nil
 }
 
-func shellQuote(s string) string {
-	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
-}
-
 func fileExists(path string) bool {
 	if strings.TrimSpace(path) == "" {
 		return false
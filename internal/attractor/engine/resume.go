@@ -25,6 +25,7 @@ type manifest struct {
 	RunBranch     string            `json:"run_branch"`
 	RunConfigPath string            `json:"run_config_path"`
 	ForceModels   map[string]string `json:"force_models"`
+	Params        map[string]string `json:"params"`
 
 	ModelDB struct {
 		OpenRouterModelInfoPath   string `json:"openrouter_model_info_path"`
@@ -112,7 +113,7 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	if err != nil {
 		return nil, err
 	}
-	g, _, err := Prepare(dotSource)
+	g, _, err := PrepareWithOptions(dotSource, PrepareOptions{Params: m.Params, RequireParams: true})
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +141,8 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	var startup *CXDBStartupInfo
 	var inputInferer InputReferenceInferer
 	var inputInfererInitWarning string
+	var stageSummarizer StageSummarizer
+	var stageSummarizerInitWarning string
 	if cfg != nil {
 		// Resume MUST use the run's snapshotted catalog.
 		snapshotPath := firstExistingPath(
@@ -154,7 +157,7 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 			return nil, err
 		}
 		catalog = cat
-		backend, err = newResumeCodergenBackend(cfg, catalog)
+		backend, err = newResumeCodergenBackend(cfg, catalog, logsRoot)
 		if err != nil {
 			return nil, err
 		}
@@ -170,6 +173,18 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 				inputInferer = inferer
 			}
 		}
+		if cfg.Fidelity.Summary.Enabled != nil && *cfg.Fidelity.Summary.Enabled {
+			runtimes, rtErr := resolveProviderRuntimes(cfg)
+			if rtErr != nil {
+				return nil, rtErr
+			}
+			summarizer, sumErr := newStageSummarizerFromConfig(cfg, runtimes)
+			if sumErr != nil {
+				stageSummarizerInitWarning = fmt.Sprintf("fidelity summarizer init failed on resume (context-only preamble fallback): %v", sumErr)
+			} else {
+				stageSummarizer = summarizer
+			}
+		}
 
 		// Re-attach to the existing CXDB context head (metaspec required).
 		baseURL := strings.TrimSpace(ov.CXDBHTTPBaseURL)
@@ -220,6 +235,10 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		RunBranchPrefix: prefix,
 		RequireClean:    resolveRequireClean(cfg),
 		ForceModels:     normalizeForceModels(copyStringStringMap(m.ForceModels)),
+		Params:          copyStringStringMap(m.Params),
+	}
+	if cfg != nil && cfg.RuntimePolicy.MaxCostUSD != nil {
+		opts.MaxCostUSD = *cfg.RuntimePolicy.MaxCostUSD
 	}
 	if err := opts.applyDefaults(); err != nil {
 		return nil, err
@@ -237,6 +256,7 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	eng.RunConfig = cfg
 	eng.ArtifactPolicy = resolvedArtifactPolicy
 	eng.CodergenBackend = backend
+	defer closeMCPServers(backend)
 	eng.CXDB = sink
 	eng.ModelCatalogSHA = func() string {
 		if catalog == nil {
@@ -253,6 +273,7 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	}()
 	eng.InputMaterializationPolicy = inputMaterializationPolicyFromConfig(cfg)
 	eng.InputReferenceInferer = inputInferer
+	eng.StageSummarizer = stageSummarizer
 	eng.InputInferenceCache = loadInputInferenceCache(inputInferenceCachePath(logsRoot))
 	if m, mErr := loadInputManifest(inputRunManifestPath(logsRoot)); mErr == nil && m != nil {
 		eng.InputSourceTargetMap = sourceTargetMapFromManifest(m)
@@ -265,8 +286,12 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	if strings.TrimSpace(inputInfererInitWarning) != "" {
 		eng.Warn(inputInfererInitWarning)
 	}
+	if strings.TrimSpace(stageSummarizerInitWarning) != "" {
+		eng.Warn(stageSummarizerInitWarning)
+	}
 	eng.Context.ReplaceSnapshot(cp.ContextValues, cp.Logs)
 	eng.baseLogsRoot, eng.restartCount = restoreRestartState(logsRoot, cp)
+	eng.costs = loadCostLedger(eng.baseLogsRoot)
 	eng.restartFailureSignatures = restoreRestartFailureSignatures(cp)
 	eng.loopFailureSignatures = restoreLoopFailureSignatures(cp)
 	eng.baseSHA = cp.GitCommitSHA
@@ -274,9 +299,13 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	if cp != nil && cp.Extra != nil {
 		// Metaspec/attractor-spec: if the previous hop used `full` fidelity, degrade to
 		// summary:high for the first resumed node unless exact session restore is supported.
-		// Kilroy v1 does not serialize in-memory sessions, so always degrade.
+		// API agent-loop threads are persisted under logs_root/threads; when the last
+		// thread was persisted it can be restored exactly, so no degrade is needed.
 		if strings.EqualFold(strings.TrimSpace(fmt.Sprint(cp.Extra["last_fidelity"])), "full") {
-			eng.forceNextFidelity = "summary:high"
+			lastThread, _ := cp.Extra["last_thread_key"].(string)
+			if !threadHistoryExists(logsRoot, lastThread) {
+				eng.forceNextFidelity = "summary:high"
+			}
 		}
 	}
 
@@ -352,7 +381,7 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		if t == "" {
 			t = shapeToType(lastNode.Shape())
 		}
-		if t == "parallel" {
+		if t == "parallel" || t == "parallel.foreach" {
 			join := strings.TrimSpace(eng.Context.GetString("parallel.join_node", ""))
 			if join == "" {
 				return nil, fmt.Errorf("resume: parallel node missing parallel.join_node in checkpoint context")
@@ -377,7 +406,7 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 				Engine:      eng,
 				Artifacts:   eng.Artifacts,
 			}
-			results, baseSHA, dispatchErr := dispatchParallelBranches(ctx, exec, lastNodeID, allEdges, joinID)
+			results, baseSHA, dispatchErr := dispatchParallelBranches(ctx, exec, lastNodeID, edgeBranches(allEdges), joinID)
 			if dispatchErr != nil {
 				return nil, dispatchErr
 			}
@@ -477,13 +506,16 @@ func firstExistingPath(paths ...string) string {
 	return ""
 }
 
-func newResumeCodergenBackend(cfg *RunConfigFile, catalog *modeldb.Catalog) (CodergenBackend, error) {
+func newResumeCodergenBackend(cfg *RunConfigFile, catalog *modeldb.Catalog, logsRoot string) (CodergenBackend, error) {
 	// Resume consumes snapshotted graph+config from a previously validated run,
 	// so we only need runtime materialization here (not full preflight validation).
 	runtimes, err := resolveProviderRuntimes(cfg)
 	if err != nil {
 		return nil, err
 	}
+	if err := mergeDiscoveredModelSnapshots(catalog, logsRoot, runtimes); err != nil {
+		return nil, err
+	}
 	return NewCodergenRouterWithRuntimes(cfg, catalog, runtimes), nil
 }
 
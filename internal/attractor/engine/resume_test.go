@@ -249,7 +249,7 @@ func TestNewResumeCodergenBackend_LoadsProviderRuntimes(t *testing.T) {
 		},
 	}
 
-	backend, err := newResumeCodergenBackend(cfg, nil)
+	backend, err := newResumeCodergenBackend(cfg, nil, "")
 	if err != nil {
 		t.Fatalf("newResumeCodergenBackend: %v", err)
 	}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// runEffects is what a run does beyond routing: git checkpoints and branch
+// worktrees, retry backoff and branch concurrency, plus hooks that observe
+// the walk. Real runs use gitEffects; Simulate installs its *simulation, which
+// skips the git work and records the walk instead.
+type runEffects interface {
+	// commit checkpoints the worktree and returns the new commit.
+	commit(worktreeDir, msg string, excludes []string) (string, error)
+	// branchWorktree prepares the worktree a parallel branch runs in,
+	// starting at baseSHA, and returns its path.
+	branchWorktree(exec *Execution, branchName, baseSHA, worktreeDir string) (string, error)
+	retryDelay(d time.Duration) time.Duration
+	maxParallel(n int) int
+
+	traversed(edge *model.Edge)
+	visited(e *Engine, node *model.Node, out runtime.Outcome)
+}
+
+// effects returns the engine's runEffects; engines built without
+// newBaseEngine get gitEffects.
+func (e *Engine) effects() runEffects {
+	if e.sideEffects == nil {
+		return gitEffects{}
+	}
+	return e.sideEffects
+}
+
+type gitEffects struct{}
+
+func (gitEffects) commit(worktreeDir, msg string, excludes []string) (string, error) {
+	return gitutil.CommitAllowEmptyWithExcludes(worktreeDir, msg, excludes)
+}
+
+func (gitEffects) branchWorktree(exec *Execution, branchName, baseSHA, worktreeDir string) (string, error) {
+	repo := exec.Engine.Options.RepoPath
+	_ = gitutil.RemoveWorktree(repo, worktreeDir)
+	if err := gitutil.CreateBranchAt(repo, branchName, baseSHA); err != nil {
+		return "", err
+	}
+	if err := gitutil.AddWorktree(repo, worktreeDir, branchName); err != nil {
+		return "", err
+	}
+	_ = gitutil.ResetHard(worktreeDir, baseSHA)
+	return worktreeDir, nil
+}
+
+func (gitEffects) retryDelay(d time.Duration) time.Duration { return d }
+func (gitEffects) maxParallel(n int) int                    { return n }
+
+func (gitEffects) traversed(*model.Edge)                         {}
+func (gitEffects) visited(*Engine, *model.Node, runtime.Outcome) {}
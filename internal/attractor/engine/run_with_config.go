@@ -45,9 +45,11 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 
 	// Prepare graph (parse + transforms + validate).
 	g, _, err := PrepareWithOptions(dotSource, PrepareOptions{
-		RepoPath:   cfg.Repo.Path,
-		KnownTypes: reg.KnownTypes(),
-		Catalog:    earlyCatalog,
+		RepoPath:      cfg.Repo.Path,
+		KnownTypes:    reg.KnownTypes(),
+		Catalog:       earlyCatalog,
+		Params:        overrides.Params,
+		RequireParams: true,
 	})
 	if err != nil {
 		return nil, err
@@ -86,6 +88,11 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 			inputInferer = inferer
 		}
 	}
+	var stageSummarizerInitWarning string
+	stageSummarizer, summarizerErr := newStageSummarizerFromConfig(cfg, runtimes)
+	if summarizerErr != nil {
+		stageSummarizerInitWarning = fmt.Sprintf("fidelity summarizer init failed (context-only preamble fallback): %v", summarizerErr)
+	}
 	for p := range usedProviders {
 		rt, ok := runtimes[p]
 		if !ok || (rt.Backend != BackendAPI && rt.Backend != BackendCLI) {
@@ -110,6 +117,9 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 		),
 		MaxLLMRetries: copyOptionalInt(cfg.RuntimePolicy.MaxLLMRetries),
 	}
+	if cfg.RuntimePolicy.MaxCostUSD != nil {
+		opts.MaxCostUSD = *cfg.RuntimePolicy.MaxCostUSD
+	}
 	// Allow select overrides.
 	if overrides.RunID != "" {
 		opts.RunID = overrides.RunID
@@ -125,9 +135,12 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	}
 	opts.AllowTestShim = overrides.AllowTestShim
 	opts.ForceModels = normalizeForceModels(overrides.ForceModels)
+	opts.Params = copyStringStringMap(overrides.Params)
 	opts.ProgressSink = overrides.ProgressSink
 	opts.Interviewer = overrides.Interviewer
 	opts.OnEngineReady = overrides.OnEngineReady
+	opts.RecordLLM = overrides.RecordLLM
+	opts.ReplayFrom = overrides.ReplayFrom
 
 	if err := opts.applyDefaults(); err != nil {
 		return nil, err
@@ -174,6 +187,10 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	if err := os.MkdirAll(opts.LogsRoot, 0o755); err != nil {
 		return nil, fmt.Errorf("cannot create logs directory %s: %w", opts.LogsRoot, err)
 	}
+	cassette, err := newRunCassette(opts)
+	if err != nil {
+		return nil, err
+	}
 
 	if err := validateRunCLIProfilePolicy(cfg, opts, runUsesCLIProviders); err != nil {
 		report := &providerPreflightReport{
@@ -209,7 +226,12 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	if err != nil {
 		return nil, err
 	}
-	catalogChecks, catalogErr := validateProviderModelPairs(g, runtimes, catalog, opts)
+	catalogChecks, catalogErr := discoverProviderModels(ctx, g, runtimes, catalog, opts)
+	if catalogErr == nil {
+		var pairChecks []providerPreflightCheck
+		pairChecks, catalogErr = validateProviderModelPairs(g, runtimes, catalog, opts)
+		catalogChecks = append(catalogChecks, pairChecks...)
+	}
 	if catalogErr != nil {
 		report := &providerPreflightReport{
 			GeneratedAt:         time.Now().UTC().Format(time.RFC3339Nano),
@@ -265,7 +287,10 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	eng.RunConfig = cfg
 	eng.ArtifactPolicy = resolvedArtifactPolicy
 	eng.Context = NewContextWithGraphAttrs(g)
-	eng.CodergenBackend = NewCodergenRouterWithRuntimes(cfg, catalog, runtimes)
+	router := NewCodergenRouterWithRuntimes(cfg, catalog, runtimes)
+	router.cassette = cassette
+	eng.CodergenBackend = router
+	defer closeMCPServers(eng.CodergenBackend)
 	eng.CXDB = sink
 	eng.ModelCatalogSHA = catalog.SHA256
 	eng.ModelCatalogSource = resolved.Source
@@ -274,6 +299,7 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	eng.InputReferenceInferer = inputInferer
 	eng.InputInferenceCache = map[string][]InferredReference{}
 	eng.InputSourceTargetMap = map[string]string{}
+	eng.StageSummarizer = stageSummarizer
 	if strings.TrimSpace(resolved.Warning) != "" {
 		eng.Warn(resolved.Warning)
 		eng.Context.AppendLog(resolved.Warning)
@@ -282,6 +308,10 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 		eng.Warn(inputInfererInitWarning)
 		eng.Context.AppendLog(inputInfererInitWarning)
 	}
+	if strings.TrimSpace(stageSummarizerInitWarning) != "" {
+		eng.Warn(stageSummarizerInitWarning)
+		eng.Context.AppendLog(stageSummarizerInitWarning)
+	}
 	if startup != nil {
 		for _, w := range startup.Warnings {
 			eng.Warn(w)
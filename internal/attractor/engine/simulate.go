@@ -0,0 +1,405 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+const (
+	simulationRunID        = "simulate"
+	simulationBranchPrefix = "simulate"
+)
+
+// SimulationScript scripts stage outcomes for Simulate. Each execution of a
+// node (every retry attempt and every revisit) consumes the next entry of its
+// list; once the list is exhausted the last entry repeats. Nodes without
+// entries finish with Default (success when empty).
+//
+//	default: success
+//	nodes:
+//	  verify: [fail, success]
+//	  review:
+//	    - status: success
+//	      preferred_label: approve
+//	      context_updates: {review.score: 9}
+type SimulationScript struct {
+	Default string                       `yaml:"default,omitempty" json:"default,omitempty"`
+	Nodes   map[string]SimulatedOutcomes `yaml:"nodes,omitempty" json:"nodes,omitempty"`
+}
+
+// SimulatedOutcomes is a node's scripted outcome sequence. A single outcome
+// may be written without the surrounding list.
+type SimulatedOutcomes []SimulatedOutcome
+
+// SimulatedOutcome is one scripted stage result. A bare scalar is shorthand
+// for {status: <scalar>}.
+type SimulatedOutcome struct {
+	Status           string         `yaml:"status" json:"status"`
+	PreferredLabel   string         `yaml:"preferred_label,omitempty" json:"preferred_label,omitempty"`
+	SuggestedNextIDs []string       `yaml:"suggested_next_ids,omitempty" json:"suggested_next_ids,omitempty"`
+	FailureReason    string         `yaml:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	FailureClass     string         `yaml:"failure_class,omitempty" json:"failure_class,omitempty"`
+	ContextUpdates   map[string]any `yaml:"context_updates,omitempty" json:"context_updates,omitempty"`
+}
+
+func (o *SimulatedOutcome) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		o.Status = n.Value
+		return nil
+	}
+	type plain SimulatedOutcome
+	return n.Decode((*plain)(o))
+}
+
+func (s *SimulatedOutcomes) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.SequenceNode {
+		var one SimulatedOutcome
+		if err := n.Decode(&one); err != nil {
+			return err
+		}
+		*s = SimulatedOutcomes{one}
+		return nil
+	}
+	var many []SimulatedOutcome
+	if err := n.Decode(&many); err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
+
+// LoadSimulationScript reads a YAML (or JSON) outcome script.
+func LoadSimulationScript(path string) (*SimulationScript, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s SimulationScript
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parse simulation script %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+func (o SimulatedOutcome) outcome() (runtime.Outcome, error) {
+	st, err := runtime.ParseStageStatus(o.Status)
+	if err != nil {
+		return runtime.Outcome{}, err
+	}
+	out := runtime.Outcome{
+		Status:           st,
+		PreferredLabel:   o.PreferredLabel,
+		SuggestedNextIDs: append([]string{}, o.SuggestedNextIDs...),
+		FailureReason:    o.FailureReason,
+		ContextUpdates:   map[string]any{},
+		Notes:            "simulated outcome",
+	}
+	for k, v := range o.ContextUpdates {
+		out.ContextUpdates[k] = v
+	}
+	if cls := strings.TrimSpace(o.FailureClass); cls != "" {
+		out.Meta = map[string]any{"failure_class": cls}
+	}
+	if (st == runtime.StatusFail || st == runtime.StatusRetry) && strings.TrimSpace(out.FailureReason) == "" {
+		out.FailureReason = "simulated " + string(st)
+	}
+	return out, nil
+}
+
+// SimulationStep is one node execution in a simulation, in order.
+type SimulationStep struct {
+	NodeID        string `json:"node_id"`
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason,omitempty"`
+	// Branch names the parallel branch (<fan_out_node>/<branch_key>) that ran
+	// the node; empty on the main path.
+	Branch string `json:"branch,omitempty"`
+	// Restart is the loop_restart iteration the step ran in.
+	Restart int `json:"restart,omitempty"`
+}
+
+// SimulationEdge identifies a graph edge in a simulation report.
+type SimulationEdge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Label     string `json:"label,omitempty"`
+	Condition string `json:"condition,omitempty"`
+}
+
+func (e SimulationEdge) String() string {
+	s := e.From + " -> " + e.To
+	var attrs []string
+	if e.Label != "" {
+		attrs = append(attrs, fmt.Sprintf("label=%q", e.Label))
+	}
+	if e.Condition != "" {
+		attrs = append(attrs, fmt.Sprintf("condition=%q", e.Condition))
+	}
+	if len(attrs) > 0 {
+		s += " [" + strings.Join(attrs, ", ") + "]"
+	}
+	return s
+}
+
+// SimulationReport is the result of walking a graph against a script.
+type SimulationReport struct {
+	FinalStatus   runtime.FinalStatus `json:"final_status"`
+	FailureReason string              `json:"failure_reason,omitempty"`
+	Path          []SimulationStep    `json:"path"`
+	Visits        map[string]int      `json:"visits"`
+	Restarts      int                 `json:"restarts,omitempty"`
+	// Context is the run context when the simulation ended.
+	Context map[string]any `json:"context,omitempty"`
+	// UnvisitedNodes never executed in this simulation; validation already
+	// rejects nodes that no edge can reach.
+	UnvisitedNodes []string `json:"unvisited_nodes,omitempty"`
+	// UnusedEdges were never traversed in this simulation.
+	UnusedEdges []SimulationEdge `json:"unused_edges,omitempty"`
+}
+
+// simulation is the per-run state of Simulate. It is the runEffects of the
+// engines running a simulation: it records the walk and skips git
+// checkpoints, branch worktrees and retry backoff.
+type simulation struct {
+	script *SimulationScript
+
+	mu       sync.Mutex
+	consumed map[string]int
+	steps    []SimulationStep
+	edges    map[*model.Edge]bool
+}
+
+// commit makes no checkpoint; simulations have no worktree to commit.
+func (s *simulation) commit(string, string, []string) (string, error) { return "", nil }
+
+// branchWorktree shares the parent's (absent) worktree with the branch.
+func (s *simulation) branchWorktree(exec *Execution, _, _, _ string) (string, error) {
+	return exec.WorktreeDir, nil
+}
+
+func (s *simulation) retryDelay(time.Duration) time.Duration { return 0 }
+
+// maxParallel runs branches one at a time so the reported path is stable.
+func (s *simulation) maxParallel(int) int { return 1 }
+
+// traversed records that edge was followed.
+func (s *simulation) traversed(edge *model.Edge) {
+	if edge == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.edges[edge] = true
+}
+
+// visited records a node execution by e.
+func (s *simulation) visited(e *Engine, node *model.Node, out runtime.Outcome) {
+	if node == nil {
+		return
+	}
+	step := SimulationStep{
+		NodeID:        node.ID,
+		Status:        string(out.Status),
+		FailureReason: out.FailureReason,
+		Restart:       e.restartCount,
+	}
+	mainBranch := buildParallelBranch(simulationBranchPrefix, simulationRunID, "", "") + "/"
+	if strings.HasPrefix(e.RunBranch, mainBranch) {
+		step.Branch = strings.TrimPrefix(e.RunBranch, mainBranch)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, step)
+}
+
+// next returns the scripted outcome for the next execution of node.
+func (s *simulation) next(node *model.Node) (runtime.Outcome, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.script.Nodes[node.ID]
+	if len(entries) == 0 {
+		return runtime.Outcome{}, false, nil
+	}
+	i := s.consumed[node.ID]
+	s.consumed[node.ID]++
+	if i >= len(entries) {
+		i = len(entries) - 1
+	}
+	out, err := entries[i].outcome()
+	if err != nil {
+		return runtime.Outcome{}, true, fmt.Errorf("simulation script nodes.%s[%d]: %w", node.ID, i, err)
+	}
+	return out, true, nil
+}
+
+// scriptedHandler stands in for handlers that would reach providers, tools or
+// child pipelines. Nodes without script entries use fallback when set.
+type scriptedHandler struct {
+	sim      *simulation
+	fallback Handler
+}
+
+func (h *scriptedHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
+	out, ok, err := h.sim.next(node)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+	}
+	if ok {
+		return out, nil
+	}
+	if h.fallback != nil {
+		return h.fallback.Execute(ctx, exec, node)
+	}
+	return SimulatedOutcome{Status: h.sim.script.Default}.outcome()
+}
+
+// simulatedFanInHandler joins branches with the heuristic strategy; llm,
+// command and merge judges need providers or git.
+type simulatedFanInHandler struct{}
+
+func (h *simulatedFanInHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
+	attrs := make(map[string]string, len(node.Attrs)+1)
+	for k, v := range node.Attrs {
+		attrs[k] = v
+	}
+	attrs["fan_in_strategy"] = fanInStrategyHeuristic
+	heuristic := *node
+	heuristic.Attrs = attrs
+	return (&FanInHandler{}).Execute(ctx, exec, &heuristic)
+}
+
+func simulationRegistry(sim *simulation) *HandlerRegistry {
+	reg := NewDefaultRegistry()
+	scripted := &scriptedHandler{sim: sim}
+	reg.Register("codergen", scripted)
+	reg.Register("tool", scripted)
+	reg.Register("stack.manager_loop", scripted)
+	reg.Register("stack.call", scripted)
+	reg.Register("wait.human", &scriptedHandler{sim: sim, fallback: &WaitHumanHandler{}})
+	reg.Register("parallel.fan_in", &simulatedFanInHandler{})
+	reg.defaultHandler = scripted
+	return reg
+}
+
+// derivedOutcomeTypes are handlers whose outcome the engine derives from the
+// graph and earlier stages; scripting them would bypass the routing under test.
+var derivedOutcomeTypes = map[string]bool{
+	"start":            true,
+	"exit":             true,
+	"conditional":      true,
+	"parallel":         true,
+	"parallel.foreach": true,
+	"parallel.fan_in":  true,
+}
+
+func validateSimulationScript(g *model.Graph, script *SimulationScript) error {
+	if _, err := (SimulatedOutcome{Status: script.Default}).outcome(); err != nil {
+		return fmt.Errorf("simulation script default: %w", err)
+	}
+	ids := make([]string, 0, len(script.Nodes))
+	for id := range script.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := g.Nodes[id]
+		if n == nil {
+			return fmt.Errorf("simulation script: unknown node %q", id)
+		}
+		t := strings.TrimSpace(n.TypeOverride())
+		if t == "" {
+			t = shapeToType(n.Shape())
+		}
+		if derivedOutcomeTypes[t] {
+			return fmt.Errorf("simulation script: node %q is a %s node; its outcome is derived by the engine", id, t)
+		}
+		for i, o := range script.Nodes[id] {
+			if _, err := o.outcome(); err != nil {
+				return fmt.Errorf("simulation script nodes.%s[%d]: %w", id, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Simulate walks the graph with the engine's real routing (edge selection,
+// retries, goal gates, loop restarts, parallel fan-out and joins) against
+// scripted stage outcomes. It needs no providers, git repository or CXDB;
+// stage logs go to a temporary directory that is removed afterwards.
+func Simulate(ctx context.Context, dotSource []byte, script *SimulationScript) (*SimulationReport, error) {
+	if script == nil {
+		script = &SimulationScript{}
+	}
+	if strings.TrimSpace(script.Default) == "" {
+		script.Default = string(runtime.StatusSuccess)
+	}
+	reg := NewDefaultRegistry()
+	g, _, err := PrepareWithOptions(dotSource, PrepareOptions{KnownTypes: reg.KnownTypes()})
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSimulationScript(g, script); err != nil {
+		return nil, err
+	}
+	logsRoot, err := os.MkdirTemp("", "kilroy-simulate-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(logsRoot) }()
+
+	sim := &simulation{script: script, consumed: map[string]int{}, edges: map[*model.Edge]bool{}}
+	eng := newBaseEngine(g, dotSource, RunOptions{
+		RunID:           simulationRunID,
+		LogsRoot:        logsRoot,
+		RunBranchPrefix: simulationBranchPrefix,
+		DisableCXDB:     true,
+	})
+	eng.Registry = simulationRegistry(sim)
+	eng.sideEffects = sim
+	eng.baseLogsRoot = logsRoot
+	for k, v := range g.Attrs {
+		eng.Context.Set("graph."+k, v)
+	}
+	eng.Context.Set("graph.goal", g.Attrs["goal"])
+
+	start := findStartNodeID(g)
+	if start == "" {
+		return nil, fmt.Errorf("no start node found")
+	}
+	rep := &SimulationReport{FinalStatus: runtime.FinalSuccess}
+	if _, runErr := eng.runLoop(ctx, start, nil, map[string]int{}, map[string]runtime.Outcome{}); runErr != nil {
+		if ctx.Err() != nil {
+			return nil, runErr
+		}
+		rep.FinalStatus = runtime.FinalFail
+		rep.FailureReason = runErr.Error()
+	}
+	rep.Restarts = eng.restartCount
+	rep.Context = eng.Context.SnapshotValues()
+	rep.Path = sim.steps
+	rep.Visits = map[string]int{}
+	for _, s := range sim.steps {
+		rep.Visits[s.NodeID]++
+	}
+	for _, id := range sortedKeys(g.Nodes) {
+		if rep.Visits[id] == 0 {
+			rep.UnvisitedNodes = append(rep.UnvisitedNodes, id)
+		}
+	}
+	for _, edge := range g.Edges {
+		if !sim.edges[edge] {
+			rep.UnusedEdges = append(rep.UnusedEdges, SimulationEdge{From: edge.From, To: edge.To, Label: edge.Label(), Condition: edge.Condition()})
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SimulationSuiteSuffix names pipeline test files. A suite for pipeline.dot
+// lives next to it as pipeline.test.yaml.
+const SimulationSuiteSuffix = ".test.yaml"
+
+// SimulationSuite is a checked-in set of simulations for one graph.
+//
+//	graph: pipeline.dot            # optional; defaults to the sibling .dot
+//	tests:
+//	  - name: failing verify routes to postmortem
+//	    nodes:
+//	      verify: fail
+//	    expect:
+//	      path: [start, implement, verify, postmortem, exit]
+//	      final_status: success
+//	      visits: {verify: 1}
+//	      context: {outcome: success}
+type SimulationSuite struct {
+	// Path is the suite file the suite was loaded from.
+	Path string `yaml:"-"`
+	// Graph is the DOT file under test, relative to the suite file.
+	Graph string           `yaml:"graph,omitempty"`
+	Tests []SimulationCase `yaml:"tests"`
+}
+
+// SimulationCase is one scripted walk of the graph and its assertions.
+type SimulationCase struct {
+	Name             string `yaml:"name"`
+	SimulationScript `yaml:",inline"`
+	Expect           SimulationExpectation `yaml:"expect"`
+}
+
+// SimulationExpectation lists the assertions of a case. Unset fields are not
+// checked.
+type SimulationExpectation struct {
+	// Path is the exact sequence of node executions, retries and parallel
+	// branch stages included.
+	Path        []string       `yaml:"path,omitempty"`
+	FinalStatus string         `yaml:"final_status,omitempty"`
+	Context     map[string]any `yaml:"context,omitempty"`
+	Visits      map[string]int `yaml:"visits,omitempty"`
+}
+
+// SimulationCaseResult is the outcome of one case. Error is set when the case
+// could not be simulated at all (for example an invalid script); Failures
+// lists the assertions that did not hold.
+type SimulationCaseResult struct {
+	Name     string            `json:"name"`
+	Failures []string          `json:"failures,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Duration time.Duration     `json:"duration_ns"`
+	Report   *SimulationReport `json:"report,omitempty"`
+}
+
+func (r SimulationCaseResult) Passed() bool {
+	return r.Error == "" && len(r.Failures) == 0
+}
+
+// LoadSimulationSuite reads a pipeline test file.
+func LoadSimulationSuite(path string) (*SimulationSuite, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s SimulationSuite
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parse pipeline tests %s: %w", path, err)
+	}
+	s.Path = path
+	if strings.TrimSpace(s.Graph) == "" {
+		s.Graph = strings.TrimSuffix(filepath.Base(path), SimulationSuiteSuffix) + ".dot"
+	}
+	if !filepath.IsAbs(s.Graph) {
+		s.Graph = filepath.Join(filepath.Dir(path), s.Graph)
+	}
+	if len(s.Tests) == 0 {
+		return nil, fmt.Errorf("pipeline tests %s: no tests", path)
+	}
+	for i, tc := range s.Tests {
+		if strings.TrimSpace(tc.Name) == "" {
+			return nil, fmt.Errorf("pipeline tests %s: tests[%d] has no name", path, i)
+		}
+	}
+	return &s, nil
+}
+
+// RunSimulationSuite simulates every case of the suite against its graph.
+// It only fails when the graph cannot be read; invalid graphs and scripts are
+// reported per case.
+func RunSimulationSuite(ctx context.Context, suite *SimulationSuite) ([]SimulationCaseResult, error) {
+	dotSource, err := os.ReadFile(suite.Graph)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SimulationCaseResult, 0, len(suite.Tests))
+	for _, tc := range suite.Tests {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		started := time.Now()
+		script := tc.SimulationScript
+		res := SimulationCaseResult{Name: tc.Name}
+		rep, err := Simulate(ctx, dotSource, &script)
+		res.Duration = time.Since(started)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Report = rep
+			res.Failures = tc.Expect.check(rep)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (x SimulationExpectation) check(rep *SimulationReport) []string {
+	var failures []string
+	if x.Path != nil {
+		got := make([]string, 0, len(rep.Path))
+		for _, s := range rep.Path {
+			got = append(got, s.NodeID)
+		}
+		if !reflect.DeepEqual(got, x.Path) {
+			failures = append(failures, fmt.Sprintf("path: got [%s], want [%s]", strings.Join(got, " "), strings.Join(x.Path, " ")))
+		}
+	}
+	if want := strings.TrimSpace(x.FinalStatus); want != "" && !strings.EqualFold(want, string(rep.FinalStatus)) {
+		msg := fmt.Sprintf("final_status: got %s, want %s", rep.FinalStatus, want)
+		if rep.FailureReason != "" {
+			msg += " (" + rep.FailureReason + ")"
+		}
+		failures = append(failures, msg)
+	}
+	for _, node := range sortedKeys(x.Visits) {
+		if got, want := rep.Visits[node], x.Visits[node]; got != want {
+			failures = append(failures, fmt.Sprintf("visits[%s]: got %d, want %d", node, got, want))
+		}
+	}
+	for _, k := range sortedKeys(x.Context) {
+		got, ok := rep.Context[k]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("context[%s]: not set, want %v", k, x.Context[k]))
+			continue
+		}
+		if !sameContextValue(got, x.Context[k]) {
+			failures = append(failures, fmt.Sprintf("context[%s]: got %v, want %v", k, got, x.Context[k]))
+		}
+	}
+	return failures
+}
+
+// sameContextValue compares context values by their JSON form, so 3 and 3.0
+// (or a YAML map and a decoded JSON object) are equal.
+func sameContextValue(got, want any) bool {
+	norm := func(v any) (any, bool) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		var out any
+		if err := json.Unmarshal(b, &out); err != nil {
+			return nil, false
+		}
+		return out, true
+	}
+	g, ok1 := norm(got)
+	w, ok2 := norm(want)
+	if !ok1 || !ok2 {
+		return fmt.Sprint(got) == fmt.Sprint(want)
+	}
+	return reflect.DeepEqual(g, w)
+}
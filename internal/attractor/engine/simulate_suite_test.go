@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSimulationSuite_ChecksPathStatusVisitsAndContext(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "pipeline.dot"), []byte(`
+digraph G {
+  graph [goal="ship", default_max_retry=0]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  review     [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="review"]
+  postmortem [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="postmortem"]
+  start -> review
+  review -> exit [condition="context.review.score>=8"]
+  review -> postmortem
+  postmortem -> exit
+}
+`), 0o644)
+	suitePath := filepath.Join(dir, "pipeline"+SimulationSuiteSuffix)
+	_ = os.WriteFile(suitePath, []byte(`
+tests:
+  - name: high score skips postmortem
+    nodes:
+      review:
+        status: success
+        context_updates: {review.score: 9}
+    expect:
+      path: [start, review, exit]
+      final_status: success
+      context: {review.score: 9.0}
+  - name: broken expectation
+    nodes:
+      review: {status: success, context_updates: {review.score: 3}}
+    expect:
+      path: [start, review, exit]
+      visits: {postmortem: 0}
+      context: {review.score: 9, missing.key: x}
+  - name: invalid script
+    nodes:
+      nope: fail
+`), 0o644)
+
+	suite, err := LoadSimulationSuite(suitePath)
+	if err != nil {
+		t.Fatalf("LoadSimulationSuite: %v", err)
+	}
+	if suite.Graph != filepath.Join(dir, "pipeline.dot") {
+		t.Fatalf("graph: %s", suite.Graph)
+	}
+	results, err := RunSimulationSuite(context.Background(), suite)
+	if err != nil {
+		t.Fatalf("RunSimulationSuite: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("results: %+v", results)
+	}
+	if !results[0].Passed() {
+		t.Fatalf("expected first case to pass: %+v", results[0])
+	}
+	got := strings.Join(results[1].Failures, "\n")
+	for _, want := range []string{
+		"path: got [start review postmortem exit], want [start review exit]",
+		"visits[postmortem]: got 1, want 0",
+		"context[missing.key]: not set",
+		"context[review.score]: got 3, want 9",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing failure %q in:\n%s", want, got)
+		}
+	}
+	if results[2].Passed() || !strings.Contains(results[2].Error, `unknown node "nope"`) {
+		t.Fatalf("expected script error: %+v", results[2])
+	}
+}
+
+func TestLoadSimulationSuite_RequiresNamedTests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "g"+SimulationSuiteSuffix)
+	_ = os.WriteFile(path, []byte("tests:\n  - nodes: {a: fail}\n"), 0o644)
+	if _, err := LoadSimulationSuite(path); err == nil || !strings.Contains(err.Error(), "tests[0] has no name") {
+		t.Fatalf("expected missing name error, got %v", err)
+	}
+	_ = os.WriteFile(path, []byte("graph: other.dot\n"), 0o644)
+	if _, err := LoadSimulationSuite(path); err == nil || !strings.Contains(err.Error(), "no tests") {
+		t.Fatalf("expected no tests error, got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func simulatedNodeIDs(rep *SimulationReport) []string {
+	var ids []string
+	for _, s := range rep.Path {
+		ids = append(ids, s.NodeID)
+	}
+	return ids
+}
+
+func writeSimulationScript(t *testing.T, yaml string) *SimulationScript {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "outcomes.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script, err := LoadSimulationScript(path)
+	if err != nil {
+		t.Fatalf("LoadSimulationScript: %v", err)
+	}
+	return script
+}
+
+func TestSimulate_FailureRoutesToPostmortem(t *testing.T) {
+	dot := []byte(`
+digraph G {
+  graph [goal="ship", default_max_retry=0]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  implement  [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="implement"]
+  verify     [shape=parallelogram, tool_command="make test"]
+  postmortem [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="postmortem"]
+  start -> implement -> verify
+  verify -> exit [condition="outcome=success"]
+  verify -> postmortem [condition="outcome=fail"]
+  verify -> exit
+  postmortem -> implement
+}
+`)
+	script := writeSimulationScript(t, `
+nodes:
+  verify: [fail, success]
+`)
+	rep, err := Simulate(context.Background(), dot, script)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if rep.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: %+v", rep)
+	}
+	want := []string{"start", "implement", "verify", "postmortem", "implement", "verify", "exit"}
+	if got := simulatedNodeIDs(rep); !reflect.DeepEqual(got, want) {
+		t.Fatalf("path: got %v want %v", got, want)
+	}
+	if rep.Visits["implement"] != 2 || rep.Visits["verify"] != 2 {
+		t.Fatalf("visits: %v", rep.Visits)
+	}
+	if len(rep.UnvisitedNodes) != 0 {
+		t.Fatalf("unvisited: %v", rep.UnvisitedNodes)
+	}
+	var unused []string
+	for _, e := range rep.UnusedEdges {
+		unused = append(unused, e.String())
+	}
+	if !reflect.DeepEqual(unused, []string{"verify -> exit"}) {
+		t.Fatalf("unused edges: %v", unused)
+	}
+}
+
+func TestSimulate_RetriesTransientFailures(t *testing.T) {
+	dot := []byte(`
+digraph G {
+  graph [goal="ship"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  implement [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="implement", max_retries=2]
+  start -> implement -> exit
+}
+`)
+	script := writeSimulationScript(t, `
+nodes:
+  implement:
+    - status: fail
+      failure_reason: connection reset
+      failure_class: transient_infra
+    - success
+`)
+	rep, err := Simulate(context.Background(), dot, script)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if rep.Visits["implement"] != 2 || rep.Path[1].Status != "fail" || rep.Path[1].FailureReason != "connection reset" {
+		t.Fatalf("expected a retried implement attempt, got %+v", rep.Path)
+	}
+	if rep.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: %+v", rep)
+	}
+}
+
+func TestSimulate_GoalGateAndLoopRestart(t *testing.T) {
+	dot := []byte(`
+digraph G {
+  graph [goal="ship", default_max_retry=0]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  work  [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="work"]
+  check [shape=diamond]
+  gate  [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="review", goal_gate=true, retry_target=work]
+  start -> work -> check
+  check -> gate [condition="outcome=success"]
+  check -> work [condition="outcome=fail", loop_restart=true]
+  check -> exit
+  gate -> exit
+}
+`)
+	script := writeSimulationScript(t, `
+nodes:
+  work:
+    - status: fail
+      failure_class: transient_infra
+    - success
+  gate: [fail, success]
+`)
+	rep, err := Simulate(context.Background(), dot, script)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	want := []string{"start", "work", "check", "work", "check", "gate", "work", "check", "gate", "exit"}
+	if got := simulatedNodeIDs(rep); !reflect.DeepEqual(got, want) {
+		t.Fatalf("path: got %v want %v", got, want)
+	}
+	if rep.Restarts != 1 || rep.Path[3].Restart != 1 {
+		t.Fatalf("restarts: %d path=%+v", rep.Restarts, rep.Path)
+	}
+	if rep.FinalStatus != runtime.FinalSuccess || len(rep.UnusedEdges) != 1 || rep.UnusedEdges[0].String() != "check -> exit" {
+		t.Fatalf("report: %+v", rep)
+	}
+}
+
+func TestSimulate_ParallelJoin(t *testing.T) {
+	dot := []byte(`
+digraph G {
+  graph [goal="ship"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  fan  [shape=component]
+  a    [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="a"]
+  b    [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="b"]
+  join [shape=tripleoctagon, fan_in_strategy=llm]
+  fix  [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="fix"]
+  start -> fan
+  fan -> a -> join
+  fan -> b -> join
+  join -> exit [condition="outcome=success"]
+  join -> fix [condition="outcome=fail"]
+  join -> fix
+  fix -> exit
+}
+`)
+	script := writeSimulationScript(t, `
+default: fail
+nodes:
+  a: success
+`)
+	rep, err := Simulate(context.Background(), dot, script)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	branches := map[string]string{}
+	for _, s := range rep.Path {
+		if s.Branch != "" {
+			branches[s.NodeID] = s.Branch
+		}
+	}
+	if branches["a"] != "fan/a" || branches["b"] != "fan/b" {
+		t.Fatalf("branch steps: %+v", rep.Path)
+	}
+	ids := simulatedNodeIDs(rep)
+	if ids[len(ids)-2] != "join" || ids[len(ids)-1] != "exit" || !reflect.DeepEqual(rep.UnvisitedNodes, []string{"fix"}) {
+		t.Fatalf("expected the join to pick the successful branch, got %v", ids)
+	}
+	var unused []string
+	for _, e := range rep.UnusedEdges {
+		unused = append(unused, e.From+"->"+e.To)
+	}
+	if !reflect.DeepEqual(unused, []string{"join->fix", "join->fix", "fix->exit"}) {
+		t.Fatalf("unused edges: %v", unused)
+	}
+}
+
+func TestSimulate_RejectsInvalidScripts(t *testing.T) {
+	dot := []byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  check [shape=diamond]
+  work  [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="work"]
+  start -> work -> check -> exit
+}
+`)
+	for name, tc := range map[string]struct {
+		script *SimulationScript
+		want   string
+	}{
+		"unknown node":   {&SimulationScript{Nodes: map[string]SimulatedOutcomes{"nope": {{Status: "success"}}}}, `unknown node "nope"`},
+		"derived node":   {&SimulationScript{Nodes: map[string]SimulatedOutcomes{"check": {{Status: "fail"}}}}, "derived by the engine"},
+		"bad status":     {&SimulationScript{Nodes: map[string]SimulatedOutcomes{"work": {{Status: ""}}}}, "nodes.work[0]"},
+		"blank default":  {&SimulationScript{Default: "   "}, ""},
+		"custom outcome": {&SimulationScript{Nodes: map[string]SimulatedOutcomes{"work": {{Status: "needs_review"}}}}, ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Simulate(context.Background(), dot, tc.script)
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("Simulate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
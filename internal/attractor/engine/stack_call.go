@@ -0,0 +1,308 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+// StackCallHandler runs another pipeline inline (type=stack.call). Unlike
+// stack.manager_loop there is no supervised child run: the called graph's
+// stages execute on the caller's run branch and worktree, checkpoint into
+// logs_root/<node>/, and see only the context keys mapped in by
+// stack.call_inputs. stack.call_outputs copies keys back when it finishes.
+type StackCallHandler struct{}
+
+// callResultFileName marks a finished call. A child checkpoint without it
+// belongs to a call that was interrupted and is continued on resume.
+const callResultFileName = "call_result.json"
+
+// callMapping copies one context key across the call boundary: Dest is the
+// key written on the receiving side, Src the key read on the other.
+type callMapping struct {
+	Dest string
+	Src  string
+}
+
+func (h *StackCallHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
+	if exec == nil || exec.Engine == nil || exec.Graph == nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "stack.call handler missing execution context"}, nil
+	}
+	fail := func(format string, args ...any) (runtime.Outcome, error) {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf(format, args...)}, nil
+	}
+
+	dotfile := strings.TrimSpace(node.Attr("stack.call_dotfile", ""))
+	if dotfile == "" {
+		return fail("stack.call node requires stack.call_dotfile")
+	}
+	// Prepare rejects cycles it can see, but the called files are read from
+	// the worktree, which earlier stages may have rewritten.
+	callKey := filepath.Clean(dotfile)
+	if i := slices.Index(exec.Engine.callStack, callKey); i >= 0 {
+		cycle := append(append([]string{}, exec.Engine.callStack[i:]...), callKey)
+		return fail("stack.call cycle: %s", strings.Join(cycle, " -> "))
+	}
+	inputs, err := parseCallMappings(node.Attr("stack.call_inputs", ""))
+	if err != nil {
+		return fail("stack.call_inputs: %v", err)
+	}
+	outputs, err := parseCallMappings(node.Attr("stack.call_outputs", ""))
+	if err != nil {
+		return fail("stack.call_outputs: %v", err)
+	}
+
+	// Called graphs get the run's params for the names they declare.
+	childGraph, dotSource, err := loadChildGraph(exec, dotfile, PrepareOptions{
+		Params:              exec.Engine.Options.Params,
+		RequireParams:       true,
+		IgnoreUnknownParams: true,
+	})
+	if err != nil {
+		return fail("stack.call %s: %v", dotfile, err)
+	}
+	startID := findStartNodeID(childGraph)
+	if startID == "" {
+		return fail("stack.call %s: called graph has no start node", dotfile)
+	}
+	exitID := findExitNodeID(childGraph)
+
+	childCtx := runtime.NewContext()
+	for k, v := range childGraph.Attrs {
+		childCtx.Set("graph."+k, v)
+	}
+	childCtx.Set("graph.goal", childGraph.Attrs["goal"])
+	if baseSHA := exec.Context.GetString("base_sha", ""); baseSHA != "" {
+		childCtx.Set("base_sha", baseSHA)
+		expandBaseSHA(childGraph, baseSHA)
+	}
+	for _, m := range inputs {
+		v, ok := exec.Context.Get(m.Src)
+		if !ok {
+			return fail("stack.call_inputs: context key %q is not set", m.Src)
+		}
+		childCtx.Set(m.Dest, v)
+	}
+
+	childLogsRoot := filepath.Join(exec.LogsRoot, node.ID)
+	_ = os.MkdirAll(childLogsRoot, 0o755)
+	childEng := &Engine{
+		Graph:                      childGraph,
+		Options:                    exec.Engine.Options,
+		DotSource:                  dotSource,
+		RunBranch:                  exec.Engine.RunBranch,
+		WorktreeDir:                exec.WorktreeDir,
+		LogsRoot:                   childLogsRoot,
+		Context:                    childCtx,
+		Registry:                   exec.Engine.Registry,
+		CodergenBackend:            exec.Engine.CodergenBackend,
+		Interviewer:                exec.Engine.Interviewer,
+		CXDB:                       exec.Engine.CXDB,
+		ArtifactPolicy:             exec.Engine.ArtifactPolicy,
+		ModelCatalogSHA:            exec.Engine.ModelCatalogSHA,
+		ModelCatalogSource:         exec.Engine.ModelCatalogSource,
+		ModelCatalogPath:           exec.Engine.ModelCatalogPath,
+		InputMaterializationPolicy: exec.Engine.InputMaterializationPolicy,
+		InputReferenceInferer:      exec.Engine.InputReferenceInferer,
+		InputInferenceCache:        exec.Engine.InputInferenceCache,
+		InputSourceTargetMap:       exec.Engine.InputSourceTargetMap,
+		StageSummarizer:            exec.Engine.StageSummarizer,
+		ManagerSteerer:             exec.Engine.ManagerSteerer,
+		FanInJudge:                 exec.Engine.FanInJudge,
+		steering:                   exec.Engine.steering,
+		costs:                      exec.Engine.costs,
+		sideEffects:                exec.Engine.sideEffects,
+		callStack:                  append(slices.Clone(exec.Engine.callStack), callKey),
+	}
+	// Child events also land in the caller's progress stream (which keeps the
+	// stall watchdog fed), tagged with the call path.
+	childEng.progressSink = func(ev map[string]any) {
+		callPath := node.ID
+		if inner := eventFieldString(ev, "call_node_id"); inner != "" {
+			callPath += "/" + inner
+		}
+		ev["call_node_id"] = callPath
+		exec.Engine.appendProgress(ev)
+	}
+
+	res, err := h.runChild(ctx, exec, node, childEng, startID, exitID)
+	if err != nil {
+		out := runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("stack.call %s: %v", dotfile, err)}
+		// An interrupted call keeps its checkpoint so resume can continue it.
+		if ctx.Err() == nil {
+			_ = writeJSON(filepath.Join(childLogsRoot, callResultFileName), out)
+		}
+		return out, nil
+	}
+
+	out := runtime.Outcome{
+		Status:         res.Outcome.Status,
+		PreferredLabel: res.Outcome.PreferredLabel,
+		FailureReason:  res.Outcome.FailureReason,
+		Notes:          fmt.Sprintf("stack.call %s completed %d stage(s), last %s", dotfile, len(res.Completed), res.LastNodeID),
+		ContextUpdates: map[string]any{},
+	}
+	if out.Status == "" {
+		out.Status = runtime.StatusSuccess
+	}
+	for _, m := range outputs {
+		if v, ok := childEng.Context.Get(m.Src); ok {
+			out.ContextUpdates[m.Dest] = v
+		}
+	}
+	_ = writeJSON(filepath.Join(childLogsRoot, callResultFileName), out)
+	return out, nil
+}
+
+// runChild runs the called graph from its start node, or continues it from
+// the child checkpoint left by an interrupted earlier attempt.
+func (h *StackCallHandler) runChild(ctx context.Context, exec *Execution, node *model.Node, childEng *Engine, startID, exitID string) (parallelBranchResult, error) {
+	cpPath := filepath.Join(childEng.LogsRoot, "checkpoint.json")
+	_, doneErr := os.Stat(filepath.Join(childEng.LogsRoot, callResultFileName))
+	cp, cpErr := runtime.LoadCheckpoint(cpPath)
+	if cpErr != nil || doneErr == nil || strings.TrimSpace(cp.CurrentNode) == "" {
+		_ = os.Remove(cpPath)
+		_ = os.Remove(filepath.Join(childEng.LogsRoot, callResultFileName))
+		return runSubgraphUntil(ctx, childEng, startID, exitID)
+	}
+
+	// Resume resets the worktree to the caller's last checkpoint; the child's
+	// commits are its descendants, so fast-forward back onto them.
+	if head, _ := gitutil.HeadSHA(childEng.WorktreeDir); head != cp.GitCommitSHA {
+		if err := gitutil.FastForwardFFOnly(childEng.WorktreeDir, cp.GitCommitSHA); err != nil {
+			exec.Engine.Warn(fmt.Sprintf("stack.call %s: cannot continue from child checkpoint (%v); restarting the called graph", node.ID, err))
+			_ = os.Remove(cpPath)
+			return runSubgraphUntil(ctx, childEng, startID, exitID)
+		}
+	}
+	childEng.Context.ReplaceSnapshot(cp.ContextValues, cp.Logs)
+
+	last := runtime.Outcome{Status: runtime.StatusSuccess}
+	if b, err := os.ReadFile(filepath.Join(childEng.LogsRoot, cp.CurrentNode, "status.json")); err == nil {
+		if o, err := runtime.DecodeOutcomeJSON(b); err == nil {
+			last = o
+		}
+	}
+	childEng.appendProgress(map[string]any{
+		"event":      "stack_call_resume",
+		"node_id":    cp.CurrentNode,
+		"completed":  len(cp.CompletedNodes),
+		"checkpoint": cp.GitCommitSHA,
+	})
+	next, err := selectNextEdge(childEng.Graph, cp.CurrentNode, last, childEng.Context)
+	if err != nil {
+		return parallelBranchResult{}, err
+	}
+	if next == nil || next.To == exitID {
+		return parallelBranchResult{
+			HeadSHA:    cp.GitCommitSHA,
+			LastNodeID: cp.CurrentNode,
+			Outcome:    last,
+			Completed:  cp.CompletedNodes,
+		}, nil
+	}
+	return continueSubgraphUntil(ctx, childEng, next.To, exitID, cp.CompletedNodes, cp.NodeRetries)
+}
+
+// validateCalledGraphs prepares every graph a stack.call node in g refers to,
+// recursively, and reports their errors and any call cycle against the
+// calling node.
+func validateCalledGraphs(g *model.Graph, opts PrepareOptions, callStack []string) []validate.Diagnostic {
+	root := opts.CallRoot
+	if root == "" {
+		root = opts.RepoPath
+	}
+	if root == "" {
+		return nil
+	}
+	var diags []validate.Diagnostic
+	report := func(n *model.Node, msg string) {
+		d := validate.Diagnostic{
+			Rule:     "stack_call_graph",
+			Attr:     "stack.call_dotfile",
+			Severity: validate.SeverityError,
+			Message:  msg,
+			NodeID:   n.ID,
+		}
+		d.Range = validate.Locate(g, d)
+		diags = append(diags, d)
+	}
+	for _, id := range g.AllNodeIDs() {
+		n := g.Nodes[id]
+		if n == nil || strings.TrimSpace(n.TypeOverride()) != "stack.call" {
+			continue
+		}
+		dotfile := strings.TrimSpace(n.Attr("stack.call_dotfile", ""))
+		if dotfile == "" {
+			continue
+		}
+		path := dotfile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if i := slices.Index(callStack, path); i >= 0 {
+			cycle := append(append([]string{}, callStack[i:]...), path)
+			report(n, fmt.Sprintf("stack.call cycle: %s", strings.Join(cycle, " -> ")))
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			report(n, fmt.Sprintf("stack.call_dotfile %s: %v", dotfile, err))
+			continue
+		}
+		childOpts := opts
+		childOpts.CallRoot = root
+		childOpts.IgnoreUnknownParams = true
+		_, childDiags, err := prepareGraph(src, childOpts, append(append([]string{}, callStack...), path))
+		reported := false
+		for _, cd := range childDiags {
+			if cd.Severity != validate.SeverityError {
+				continue
+			}
+			loc := dotfile
+			if cd.Range != nil {
+				loc = fmt.Sprintf("%s:%d:%d", dotfile, cd.Range.Start.Line, cd.Range.Start.Column)
+			}
+			report(n, fmt.Sprintf("%s: %s (%s)", loc, cd.Message, cd.Rule))
+			reported = true
+		}
+		if err != nil && !reported {
+			report(n, fmt.Sprintf("stack.call_dotfile %s: %v", dotfile, err))
+		}
+	}
+	return diags
+}
+
+// parseCallMappings parses a comma-separated list of dest=src context keys.
+// A bare key maps to itself; a leading "context." is ignored on either side.
+func parseCallMappings(raw string) ([]callMapping, error) {
+	var out []callMapping
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		dest, src, found := strings.Cut(entry, "=")
+		if !found {
+			src = dest
+		}
+		dest = strings.TrimPrefix(strings.TrimSpace(dest), "context.")
+		src = strings.TrimPrefix(strings.TrimSpace(src), "context.")
+		if dest == "" || src == "" {
+			return nil, fmt.Errorf("invalid mapping %q (want dest=src or key)", entry)
+		}
+		out = append(out, callMapping{Dest: dest, Src: src})
+	}
+	return out, nil
+}
@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+const stackCallChildDot = `
+digraph loop {
+  graph [goal="child"]
+  start [shape=Mdiamond]
+  one [shape=parallelogram, tool_command="echo one >> trace.txt"]
+  two [shape=parallelogram, tool_command="echo two >> trace.txt && printf '%s' '{\"status\":\"success\",\"context_updates\":{\"loop.result\":\"fixed\"}}' > \"$KILROY_STAGE_LOGS_DIR/status.json\""]
+  exit [shape=Msquare]
+  start -> one -> two -> exit
+}
+`
+
+const stackCallParentDot = `
+digraph P {
+  graph [goal="parent"]
+  start [shape=Mdiamond]
+  seed [shape=parallelogram, tool_command="printf '%s' '{\"status\":\"success\",\"context_updates\":{\"plan.task\":\"t-1\",\"plan.secret\":\"s\"}}' > \"$KILROY_STAGE_LOGS_DIR/status.json\""]
+  call [shape=house, type="stack.call", stack.call_dotfile="pipelines/loop.dot", stack.call_inputs="task=context.plan.task", stack.call_outputs="result=loop.result"]
+  exit [shape=Msquare]
+  start -> seed -> call -> exit
+}
+`
+
+func initStackCallRepo(t *testing.T) string {
+	t.Helper()
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	_ = os.MkdirAll(filepath.Join(repo, "pipelines"), 0o755)
+	_ = os.WriteFile(filepath.Join(repo, "pipelines", "loop.dot"), []byte(stackCallChildDot), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+	return repo
+}
+
+func TestRun_StackCall_RunsCalledGraphInline(t *testing.T) {
+	repo := initStackCallRepo(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, []byte(stackCallParentDot), RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status: got %q want success", res.FinalStatus)
+	}
+
+	// Child stages run on the caller's branch and are logged under the call node.
+	assertExists(t, filepath.Join(res.LogsRoot, "call", "one", "status.json"))
+	assertExists(t, filepath.Join(res.LogsRoot, "call", callResultFileName))
+	log := runCmdOut(t, repo, "git", "log", "--format=%s", res.RunBranch)
+	for _, want := range []string{": one (success)", ": two (success)", ": call (success)"} {
+		if !strings.Contains(log, want) {
+			t.Fatalf("run branch log missing %q:\n%s", want, log)
+		}
+	}
+	if got := runCmdOut(t, repo, "git", "show", res.RunBranch+":trace.txt"); got != "one\ntwo\n" {
+		t.Fatalf("trace.txt: got %q", got)
+	}
+
+	childCP, err := runtime.LoadCheckpoint(filepath.Join(res.LogsRoot, "call", "checkpoint.json"))
+	if err != nil {
+		t.Fatalf("load child checkpoint: %v", err)
+	}
+	if childCP.ContextValues["task"] != "t-1" {
+		t.Fatalf("child context task: got %v want t-1", childCP.ContextValues["task"])
+	}
+	if _, ok := childCP.ContextValues["plan.secret"]; ok {
+		t.Fatalf("unmapped parent key leaked into the called graph")
+	}
+	cp, err := runtime.LoadCheckpoint(filepath.Join(res.LogsRoot, "checkpoint.json"))
+	if err != nil {
+		t.Fatalf("load checkpoint: %v", err)
+	}
+	if cp.ContextValues["result"] != "fixed" {
+		t.Fatalf("parent context result: got %v want fixed", cp.ContextValues["result"])
+	}
+}
+
+func TestResume_StackCall_ContinuesInsideCalledGraph(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	repo := initStackCallRepo(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, []byte(stackCallParentDot), RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	// Rewind to a crash inside the call: the caller last checkpointed seed,
+	// the called graph last checkpointed one.
+	commitFor := func(node string) string {
+		return strings.TrimSpace(runCmdOut(t, repo, "git", "log", "-1", "--format=%H", "--grep", ": "+node+" (success)", res.RunBranch))
+	}
+	cpPath := filepath.Join(res.LogsRoot, "checkpoint.json")
+	cp, err := runtime.LoadCheckpoint(cpPath)
+	if err != nil {
+		t.Fatalf("load checkpoint: %v", err)
+	}
+	cp.CurrentNode = "seed"
+	cp.CompletedNodes = []string{"start", "seed"}
+	cp.GitCommitSHA = commitFor("seed")
+	delete(cp.ContextValues, "result")
+	if err := cp.Save(cpPath); err != nil {
+		t.Fatalf("save checkpoint: %v", err)
+	}
+	childCPPath := filepath.Join(res.LogsRoot, "call", "checkpoint.json")
+	childCP, err := runtime.LoadCheckpoint(childCPPath)
+	if err != nil {
+		t.Fatalf("load child checkpoint: %v", err)
+	}
+	childCP.CurrentNode = "one"
+	childCP.CompletedNodes = []string{"start", "one"}
+	oneSHA := commitFor("one")
+	childCP.GitCommitSHA = oneSHA
+	if err := childCP.Save(childCPPath); err != nil {
+		t.Fatalf("save child checkpoint: %v", err)
+	}
+	_ = os.Remove(filepath.Join(res.LogsRoot, "call", callResultFileName))
+
+	res2, err := Resume(ctx, res.LogsRoot)
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if res2.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("resumed final status: got %q want success", res2.FinalStatus)
+	}
+	// one must not run again; two runs once on top of one's commit.
+	if got := commitFor("one"); got != oneSHA {
+		t.Fatalf("one was re-run: commit %s, want %s", got, oneSHA)
+	}
+	if got := runCmdOut(t, repo, "git", "show", res2.RunBranch+":trace.txt"); got != "one\ntwo\n" {
+		t.Fatalf("trace.txt after resume: got %q", got)
+	}
+	childCP, err = runtime.LoadCheckpoint(childCPPath)
+	if err != nil {
+		t.Fatalf("load child checkpoint: %v", err)
+	}
+	if want := []string{"start", "one", "two"}; !reflect.DeepEqual(childCP.CompletedNodes, want) {
+		t.Fatalf("child completed nodes: got %v want %v", childCP.CompletedNodes, want)
+	}
+	cp, err = runtime.LoadCheckpoint(cpPath)
+	if err != nil {
+		t.Fatalf("load checkpoint: %v", err)
+	}
+	if cp.ContextValues["result"] != "fixed" {
+		t.Fatalf("parent context result after resume: got %v want fixed", cp.ContextValues["result"])
+	}
+}
+
+func TestPrepare_StackCallValidatesCalledGraphs(t *testing.T) {
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "broken.dot"), []byte(`digraph B { start [shape=Mdiamond]; orphan [shape=parallelogram, tool_command="true"]; exit [shape=Msquare]; start -> exit }`), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "a.dot"), []byte(`digraph A { start [shape=Mdiamond]; c [shape=house, type="stack.call", stack.call_dotfile="b.dot"]; exit [shape=Msquare]; start -> c -> exit }`), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "b.dot"), []byte(`digraph B { start [shape=Mdiamond]; c [shape=house, type="stack.call", stack.call_dotfile="a.dot"]; exit [shape=Msquare]; start -> c -> exit }`), 0o644)
+
+	caller := func(target string) []byte {
+		return []byte(`digraph P { start [shape=Mdiamond]; c [shape=house, type="stack.call", stack.call_dotfile="` + target + `"]; exit [shape=Msquare]; start -> c -> exit }`)
+	}
+	for target, want := range map[string]string{
+		"broken.dot":  "broken.dot:1:",
+		"a.dot":       "stack.call cycle:",
+		"missing.dot": "stack.call_dotfile missing.dot:",
+	} {
+		_, diags, err := PrepareWithOptions(caller(target), PrepareOptions{CallRoot: root})
+		if err == nil {
+			t.Fatalf("%s: expected a validation error", target)
+		}
+		found := false
+		for _, d := range diags {
+			if d.Rule == "stack_call_graph" && d.NodeID == "c" && strings.Contains(d.Message, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("%s: no stack_call_graph diagnostic containing %q: %+v", target, want, diags)
+		}
+	}
+
+	if _, _, err := PrepareWithOptions(caller("a.dot"), PrepareOptions{}); err != nil {
+		t.Fatalf("called graphs should not be checked without a call root: %v", err)
+	}
+}
+
+func TestStackCall_FailsOnGraphAlreadyOnCallStack(t *testing.T) {
+	repo := initStackCallRepo(t)
+	g, _, err := Prepare([]byte(stackCallParentDot))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	// The run is already inside a call of loop.dot, e.g. loop.dot was
+	// rewritten after it was prepared and now calls itself.
+	eng := &Engine{Graph: g, LogsRoot: t.TempDir(), WorktreeDir: repo, callStack: []string{"pipelines/other.dot", "pipelines/loop.dot"}}
+	exec := &Execution{Graph: g, Context: runtime.NewContext(), LogsRoot: eng.LogsRoot, WorktreeDir: repo, Engine: eng}
+	node := g.Nodes["call"]
+	node.Attrs["stack.call_dotfile"] = "./pipelines/loop.dot"
+	node.Attrs["stack.call_inputs"] = ""
+
+	out, err := (&StackCallHandler{}).Execute(context.Background(), exec, node)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	want := "stack.call cycle: pipelines/loop.dot -> pipelines/loop.dot"
+	if out.Status != runtime.StatusFail || out.FailureReason != want {
+		t.Fatalf("outcome: got %s %q want fail %q", out.Status, out.FailureReason, want)
+	}
+	if _, err := os.Stat(filepath.Join(eng.LogsRoot, "call")); err == nil {
+		t.Fatalf("the cyclic call should fail before running anything")
+	}
+}
+
+func TestParseCallMappings(t *testing.T) {
+	got, err := parseCallMappings(" task=context.plan.task, spec ,, context.out=res ")
+	if err != nil {
+		t.Fatalf("parseCallMappings: %v", err)
+	}
+	want := []callMapping{{Dest: "task", Src: "plan.task"}, {Dest: "spec", Src: "spec"}, {Dest: "out", Src: "res"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v want %+v", got, want)
+	}
+	if _, err := parseCallMappings("a="); err == nil {
+		t.Fatalf("expected an error for an empty source")
+	}
+}
@@ -12,6 +12,12 @@ import (
 // runSubgraphUntil executes a subgraph starting at startNodeID and stops when the next hop would enter stopNodeID.
 // The stop node itself is not executed. This is used to run parallel branches up to a shared fan-in node.
 func runSubgraphUntil(ctx context.Context, eng *Engine, startNodeID, stopNodeID string) (parallelBranchResult, error) {
+	return continueSubgraphUntil(ctx, eng, startNodeID, stopNodeID, nil, nil)
+}
+
+// continueSubgraphUntil is runSubgraphUntil for a subgraph that already ran
+// part way: completed and nodeRetries carry over from its last checkpoint.
+func continueSubgraphUntil(ctx context.Context, eng *Engine, startNodeID, stopNodeID string, completed []string, nodeRetries map[string]int) (parallelBranchResult, error) {
 	if eng == nil || eng.Graph == nil {
 		return parallelBranchResult{}, fmt.Errorf("subgraph engine is nil")
 	}
@@ -22,8 +28,8 @@ func runSubgraphUntil(ctx context.Context, eng *Engine, startNodeID, stopNodeID
 	headSHA, _ := gitutil.HeadSHA(eng.WorktreeDir)
 
 	current := startNodeID
-	completed := []string{}
-	nodeRetries := map[string]int{}
+	completed = append([]string{}, completed...)
+	nodeRetries = copyStringIntMap(nodeRetries)
 	nodeVisits := map[string]int{}
 	visitLimit := maxNodeVisits(eng.Graph)
 
@@ -185,6 +191,7 @@ func runSubgraphUntil(ctx context.Context, eng *Engine, startNodeID, stopNodeID
 		if err != nil {
 			return parallelBranchResult{}, err
 		}
+		eng.effects().traversed(next)
 		if next == nil {
 			return parallelBranchResult{
 				HeadSHA:    headSHA,
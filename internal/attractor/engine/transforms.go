@@ -56,6 +56,7 @@ func (t goalExpansionTransform) Apply(g *model.Graph) error {
 //   - If both prompt and prompt_file are set, it is an error (ambiguous).
 //   - If the referenced file does not exist or is unreadable, it is an error.
 //   - After expansion, prompt_file is removed from the node attributes.
+//   - A .tmpl prompt_file turns on prompt_template unless the node sets it.
 func expandPromptFiles(g *model.Graph, repoPath string) error {
 	if repoPath == "" {
 		return nil
@@ -85,6 +86,9 @@ func expandPromptFiles(g *model.Graph, repoPath string) error {
 		}
 		n.Attrs["prompt"] = string(data)
 		delete(n.Attrs, "prompt_file")
+		if _, set := n.Attrs["prompt_template"]; !set && strings.HasSuffix(pf, ".tmpl") {
+			n.Attrs["prompt_template"] = "true"
+		}
 	}
 	return nil
 }
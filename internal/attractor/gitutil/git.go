@@ -150,9 +150,7 @@ func commitAllowEmpty(worktreeDir, message string) (string, error) {
 	if err != nil {
 		// If identity is missing, retry once with an explicit fallback committer identity
 		// (without mutating repo config).
-		if strings.Contains(err.Error(), "Author identity unknown") ||
-			strings.Contains(err.Error(), "Please tell me who you are") ||
-			strings.Contains(err.Error(), "unable to auto-detect email address") {
+		if isMissingIdentity(err) {
 			_, _, err = runGit(
 				worktreeDir,
 				"-c", "user.name=kilroy-attractor",
@@ -185,19 +183,90 @@ func FastForwardFFOnly(worktreeDir, otherRef string) error {
 	return MergeFastForwardOnly(worktreeDir, otherRef)
 }
 
-// DiffNameOnly returns file paths changed between baseRef and HEAD in the given directory.
-func DiffNameOnly(dir, baseRef string) ([]string, error) {
-	out, _, err := runGit(dir, "diff", "--name-only", baseRef)
+// MergeNoFF merges otherRef into the currently checked out branch with a merge
+// commit. On conflict the merge is aborted, leaving the worktree as it was, and
+// the conflicted paths are returned along with the error.
+func MergeNoFF(worktreeDir, otherRef, message string) ([]string, error) {
+	args := []string{"merge", "--no-ff", "--no-edit", "-m", message, otherRef}
+	_, _, err := runGit(worktreeDir, args...)
+	if err != nil && isMissingIdentity(err) {
+		_, _, err = runGit(worktreeDir, append([]string{
+			"-c", "user.name=kilroy-attractor",
+			"-c", "user.email=kilroy-attractor@local",
+		}, args...)...)
+	}
+	if err == nil {
+		return nil, nil
+	}
+	conflicts, _ := listLines(worktreeDir, "diff", "--name-only", "--diff-filter=U")
+	if _, _, aerr := runGit(worktreeDir, "rev-parse", "-q", "--verify", "MERGE_HEAD"); aerr == nil {
+		if _, _, aerr := runGit(worktreeDir, "merge", "--abort"); aerr != nil {
+			return conflicts, fmt.Errorf("%v (merge --abort also failed: %v)", err, aerr)
+		}
+	}
+	return conflicts, err
+}
+
+// DiffPatch returns a diffstat followed by the patch of the changes on headRef
+// since it diverged from baseRef.
+func DiffPatch(dir, baseRef, headRef string) (string, error) {
+	out, _, err := runGit(dir, "diff", "--stat", "--patch", baseRef+"..."+headRef)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// TreeSHA returns the tree object ref points at.
+func TreeSHA(dir, ref string) (string, error) {
+	out, _, err := runGit(dir, "rev-parse", ref+"^{tree}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// BinaryDiff returns a patch from baseRef to headRef that git apply can
+// replay, binary files included.
+func BinaryDiff(dir, baseRef, headRef string) (string, error) {
+	out, _, err := runGit(dir, "diff", "--binary", "--full-index", baseRef, headRef)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// ApplyPatch applies the patch file at patchPath to the worktree.
+func ApplyPatch(worktreeDir, patchPath string) error {
+	_, _, err := runGit(worktreeDir, "apply", "--binary", "--whitespace=nowarn", patchPath)
+	return err
+}
+
+func isMissingIdentity(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "Author identity unknown") ||
+		strings.Contains(msg, "Committer identity unknown") ||
+		strings.Contains(msg, "Please tell me who you are") ||
+		strings.Contains(msg, "unable to auto-detect email address")
+}
+
+func listLines(dir string, args ...string) ([]string, error) {
+	out, _, err := runGit(dir, args...)
 	if err != nil {
 		return nil, err
 	}
-	var files []string
+	var lines []string
 	for _, line := range strings.Split(out, "\n") {
 		if trimmed := strings.TrimSpace(line); trimmed != "" {
-			files = append(files, trimmed)
+			lines = append(lines, trimmed)
 		}
 	}
-	return files, nil
+	return lines, nil
+}
+
+// DiffNameOnly returns file paths changed between baseRef and HEAD in the given directory.
+func DiffNameOnly(dir, baseRef string) ([]string, error) {
+	return listLines(dir, "diff", "--name-only", baseRef)
 }
 
 func ensureUserIdentity(worktreeDir string) error {
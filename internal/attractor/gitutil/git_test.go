@@ -4,6 +4,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -89,3 +90,117 @@ func TestDiffNameOnly_NoChanges(t *testing.T) {
 		t.Errorf("DiffNameOnly with no changes = %v, want []", files)
 	}
 }
+
+func commitFile(t *testing.T, dir, name, content, msg string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CommitAllowEmpty(dir, msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeNoFF_MergesDivergentBranches(t *testing.T) {
+	dir := initTestRepo(t)
+	base, _ := HeadSHA(dir)
+	if err := CreateBranchAt(dir, "other", base); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "a.txt", "a", "add a")
+	if err := CheckoutBranch(dir, "other"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "b.txt", "b", "add b")
+	if err := CheckoutBranch(dir, "main"); err != nil {
+		t.Fatal(err)
+	}
+
+	conflicts, err := MergeNoFF(dir, "other", "merge other")
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("MergeNoFF: conflicts=%v err=%v", conflicts, err)
+	}
+	for _, f := range []string{"a.txt", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatalf("expected %s after merge: %v", f, err)
+		}
+	}
+	patch, err := DiffPatch(dir, base, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(patch, "+++ b/a.txt") || !strings.Contains(patch, "+++ b/b.txt") {
+		t.Fatalf("DiffPatch missing files:\n%s", patch)
+	}
+}
+
+func TestMergeNoFF_ConflictAbortsAndReportsPaths(t *testing.T) {
+	dir := initTestRepo(t)
+	base, _ := HeadSHA(dir)
+	if err := CreateBranchAt(dir, "other", base); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "initial.txt", "ours", "edit ours")
+	if err := CheckoutBranch(dir, "other"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "initial.txt", "theirs", "edit theirs")
+	if err := CheckoutBranch(dir, "main"); err != nil {
+		t.Fatal(err)
+	}
+	head, _ := HeadSHA(dir)
+
+	conflicts, err := MergeNoFF(dir, "other", "merge other")
+	if err == nil {
+		t.Fatal("expected a merge conflict")
+	}
+	if len(conflicts) != 1 || conflicts[0] != "initial.txt" {
+		t.Fatalf("conflicts = %v, want [initial.txt]", conflicts)
+	}
+	if after, _ := HeadSHA(dir); after != head {
+		t.Fatalf("HEAD moved after aborted merge: %s -> %s", head, after)
+	}
+	if clean, err := IsClean(dir); err != nil || !clean {
+		t.Fatalf("expected clean worktree after abort (clean=%v err=%v)", clean, err)
+	}
+}
+
+func TestBinaryDiff_ApplyPatchReplaysCommit(t *testing.T) {
+	dir := initTestRepo(t)
+	base, _ := HeadSHA(dir)
+	baseTree, err := TreeSHA(dir, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "a.txt", "a", "add a")
+	head, _ := HeadSHA(dir)
+	headTree, _ := TreeSHA(dir, head)
+
+	patch, err := BinaryDiff(dir, base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patchPath := filepath.Join(t.TempDir(), "change.patch")
+	if err := os.WriteFile(patchPath, []byte(patch), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResetHard(dir, base); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := TreeSHA(dir, "HEAD"); got != baseTree {
+		t.Fatalf("tree after reset: got %s want %s", got, baseTree)
+	}
+	if err := ApplyPatch(dir, patchPath); err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	if err := AddAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	sha, err := CommitAllowEmpty(dir, "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := TreeSHA(dir, sha); got != headTree {
+		t.Fatalf("replayed tree: got %s want %s", got, headTree)
+	}
+}
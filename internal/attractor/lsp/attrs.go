@@ -0,0 +1,175 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// scope says which DOT statements an attribute belongs to.
+type scope uint8
+
+const (
+	scopeGraph scope = 1 << iota
+	scopeNode
+	scopeEdge
+)
+
+func (s scope) String() string {
+	var parts []string
+	if s&scopeGraph != 0 {
+		parts = append(parts, "graph")
+	}
+	if s&scopeNode != 0 {
+		parts = append(parts, "node")
+	}
+	if s&scopeEdge != 0 {
+		parts = append(parts, "edge")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// attrDoc documents one attribute for completion and hover. Values lists the
+// accepted values of enumerated attributes.
+type attrDoc struct {
+	Name   string
+	Scope  scope
+	Type   string
+	Doc    string
+	Values []string
+}
+
+var boolValues = []string{"true", "false"}
+
+var fidelityValues = []string{"full", "truncate", "compact", "summary:low", "summary:medium", "summary:high"}
+
+// shapeTypes is the shape-to-handler mapping of spec §2.8.
+var shapeTypes = map[string]string{
+	"Mdiamond":      "start",
+	"circle":        "start",
+	"Msquare":       "exit",
+	"doublecircle":  "exit",
+	"box":           "codergen",
+	"hexagon":       "wait.human",
+	"diamond":       "conditional",
+	"component":     "parallel",
+	"tripleoctagon": "parallel.fan_in",
+	"parallelogram": "tool",
+	"house":         "stack.manager_loop",
+}
+
+var attrDocs = []attrDoc{
+	// Graph attributes (spec §2.5 plus engine extensions).
+	{Name: "goal", Scope: scopeGraph, Type: "string", Doc: "Human-readable goal for the pipeline. Exposed as `$goal` in prompts and as `graph.goal` in the run context."},
+	{Name: "params", Scope: scopeGraph, Type: "string", Doc: "Declared pipeline parameters, `;`-separated `name[:type][!][=default]` entries (`!` = required). Supplied with `attractor run --param name=value` and expanded as `$param.name`."},
+	{Name: "model_stylesheet", Scope: scopeGraph, Type: "string", Doc: "CSS-like stylesheet that sets `llm_provider`, `llm_model` and `reasoning_effort` defaults by `*`, shape, `.class` or `#id`."},
+	{Name: "cache", Scope: scopeGraph | scopeNode, Type: "boolean", Doc: "Memoize LLM stages: replay the outcome and diff an earlier run recorded for the same attributes, prompt as sent (context preamble included) and worktree tree instead of calling the model. On the graph it applies to every node.", Values: boolValues},
+	{Name: "default_max_retry", Scope: scopeGraph, Type: "integer", Doc: "Retry ceiling for nodes that omit `max_retries`. Default 3."},
+	{Name: "default_fidelity", Scope: scopeGraph, Type: "string", Doc: "Default context fidelity mode for LLM stages.", Values: fidelityValues},
+	{Name: "max_restarts", Scope: scopeGraph, Type: "integer", Doc: "Upper bound on `loop_restart` cycles before the run fails."},
+	{Name: "max_node_visits", Scope: scopeGraph, Type: "integer", Doc: "Upper bound on executions of any single node within one run, guarding against unbounded loops."},
+	{Name: "loop_restart_signature_limit", Scope: scopeGraph, Type: "integer", Doc: "Number of identical deterministic failure signatures tolerated before the run stops restarting."},
+	{Name: "loop_restart_persist_keys", Scope: scopeGraph, Type: "string", Doc: "Comma-separated context keys carried across `loop_restart` into the fresh run."},
+	{Name: "retries_before_escalation", Scope: scopeGraph, Type: "integer", Doc: "Failed attempts on one model before codergen moves to the next `escalation_models` entry."},
+	{Name: "default_command_timeout_ms", Scope: scopeGraph, Type: "integer", Doc: "Default timeout for agent shell commands, in milliseconds."},
+	{Name: "max_command_timeout_ms", Scope: scopeGraph, Type: "integer", Doc: "Upper bound on agent shell command timeouts, in milliseconds."},
+	{Name: "context_compaction_threshold", Scope: scopeGraph | scopeNode, Type: "integer", Doc: "Percent of the context window at which agent history is compacted. Default 70."},
+	{Name: "context_compaction_keep_turns", Scope: scopeGraph | scopeNode, Type: "integer", Doc: "Most recent agent turns kept verbatim when history is compacted. Default 20."},
+	{Name: "retry.backoff.initial_delay_ms", Scope: scopeGraph, Type: "integer", Doc: "First retry delay, in milliseconds."},
+	{Name: "retry.backoff.backoff_factor", Scope: scopeGraph, Type: "number", Doc: "Multiplier applied to the retry delay after each attempt."},
+	{Name: "retry.backoff.max_delay_ms", Scope: scopeGraph, Type: "integer", Doc: "Upper bound on the retry delay, in milliseconds."},
+	{Name: "retry.backoff.jitter", Scope: scopeGraph, Type: "boolean", Doc: "Randomize retry delays.", Values: boolValues},
+	{Name: "provenance_version", Scope: scopeGraph, Type: "string", Doc: "Template provenance marker. Enables template-policy lint rules."},
+	{Name: "rankdir", Scope: scopeGraph, Type: "string", Doc: "Graphviz layout direction. Ignored by the engine.", Values: []string{"TB", "LR", "BT", "RL"}},
+
+	// Node attributes (spec §2.6 plus engine extensions).
+	{Name: "label", Scope: scopeGraph | scopeNode | scopeEdge, Type: "string", Doc: "Display name. On edges it is also the routing key matched against an outcome's preferred label."},
+	{Name: "shape", Scope: scopeNode, Type: "string", Doc: "Graphviz shape. Selects the handler unless `type` is set: Mdiamond=start, Msquare=exit, box=codergen, hexagon=wait.human, diamond=conditional, component=parallel, tripleoctagon=parallel.fan_in, parallelogram=tool, house=stack.manager_loop.", Values: []string{"Mdiamond", "Msquare", "box", "hexagon", "diamond", "component", "tripleoctagon", "parallelogram", "house", "circle", "doublecircle"}},
+	{Name: "type", Scope: scopeNode, Type: "string", Doc: "Explicit handler type. Takes precedence over the shape mapping."},
+	{Name: "prompt", Scope: scopeNode, Type: "string", Doc: "Primary instruction for the stage. Supports `$goal` expansion; falls back to `label` for LLM stages."},
+	{Name: "llm_prompt", Scope: scopeNode, Type: "string", Doc: "Alias for `prompt`."},
+	{Name: "prompt_file", Scope: scopeNode, Type: "string", Doc: "Path, relative to the repository, whose contents become the prompt. Conflicts with `prompt`. A `.tmpl` file is rendered as a prompt template."},
+	{Name: "prompt_template", Scope: scopeNode, Type: "boolean", Doc: "Render the prompt with Go `text/template` before the stage runs, with `.Context`, `.Stages.<node_id>` (status.json fields and `.Response`) and the `file`, `exists`, `truncate` and `json` helpers.", Values: boolValues},
+	{Name: "max_retries", Scope: scopeNode, Type: "integer", Doc: "Additional attempts beyond the first execution. `max_retries=3` allows up to 4 executions."},
+	{Name: "goal_gate", Scope: scopeNode, Type: "boolean", Doc: "The node must reach SUCCESS before the pipeline may exit.", Values: boolValues},
+	{Name: "retry_target", Scope: scopeGraph | scopeNode, Type: "node ID", Doc: "Node to jump to when this node fails with retries exhausted, or (on the graph) when exit is reached with unsatisfied goal gates."},
+	{Name: "fallback_retry_target", Scope: scopeGraph | scopeNode, Type: "node ID", Doc: "Secondary jump target used when `retry_target` is missing or invalid."},
+	{Name: "fidelity", Scope: scopeNode | scopeEdge, Type: "string", Doc: "Context fidelity mode for the stage's LLM session. On an edge it overrides the target node.", Values: fidelityValues},
+	{Name: "thread_id", Scope: scopeNode | scopeEdge, Type: "string", Doc: "Thread identifier for LLM session reuse under `full` fidelity."},
+	{Name: "class", Scope: scopeNode, Type: "string", Doc: "Comma-separated class names targeted by `.class` stylesheet selectors."},
+	{Name: "timeout", Scope: scopeNode, Type: "duration", Doc: "Maximum execution time for the node, e.g. `30m`."},
+	{Name: "llm_model", Scope: scopeNode, Type: "string", Doc: "Model identifier. Overridable by the stylesheet."},
+	{Name: "llm_provider", Scope: scopeNode, Type: "string", Doc: "Provider key for the node's model."},
+	{Name: "reasoning_effort", Scope: scopeNode, Type: "string", Doc: "LLM reasoning effort. Default high.", Values: []string{"low", "medium", "high"}},
+	{Name: "auto_status", Scope: scopeNode, Type: "boolean", Doc: "Treat a stage that writes no status as SUCCESS.", Values: boolValues},
+	{Name: "allow_partial", Scope: scopeNode, Type: "boolean", Doc: "Accept PARTIAL_SUCCESS instead of failing when retries are exhausted.", Values: boolValues},
+	{Name: "codergen_mode", Scope: scopeNode, Type: "string", Doc: "How the API backend drives the model: a tool-using agent loop or a single completion.", Values: []string{"agent_loop", "one_shot"}},
+	{Name: "max_tokens", Scope: scopeNode, Type: "integer", Doc: "Output token limit per LLM call. Default 32768."},
+	{Name: "max_agent_turns", Scope: scopeNode, Type: "integer", Doc: "Turn budget for the agent loop of one attempt."},
+	{Name: "max_cost_usd", Scope: scopeNode, Type: "number", Doc: "Cost budget, in US dollars, for one attempt of the node."},
+	{Name: "context_compaction", Scope: scopeGraph | scopeNode, Type: "string", Doc: "How agent history is shrunk when it nears the context window.", Values: []string{"off", "elide", "summarize"}},
+	{Name: "escalation_models", Scope: scopeNode, Type: "string", Doc: "Comma-separated `provider:model` list tried in order after repeated failures."},
+	{Name: "mcp_servers", Scope: scopeNode, Type: "string", Doc: "Comma-separated MCP servers whose tools the stage may call, or `none`."},
+	{Name: "tool_command", Scope: scopeNode, Type: "string", Doc: "Shell command run by tool (parallelogram) nodes."},
+	{Name: "tool_hooks.pre", Scope: scopeGraph | scopeNode, Type: "string", Doc: "Shell command run before each agent tool call. A non-zero exit blocks the call."},
+	{Name: "tool_hooks.post", Scope: scopeGraph | scopeNode, Type: "string", Doc: "Shell command run after each agent tool call."},
+	{Name: "question", Scope: scopeNode, Type: "string", Doc: "Question shown to the human at a wait.human node. Defaults to the label."},
+	{Name: "human.default_choice", Scope: scopeNode, Type: "string", Doc: "Edge target selected when a wait.human gate times out."},
+	{Name: "join_policy", Scope: scopeNode, Type: "string", Doc: "When a parallel node's branches count as done: `wait_all` (default), `first_success`, `k_of_n` (needs `k`) or `quorum` (needs `quorum_fraction`).", Values: []string{"wait_all", "first_success", "k_of_n", "quorum"}},
+	{Name: "error_policy", Scope: scopeNode, Type: "string", Doc: "How a parallel node treats failing branches: `continue` (default), `fail_fast` cancels the rest, `ignore` drops them from the join.", Values: []string{"continue", "fail_fast", "ignore"}},
+	{Name: "k", Scope: scopeNode, Type: "integer", Doc: "Successful branches required by `join_policy=k_of_n`."},
+	{Name: "quorum_fraction", Scope: scopeNode, Type: "number", Doc: "Fraction of branches, 0-1, that must succeed under `join_policy=quorum`. Default 0.5."},
+	{Name: "max_parallel", Scope: scopeNode, Type: "integer", Doc: "Branches a parallel node runs at once. Default 4."},
+	{Name: "foreach_key", Scope: scopeNode, Type: "string", Doc: "Context key holding the list a `type=parallel.foreach` node fans out over, one branch per item."},
+	{Name: "fan_in_strategy", Scope: scopeNode, Type: "string", Doc: "How a fan-in node picks the winning branch: `heuristic` (default), `llm`, `command` (runs `fan_in_command`) or `merge`.", Values: []string{"heuristic", "llm", "command", "merge"}},
+	{Name: "fan_in_command", Scope: scopeNode, Type: "string", Doc: "Scoring command for `fan_in_strategy=command`, run in each branch worktree."},
+	{Name: "fan_in_command_timeout", Scope: scopeNode, Type: "duration", Doc: "Per-branch timeout for `fan_in_command`. Default 10m."},
+	{Name: "stack.child_dotfile", Scope: scopeGraph | scopeNode, Type: "string", Doc: "Child pipeline supervised by a stack.manager_loop node, relative to the worktree."},
+	{Name: "stack.call_dotfile", Scope: scopeNode, Type: "string", Doc: "Pipeline a `type=stack.call` node runs inline on the run branch, relative to the repository."},
+	{Name: "stack.call_inputs", Scope: scopeNode, Type: "string", Doc: "Comma-separated `child_key=parent_key` context keys copied into the called graph. A bare key keeps its name."},
+	{Name: "stack.call_outputs", Scope: scopeNode, Type: "string", Doc: "Comma-separated `parent_key=child_key` context keys copied back when the called graph finishes."},
+	{Name: "stack.child_autostart", Scope: scopeNode, Type: "boolean", Doc: "Start the child pipeline when the manager loop begins. Default true.", Values: boolValues},
+	{Name: "manager.poll_interval", Scope: scopeNode, Type: "duration", Doc: "Time between manager observation cycles. Default 45s."},
+	{Name: "manager.max_cycles", Scope: scopeNode, Type: "integer", Doc: "Observation cycles before the manager loop fails. Default 1000."},
+	{Name: "manager.stop_condition", Scope: scopeNode, Type: "condition", Doc: "Condition evaluated each cycle; when true the manager succeeds and cancels the child."},
+	{Name: "manager.actions", Scope: scopeNode, Type: "string", Doc: "Comma-separated actions per cycle: `observe`, `wait`, `steer`. Default observe,wait."},
+	{Name: "manager.steer_condition", Scope: scopeNode, Type: "condition", Doc: "Condition on the child context that triggers `manager.steer_message`."},
+	{Name: "manager.steer_message", Scope: scopeNode, Type: "string", Doc: "Guidance sent to the child when `manager.steer_condition` becomes true."},
+	{Name: "manager.steer_prompt", Scope: scopeNode, Type: "string", Doc: "Supervisor instructions for LLM-driven steering."},
+	{Name: "manager.steer_cooldown", Scope: scopeNode, Type: "duration", Doc: "Minimum time between steers. Default 5m."},
+
+	// Edge attributes (spec §2.7).
+	{Name: "condition", Scope: scopeEdge, Type: "condition", Doc: "Guard evaluated against the outcome and context, e.g. `outcome=success && context.tests=pass`."},
+	{Name: "weight", Scope: scopeEdge, Type: "integer", Doc: "Priority among equally eligible edges; higher wins."},
+	{Name: "loop_restart", Scope: scopeEdge, Type: "boolean", Doc: "Restart the run with a fresh log directory when this edge is taken.", Values: boolValues},
+}
+
+var attrIndex = func() map[string]*attrDoc {
+	m := make(map[string]*attrDoc, len(attrDocs))
+	for i := range attrDocs {
+		m[attrDocs[i].Name] = &attrDocs[i]
+	}
+	return m
+}()
+
+// attrsFor returns the documented attributes of the given scope, sorted by name.
+func attrsFor(s scope) []*attrDoc {
+	var out []*attrDoc
+	for i := range attrDocs {
+		if attrDocs[i].Scope&s != 0 {
+			out = append(out, &attrDocs[i])
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// markdown renders the hover text for an attribute.
+func (a *attrDoc) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** (%s attribute, %s)\n\n%s", a.Name, a.Scope, a.Type, a.Doc)
+	if len(a.Values) > 0 && a.Name != "shape" {
+		b.WriteString("\n\nValues: `" + strings.Join(a.Values, "`, `") + "`")
+	}
+	return b.String()
+}
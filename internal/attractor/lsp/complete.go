@@ -0,0 +1,389 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/providerspec"
+)
+
+type cursorKind int
+
+const (
+	cursorNone cursorKind = iota
+	cursorAttrKey
+	cursorAttrValue
+	cursorEdgeTarget
+)
+
+// cursor describes what is being typed at an offset: an attribute key or
+// value (of a [...] block, or a top-level graph "key = value"), or the target
+// of an edge. The text is scanned directly rather than parsed, because it is
+// usually incomplete while the user types.
+type cursor struct {
+	kind  cursorKind
+	scope scope
+	// key is the attribute whose value is being typed.
+	key string
+	// prefix is the text typed so far, starting at offset start.
+	prefix string
+	start  int
+	// present holds the attributes already set earlier in the same block.
+	present map[string]string
+}
+
+// scanCursor classifies offset within text.
+func scanCursor(text string, offset int) cursor {
+	stmtStart, blockStart, segStart := 0, -1, -1
+	present := map[string]string{}
+	inString := false
+	for i := 0; i < offset; i++ {
+		c := text[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(text) && text[i+1] == '/', c == '#' && lineStartsAt(text, i):
+			nl := strings.IndexByte(text[i:], '\n')
+			if nl < 0 || i+nl >= offset {
+				return cursor{}
+			}
+			i += nl - 1
+		case c == '/' && i+1 < len(text) && text[i+1] == '*':
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 || i+2+end+2 > offset {
+				return cursor{}
+			}
+			i += 2 + end + 1
+		case c == '[' && blockStart < 0:
+			blockStart, segStart = i, i+1
+			clear(present)
+		case c == ',' && blockStart >= 0:
+			if key, val, ok := splitAttr(text[segStart:i]); ok {
+				present[key] = val
+			}
+			segStart = i + 1
+		case c == ']' && blockStart >= 0:
+			blockStart = -1
+			stmtStart = i + 1
+		case blockStart < 0 && (c == ';' || c == '{' || c == '}' || c == '\n'):
+			stmtStart = i + 1
+		}
+	}
+	if inString && blockStart < 0 && !strings.Contains(text[stmtStart:offset], "=") {
+		return cursor{}
+	}
+
+	if blockStart >= 0 {
+		cur := cursor{scope: statementScope(text[stmtStart:blockStart]), present: present}
+		seg := text[segStart:offset]
+		if eq := strings.IndexByte(seg, '='); eq >= 0 {
+			cur.kind = cursorAttrValue
+			cur.key = strings.TrimSpace(seg[:eq])
+			cur.start = valueStart(text, segStart+eq+1, offset)
+		} else {
+			cur.kind = cursorAttrKey
+			cur.start = segStart + len(seg) - len(strings.TrimLeft(seg, " \t\r\n"))
+		}
+		cur.prefix = text[cur.start:offset]
+		return cur
+	}
+
+	stmt := text[stmtStart:offset]
+	if eq := strings.IndexByte(stmt, '='); eq >= 0 {
+		cur := cursor{kind: cursorAttrValue, scope: scopeGraph, key: strings.TrimSpace(stmt[:eq])}
+		cur.start = valueStart(text, stmtStart+eq+1, offset)
+		cur.prefix = text[cur.start:offset]
+		return cur
+	}
+	start := offset
+	for start > stmtStart && isIdentByte(text[start-1]) {
+		start--
+	}
+	if strings.HasSuffix(strings.TrimRight(text[stmtStart:start], " \t"), "->") {
+		return cursor{kind: cursorEdgeTarget, prefix: text[start:offset], start: start}
+	}
+	return cursor{}
+}
+
+// valueStart skips the blanks and opening quote before an attribute value.
+func valueStart(text string, i, offset int) int {
+	for i < offset && (text[i] == ' ' || text[i] == '\t') {
+		i++
+	}
+	if i < offset && text[i] == '"' {
+		i++
+	}
+	return i
+}
+
+// splitAttr splits a complete "key=value" segment of an attribute block.
+func splitAttr(seg string) (key, val string, ok bool) {
+	k, v, ok := strings.Cut(seg, "=")
+	if !ok {
+		return "", "", false
+	}
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		v = v[1 : len(v)-1]
+	}
+	return strings.TrimSpace(k), v, true
+}
+
+// statementScope says which attributes apply to the [...] block following
+// stmt: graph/node/edge defaults, an edge statement, or a node statement.
+func statementScope(stmt string) scope {
+	stmt = strings.TrimSpace(stmt)
+	switch {
+	case stmt == "graph":
+		return scopeGraph
+	case stmt == "node":
+		return scopeNode
+	case stmt == "edge", strings.Contains(stmt, "->"):
+		return scopeEdge
+	default:
+		return scopeNode
+	}
+}
+
+func lineStartsAt(text string, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		switch text[j] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// complete returns the completion items at offset.
+func (s *Server) complete(doc *document, offset int) completionList {
+	cur := scanCursor(doc.text, offset)
+	edit := func(label string) *textEdit {
+		return &textEdit{Range: rangeAt(doc.text, cur.start, offset), NewText: label}
+	}
+	items := []completionItem{}
+	add := func(label string, kind int, detail, docs string) {
+		if !hasPrefixFold(label, cur.prefix) {
+			return
+		}
+		it := completionItem{Label: label, Kind: kind, Detail: detail, TextEdit: edit(label)}
+		if docs != "" {
+			it.Documentation = &markupContent{Kind: "markdown", Value: docs}
+		}
+		items = append(items, it)
+	}
+
+	switch cur.kind {
+	case cursorAttrKey:
+		for _, a := range attrsFor(cur.scope) {
+			if _, ok := cur.present[a.Name]; ok {
+				continue
+			}
+			add(a.Name, completionKindProperty, a.Type, a.markdown())
+		}
+	case cursorAttrValue:
+		switch cur.key {
+		case "type":
+			for _, t := range s.knownTypes {
+				add(t, completionKindEnum, "handler type", "")
+			}
+		case "llm_provider":
+			for _, p := range s.providers {
+				add(p, completionKindEnum, "provider", "")
+			}
+		case "llm_model":
+			for _, m := range s.modelIDs(cur.present["llm_provider"]) {
+				add(m.id, completionKindValue, m.provider, "")
+			}
+		case "retry_target", "fallback_retry_target":
+			for _, id := range nodeIDs(doc.graph) {
+				add(id, completionKindValue, "node", "")
+			}
+		default:
+			if a := attrIndex[cur.key]; a != nil {
+				for _, v := range a.Values {
+					detail := ""
+					if a.Name == "shape" {
+						detail = shapeTypes[v]
+					}
+					add(v, completionKindEnum, detail, "")
+				}
+			}
+		}
+	case cursorEdgeTarget:
+		for _, id := range nodeIDs(doc.graph) {
+			add(id, completionKindValue, nodeDetail(doc.graph.Nodes[id]), "")
+		}
+	}
+	return completionList{Items: items}
+}
+
+type modelID struct {
+	id       string
+	provider string
+}
+
+// modelIDs lists catalog models as llm_model values, which are relative to
+// the provider. When provider is set only its models are listed.
+func (s *Server) modelIDs(provider string) []modelID {
+	if s.catalog == nil {
+		return nil
+	}
+	want := providerspec.CanonicalProviderKey(provider)
+	var out []modelID
+	for key, entry := range s.catalog.Models {
+		p := providerspec.CanonicalProviderKey(entry.Provider)
+		if want != "" && p != want {
+			continue
+		}
+		id := key
+		if i := strings.IndexByte(key, '/'); i >= 0 {
+			id = key[i+1:]
+		}
+		out = append(out, modelID{id: id, provider: p})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].id != out[j].id {
+			return out[i].id < out[j].id
+		}
+		return out[i].provider < out[j].provider
+	})
+	return out
+}
+
+func nodeIDs(g *model.Graph) []string {
+	if g == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// nodeDetail is the one-line summary of a node: its handler type and label.
+func nodeDetail(n *model.Node) string {
+	if n == nil {
+		return ""
+	}
+	typ := n.TypeOverride()
+	if typ == "" {
+		typ = shapeTypes[n.Shape()]
+	}
+	if typ == "" {
+		typ = "codergen"
+	}
+	if label := n.Attr("label", ""); label != "" && label != n.ID {
+		return fmt.Sprintf("%s: %s", typ, label)
+	}
+	return typ
+}
+
+// wordAt returns the identifier around offset.
+func wordAt(text string, offset int) (start, end int) {
+	start, end = offset, offset
+	for start > 0 && isIdentByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isIdentByte(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+// followedByEquals reports whether the text after i, skipping blanks, is "=".
+func followedByEquals(text string, i int) bool {
+	rest := strings.TrimLeft(text[i:], " \t")
+	return strings.HasPrefix(rest, "=")
+}
+
+// hover documents the attribute name or value at offset, or summarizes the
+// node whose ID is there.
+func (s *Server) hover(doc *document, offset int) *hover {
+	start, end := wordAt(doc.text, offset)
+	if start == end {
+		return nil
+	}
+	word := doc.text[start:end]
+	cur := scanCursor(doc.text, start)
+	rng := rangeAt(doc.text, start, end)
+	text := ""
+	switch {
+	case (cur.kind == cursorAttrKey || cur.kind == cursorNone) && followedByEquals(doc.text, end):
+		if a := attrIndex[word]; a != nil {
+			text = a.markdown()
+		}
+	case cur.kind == cursorAttrValue:
+		if cur.key == "shape" && shapeTypes[word] != "" {
+			text = fmt.Sprintf("**%s**: `%s` handler", word, shapeTypes[word])
+		} else if n := s.nodeAt(doc, cur, word); n != nil {
+			text = nodeHover(n)
+		} else if a := attrIndex[cur.key]; a != nil {
+			text = a.markdown()
+		}
+	default:
+		if doc.graph != nil && doc.graph.Nodes[word] != nil {
+			text = nodeHover(doc.graph.Nodes[word])
+		}
+	}
+	if text == "" {
+		return nil
+	}
+	return &hover{Contents: markupContent{Kind: "markdown", Value: text}, Range: &rng}
+}
+
+func nodeHover(n *model.Node) string {
+	return fmt.Sprintf("**%s** (%s)", n.ID, nodeDetail(n))
+}
+
+// nodeAt returns the node a retry target value names.
+func (s *Server) nodeAt(doc *document, cur cursor, word string) *model.Node {
+	if doc.graph == nil || (cur.key != "retry_target" && cur.key != "fallback_retry_target") {
+		return nil
+	}
+	return doc.graph.Nodes[word]
+}
+
+// definition locates the declaration of the node named at offset: an edge
+// endpoint or a retry_target/fallback_retry_target value.
+func (s *Server) definition(doc *document, offset int) *location {
+	start, end := wordAt(doc.text, offset)
+	if start == end || doc.graph == nil {
+		return nil
+	}
+	word := doc.text[start:end]
+	cur := scanCursor(doc.text, start)
+	var n *model.Node
+	switch cur.kind {
+	case cursorAttrValue:
+		n = s.nodeAt(doc, cur, word)
+	case cursorAttrKey:
+	default:
+		if !followedByEquals(doc.text, end) {
+			n = doc.graph.Nodes[word]
+		}
+	}
+	if n == nil {
+		return nil
+	}
+	return spanLocation(doc, n.Span)
+}
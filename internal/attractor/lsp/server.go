@@ -0,0 +1,284 @@
+// Package lsp implements a Language Server Protocol server for Attractor DOT
+// pipelines. It publishes validation diagnostics as documents change and
+// offers attribute completion, hover documentation and go-to-definition for
+// node references.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+	"github.com/danshapiro/kilroy/internal/providerspec"
+)
+
+// ErrExitWithoutShutdown is returned by Serve when the client sends exit
+// without a preceding shutdown request.
+var ErrExitWithoutShutdown = errors.New("lsp: exit before shutdown")
+
+// Server is a single-client language server. It is not safe for concurrent
+// use; Serve processes messages one at a time.
+type Server struct {
+	catalog    *modeldb.Catalog
+	knownTypes []string
+	providers  []string
+
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+// document is an open text document. graph is the last version that parsed,
+// kept so navigation keeps working while the text is mid-edit.
+type document struct {
+	uri     string
+	version int
+	text    string
+	graph   *model.Graph
+}
+
+// NewServer returns a server that validates against catalog, which may be nil
+// to skip model catalog checks and model completion.
+func NewServer(catalog *modeldb.Catalog) *Server {
+	providers := make([]string, 0, len(providerspec.Builtins()))
+	for key := range providerspec.Builtins() {
+		providers = append(providers, key)
+	}
+	sort.Strings(providers)
+	return &Server{
+		catalog:    catalog,
+		knownTypes: engine.NewDefaultRegistry().KnownTypes(),
+		providers:  providers,
+		docs:       map[string]*document{},
+	}
+}
+
+// Serve reads requests from in and writes responses and notifications to out
+// until the client sends exit, in is closed, or ctx is done.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = out
+	r := bufio.NewReader(in)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		body, err := readMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if werr := s.replyError(json.RawMessage("null"), codeParseError, err.Error()); werr != nil {
+				return werr
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+		result, rerr, err := s.handle(msg)
+		if err != nil {
+			return err
+		}
+		if msg.ID == nil {
+			// Notifications get no response, not even an error.
+			continue
+		}
+		if rerr != nil {
+			err = s.replyError(*msg.ID, rerr.Code, rerr.Message)
+		} else {
+			err = writeMessage(s.out, resultResponse{JSONRPC: "2.0", ID: *msg.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) replyError(id json.RawMessage, code int, msg string) error {
+	return writeMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: &responseError{Code: code, Message: msg}})
+}
+
+func (s *Server) notify(method string, params any) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle dispatches one message. The returned error is a failure to write to
+// the client and ends the session; protocol errors go in the responseError.
+func (s *Server) handle(msg message) (any, *responseError, error) {
+	decode := func(v any) *responseError {
+		if err := json.Unmarshal(msg.Params, v); err != nil {
+			return &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+	if s.shutdown && msg.ID != nil {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}, nil
+	}
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": 1, // full document sync
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"[", ",", "=", ">", " "},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "kilroy-attractor"},
+		}, nil, nil
+	case "initialized", "$/setTrace", "$/cancelRequest", "workspace/didChangeConfiguration":
+		return nil, nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := decode(&p); err != nil {
+			return nil, err, nil
+		}
+		doc := &document{uri: p.TextDocument.URI, version: p.TextDocument.Version, text: p.TextDocument.Text}
+		s.docs[doc.uri] = doc
+		return nil, nil, s.publish(doc)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := decode(&p); err != nil {
+			return nil, err, nil
+		}
+		doc := s.docs[p.TextDocument.URI]
+		if doc == nil {
+			return nil, nil, nil
+		}
+		for _, ch := range p.ContentChanges {
+			if ch.Range == nil {
+				doc.text = ch.Text
+				continue
+			}
+			start, end := offsetAt(doc.text, ch.Range.Start), offsetAt(doc.text, ch.Range.End)
+			if end < start {
+				start, end = end, start
+			}
+			doc.text = doc.text[:start] + ch.Text + doc.text[end:]
+		}
+		doc.version = p.TextDocument.Version
+		return nil, nil, s.publish(doc)
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := decode(&p); err != nil {
+			return nil, err, nil
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, nil, s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+	case "textDocument/didSave":
+		return nil, nil, nil
+
+	case "textDocument/completion", "textDocument/hover", "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := decode(&p); err != nil {
+			return nil, err, nil
+		}
+		doc := s.docs[p.TextDocument.URI]
+		if doc == nil {
+			return nil, nil, nil
+		}
+		offset := offsetAt(doc.text, p.Position)
+		switch msg.Method {
+		case "textDocument/completion":
+			return s.complete(doc, offset), nil, nil
+		case "textDocument/hover":
+			if h := s.hover(doc, offset); h != nil {
+				return h, nil, nil
+			}
+			return nil, nil, nil
+		default:
+			if loc := s.definition(doc, offset); loc != nil {
+				return loc, nil, nil
+			}
+			return nil, nil, nil
+		}
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not supported: %s", msg.Method)}, nil
+}
+
+// publish validates doc and sends its diagnostics.
+func (s *Server) publish(doc *document) error {
+	diags := s.validate(doc)
+	out := make([]diagnostic, 0, len(diags))
+	for _, d := range diags {
+		out = append(out, toLSPDiagnostic(doc.text, d))
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: doc.uri, Version: doc.version, Diagnostics: out})
+}
+
+// validate runs the same preparation as `attractor validate` and remembers
+// the graph when the text parses.
+func (s *Server) validate(doc *document) []validate.Diagnostic {
+	g, diags, err := engine.PrepareWithOptions([]byte(doc.text), engine.PrepareOptions{
+		KnownTypes: s.knownTypes,
+		Catalog:    s.catalog,
+	})
+	if g != nil {
+		doc.graph = g
+	}
+	if err != nil && len(diags) == 0 {
+		diags = []validate.Diagnostic{{Rule: "prepare", Severity: validate.SeverityError, Message: err.Error()}}
+	}
+	return diags
+}
+
+func toLSPDiagnostic(text string, d validate.Diagnostic) diagnostic {
+	out := diagnostic{Code: d.Rule, Source: "kilroy", Message: d.Message}
+	if d.Fix != "" {
+		out.Message += "\nfix: " + d.Fix
+	}
+	switch d.Severity {
+	case validate.SeverityError:
+		out.Severity = severityError
+	case validate.SeverityWarning:
+		out.Severity = severityWarning
+	default:
+		out.Severity = severityInformation
+	}
+	if d.Range != nil && d.Range.IsValid() {
+		end := d.Range.End.Offset
+		if !d.Range.End.IsValid() || end < d.Range.Start.Offset {
+			end = d.Range.Start.Offset
+		}
+		out.Range = rangeAt(text, d.Range.Start.Offset, end)
+	}
+	return out
+}
+
+func spanLocation(doc *document, sp model.Span) *location {
+	if !sp.IsValid() {
+		return nil
+	}
+	// Spans come from the last parsed version, which may be older than the
+	// text; clamp rather than point past the end.
+	start, end := min(sp.Start.Offset, len(doc.text)), min(sp.End.Offset, len(doc.text))
+	if end < start {
+		end = start
+	}
+	return &location{URI: doc.uri, Range: rangeAt(doc.text, start, end)}
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
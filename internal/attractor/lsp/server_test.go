@@ -0,0 +1,335 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+)
+
+const testURI = "file:///work/pipeline.dot"
+
+const testGraph = `digraph G {
+  graph [goal="ship"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  implement [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="implement"]
+  verify    [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="verify", goal_gate=true, retry_target=implement]
+  start -> implement -> verify -> exit
+}
+`
+
+// testClient drives a Server over an in-process pipe.
+type testClient struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+	// notes holds notifications received while waiting for responses.
+	notes []message
+}
+
+func startServer(t *testing.T) *testClient {
+	t.Helper()
+	cat, err := modeldb.LoadEmbeddedCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &testClient{t: t, in: inW, out: bufio.NewReader(outR), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(cat).Serve(context.Background(), inR, outW)
+		_ = outW.Close()
+		c.done <- err
+	}()
+	t.Cleanup(func() { _ = inW.Close() })
+	c.request("initialize", map[string]any{"capabilities": map[string]any{}})
+	c.notify("initialized", map[string]any{})
+	return c
+}
+
+func (c *testClient) send(v any) {
+	c.t.Helper()
+	if err := writeMessage(c.in, v); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+func (c *testClient) read() message {
+	c.t.Helper()
+	body, err := readMessage(c.out)
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	var m struct {
+		message
+		Result json.RawMessage `json:"result"`
+		Error  *responseError  `json:"error"`
+	}
+	if err := json.Unmarshal(body, &m); err != nil {
+		c.t.Fatalf("decode %s: %v", body, err)
+	}
+	if m.Error != nil {
+		c.t.Fatalf("error response: %+v", m.Error)
+	}
+	if m.ID != nil {
+		m.Params = m.Result
+	}
+	return m.message
+}
+
+func (c *testClient) notify(method string, params any) {
+	c.t.Helper()
+	c.send(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// request sends a request and returns its result, keeping notifications that
+// arrive first.
+func (c *testClient) request(method string, params any, result ...any) {
+	c.t.Helper()
+	c.nextID++
+	c.send(map[string]any{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	for {
+		m := c.read()
+		if m.ID == nil {
+			c.notes = append(c.notes, m)
+			continue
+		}
+		if len(result) > 0 {
+			if err := json.Unmarshal(m.Params, result[0]); err != nil {
+				c.t.Fatalf("%s result %s: %v", method, m.Params, err)
+			}
+		}
+		return
+	}
+}
+
+// diagnostics returns the next published diagnostics.
+func (c *testClient) diagnostics() publishDiagnosticsParams {
+	c.t.Helper()
+	var m message
+	if len(c.notes) > 0 {
+		m, c.notes = c.notes[0], c.notes[1:]
+	} else {
+		m = c.read()
+	}
+	if m.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %s", m.Method)
+	}
+	var p publishDiagnosticsParams
+	if err := json.Unmarshal(m.Params, &p); err != nil {
+		c.t.Fatal(err)
+	}
+	return p
+}
+
+func (c *testClient) open(text string) {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: testURI, LanguageID: "dot", Version: 1, Text: text}})
+}
+
+func (c *testClient) change(version int, text string) {
+	c.t.Helper()
+	c.notify("textDocument/didChange", didChangeParams{
+		TextDocument:   versionedTextDocumentIdentifier{URI: testURI, Version: version},
+		ContentChanges: []textDocumentContentChangeEvent{{Text: text}},
+	})
+}
+
+// at returns the position just after the first occurrence of marker.
+func at(t *testing.T, text, marker string) textDocumentPositionParams {
+	t.Helper()
+	i := strings.Index(text, marker)
+	if i < 0 {
+		t.Fatalf("marker %q not found", marker)
+	}
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: testURI}, Position: positionAt(text, i+len(marker))}
+}
+
+func findDiagnostic(p publishDiagnosticsParams, code string) *diagnostic {
+	for i := range p.Diagnostics {
+		if p.Diagnostics[i].Code == code {
+			return &p.Diagnostics[i]
+		}
+	}
+	return nil
+}
+
+func TestServer_PublishesDiagnosticsAsYouType(t *testing.T) {
+	c := startServer(t)
+	c.open(testGraph)
+	p := c.diagnostics()
+	if p.URI != testURI || p.Version != 1 {
+		t.Fatalf("open: %+v", p)
+	}
+	for _, d := range p.Diagnostics {
+		if d.Severity == severityError {
+			t.Fatalf("valid graph reported an error: %+v", d)
+		}
+	}
+
+	broken := strings.Replace(testGraph, "verify -> exit", "verify -> exitt", 1)
+	c.change(2, broken)
+	p = c.diagnostics()
+	d := findDiagnostic(p, "edge_target_exists")
+	if p.Version != 2 || d == nil || d.Severity != severityError {
+		t.Fatalf("expected an edge_target_exists error, got %+v", p)
+	}
+	if want := at(t, broken, "verify -> ").Position; d.Range.Start != want {
+		t.Fatalf("range start: got %+v want %+v", d.Range.Start, want)
+	}
+
+	c.change(3, strings.Replace(testGraph, `[shape=Msquare]`, `[shape=Msquare`, 1))
+	// The unclosed block is reported at the token that follows it.
+	if d := findDiagnostic(c.diagnostics(), "dot_syntax"); d == nil || d.Range.Start != (position{Line: 4, Character: 2}) {
+		t.Fatalf("expected a dot_syntax error at 5:3, got %+v", d)
+	}
+
+	c.notify("textDocument/didClose", didCloseParams{TextDocument: textDocumentIdentifier{URI: testURI}})
+	if p := c.diagnostics(); len(p.Diagnostics) != 0 {
+		t.Fatalf("close should clear diagnostics: %+v", p)
+	}
+}
+
+// completionLabels edits a statement into the graph, as if being typed
+// before the closing brace, and completes at its end.
+func completionLabels(t *testing.T, c *testClient, version int, typed string) []string {
+	t.Helper()
+	i := strings.LastIndex(testGraph, "}")
+	text := testGraph[:i] + "  " + typed + "\n" + testGraph[i:]
+	c.change(version, text)
+	c.diagnostics()
+	var list completionList
+	c.request("textDocument/completion", at(t, text, typed), &list)
+	labels := make([]string, 0, len(list.Items))
+	for _, it := range list.Items {
+		labels = append(labels, it.Label)
+	}
+	return labels
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestServer_Completion(t *testing.T) {
+	c := startServer(t)
+	c.open(testGraph)
+	c.diagnostics()
+
+	for i, tc := range []struct {
+		typed   string
+		want    []string
+		notWant []string
+	}{
+		{typed: `review [sh`, want: []string{"shape"}, notWant: []string{"goal_gate"}},
+		{typed: `review [shape=box, `, want: []string{"fidelity", "join_policy", "llm_model", "prompt"}, notWant: []string{"shape", "condition", "goal"}},
+		{typed: `review [shape=`, want: []string{"box", "Mdiamond", "parallelogram"}},
+		{typed: `review [llm_provider=`, want: []string{"anthropic", "openai"}},
+		{typed: `review [llm_provider=openai, llm_model=gpt-5`, want: []string{"gpt-5", "gpt-5-codex"}, notWant: []string{"claude-sonnet-4.5"}},
+		{typed: `review [type="code`, want: []string{"codergen"}, notWant: []string{"tool"}},
+		{typed: `review [fidelity=summary:`, want: []string{"summary:low", "summary:high"}, notWant: []string{"full"}},
+		{typed: `review [retry_target=`, want: []string{"exit", "implement", "start", "verify"}},
+		{typed: `start -> ver`, want: []string{"verify"}, notWant: []string{"exit"}},
+		{typed: `verify -> exit [con`, want: []string{"condition"}},
+		{typed: `edge [`, want: []string{"condition", "weight", "loop_restart"}, notWant: []string{"prompt"}},
+		{typed: `graph [`, want: []string{"goal", "model_stylesheet", "default_max_retry"}, notWant: []string{"prompt"}},
+		{typed: `rankdir = `, want: []string{"LR", "TB"}},
+		{typed: `// start -> ver`, notWant: []string{"verify"}},
+	} {
+		got := completionLabels(t, c, i+2, tc.typed)
+		for _, w := range tc.want {
+			if !contains(got, w) {
+				t.Errorf("after %q: missing %q in %v", tc.typed, w, got)
+			}
+		}
+		for _, w := range tc.notWant {
+			if contains(got, w) {
+				t.Errorf("after %q: unexpected %q", tc.typed, w)
+			}
+		}
+	}
+}
+
+func TestServer_HoverAndDefinition(t *testing.T) {
+	text := strings.Replace(testGraph, `prompt="implement"]`, `prompt="implement", fidelity=compact]`, 1) +
+		"// parallel\n"
+	c := startServer(t)
+	c.open(text)
+	c.diagnostics()
+
+	var h hover
+	c.request("textDocument/hover", at(t, text, "fidel"), &h)
+	if !strings.Contains(h.Contents.Value, "**fidelity**") || !strings.Contains(h.Contents.Value, "summary:high") {
+		t.Fatalf("fidelity hover: %+v", h)
+	}
+	c.request("textDocument/hover", at(t, text, "shape=Msq"), &h)
+	if !strings.Contains(h.Contents.Value, "exit") {
+		t.Fatalf("shape value hover: %+v", h)
+	}
+	c.request("textDocument/hover", at(t, text, "-> ver"), &h)
+	if !strings.Contains(h.Contents.Value, "**verify** (codergen)") {
+		t.Fatalf("node hover: %+v", h)
+	}
+
+	implementDecl := positionAt(text, strings.Index(text, "implement [")).Line
+	for _, marker := range []string{"start -> impl", "retry_target=impl"} {
+		var loc *location
+		c.request("textDocument/definition", at(t, text, marker), &loc)
+		if loc == nil || loc.URI != testURI || loc.Range.Start.Line != implementDecl || loc.Range.Start.Character != 2 {
+			t.Fatalf("definition at %q: %+v", marker, loc)
+		}
+	}
+	var none *location
+	c.request("textDocument/definition", at(t, text, "// paral"), &none)
+	if none != nil {
+		t.Fatalf("definition inside a comment: %+v", none)
+	}
+}
+
+func TestServer_ExitRequiresShutdown(t *testing.T) {
+	c := startServer(t)
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Fatalf("Serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not exit")
+	}
+
+	c = startServer(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err != ErrExitWithoutShutdown {
+		t.Fatalf("exit without shutdown: %v", err)
+	}
+}
+
+func TestPositionsCountUTF16(t *testing.T) {
+	text := "a [label=\"héllo 🚀\"]\nb -> c"
+	i := strings.Index(text, "\"]")
+	pos := positionAt(text, i)
+	if pos != (position{Line: 0, Character: 18}) {
+		t.Fatalf("positionAt: %+v", pos)
+	}
+	if got := offsetAt(text, pos); got != i {
+		t.Fatalf("offsetAt: got %d want %d", got, i)
+	}
+	if got := offsetAt(text, position{Line: 1, Character: 99}); got != len(text) {
+		t.Fatalf("clamped offset: got %d want %d", got, len(text))
+	}
+}
@@ -6,12 +6,44 @@ import (
 	"strings"
 )
 
+// Position is a location in DOT source. Line and Column are 1-based; Column
+// counts bytes. The zero Position means "unknown".
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is a half-open range of DOT source; End is the position just past the
+// last byte.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+func (s Span) IsValid() bool { return s.Start.IsValid() }
+
 // Graph is the parsed, flattened representation of a DOT digraph pipeline.
 // Attributes are stored as raw strings; callers can parse types as needed.
 type Graph struct {
 	Name  string
 	Attrs map[string]string
 
+	// Span covers the "digraph <name>" header. AttrSpans locates the
+	// declaration ("key = value" or "key=value" in a graph block) that set
+	// each graph attribute. Both are zero for graphs not built by the parser.
+	Span      Span
+	AttrSpans map[string]Span
+
 	Nodes map[string]*Node
 	Edges []*Edge // declaration order (expanded for chained edges)
 
@@ -21,12 +53,13 @@ type Graph struct {
 
 func NewGraph(name string) *Graph {
 	return &Graph{
-		Name:     name,
-		Attrs:    map[string]string{},
-		Nodes:    map[string]*Node{},
-		Edges:    []*Edge{},
-		outgoing: map[string][]*Edge{},
-		incoming: map[string][]*Edge{},
+		Name:      name,
+		Attrs:     map[string]string{},
+		AttrSpans: map[string]Span{},
+		Nodes:     map[string]*Node{},
+		Edges:     []*Edge{},
+		outgoing:  map[string][]*Edge{},
+		incoming:  map[string][]*Edge{},
 	}
 }
 
@@ -44,6 +77,12 @@ func (g *Graph) AddNode(n *Node) error {
 		for k, v := range n.Attrs {
 			existing.Attrs[k] = v
 		}
+		if len(n.AttrSpans) > 0 && existing.AttrSpans == nil {
+			existing.AttrSpans = map[string]Span{}
+		}
+		for k, sp := range n.AttrSpans {
+			existing.AttrSpans[k] = sp
+		}
 		existing.Classes = mergeClasses(existing.Classes, n.Classes)
 		return nil
 	}
@@ -88,12 +127,19 @@ type Node struct {
 	Attrs   map[string]string
 	Classes []string
 	Order   int // first-seen declaration order (stable)
+
+	// Span covers the first statement declaring the node. AttrSpans locates
+	// where each attribute was set, including node [...] defaults; later
+	// statements win, like Attrs.
+	Span      Span
+	AttrSpans map[string]Span
 }
 
 func NewNode(id string) *Node {
 	return &Node{
-		ID:    id,
-		Attrs: map[string]string{},
+		ID:        id,
+		Attrs:     map[string]string{},
+		AttrSpans: map[string]Span{},
 	}
 }
 
@@ -134,6 +180,14 @@ func (n *Node) Prompt() string {
 	return n.Attr("llm_prompt", "")
 }
 
+// PromptAttr names the attribute Prompt reads.
+func (n *Node) PromptAttr() string {
+	if n.Attr("prompt", "") != "" {
+		return "prompt"
+	}
+	return "llm_prompt"
+}
+
 func (n *Node) ClassList() []string {
 	// classes may come from:
 	// - node attr "class" (comma separated)
@@ -156,14 +210,22 @@ type Edge struct {
 	To    string
 	Attrs map[string]string
 	Order int // declaration order (stable)
+
+	// Span covers "from -> to" (one hop of a chained statement); ToSpan is
+	// the target identifier. AttrSpans locates where each attribute was set,
+	// including edge [...] defaults.
+	Span      Span
+	ToSpan    Span
+	AttrSpans map[string]Span
 }
 
 func NewEdge(from, to string) *Edge {
 	return &Edge{
-		From:  from,
-		To:    to,
-		Attrs: map[string]string{},
-		Order: -1,
+		From:      from,
+		To:        to,
+		Attrs:     map[string]string{},
+		AttrSpans: map[string]Span{},
+		Order:     -1,
 	}
 }
 
@@ -185,6 +247,32 @@ func (e *Edge) Condition() string {
 	return e.Attr("condition", "")
 }
 
+// AttrSpan returns where graph attribute key was set, falling back to the
+// graph header.
+func (g *Graph) AttrSpan(key string) Span {
+	if sp, ok := g.AttrSpans[key]; ok {
+		return sp
+	}
+	return g.Span
+}
+
+// AttrSpan returns where attribute key was set, falling back to the node
+// declaration.
+func (n *Node) AttrSpan(key string) Span {
+	if sp, ok := n.AttrSpans[key]; ok {
+		return sp
+	}
+	return n.Span
+}
+
+// AttrSpan returns where attribute key was set, falling back to the edge.
+func (e *Edge) AttrSpan(key string) Span {
+	if sp, ok := e.AttrSpans[key]; ok {
+		return sp
+	}
+	return e.Span
+}
+
 func mergeClasses(a, b []string) []string {
 	out := append([]string{}, a...)
 	out = append(out, b...)
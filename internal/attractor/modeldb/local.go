@@ -0,0 +1,183 @@
+package modeldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/modelmeta"
+)
+
+// LocalModel is one model served by an OpenAI-compatible local server
+// (Ollama, llama.cpp, vLLM, LM Studio).
+type LocalModel struct {
+	ID            string
+	ContextWindow int
+	// SupportsTools is nil when the server does not report capabilities.
+	SupportsTools *bool
+}
+
+// DiscoverLocalModels lists models from an OpenAI-compatible models endpoint
+// (baseURL+modelsPath). Context windows come from whichever field the server
+// reports (context_length, max_model_len, meta.n_ctx_train). Models the listing
+// says nothing about are looked up through Ollama's /api/show, which also
+// reports tool support; servers without that endpoint are only tried once.
+func DiscoverLocalModels(ctx context.Context, baseURL, modelsPath, apiKey string, timeout time.Duration) ([]LocalModel, error) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var payload struct {
+		Data []struct {
+			ID            string   `json:"id"`
+			ContextLength int      `json:"context_length"`
+			MaxModelLen   int      `json:"max_model_len"`
+			Capabilities  []string `json:"capabilities"`
+			Meta          struct {
+				NCtxTrain int `json:"n_ctx_train"`
+			} `json:"meta"`
+		} `json:"data"`
+	}
+	if err := localJSON(cctx, http.MethodGet, baseURL+modelsPath, apiKey, nil, &payload); err != nil {
+		return nil, err
+	}
+	var out []LocalModel
+	showSupported := true
+	for _, m := range payload.Data {
+		id := strings.TrimSpace(m.ID)
+		if id == "" {
+			continue
+		}
+		lm := LocalModel{ID: id, SupportsTools: toolSupportFromCapabilities(m.Capabilities)}
+		for _, n := range []int{m.ContextLength, m.MaxModelLen, m.Meta.NCtxTrain} {
+			if n > 0 {
+				lm.ContextWindow = n
+				break
+			}
+		}
+		if showSupported && (lm.ContextWindow == 0 || lm.SupportsTools == nil) {
+			ctxWindow, tools, err := ollamaShow(cctx, baseURL, apiKey, id)
+			if err != nil {
+				showSupported = false
+			} else {
+				if lm.ContextWindow == 0 {
+					lm.ContextWindow = ctxWindow
+				}
+				if lm.SupportsTools == nil {
+					lm.SupportsTools = tools
+				}
+			}
+		}
+		out = append(out, lm)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s%s lists no models", baseURL, modelsPath)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func ollamaShow(ctx context.Context, baseURL, apiKey, id string) (int, *bool, error) {
+	var show struct {
+		Capabilities []string       `json:"capabilities"`
+		ModelInfo    map[string]any `json:"model_info"`
+	}
+	if err := localJSON(ctx, http.MethodPost, baseURL+"/api/show", apiKey, map[string]string{"model": id}, &show); err != nil {
+		return 0, nil, err
+	}
+	ctxWindow := 0
+	for k, v := range show.ModelInfo {
+		if n, ok := v.(float64); ok && strings.HasSuffix(k, ".context_length") && n > 0 {
+			ctxWindow = int(n)
+		}
+	}
+	return ctxWindow, toolSupportFromCapabilities(show.Capabilities), nil
+}
+
+func toolSupportFromCapabilities(caps []string) *bool {
+	if len(caps) == 0 {
+		return nil
+	}
+	v := modelmeta.ContainsFold(caps, "tools") || modelmeta.ContainsFold(caps, "tool_use") || modelmeta.ContainsFold(caps, "function_calling")
+	return &v
+}
+
+func localJSON(ctx context.Context, method, url, apiKey string, body any, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return fmt.Errorf("status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// LocalModelsCatalogJSON renders discovered models in the OpenRouter payload
+// shape under provider/<id> with zero pricing, so the snapshot loads through
+// LoadCatalogFromOpenRouterJSON like any other catalog. Models with unknown
+// tool support are listed as tool-capable.
+func LocalModelsCatalogJSON(provider string, models []LocalModel) ([]byte, error) {
+	provider = modelmeta.NormalizeProvider(provider)
+	data := make([]map[string]any, 0, len(models))
+	for _, m := range models {
+		params := []string{}
+		if m.SupportsTools == nil || *m.SupportsTools {
+			params = append(params, "tools")
+		}
+		data = append(data, map[string]any{
+			"id":                   provider + "/" + m.ID,
+			"context_length":       m.ContextWindow,
+			"supported_parameters": params,
+			"pricing":              map[string]string{"prompt": "0", "completion": "0"},
+		})
+	}
+	return json.MarshalIndent(map[string]any{"data": data}, "", "  ")
+}
+
+// MergeCatalog adds src's models to dst. Entries already in dst win.
+func MergeCatalog(dst, src *Catalog) {
+	if dst == nil || src == nil {
+		return
+	}
+	if dst.Models == nil {
+		dst.Models = map[string]ModelEntry{}
+	}
+	if dst.CoveredProviders == nil {
+		dst.CoveredProviders = map[string]bool{}
+	}
+	for id, e := range src.Models {
+		if _, ok := dst.Models[id]; !ok {
+			dst.Models[id] = e
+		}
+	}
+	for p := range src.CoveredProviders {
+		dst.CoveredProviders[p] = true
+	}
+}
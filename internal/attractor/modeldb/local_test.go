@@ -0,0 +1,95 @@
+package modeldb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiscoverLocalModels_OllamaShowFillsContextAndTools(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/models":
+			_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"qwen2.5-coder:7b"},{"id":"gemma:2b"}]}`))
+		case "/api/show":
+			var req struct{ Model string }
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.Model == "gemma:2b" {
+				_, _ = w.Write([]byte(`{"capabilities":["completion"],"model_info":{"gemma.context_length":8192}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"capabilities":["completion","tools"],"model_info":{"qwen2.context_length":32768}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	models, err := DiscoverLocalModels(context.Background(), srv.URL, "/v1/models", "", 5*time.Second)
+	if err != nil {
+		t.Fatalf("DiscoverLocalModels: %v", err)
+	}
+	if len(models) != 2 || models[0].ID != "gemma:2b" || models[1].ID != "qwen2.5-coder:7b" {
+		t.Fatalf("models: %+v", models)
+	}
+	if models[0].ContextWindow != 8192 || models[0].SupportsTools == nil || *models[0].SupportsTools {
+		t.Fatalf("gemma: %+v", models[0])
+	}
+	if models[1].ContextWindow != 32768 || models[1].SupportsTools == nil || !*models[1].SupportsTools {
+		t.Fatalf("qwen: %+v", models[1])
+	}
+
+	b, err := LocalModelsCatalogJSON("ollama", models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "local_models.json")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	local, err := LoadCatalogFromOpenRouterJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cat := &Catalog{Models: map[string]ModelEntry{"openai/gpt-5": {Provider: "openai"}}, CoveredProviders: map[string]bool{"openai": true}}
+	MergeCatalog(cat, local)
+	e, ok := LookupModelEntry(cat, "local", "gemma:2b")
+	if !ok || e.ContextWindow != 8192 || e.SupportsTools || e.InputCostPerToken == nil || *e.InputCostPerToken != 0 {
+		t.Fatalf("merged gemma entry: %+v ok=%v", e, ok)
+	}
+	if !CatalogCoversProvider(cat, "local") || !CatalogHasProviderModel(cat, "openai", "gpt-5") {
+		t.Fatalf("merge lost coverage: %+v", cat.CoveredProviders)
+	}
+}
+
+func TestDiscoverLocalModels_VLLMListing(t *testing.T) {
+	var shows int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			if r.Header.Get("Authorization") != "Bearer k" {
+				t.Errorf("authorization header: %q", r.Header.Get("Authorization"))
+			}
+			_, _ = w.Write([]byte(`{"data":[{"id":"meta-llama/Llama-3.1-8B-Instruct","max_model_len":131072},{"id":"mistral-7b"}]}`))
+			return
+		}
+		shows++
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	models, err := DiscoverLocalModels(context.Background(), srv.URL+"/", "/v1/models", "k", 5*time.Second)
+	if err != nil {
+		t.Fatalf("DiscoverLocalModels: %v", err)
+	}
+	if models[0].ContextWindow != 131072 || models[0].SupportsTools != nil {
+		t.Fatalf("llama: %+v", models[0])
+	}
+	if shows != 1 {
+		t.Fatalf("expected /api/show to be tried once on a non-Ollama server, got %d", shows)
+	}
+}
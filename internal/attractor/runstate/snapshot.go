@@ -18,6 +18,9 @@ type finalOutcomeDoc struct {
 	Status        string `json:"status"`
 	RunID         string `json:"run_id"`
 	FailureReason string `json:"failure_reason"`
+	Cost          *struct {
+		USD float64 `json:"usd"`
+	} `json:"cost"`
 }
 
 // LoadSnapshot reads run artifacts in logsRoot and returns a compact run snapshot.
@@ -48,6 +51,9 @@ func LoadSnapshot(logsRoot string) (*Snapshot, error) {
 	if err := applyPIDFile(s, terminal); err != nil {
 		return nil, err
 	}
+	if s.CostUSD == nil {
+		applyCostLedger(s)
+	}
 	if s.State == StateUnknown && s.PIDAlive {
 		s.State = StateRunning
 	}
@@ -73,6 +79,10 @@ func applyFinalOutcome(s *Snapshot) error {
 	if rid := strings.TrimSpace(doc.RunID); rid != "" {
 		s.RunID = rid
 	}
+	if doc.Cost != nil {
+		usd := doc.Cost.USD
+		s.CostUSD = &usd
+	}
 	switch strings.ToLower(strings.TrimSpace(doc.Status)) {
 	case string(StateSuccess):
 		s.State = StateSuccess
@@ -85,6 +95,25 @@ func applyFinalOutcome(s *Snapshot) error {
 	return nil
 }
 
+// applyCostLedger reads the running LLM spend total from cost.json (written
+// by the engine after each stage) for runs that have no final.json yet.
+func applyCostLedger(s *Snapshot) {
+	b, err := os.ReadFile(filepath.Join(s.LogsRoot, "cost.json"))
+	if err != nil {
+		return
+	}
+	var doc struct {
+		Run struct {
+			USD float64 `json:"usd"`
+		} `json:"run"`
+	}
+	if json.Unmarshal(b, &doc) != nil {
+		return
+	}
+	usd := doc.Run.USD
+	s.CostUSD = &usd
+}
+
 func applyLiveOrProgress(s *Snapshot) error {
 	live, found, err := readLiveEvent(filepath.Join(s.LogsRoot, "live.json"))
 	if err != nil {
@@ -159,3 +159,25 @@ func TestLoadSnapshot_TerminalStateIgnoresMalformedPIDFile(t *testing.T) {
 		t.Fatal("pid_alive=true want false for malformed pid file")
 	}
 }
+
+func TestLoadSnapshot_CostFromFinalOrCostLedger(t *testing.T) {
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "cost.json"), []byte(`{"run":{"usd":1.5}}`), 0o644)
+
+	s, err := LoadSnapshot(root)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if s.CostUSD == nil || *s.CostUSD != 1.5 {
+		t.Fatalf("cost_usd=%v want 1.5 from cost.json", s.CostUSD)
+	}
+
+	_ = os.WriteFile(filepath.Join(root, "final.json"), []byte(`{"status":"fail","run_id":"r1","cost":{"usd":2.25}}`), 0o644)
+	s, err = LoadSnapshot(root)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if s.CostUSD == nil || *s.CostUSD != 2.25 {
+		t.Fatalf("cost_usd=%v want 2.25 from final.json", s.CostUSD)
+	}
+}
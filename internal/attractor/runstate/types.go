@@ -35,6 +35,7 @@ type Snapshot struct {
 	FailureReason string    `json:"failure_reason,omitempty"`
 	PID           int       `json:"pid,omitempty"`
 	PIDAlive      bool      `json:"pid_alive"`
+	CostUSD       *float64  `json:"cost_usd,omitempty"`
 
 	// Verbose fields (populated only when requested via ApplyVerbose)
 	FinalCommitSHA string           `json:"final_commit_sha,omitempty"`
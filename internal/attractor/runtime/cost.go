@@ -0,0 +1,22 @@
+package runtime
+
+// CostSummary totals LLM token usage and spend. USD only covers calls whose
+// model had catalog pricing (or whose backend reported a cost); UnpricedCalls
+// counts the rest so a zero total is never mistaken for "free".
+type CostSummary struct {
+	USD           float64 `json:"usd"`
+	InputTokens   int     `json:"input_tokens"`
+	OutputTokens  int     `json:"output_tokens"`
+	Calls         int     `json:"calls"`
+	UnpricedCalls int     `json:"unpriced_calls,omitempty"`
+}
+
+func (c CostSummary) Add(v CostSummary) CostSummary {
+	return CostSummary{
+		USD:           c.USD + v.USD,
+		InputTokens:   c.InputTokens + v.InputTokens,
+		OutputTokens:  c.OutputTokens + v.OutputTokens,
+		Calls:         c.Calls + v.Calls,
+		UnpricedCalls: c.UnpricedCalls + v.UnpricedCalls,
+	}
+}
@@ -23,6 +23,9 @@ type FinalOutcome struct {
 
 	CXDBContextID  string `json:"cxdb_context_id"`
 	CXDBHeadTurnID string `json:"cxdb_head_turn_id"`
+
+	// Cost is the run's total LLM spend across all stages and loop restarts.
+	Cost *CostSummary `json:"cost,omitempty"`
 }
 
 func (fo *FinalOutcome) Save(path string) error {
@@ -68,6 +68,8 @@ type Outcome struct {
 	Details any `json:"details,omitempty"`
 	// Optional: handler-specific metadata (not used for routing).
 	Meta map[string]any `json:"meta,omitempty"`
+	// Cost is the LLM spend of this attempt, filled in by the engine.
+	Cost *CostSummary `json:"cost,omitempty"`
 }
 
 func (o Outcome) Canonicalize() (Outcome, error) {
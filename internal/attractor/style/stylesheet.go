@@ -2,6 +2,7 @@ package style
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/danshapiro/kilroy/internal/attractor/model"
@@ -29,6 +30,59 @@ func ParseStylesheet(src string) ([]Rule, error) {
 	return p.parse()
 }
 
+// declOrder is the order String prints declarations in.
+var declOrder = []string{"llm_model", "llm_provider", "reasoning_effort", "max_tokens"}
+
+// String renders the rule in canonical form, e.g.
+// `.hard { llm_model: gpt-5.2; llm_provider: openai; }`. Parsing the result
+// yields the same selector and declarations.
+func (r Rule) String() string {
+	var b strings.Builder
+	switch r.Kind {
+	case SelectorUniversal:
+		b.WriteString("*")
+	case SelectorClass:
+		b.WriteString("." + r.Value)
+	case SelectorID:
+		b.WriteString("#" + r.Value)
+	default:
+		b.WriteString(r.Value)
+	}
+	b.WriteString(" {")
+	seen := map[string]bool{}
+	write := func(prop string) {
+		seen[prop] = true
+		b.WriteString(" " + prop + ": " + formatDeclValue(r.Decls[prop]) + ";")
+	}
+	for _, prop := range declOrder {
+		if _, ok := r.Decls[prop]; ok {
+			write(prop)
+		}
+	}
+	var rest []string
+	for prop := range r.Decls {
+		if !seen[prop] {
+			rest = append(rest, prop)
+		}
+	}
+	sort.Strings(rest)
+	for _, prop := range rest {
+		write(prop)
+	}
+	b.WriteString(" }")
+	return b.String()
+}
+
+// formatDeclValue leaves values bare when parseValue reads them back
+// unchanged, and quotes the rest.
+func formatDeclValue(v string) string {
+	if v != "" && v == strings.TrimSpace(v) && !strings.ContainsAny(v, "\";}\n\t\\") {
+		return v
+	}
+	r := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t")
+	return `"` + r.Replace(v) + `"`
+}
+
 func ApplyStylesheet(g *model.Graph, rules []Rule) error {
 	if g == nil {
 		return fmt.Errorf("graph is nil")
@@ -183,3 +183,39 @@ func TestParseStylesheet_UppercaseClassNameFailsAtBoundary(t *testing.T) {
 		t.Fatalf("error should mention 'class name': %v", err)
 	}
 }
+
+func TestRuleString_RoundTrips(t *testing.T) {
+	ss := `#n1{reasoning_effort:high;llm_model:"gpt; 5"}  box { llm_provider : openai }
+.code { llm_model: "say \"hi\""; max_tokens: 100 } * {}`
+	rules, err := ParseStylesheet(ss)
+	if err != nil {
+		t.Fatalf("ParseStylesheet: %v", err)
+	}
+	var lines []string
+	for _, r := range rules {
+		lines = append(lines, r.String())
+	}
+	want := []string{
+		`#n1 { llm_model: "gpt; 5"; reasoning_effort: high; }`,
+		`box { llm_provider: openai; }`,
+		`.code { llm_model: "say \"hi\""; max_tokens: 100; }`,
+		`* { }`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	again, err := ParseStylesheet(strings.Join(lines, "\n"))
+	if err != nil {
+		t.Fatalf("reparse: %v", err)
+	}
+	for i := range rules {
+		if again[i].Kind != rules[i].Kind || again[i].Value != rules[i].Value || len(again[i].Decls) != len(rules[i].Decls) {
+			t.Fatalf("rule %d: got %+v want %+v", i, again[i], rules[i])
+		}
+		for k, v := range rules[i].Decls {
+			if again[i].Decls[k] != v {
+				t.Fatalf("rule %d %s: got %q want %q", i, k, again[i].Decls[k], v)
+			}
+		}
+	}
+}
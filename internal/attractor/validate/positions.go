@@ -0,0 +1,62 @@
+package validate
+
+import "github.com/danshapiro/kilroy/internal/attractor/model"
+
+// Locate returns the source span a diagnostic refers to: its Attr when that
+// is set, otherwise the edge, node or graph header the diagnostic names. It
+// returns nil for graphs built without source positions.
+func Locate(g *model.Graph, d Diagnostic) *model.Span {
+	if g == nil {
+		return nil
+	}
+	var sp model.Span
+	switch {
+	case d.EdgeFrom != "" || d.EdgeTo != "":
+		e := findEdge(g, d.EdgeFrom, d.EdgeTo)
+		if e == nil {
+			sp = g.Span
+			break
+		}
+		sp = e.Span
+		if s, ok := e.AttrSpans[d.Attr]; ok && d.Attr != "" {
+			sp = s
+		}
+	case d.NodeID != "" && g.Nodes[d.NodeID] != nil:
+		n := g.Nodes[d.NodeID]
+		sp = n.Span
+		if s, ok := n.AttrSpans[d.Attr]; ok && d.Attr != "" {
+			sp = s
+		}
+	default:
+		sp = g.Span
+		if s, ok := g.AttrSpans[d.Attr]; ok && d.Attr != "" {
+			sp = s
+		}
+	}
+	return spanPtr(sp)
+}
+
+func spanPtr(sp model.Span) *model.Span {
+	if !sp.IsValid() {
+		return nil
+	}
+	return &sp
+}
+
+func findEdge(g *model.Graph, from, to string) *model.Edge {
+	for _, e := range g.Edges {
+		if (from == "" || e.From == from) && (to == "" || e.To == to) {
+			return e
+		}
+	}
+	return nil
+}
+
+// locateAll fills in Range for diagnostics that do not carry one.
+func locateAll(g *model.Graph, diags []Diagnostic) {
+	for i := range diags {
+		if diags[i].Range == nil {
+			diags[i].Range = Locate(g, diags[i])
+		}
+	}
+}
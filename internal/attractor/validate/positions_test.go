@@ -0,0 +1,60 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/dot"
+)
+
+func TestValidate_DiagnosticsPointAtSource(t *testing.T) {
+	g, err := dot.Parse([]byte(`digraph G {
+  graph [model_stylesheet="* { llm_provider: openai; llm_model: gpt-5.2; }"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, prompt="do it", fidelity=bogus]
+  start -> a
+  a -> exit [condition="=success"]
+  a -> missing
+  c [shape=diamond, llm_prompt="unused"]
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := map[string]string{
+		"fidelity_valid":     "5:33",
+		"condition_syntax":   "7:14",
+		"edge_target_exists": "8:8",
+		// Rules report the attribute they inspected, here llm_prompt.
+		"prompt_on_conditional_node": "9:21",
+	}
+	for _, d := range Validate(g) {
+		if d.Range == nil {
+			t.Errorf("%s has no range: %+v", d.Rule, d)
+			continue
+		}
+		if pos, ok := want[d.Rule]; ok {
+			if got := d.Range.Start.String(); got != pos {
+				t.Errorf("%s: got %s want %s", d.Rule, got, pos)
+			}
+			delete(want, d.Rule)
+		}
+	}
+	if len(want) != 0 {
+		t.Fatalf("rules not reported: %v", want)
+	}
+}
+
+func TestLocate_GraphLevelFallsBackToHeader(t *testing.T) {
+	g, err := dot.Parse([]byte("digraph Pipeline {\n  a [shape=box]\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := Locate(g, Diagnostic{Rule: "start_node"})
+	if sp == nil || sp.Start.String() != "1:1" || sp.End.String() != "1:17" {
+		t.Fatalf("span: %+v", sp)
+	}
+	if sp := Locate(g, Diagnostic{Rule: "llm_provider_required", NodeID: "a"}); sp == nil || sp.Start.String() != "2:3" {
+		t.Fatalf("node span: %+v", sp)
+	}
+}
@@ -3,6 +3,7 @@ package validate
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/danshapiro/kilroy/internal/attractor/cond"
@@ -27,7 +28,14 @@ type Diagnostic struct {
 	NodeID   string   `json:"node_id,omitempty"`
 	EdgeFrom string   `json:"edge_from,omitempty"`
 	EdgeTo   string   `json:"edge_to,omitempty"`
-	Fix      string   `json:"fix,omitempty"`
+	// Attr names the attribute the diagnostic is about, on that node or
+	// edge or on the graph.
+	Attr string `json:"attr,omitempty"`
+	Fix  string `json:"fix,omitempty"`
+	// Range is the DOT source the diagnostic points at. Validate fills it
+	// in from Attr, or from the node, edge or graph named; it is nil for
+	// graphs built without source positions.
+	Range *model.Span `json:"range,omitempty"`
 }
 
 // LintRule is the interface for custom lint rules that can be passed to
@@ -74,6 +82,10 @@ func ValidateWithOptions(g *model.Graph, opts ValidateOptions, extraRules ...Lin
 	diags = append(diags, lintGoalGateExitStatusContract(g)...)
 	diags = append(diags, lintGoalGatePromptStatusHint(g)...)
 	diags = append(diags, lintFidelityValid(g)...)
+	diags = append(diags, lintContextCompactionValid(g)...)
+	diags = append(diags, lintManagerSteerConfig(g)...)
+	diags = append(diags, lintStackCallConfig(g)...)
+	diags = append(diags, lintFanInStrategy(g)...)
 	diags = append(diags, lintPromptOnCodergenNodes(g)...)
 	diags = append(diags, lintStatusContractInPrompt(g)...)
 	diags = append(diags, lintPromptOnConditionalNodes(g)...)
@@ -99,6 +111,7 @@ func ValidateWithOptions(g *model.Graph, opts ValidateOptions, extraRules ...Lin
 			diags = append(diags, rule.Apply(g)...)
 		}
 	}
+	locateAll(g, diags)
 	return diags
 }
 
@@ -170,6 +183,7 @@ func lintEdgeTargetsExist(g *model.Graph) []Diagnostic {
 				Message:  "edge references missing from-node",
 				EdgeFrom: e.From,
 				EdgeTo:   e.To,
+				Range:    spanPtr(e.Span),
 			})
 		}
 		if _, ok := g.Nodes[e.To]; !ok {
@@ -179,6 +193,7 @@ func lintEdgeTargetsExist(g *model.Graph) []Diagnostic {
 				Message:  "edge references missing to-node",
 				EdgeFrom: e.From,
 				EdgeTo:   e.To,
+				Range:    spanPtr(e.ToSpan),
 			})
 		}
 	}
@@ -330,6 +345,7 @@ func lintConditionSyntax(g *model.Graph) []Diagnostic {
 		if err := validateConditionSyntax(c); err != nil {
 			diags = append(diags, Diagnostic{
 				Rule:     "condition_syntax",
+				Attr:     "condition",
 				Severity: SeverityError,
 				Message:  err.Error(),
 				EdgeFrom: e.From,
@@ -337,10 +353,9 @@ func lintConditionSyntax(g *model.Graph) []Diagnostic {
 			})
 			continue
 		}
-		// NOTE: evalClause error paths are unreachable for inputs that pass
-		// validateConditionSyntax above: SplitN(s, op, 2) on a string that
-		// contains op always yields exactly 2 parts. The Evaluate call below
-		// is retained as a forward-compatibility safety net.
+		// NOTE: Evaluate error paths are unreachable for inputs that pass
+		// validateConditionSyntax above: both parse with cond.Parse. The
+		// Evaluate call below is retained as a forward-compatibility safety net.
 		//
 		// Also ensure our evaluator can process it. Discard the boolean result
 		// (we are linting with a synthetic outcome, so the match value is
@@ -350,6 +365,7 @@ func lintConditionSyntax(g *model.Graph) []Diagnostic {
 		if _, evalErr := cond.Evaluate(c, runtime.Outcome{Status: runtime.StatusSuccess}, runtime.NewContext()); evalErr != nil {
 			diags = append(diags, Diagnostic{
 				Rule:     "condition_syntax",
+				Attr:     "condition",
 				Severity: SeverityError,
 				Message:  fmt.Sprintf("condition evaluator rejected expression %q: %v", c, evalErr),
 				EdgeFrom: e.From,
@@ -360,46 +376,28 @@ func lintConditionSyntax(g *model.Graph) []Diagnostic {
 	return diags
 }
 
+// validateConditionSyntax checks a condition against the grammar in
+// cond.Evaluate and additionally rejects malformed keys, missing literals and
+// non-numeric operands of numeric comparisons, which the evaluator tolerates.
 func validateConditionSyntax(condExpr string) error {
-	clauses := strings.Split(condExpr, "&&")
-	for _, clause := range clauses {
-		clause = strings.TrimSpace(clause)
-		if clause == "" {
-			continue
-		}
-		// Disallow known future operators so mistakes don't silently "parse" as bare keys.
-		if strings.ContainsAny(clause, "<>|") {
-			return fmt.Errorf("invalid condition operator in clause %q", clause)
+	expr, err := cond.Parse(condExpr)
+	if err != nil {
+		return err
+	}
+	for _, c := range expr.Clauses() {
+		if err := validateCondKey(strings.TrimSpace(c.Key)); err != nil {
+			return err
 		}
-		if strings.Contains(clause, "!=") {
-			parts := strings.SplitN(clause, "!=", 2)
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid condition clause %q", clause)
-			}
-			if err := validateCondKey(strings.TrimSpace(parts[0])); err != nil {
-				return err
+		for _, v := range c.Values {
+			if strings.TrimSpace(v) == "" {
+				return fmt.Errorf("invalid condition clause %q: missing literal", c.Text)
 			}
-			if strings.TrimSpace(parts[1]) == "" {
-				return fmt.Errorf("invalid condition clause %q: missing literal", clause)
-			}
-			continue
 		}
-		if strings.Contains(clause, "=") {
-			parts := strings.SplitN(clause, "=", 2)
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid condition clause %q", clause)
-			}
-			if err := validateCondKey(strings.TrimSpace(parts[0])); err != nil {
-				return err
+		switch c.Op {
+		case cond.OpLt, cond.OpLe, cond.OpGt, cond.OpGe:
+			if _, err := strconv.ParseFloat(c.Values[0], 64); err != nil {
+				return fmt.Errorf("invalid condition clause %q: %s needs a numeric literal", c.Text, c.Op)
 			}
-			if strings.TrimSpace(parts[1]) == "" {
-				return fmt.Errorf("invalid condition clause %q: missing literal", clause)
-			}
-			continue
-		}
-		// Bare key: allow but validate key shape.
-		if err := validateCondKey(strings.TrimSpace(clause)); err != nil {
-			return err
 		}
 	}
 	return nil
@@ -450,6 +448,7 @@ func lintStylesheetSyntax(g *model.Graph) []Diagnostic {
 	if _, err := style.ParseStylesheet(raw); err != nil {
 		return []Diagnostic{{
 			Rule:     "stylesheet_syntax",
+			Attr:     "model_stylesheet",
 			Severity: SeverityError,
 			Message:  err.Error(),
 		}}
@@ -507,12 +506,14 @@ func lintStylesheetModelIDs(g *model.Graph, catalog *modeldb.Catalog) []Diagnost
 		case modeldb.ModelNotFound:
 			diags = append(diags, Diagnostic{
 				Rule:     "stylesheet_unknown_model",
+				Attr:     "model_stylesheet",
 				Severity: SeverityWarning,
 				Message:  fmt.Sprintf("model_stylesheet: model %q not found in catalog for provider %q", modelID, provider),
 			})
 		case modeldb.ModelFoundNonCanonical:
 			diags = append(diags, Diagnostic{
 				Rule:     "stylesheet_noncanonical_model_id",
+				Attr:     "model_stylesheet",
 				Severity: SeverityError,
 				Message:  fmt.Sprintf("model_stylesheet: model %q uses non-canonical format; version suffixes must use dots not dashes (e.g. claude-opus-4.6 not claude-opus-4-6)", modelID),
 				Fix:      "replace dashes in the version number suffix with dots: claude-opus-4-6 → claude-opus-4.6",
@@ -538,6 +539,7 @@ func lintRetryTargetsExist(g *model.Graph) []Diagnostic {
 			if _, ok := g.Nodes[t]; !ok {
 				diags = append(diags, Diagnostic{
 					Rule:     "retry_target_exists",
+					Attr:     k,
 					Severity: SeverityWarning,
 					Message:  fmt.Sprintf("%s references missing node %q", k, t),
 					NodeID:   id,
@@ -559,6 +561,7 @@ func lintGoalGateHasRetry(g *model.Graph) []Diagnostic {
 				strings.TrimSpace(g.Attrs["retry_target"]) == "" && strings.TrimSpace(g.Attrs["fallback_retry_target"]) == "" {
 				diags = append(diags, Diagnostic{
 					Rule:     "goal_gate_has_retry",
+					Attr:     "goal_gate",
 					Severity: SeverityWarning,
 					Message:  "goal_gate node has no retry_target/fallback_retry_target (node or graph)",
 					NodeID:   id,
@@ -589,6 +592,7 @@ func lintGoalGateMissingNodeRetryTarget(g *model.Graph) []Diagnostic {
 		if nodeRetry == "" && nodeFallback == "" {
 			diags = append(diags, Diagnostic{
 				Rule:     "goal_gate_missing_node_retry_target",
+				Attr:     "goal_gate",
 				Severity: SeverityWarning,
 				Message:  "goal_gate node has no node-level retry_target or fallback_retry_target; graph-level retry_target is for transient failures, not goal-gate rejection",
 				NodeID:   id,
@@ -659,6 +663,7 @@ func lintGoalGatePromptStatusHint(g *model.Graph) []Diagnostic {
 		}
 		diags = append(diags, Diagnostic{
 			Rule:     "goal_gate_prompt_status_hint",
+			Attr:     n.PromptAttr(),
 			Severity: SeverityWarning,
 			Message:  fmt.Sprintf("goal_gate prompt instructs custom outcome=%s without canonical success outcome; prefer outcome=success (or partial_success) for gate satisfaction", customOutcome),
 			NodeID:   id,
@@ -737,6 +742,7 @@ func lintFidelityValid(g *model.Graph) []Diagnostic {
 		if f := strings.TrimSpace(n.Attr("fidelity", "")); f != "" && !valid[f] {
 			diags = append(diags, Diagnostic{
 				Rule:     "fidelity_valid",
+				Attr:     "fidelity",
 				Severity: SeverityWarning,
 				Message:  fmt.Sprintf("invalid fidelity value %q", f),
 				NodeID:   id,
@@ -750,6 +756,7 @@ func lintFidelityValid(g *model.Graph) []Diagnostic {
 		if f := strings.TrimSpace(e.Attr("fidelity", "")); f != "" && !valid[f] {
 			diags = append(diags, Diagnostic{
 				Rule:     "fidelity_valid",
+				Attr:     "fidelity",
 				Severity: SeverityWarning,
 				Message:  fmt.Sprintf("invalid fidelity value %q", f),
 				EdgeFrom: e.From,
@@ -760,6 +767,163 @@ func lintFidelityValid(g *model.Graph) []Diagnostic {
 	return diags
 }
 
+func lintContextCompactionValid(g *model.Graph) []Diagnostic {
+	valid := map[string]bool{"off": true, "none": true, "elide": true, "summarize": true}
+	var diags []Diagnostic
+	if v := strings.ToLower(strings.TrimSpace(g.Attrs["context_compaction"])); v != "" && !valid[v] {
+		diags = append(diags, Diagnostic{
+			Rule:     "context_compaction_valid",
+			Attr:     "context_compaction",
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("invalid graph context_compaction value %q (want off|elide|summarize)", v),
+		})
+	}
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		if v := strings.ToLower(strings.TrimSpace(n.Attr("context_compaction", ""))); v != "" && !valid[v] {
+			diags = append(diags, Diagnostic{
+				Rule:     "context_compaction_valid",
+				Attr:     "context_compaction",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("invalid context_compaction value %q (want off|elide|summarize)", v),
+				NodeID:   id,
+			})
+		}
+	}
+	return diags
+}
+
+// lintManagerSteerConfig checks that manager_loop nodes with the steer action
+// have something to steer with, and that manager.steer_condition parses.
+func lintManagerSteerConfig(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		if c := strings.TrimSpace(n.Attr("manager.steer_condition", "")); c != "" {
+			if err := validateConditionSyntax(c); err != nil {
+				diags = append(diags, Diagnostic{
+					Rule:     "manager_steer_config",
+					Attr:     "manager.steer_condition",
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("invalid manager.steer_condition: %v", err),
+					NodeID:   id,
+				})
+			}
+		}
+		steer := false
+		for _, a := range strings.Split(n.Attr("manager.actions", ""), ",") {
+			if strings.EqualFold(strings.TrimSpace(a), "steer") {
+				steer = true
+			}
+		}
+		if !steer {
+			continue
+		}
+		hasCondition := strings.TrimSpace(n.Attr("manager.steer_condition", "")) != "" && strings.TrimSpace(n.Attr("manager.steer_message", "")) != ""
+		if !hasCondition && strings.TrimSpace(n.Attr("manager.steer_prompt", "")) == "" {
+			diags = append(diags, Diagnostic{
+				Rule:     "manager_steer_config",
+				Attr:     "manager.actions",
+				Severity: SeverityWarning,
+				Message:  "manager.actions includes steer but the node has no manager.steer_condition/manager.steer_message or manager.steer_prompt",
+				NodeID:   id,
+				Fix:      "set manager.steer_condition and manager.steer_message, or manager.steer_prompt",
+			})
+		}
+	}
+	return diags
+}
+
+// lintStackCallConfig checks that stack.call nodes name a graph to call and
+// that their context mappings are dest=src or bare keys.
+func lintStackCallConfig(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil || strings.TrimSpace(n.Attr("type", "")) != "stack.call" {
+			continue
+		}
+		if strings.TrimSpace(n.Attr("stack.call_dotfile", "")) == "" {
+			diags = append(diags, Diagnostic{
+				Rule:     "stack_call_config",
+				Severity: SeverityError,
+				Message:  "stack.call node has no stack.call_dotfile",
+				NodeID:   id,
+				Fix:      "set stack.call_dotfile to the .dot file to run, relative to the repository root",
+			})
+		}
+		for _, attr := range []string{"stack.call_inputs", "stack.call_outputs"} {
+			for _, entry := range strings.Split(n.Attr(attr, ""), ",") {
+				entry = strings.TrimSpace(entry)
+				if entry == "" {
+					continue
+				}
+				dest, src, found := strings.Cut(entry, "=")
+				if strings.TrimSpace(dest) != "" && (!found || strings.TrimSpace(src) != "") {
+					continue
+				}
+				diags = append(diags, Diagnostic{
+					Rule:     "stack_call_config",
+					Attr:     attr,
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("%s entry %q is not dest=src or a bare key", attr, entry),
+					NodeID:   id,
+				})
+			}
+		}
+	}
+	return diags
+}
+
+// lintFanInStrategy checks fan_in_strategy values and the attributes each
+// strategy needs.
+func lintFanInStrategy(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		strategy := strings.ToLower(strings.TrimSpace(n.Attr("fan_in_strategy", "")))
+		switch strategy {
+		case "", "heuristic", "merge":
+		case "llm":
+			if strings.TrimSpace(n.Attr("llm_provider", "")) == "" || strings.TrimSpace(n.Attr("llm_model", "")) == "" {
+				diags = append(diags, Diagnostic{
+					Rule:     "fan_in_strategy",
+					Attr:     "fan_in_strategy",
+					Severity: SeverityWarning,
+					Message:  "fan_in_strategy=llm without llm_provider and llm_model; fan-in will fall back to the heuristic winner",
+					NodeID:   id,
+					Fix:      "set llm_provider and llm_model on the fan-in node",
+				})
+			}
+		case "command":
+			if strings.TrimSpace(n.Attr("fan_in_command", "")) == "" {
+				diags = append(diags, Diagnostic{
+					Rule:     "fan_in_strategy",
+					Attr:     "fan_in_strategy",
+					Severity: SeverityError,
+					Message:  "fan_in_strategy=command requires fan_in_command",
+					NodeID:   id,
+				})
+			}
+		default:
+			diags = append(diags, Diagnostic{
+				Rule:     "fan_in_strategy",
+				Attr:     "fan_in_strategy",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("unknown fan_in_strategy %q", strategy),
+				NodeID:   id,
+				Fix:      "use heuristic, llm, command, or merge",
+			})
+		}
+	}
+	return diags
+}
+
 func lintPromptOnCodergenNodes(g *model.Graph) []Diagnostic {
 	var diags []Diagnostic
 	for id, n := range g.Nodes {
@@ -806,6 +970,7 @@ func lintStatusContractInPrompt(g *model.Graph) []Diagnostic {
 		}
 		diags = append(diags, Diagnostic{
 			Rule:     "status_contract_in_prompt",
+			Attr:     n.PromptAttr(),
 			Severity: SeverityWarning,
 			Message:  "codergen node prompt does not reference KILROY_STAGE_STATUS_PATH or KILROY_STAGE_STATUS_FALLBACK_PATH; node cannot write status.json and custom outcome routing will be lost",
 			NodeID:   id,
@@ -831,6 +996,7 @@ func lintPromptOnConditionalNodes(g *model.Graph) []Diagnostic {
 		if strings.TrimSpace(n.Prompt()) != "" {
 			diags = append(diags, Diagnostic{
 				Rule:     "prompt_on_conditional_node",
+				Attr:     n.PromptAttr(),
 				Severity: SeverityWarning,
 				Message:  "diamond (conditional) node has a prompt that will be ignored; use shape=box if the prompt should execute",
 				NodeID:   id,
@@ -952,6 +1118,7 @@ func lintLoopRestartFailureClassGuard(g *model.Graph) []Diagnostic {
 		}
 		diags = append(diags, Diagnostic{
 			Rule:     "loop_restart_failure_class_guard",
+			Attr:     "loop_restart",
 			Severity: SeverityWarning,
 			Message:  "loop_restart=true requires condition guarded by context.failure_class=transient_infra",
 			EdgeFrom: e.From,
@@ -979,6 +1146,7 @@ func lintLoopRestartFailureClassGuard(g *model.Graph) []Diagnostic {
 		if !hasDeterministicFallback {
 			diags = append(diags, Diagnostic{
 				Rule:     "loop_restart_failure_class_guard",
+				Attr:     "loop_restart",
 				Severity: SeverityWarning,
 				Message:  "node with transient-infra loop_restart must also have a non-restart edge for deterministic failures",
 				EdgeFrom: from,
@@ -1012,6 +1180,7 @@ func lintFailLoopFailureClassGuard(g *model.Graph) []Diagnostic {
 		}
 		diags = append(diags, Diagnostic{
 			Rule:     "fail_loop_failure_class_guard",
+			Attr:     "condition",
 			Severity: SeverityWarning,
 			Message:  "failure back-edge from conditional node should guard retry path with context.failure_class and provide deterministic fallback routing",
 			EdgeFrom: e.From,
@@ -1203,6 +1372,7 @@ func lintPromptFileConflict(g *model.Graph) []Diagnostic {
 		if hasPrompt {
 			diags = append(diags, Diagnostic{
 				Rule:     "prompt_file_conflict",
+				Attr:     "prompt_file",
 				Severity: SeverityError,
 				Message:  fmt.Sprintf("node has both prompt_file and prompt/llm_prompt — use one or the other"),
 				NodeID:   id,
@@ -1232,6 +1402,7 @@ func lintEscalationModelsSyntax(g *model.Graph) []Diagnostic {
 			if idx < 0 {
 				diags = append(diags, Diagnostic{
 					Rule:     "escalation_models_syntax",
+					Attr:     "escalation_models",
 					Severity: SeverityWarning,
 					Message:  fmt.Sprintf("escalation_models entry %q missing colon separator (expected provider:model)", entry),
 					NodeID:   id,
@@ -1244,6 +1415,7 @@ func lintEscalationModelsSyntax(g *model.Graph) []Diagnostic {
 			if prov == "" {
 				diags = append(diags, Diagnostic{
 					Rule:     "escalation_models_syntax",
+					Attr:     "escalation_models",
 					Severity: SeverityWarning,
 					Message:  fmt.Sprintf("escalation_models entry %q has empty provider", entry),
 					NodeID:   id,
@@ -1252,6 +1424,7 @@ func lintEscalationModelsSyntax(g *model.Graph) []Diagnostic {
 			if mod == "" {
 				diags = append(diags, Diagnostic{
 					Rule:     "escalation_models_syntax",
+					Attr:     "escalation_models",
 					Severity: SeverityWarning,
 					Message:  fmt.Sprintf("escalation_models entry %q has empty model", entry),
 					NodeID:   id,
@@ -1293,6 +1466,7 @@ func (r *TypeKnownRule) Apply(g *model.Graph) []Diagnostic {
 		if !r.KnownTypes[t] {
 			diags = append(diags, Diagnostic{
 				Rule:     "type_known",
+				Attr:     "type",
 				Severity: SeverityWarning,
 				Message:  fmt.Sprintf("node type %q is not recognized by the handler registry", t),
 				NodeID:   id,
@@ -1320,6 +1494,7 @@ func lintToolCommandAbsPath(g *model.Graph) []Diagnostic {
 		if toolCommandAbsPathPattern.MatchString(cmd) {
 			diags = append(diags, Diagnostic{
 				Rule:     "tool_command_abs_path",
+				Attr:     "tool_command",
 				Severity: SeverityWarning,
 				Message:  fmt.Sprintf("tool_command contains 'cd /…' which overrides the engine worktree CWD"),
 				NodeID:   id,
@@ -1566,6 +1741,7 @@ func lintStatusOutcomeFieldConfusion(g *model.Graph) []Diagnostic {
 		}
 		diags = append(diags, Diagnostic{
 			Rule:     "status_outcome_field_confusion",
+			Attr:     n.PromptAttr(),
 			Severity: SeverityError,
 			NodeID:   id,
 			Message:  `prompt instructs agent to write {"status":"<canonical>","outcome":"..."} — the "outcome" JSON key is silently discarded by the runtime decoder; only the "status" field drives edge-condition matching`,
@@ -1642,6 +1818,7 @@ func lintCustomOutcomeCoverage(g *model.Graph) []Diagnostic {
 			if !written[strings.ToLower(val)] {
 				diags = append(diags, Diagnostic{
 					Rule:     "custom_outcome_coverage",
+					Attr:     n.PromptAttr(),
 					Severity: SeverityWarning,
 					NodeID:   id,
 					Message:  fmt.Sprintf(`outgoing edge requires condition="outcome=%s" but prompt contains no \"status\":\"%s\" write instruction — the conditional edge will never fire`, val, val),
@@ -1677,6 +1854,7 @@ func lintStatusFallbackInPrompt(g *model.Graph) []Diagnostic {
 		if hasPrimary && !hasFallback {
 			diags = append(diags, Diagnostic{
 				Rule:     "status_fallback_in_prompt",
+				Attr:     n.PromptAttr(),
 				Severity: SeverityWarning,
 				Message:  "codergen node prompt references $KILROY_STAGE_STATUS_PATH but omits $KILROY_STAGE_STATUS_FALLBACK_PATH; if the primary write fails the engine has no recovery signal",
 				NodeID:   id,
@@ -101,6 +101,107 @@ digraph G {
 	assertHasRule(t, diags, "condition_syntax", SeverityError)
 }
 
+func TestValidate_ContextCompactionValid(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="x", context_compaction=truncate]
+  b [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="y", context_compaction=summarize]
+  start -> a -> b -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var got []Diagnostic
+	for _, d := range Validate(g) {
+		if d.Rule == "context_compaction_valid" {
+			got = append(got, d)
+		}
+	}
+	if len(got) != 1 || got[0].NodeID != "a" || got[0].Severity != SeverityWarning {
+		t.Fatalf("context_compaction_valid diagnostics: %+v", got)
+	}
+}
+
+func TestValidate_ManagerSteerConfig(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  m1 [shape=house, manager.actions="observe,steer,wait"]
+  m2 [shape=house, manager.actions="observe,steer,wait", manager.steer_condition="context.tests=failing", manager.steer_message="fix the tests first"]
+  m3 [shape=house, manager.actions="observe,wait", manager.steer_condition="context.tests="]
+  start -> m1 -> m2 -> m3 -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	got := map[string]Severity{}
+	for _, d := range Validate(g) {
+		if d.Rule == "manager_steer_config" {
+			got[d.NodeID] = d.Severity
+		}
+	}
+	if len(got) != 2 || got["m1"] != SeverityWarning || got["m3"] != SeverityError {
+		t.Fatalf("manager_steer_config diagnostics: %+v", got)
+	}
+}
+
+func TestValidate_StackCallConfig(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  c1 [shape=house, type="stack.call"]
+  c2 [shape=house, type="stack.call", stack.call_dotfile="loop.dot", stack.call_inputs="task=plan.task, spec", stack.call_outputs="result="]
+  c3 [shape=house, type="stack.call", stack.call_dotfile="loop.dot", stack.call_inputs="task=plan.task, spec", stack.call_outputs="result=loop.result"]
+  start -> c1 -> c2 -> c3 -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	got := map[string]int{}
+	for _, d := range Validate(g) {
+		if d.Rule == "stack_call_config" && d.Severity == SeverityError {
+			got[d.NodeID]++
+		}
+	}
+	if len(got) != 2 || got["c1"] != 1 || got["c2"] != 1 {
+		t.Fatalf("stack_call_config diagnostics: %+v", got)
+	}
+}
+
+func TestValidate_FanInStrategy(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  j1 [shape=tripleoctagon, fan_in_strategy=merge]
+  j2 [shape=tripleoctagon, fan_in_strategy=command]
+  j3 [shape=tripleoctagon, fan_in_strategy=llm]
+  j4 [shape=tripleoctagon, fan_in_strategy=vote]
+  j5 [shape=tripleoctagon, fan_in_strategy=command, fan_in_command="go test ./..."]
+  start -> j1 -> j2 -> j3 -> j4 -> j5 -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	got := map[string]Severity{}
+	for _, d := range Validate(g) {
+		if d.Rule == "fan_in_strategy" {
+			got[d.NodeID] = d.Severity
+		}
+	}
+	if len(got) != 3 || got["j2"] != SeverityError || got["j3"] != SeverityWarning || got["j4"] != SeverityError {
+		t.Fatalf("fan_in_strategy diagnostics: %+v", got)
+	}
+}
+
 func TestValidate_LLMProviderRequired_Metaspec(t *testing.T) {
 	g, err := dot.Parse([]byte(`
 digraph G {
@@ -659,6 +760,12 @@ func TestLintConditionSyntax_ValidConditions(t *testing.T) {
 		"context.failure_class!=transient_infra",
 		"preferred_label=Yes",
 		"my_key=some_value",
+		"outcome=success || outcome=partial_success",
+		"(outcome=fail && context.retry_count>=3) || context.failure_class=deterministic",
+		"context.retry_count > 3",
+		"outcome in [success, partial_success]",
+		"context.log contains FAILED",
+		"context.log matches ^ok",
 	}
 
 	for _, cond := range validConds {
@@ -685,15 +792,29 @@ digraph G {
 	}
 }
 
+func TestValidateConditionSyntax_RejectsMalformedExtendedConditions(t *testing.T) {
+	for _, c := range []string{
+		"outcome=success ||",
+		"(outcome=success",
+		"context.retry_count > many",
+		"outcome in [success,]",
+		"context.log matches (",
+		"context.bad-key=1",
+		"outcome=",
+	} {
+		if err := validateConditionSyntax(c); err == nil {
+			t.Errorf("validateConditionSyntax(%q): expected error", c)
+		}
+	}
+}
+
 // TestLintConditionSyntax_SyntaxRejectsGreaterThanOperator verifies that
-// "outcome>success" produces a condition_syntax ERROR. Note: cond.Evaluate
-// is never reached for inputs that fail validateConditionSyntax, so this
-// test exercises only the syntax-checker path. The Evaluate error paths in
-// evalClause are unreachable for inputs that pass syntax check (SplitN with
-// a known operator always returns exactly 2 parts); the guard remains as a
-// forward-compatibility safety net.
+// "outcome>success" produces a condition_syntax ERROR: ">" is a numeric
+// comparison and "success" is not a number. Note: cond.Evaluate is never
+// reached for inputs that fail validateConditionSyntax, so this test
+// exercises only the syntax-checker path.
 func TestLintConditionSyntax_SyntaxRejectsGreaterThanOperator(t *testing.T) {
-	// Invalid condition: uses ">" which validateConditionSyntax rejects.
+	// Invalid condition: ">" with a non-numeric literal.
 	g, err := dot.Parse([]byte(`
 digraph G {
   start [shape=Mdiamond]
@@ -82,6 +82,17 @@ func KilroyAttractorRegistryBundle() (bundleID string, bundle RegistryBundle, sh
 				"5": field("output", "string", opt()),
 				"6": field("is_error", "bool", opt()),
 			}),
+			"com.kilroy.attractor.ContextCompacted": typeDef(map[string]any{
+				"1": field("run_id", "string"),
+				"2": field("node_id", "string", opt()),
+				"3": fieldSemantic("timestamp_ms", "u64", "unix_ms"),
+				"4": field("mode", "string"),
+				"5": field("trigger", "string", opt()),
+				"6": field("turns_compacted", "u32", opt()),
+				"7": fieldSemantic("approx_tokens_before", "u64", "count", opt()),
+				"8": fieldSemantic("approx_tokens_after", "u64", "count", opt()),
+				"9": fieldSemantic("context_window_size", "u64", "count", opt()),
+			}),
 			"com.kilroy.attractor.Blob": typeDef(map[string]any{
 				"1": field("bytes", "bytes"),
 			}),
@@ -204,6 +215,15 @@ func KilroyAttractorRegistryBundle() (bundleID string, bundle RegistryBundle, sh
 				"4": field("question_text", "string", opt()),
 				"5": fieldSemantic("duration_ms", "u64", "duration_ms", opt()),
 			}),
+			// Manager loop steering (spec §4.11).
+			"com.kilroy.attractor.ManagerSteer": typeDef(map[string]any{
+				"1": field("run_id", "string"),
+				"2": field("node_id", "string"),
+				"3": fieldSemantic("timestamp_ms", "u64", "unix_ms"),
+				"4": field("source", "string", opt()),
+				"5": field("message", "string", opt()),
+				"6": fieldArray("delivered_to", "string", opt()),
+			}),
 		},
 		Enums: map[string]any{},
 	}
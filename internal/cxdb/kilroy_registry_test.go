@@ -22,6 +22,8 @@ func TestKilroyAttractorRegistryBundle_IncludesRequiredTypes(t *testing.T) {
 		"com.kilroy.attractor.StageFinished",
 		"com.kilroy.attractor.ToolCall",
 		"com.kilroy.attractor.ToolResult",
+		"com.kilroy.attractor.ContextCompacted",
+		"com.kilroy.attractor.ManagerSteer",
 		"com.kilroy.attractor.Artifact",
 		"com.kilroy.attractor.GitCheckpoint",
 		"com.kilroy.attractor.CheckpointSaved",
@@ -0,0 +1,281 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type CassetteMode string
+
+const (
+	// CassetteRecord forwards calls to the provider and stores every successful
+	// request/response pair.
+	CassetteRecord CassetteMode = "record"
+	// CassetteReplay answers calls from stored entries and never reaches the provider.
+	CassetteReplay CassetteMode = "replay"
+)
+
+// Cassette is a Middleware that records provider traffic to a directory and plays it
+// back. Entries are keyed by a hash of the normalized request, so a replayed run only
+// hits the cassette if it sends the same requests in the same order per key.
+//
+// Identical requests are disambiguated by a per-key sequence number: the Nth identical
+// request during replay receives the Nth recorded answer.
+type Cassette struct {
+	Dir  string
+	Mode CassetteMode
+
+	// Normalize rewrites the canonical request JSON before hashing (for example to mask
+	// run-specific paths or dates). In record mode it is also applied to the stored
+	// response so Expand can reverse it on replay. Nil means identity.
+	Normalize func(string) string
+	// Expand rewrites stored response JSON before it is decoded during replay.
+	// Nil means identity.
+	Expand func(string) string
+
+	mu  sync.Mutex
+	seq map[string]int
+}
+
+// NewCassette returns a cassette rooted at dir. Record mode creates dir; replay mode
+// requires it to exist.
+func NewCassette(dir string, mode CassetteMode) (*Cassette, error) {
+	switch mode {
+	case CassetteRecord:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	case CassetteReplay:
+		st, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("cassette: %w", err)
+		}
+		if !st.IsDir() {
+			return nil, fmt.Errorf("cassette: %s is not a directory", dir)
+		}
+	default:
+		return nil, fmt.Errorf("cassette: unknown mode %q", mode)
+	}
+	return &Cassette{Dir: dir, Mode: mode, seq: map[string]int{}}, nil
+}
+
+// CassetteMissError is returned in replay mode when no recorded entry matches a request.
+// It is not retryable: replaying the same request again cannot succeed.
+type CassetteMissError struct {
+	Key  string
+	Seq  int
+	Kind string
+	Dir  string
+}
+
+func (e *CassetteMissError) Error() string {
+	return fmt.Sprintf("cassette miss: no recorded %s response for request %s (#%d) in %s; the run diverged from the recording", e.Kind, e.Key, e.Seq, e.Dir)
+}
+func (e *CassetteMissError) Provider() string           { return "" }
+func (e *CassetteMissError) StatusCode() int            { return 0 }
+func (e *CassetteMissError) Retryable() bool            { return false }
+func (e *CassetteMissError) RetryAfter() *time.Duration { return nil }
+
+type cassetteEntry struct {
+	Key        string          `json:"key"`
+	Seq        int             `json:"seq"`
+	Kind       string          `json:"kind"` // complete|stream
+	Request    json.RawMessage `json:"request"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Events     json.RawMessage `json:"events,omitempty"`
+	RecordedAt string          `json:"recorded_at"`
+}
+
+// cassetteEvent is a StreamEvent with its error preserved as text.
+type cassetteEvent struct {
+	StreamEvent
+	Error string `json:"error,omitempty"`
+}
+
+// CassetteKey returns the stable hash for req. Metadata is excluded because it carries
+// per-call bookkeeping rather than prompt content.
+func CassetteKey(req Request, normalize func(string) string) (key string, canonical string, err error) {
+	req.Metadata = nil
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", "", err
+	}
+	canonical = string(b)
+	if normalize != nil {
+		canonical = normalize(canonical)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])[:24], canonical, nil
+}
+
+func (c *Cassette) nextSeq(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seq == nil {
+		c.seq = map[string]int{}
+	}
+	n := c.seq[key]
+	c.seq[key] = n + 1
+	return n
+}
+
+func (c *Cassette) entryPath(key string, seq int) string {
+	return filepath.Join(c.Dir, fmt.Sprintf("%s.%d.json", key, seq))
+}
+
+func (c *Cassette) normalize(s string) string {
+	if c.Normalize == nil {
+		return s
+	}
+	return c.Normalize(s)
+}
+
+func (c *Cassette) expand(s string) string {
+	if c.Expand == nil {
+		return s
+	}
+	return c.Expand(s)
+}
+
+func (c *Cassette) save(kind, key, canonical string, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	e := cassetteEntry{
+		Key:        key,
+		Seq:        c.nextSeq(key),
+		Kind:       kind,
+		Request:    json.RawMessage(canonical),
+		RecordedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if kind == "stream" {
+		e.Events = json.RawMessage(c.normalize(string(b)))
+	} else {
+		e.Response = json.RawMessage(c.normalize(string(b)))
+	}
+	out, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := c.entryPath(key, e.Seq)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (c *Cassette) load(kind, key string) (*cassetteEntry, error) {
+	seq := c.nextSeq(key)
+	b, err := os.ReadFile(c.entryPath(key, seq))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &CassetteMissError{Key: key, Seq: seq, Kind: kind, Dir: c.Dir}
+		}
+		return nil, err
+	}
+	var e cassetteEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("cassette entry %s.%d: %w", key, seq, err)
+	}
+	if e.Kind != kind {
+		return nil, &CassetteMissError{Key: key, Seq: seq, Kind: kind, Dir: c.Dir}
+	}
+	return &e, nil
+}
+
+func (c *Cassette) WrapComplete(next CompleteFunc) CompleteFunc {
+	return func(ctx context.Context, req Request) (Response, error) {
+		key, canonical, err := CassetteKey(req, c.Normalize)
+		if err != nil {
+			return Response{}, err
+		}
+		if c.Mode == CassetteReplay {
+			e, err := c.load("complete", key)
+			if err != nil {
+				return Response{}, err
+			}
+			var resp Response
+			if err := json.Unmarshal([]byte(c.expand(string(e.Response))), &resp); err != nil {
+				return Response{}, fmt.Errorf("cassette entry %s.%d: %w", key, e.Seq, err)
+			}
+			return resp, nil
+		}
+		resp, err := next(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		if err := c.save("complete", key, canonical, resp); err != nil {
+			return resp, fmt.Errorf("cassette record: %w", err)
+		}
+		return resp, nil
+	}
+}
+
+func (c *Cassette) WrapStream(next StreamFunc) StreamFunc {
+	return func(ctx context.Context, req Request) (Stream, error) {
+		key, canonical, err := CassetteKey(req, c.Normalize)
+		if err != nil {
+			return nil, err
+		}
+		if c.Mode == CassetteReplay {
+			e, err := c.load("stream", key)
+			if err != nil {
+				return nil, err
+			}
+			var evs []cassetteEvent
+			if err := json.Unmarshal([]byte(c.expand(string(e.Events))), &evs); err != nil {
+				return nil, fmt.Errorf("cassette entry %s.%d: %w", key, e.Seq, err)
+			}
+			out := NewChanStream(nil)
+			go func() {
+				defer out.CloseSend()
+				for _, ev := range evs {
+					if ev.Error != "" {
+						ev.Err = errors.New(ev.Error)
+					}
+					out.Send(ev.StreamEvent)
+				}
+			}()
+			return out, nil
+		}
+		inner, err := next(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		// Closing the inner stream asynchronously keeps Close from deadlocking when the
+		// forwarder below is blocked handing an event to the consumer.
+		out := NewChanStream(func() { go inner.Close() })
+		go func() {
+			defer out.CloseSend()
+			var evs []cassetteEvent
+			finished := false
+			for ev := range inner.Events() {
+				ce := cassetteEvent{StreamEvent: ev}
+				if ev.Err != nil {
+					ce.Error = ev.Err.Error()
+				}
+				evs = append(evs, ce)
+				if ev.Type == StreamEventFinish {
+					finished = true
+				}
+				out.Send(ev)
+			}
+			_ = inner.Close()
+			// Only complete streams are useful to replay.
+			if finished {
+				_ = c.save("stream", key, canonical, evs)
+			}
+		}()
+		return out, nil
+	}
+}
@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingAdapter struct {
+	name  string
+	calls int
+}
+
+func (a *countingAdapter) Name() string { return a.name }
+func (a *countingAdapter) Complete(ctx context.Context, req Request) (Response, error) {
+	a.calls++
+	return Response{Provider: a.name, Model: req.Model, Message: Assistant("answer to " + req.Messages[len(req.Messages)-1].Text())}, nil
+}
+func (a *countingAdapter) Stream(ctx context.Context, req Request) (Stream, error) {
+	a.calls++
+	s := NewChanStream(nil)
+	go func() {
+		defer s.CloseSend()
+		s.Send(StreamEvent{Type: StreamEventTextDelta, Delta: "hel"})
+		s.Send(StreamEvent{Type: StreamEventTextDelta, Delta: "lo"})
+		s.Send(StreamEvent{Type: StreamEventFinish, FinishReason: &FinishReason{Reason: FinishReasonStop}})
+	}()
+	return s, nil
+}
+
+func drainStream(t *testing.T, s Stream) string {
+	t.Helper()
+	defer s.Close()
+	var b strings.Builder
+	for ev := range s.Events() {
+		b.WriteString(ev.Delta)
+		if ev.Type == StreamEventFinish {
+			b.WriteString("|" + ev.FinishReason.Reason)
+		}
+	}
+	return b.String()
+}
+
+func TestCassette_RecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Mask a run-specific path so a rerun in a different directory still hits.
+	normalize := func(wt string) func(string) string {
+		return func(s string) string { return strings.ReplaceAll(s, wt, "{{wt}}") }
+	}
+
+	rec, err := NewCassette(dir, CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Normalize = normalize("/tmp/run-1")
+	live := &countingAdapter{name: "openai"}
+	c := NewClient()
+	c.Register(live)
+	c.Use(rec)
+	for _, msg := range []string{"edit /tmp/run-1/a.go", "again", "again"} {
+		if _, err := c.Complete(ctx, Request{Model: "m", Messages: []Message{User(msg)}}); err != nil {
+			t.Fatalf("record complete: %v", err)
+		}
+	}
+	st, err := c.Stream(ctx, Request{Model: "m", Messages: []Message{User("stream")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := drainStream(t, st); got != "hello|stop" {
+		t.Fatalf("recorded stream: %q", got)
+	}
+
+	play, err := NewCassette(dir, CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	play.Normalize = normalize("/tmp/run-2")
+	play.Expand = func(s string) string { return strings.ReplaceAll(s, "{{wt}}", "/tmp/run-2") }
+	offline := &countingAdapter{name: "openai"}
+	c = NewClient()
+	c.Register(offline)
+	c.Use(play)
+	resp, err := c.Complete(ctx, Request{Model: "m", Messages: []Message{User("edit /tmp/run-2/a.go")}})
+	if err != nil {
+		t.Fatalf("replay complete: %v", err)
+	}
+	if resp.Text() != "answer to edit /tmp/run-2/a.go" {
+		t.Fatalf("replayed text: %q", resp.Text())
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Complete(ctx, Request{Model: "m", Messages: []Message{User("again")}}); err != nil {
+			t.Fatalf("replay repeated request %d: %v", i, err)
+		}
+	}
+	st, err = c.Stream(ctx, Request{Model: "m", Messages: []Message{User("stream")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := drainStream(t, st); got != "hello|stop" {
+		t.Fatalf("replayed stream: %q", got)
+	}
+	if offline.calls != 0 {
+		t.Fatalf("replay reached the provider %d times", offline.calls)
+	}
+
+	// A third identical request was never recorded.
+	_, err = c.Complete(ctx, Request{Model: "m", Messages: []Message{User("again")}})
+	var miss *CassetteMissError
+	if !errors.As(err, &miss) || miss.Seq != 2 {
+		t.Fatalf("expected cassette miss, got %v", err)
+	}
+	if _, err := c.Complete(ctx, Request{Model: "m", Messages: []Message{User("new prompt")}}); !errors.As(err, &miss) {
+		t.Fatalf("expected cassette miss for unseen request, got %v", err)
+	}
+}
+
+func TestCassetteKey_IgnoresMetadata(t *testing.T) {
+	a, _, _ := CassetteKey(Request{Model: "m", Messages: []Message{User("x")}, Metadata: map[string]string{"node": "a"}}, nil)
+	b, _, _ := CassetteKey(Request{Model: "m", Messages: []Message{User("x")}}, nil)
+	if a != b {
+		t.Fatalf("metadata changed the key: %s vs %s", a, b)
+	}
+	c, _, _ := CassetteKey(Request{Model: "m2", Messages: []Message{User("x")}}, nil)
+	if a == c {
+		t.Fatal("model should change the key")
+	}
+}
@@ -95,6 +95,12 @@ func ErrorFromHTTPStatus(provider string, statusCode int, message string, raw an
 		base.retryable = false
 		return &ContextLengthError{base}
 	case 429:
+		// An exhausted quota or billing limit also arrives as 429 (OpenAI and
+		// Azure code insufficient_quota) but does not clear by waiting.
+		if strings.Contains(strings.ToLower(message), "insufficient_quota") {
+			base.retryable = false
+			return &QuotaExceededError{base}
+		}
 		base.retryable = true
 		return &RateLimitError{base}
 	case 500, 502, 503, 504:
@@ -112,9 +118,12 @@ func ErrorFromHTTPStatus(provider string, statusCode int, message string, raw an
 func classifyByMessage(base httpErrorBase) error {
 	lower := strings.ToLower(base.message)
 	switch {
-	case strings.Contains(lower, "content filter") || strings.Contains(lower, "safety"):
+	case strings.Contains(lower, "content filter") || strings.Contains(lower, "safety"),
+		// Azure OpenAI: code content_filter, innererror ResponsibleAIPolicyViolation.
+		strings.Contains(lower, "content_filter") || strings.Contains(lower, "responsibleaipolicyviolation"):
 		return &ContentFilterError{base}
-	case strings.Contains(lower, "context length") || strings.Contains(lower, "too many tokens"):
+	case strings.Contains(lower, "context length") || strings.Contains(lower, "too many tokens") ||
+		strings.Contains(lower, "context_length_exceeded"):
 		return &ContextLengthError{base}
 	case strings.Contains(lower, "quota") || strings.Contains(lower, "billing"):
 		return &QuotaExceededError{base}
@@ -154,6 +154,9 @@ func TestErrorFromHTTPStatus_MessageBasedClassification(t *testing.T) {
 		{"401 always auth", 401, "content filter something", "*llm.AuthenticationError"},
 		{"429 always rate", 429, "quota exceeded", "*llm.RateLimitError"},
 		{"404 always notfound", 404, "quota exceeded", "*llm.NotFoundError"},
+		{"400 azure content_filter", 400, "map[error:map[code:content_filter innererror:map[code:ResponsibleAIPolicyViolation]]]", "*llm.ContentFilterError"},
+		{"400 context_length_exceeded", 400, "map[error:map[code:context_length_exceeded]]", "*llm.ContextLengthError"},
+		{"429 insufficient_quota", 429, "map[error:map[code:insufficient_quota]]", "*llm.QuotaExceededError"},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -9,7 +9,6 @@ import (
 	"os"
 	"sort"
 	"strings"
-	"time"
 
 	"github.com/danshapiro/kilroy/internal/llm"
 	"github.com/danshapiro/kilroy/internal/modelmeta"
@@ -21,6 +20,8 @@ type Adapter struct {
 	APIKey   string
 	BaseURL  string
 	Client   *http.Client
+	// Azure, when set, routes requests to an Azure OpenAI resource.
+	Azure *AzureConfig
 }
 
 func init() {
@@ -81,7 +82,7 @@ func (a *Adapter) Complete(ctx context.Context, req llm.Request) (llm.Response,
 	}
 
 	body := map[string]any{
-		"model":               modelmeta.ProviderRelativeModelID("openai", req.Model),
+		"model":               modelmeta.ProviderRelativeModelID("openai", a.wireModel(req.Model)),
 		"instructions":        instructions,
 		"input":               inputItems,
 		"parallel_tool_calls": false, // safer default; can be overridden later per profile
@@ -132,11 +133,11 @@ func (a *Adapter) Complete(ctx context.Context, req llm.Request) (llm.Response,
 		return llm.Response{}, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.BaseURL+"/v1/responses", bytes.NewReader(b))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint(req.Model), bytes.NewReader(b))
 	if err != nil {
 		return llm.Response{}, err
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+a.APIKey)
+	a.setAuth(httpReq.Header)
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := a.Client.Do(httpReq)
@@ -152,12 +153,13 @@ func (a *Adapter) Complete(ctx context.Context, req llm.Request) (llm.Response,
 		return llm.Response{}, err
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		ra := llm.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
 		msg := fmt.Sprintf("responses.create failed: %v", raw)
-		return llm.Response{}, llm.ErrorFromHTTPStatus(a.Name(), resp.StatusCode, msg, raw, ra)
+		return llm.Response{}, llm.ErrorFromHTTPStatus(a.Name(), resp.StatusCode, msg, raw, retryAfter(resp.Header))
 	}
 
-	return fromResponses(a.Name(), raw, req.Model), nil
+	out := fromResponses(a.Name(), raw, req.Model)
+	out.RateLimit = rateLimitFromHeaders(resp.Header)
+	return out, nil
 }
 
 func (a *Adapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
@@ -173,7 +175,7 @@ func (a *Adapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, erro
 	}
 
 	body := map[string]any{
-		"model":               req.Model,
+		"model":               a.wireModel(req.Model),
 		"instructions":        instructions,
 		"input":               inputItems,
 		"parallel_tool_calls": false,
@@ -225,12 +227,12 @@ func (a *Adapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, erro
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(sctx, http.MethodPost, a.BaseURL+"/v1/responses", bytes.NewReader(b))
+	httpReq, err := http.NewRequestWithContext(sctx, http.MethodPost, a.endpoint(req.Model), bytes.NewReader(b))
 	if err != nil {
 		cancel()
 		return nil, err
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+a.APIKey)
+	a.setAuth(httpReq.Header)
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := a.Client.Do(httpReq)
@@ -246,10 +248,9 @@ func (a *Adapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, erro
 		dec := json.NewDecoder(resp.Body)
 		dec.UseNumber()
 		_ = dec.Decode(&raw)
-		ra := llm.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
 		msg := fmt.Sprintf("responses.create(stream) failed: %v", raw)
 		cancel()
-		return nil, llm.ErrorFromHTTPStatus(a.Name(), resp.StatusCode, msg, raw, ra)
+		return nil, llm.ErrorFromHTTPStatus(a.Name(), resp.StatusCode, msg, raw, retryAfter(resp.Header))
 	}
 
 	s := llm.NewChanStream(cancel)
@@ -399,6 +400,7 @@ func (a *Adapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, erro
 					rawResp = payload
 				}
 				r := fromResponses(a.Name(), rawResp, req.Model)
+				r.RateLimit = rateLimitFromHeaders(resp.Header)
 				// Ensure text segment is closed.
 				if textStarted {
 					s.Send(llm.StreamEvent{Type: llm.StreamEventTextEnd, TextID: textID})
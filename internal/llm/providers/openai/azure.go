@@ -0,0 +1,138 @@
+package openai
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+	"github.com/danshapiro/kilroy/internal/modelmeta"
+	"github.com/danshapiro/kilroy/internal/providerspec"
+)
+
+const (
+	DefaultAzurePath       = "/openai/responses"
+	DefaultAzureAPIVersion = "2025-04-01-preview"
+)
+
+// AzureConfig routes an Adapter to an Azure OpenAI resource. Requests and
+// responses keep the Responses API shape; only routing and auth differ.
+type AzureConfig struct {
+	// Path is the Responses endpoint path. A {deployment} placeholder is
+	// replaced with the deployment name for deployment-scoped gateways.
+	Path string
+	// APIVersion is sent as the api-version query parameter.
+	APIVersion string
+	// Deployments maps model ids to deployment names. Models without an entry
+	// are sent under their own id, matching deployments named after models.
+	Deployments map[string]string
+}
+
+// NewAzure returns an adapter for an Azure OpenAI resource at baseURL
+// (https://<resource>.openai.azure.com).
+func NewAzure(provider, apiKey, baseURL string, cfg AzureConfig) *Adapter {
+	p := providerspec.CanonicalProviderKey(provider)
+	if p == "" {
+		p = "azure"
+	}
+	if strings.TrimSpace(cfg.Path) == "" {
+		cfg.Path = DefaultAzurePath
+	}
+	if strings.TrimSpace(cfg.APIVersion) == "" {
+		cfg.APIVersion = DefaultAzureAPIVersion
+	}
+	deployments := map[string]string{}
+	for model, dep := range cfg.Deployments {
+		deployments[strings.TrimSpace(model)] = strings.TrimSpace(dep)
+	}
+	cfg.Deployments = deployments
+	return &Adapter{
+		Provider: p,
+		APIKey:   strings.TrimSpace(apiKey),
+		BaseURL:  strings.TrimRight(strings.TrimSpace(baseURL), "/"),
+		Client:   &http.Client{Timeout: 0},
+		Azure:    &cfg,
+	}
+}
+
+// deployment resolves the Azure deployment for a model id.
+func (c *AzureConfig) deployment(model string) string {
+	model = strings.TrimSpace(model)
+	if dep := c.Deployments[model]; dep != "" {
+		return dep
+	}
+	rel := modelmeta.ProviderRelativeModelID("openai", model)
+	if dep := c.Deployments[rel]; dep != "" {
+		return dep
+	}
+	return rel
+}
+
+// endpoint is the Responses URL for model.
+func (a *Adapter) endpoint(model string) string {
+	if a.Azure == nil {
+		return a.BaseURL + "/v1/responses"
+	}
+	path := strings.ReplaceAll(a.Azure.Path, "{deployment}", url.PathEscape(a.Azure.deployment(model)))
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return a.BaseURL + path + sep + "api-version=" + url.QueryEscape(a.Azure.APIVersion)
+}
+
+// wireModel is the model field sent in the request body; Azure expects the
+// deployment name.
+func (a *Adapter) wireModel(model string) string {
+	if a.Azure == nil {
+		return model
+	}
+	return a.Azure.deployment(model)
+}
+
+func (a *Adapter) setAuth(h http.Header) {
+	if a.Azure != nil {
+		h.Set("api-key", a.APIKey)
+		return
+	}
+	h.Set("Authorization", "Bearer "+a.APIKey)
+}
+
+// retryAfter prefers the millisecond hints Azure sends alongside Retry-After.
+func retryAfter(h http.Header) *time.Duration {
+	for _, name := range []string{"retry-after-ms", "x-ms-retry-after-ms"} {
+		if ms, err := strconv.Atoi(strings.TrimSpace(h.Get(name))); err == nil && ms >= 0 {
+			d := time.Duration(ms) * time.Millisecond
+			return &d
+		}
+	}
+	return llm.ParseRetryAfter(h.Get("Retry-After"), time.Now())
+}
+
+// rateLimitFromHeaders reads the x-ratelimit-* headers that both OpenAI and
+// Azure OpenAI attach to responses.
+func rateLimitFromHeaders(h http.Header) *llm.RateLimitInfo {
+	intHeader := func(name string) *int {
+		n, err := strconv.Atoi(strings.TrimSpace(h.Get(name)))
+		if err != nil {
+			return nil
+		}
+		return &n
+	}
+	info := &llm.RateLimitInfo{
+		RequestsRemaining: intHeader("x-ratelimit-remaining-requests"),
+		RequestsLimit:     intHeader("x-ratelimit-limit-requests"),
+		TokensRemaining:   intHeader("x-ratelimit-remaining-tokens"),
+		TokensLimit:       intHeader("x-ratelimit-limit-tokens"),
+		ResetAt:           strings.TrimSpace(h.Get("x-ratelimit-reset-requests")),
+	}
+	if info.RequestsRemaining == nil && info.RequestsLimit == nil && info.TokensRemaining == nil && info.TokensLimit == nil && info.ResetAt == "" {
+		return nil
+	}
+	return info
+}
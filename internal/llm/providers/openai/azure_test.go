@@ -0,0 +1,130 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+func TestAzureAdapter_RoutesDeploymentWithAPIKeyAndVersion(t *testing.T) {
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/responses" || r.URL.Query().Get("api-version") != "2025-04-01-preview" {
+			t.Errorf("url: %s", r.URL)
+		}
+		if r.Header.Get("api-key") != "k" || r.Header.Get("Authorization") != "" {
+			t.Errorf("auth headers: api-key=%q authorization=%q", r.Header.Get("api-key"), r.Header.Get("Authorization"))
+		}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("x-ratelimit-remaining-requests", "99")
+		w.Header().Set("x-ratelimit-remaining-tokens", "12000")
+		_, _ = w.Write([]byte(`{"id":"resp_1","model":"prod-gpt52","output":[{"type":"message","content":[{"type":"output_text","text":"Hello"}]}],"usage":{"input_tokens":1,"output_tokens":2,"total_tokens":3}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	a := NewAzure("azure", "k", srv.URL, AzureConfig{Deployments: map[string]string{"gpt-5.2": "prod-gpt52"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := a.Complete(ctx, llm.Request{Model: "gpt-5.2", Messages: []llm.Message{llm.User("hi")}})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if gotBody["model"] != "prod-gpt52" {
+		t.Fatalf("expected the deployment name as model, got %v", gotBody["model"])
+	}
+	if resp.Provider != "azure" || resp.Text() != "Hello" {
+		t.Fatalf("response: %+v", resp)
+	}
+	if resp.RateLimit == nil || *resp.RateLimit.RequestsRemaining != 99 || *resp.RateLimit.TokensRemaining != 12000 {
+		t.Fatalf("rate limit: %+v", resp.RateLimit)
+	}
+}
+
+func TestAzureAdapter_DeploymentPathTemplate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/gpt-4.1/responses" || r.URL.Query().Get("api-version") != "preview" {
+			t.Errorf("url: %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","output":[],"usage":{}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	a := NewAzure("azure", "k", srv.URL, AzureConfig{Path: "/openai/deployments/{deployment}/responses", APIVersion: "preview"})
+	if _, err := a.Complete(context.Background(), llm.Request{Model: "gpt-4.1", Messages: []llm.Message{llm.User("hi")}}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+}
+
+func TestAzureAdapter_ErrorShapes(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		body    string
+		check   func(error) bool
+		retryIn time.Duration
+	}{
+		{
+			name:    "throttled",
+			status:  429,
+			header:  map[string]string{"retry-after-ms": "1500", "Retry-After": "2"},
+			body:    `{"error":{"code":"429","message":"Requests to the Responses API have exceeded token rate limit of your current pricing tier. Please retry after 2 seconds."}}`,
+			check:   func(err error) bool { var e *llm.RateLimitError; return errors.As(err, &e) },
+			retryIn: 1500 * time.Millisecond,
+		},
+		{
+			name:   "content filter",
+			status: 400,
+			body:   `{"error":{"code":"content_filter","message":"The response was filtered due to the prompt triggering Azure OpenAI's content management policy.","innererror":{"code":"ResponsibleAIPolicyViolation"}}}`,
+			check:  func(err error) bool { var e *llm.ContentFilterError; return errors.As(err, &e) },
+		},
+		{
+			name:   "deployment not found",
+			status: 404,
+			body:   `{"error":{"code":"DeploymentNotFound","message":"The API deployment for this resource does not exist."}}`,
+			check:  func(err error) bool { var e *llm.NotFoundError; return errors.As(err, &e) },
+		},
+		{
+			name:   "bad key",
+			status: 401,
+			body:   `{"error":{"code":"401","message":"Access denied due to invalid subscription key or wrong API endpoint."}}`,
+			check:  llm.IsAuthenticationError,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tc.header {
+					w.Header().Set(k, v)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			t.Cleanup(srv.Close)
+
+			a := NewAzure("azure", "k", srv.URL, AzureConfig{})
+			_, err := a.Complete(context.Background(), llm.Request{Model: "gpt-5.2", Messages: []llm.Message{llm.User("hi")}})
+			if err == nil || !tc.check(err) {
+				t.Fatalf("unexpected error %T: %v", err, err)
+			}
+			var le llm.Error
+			if !errors.As(err, &le) || le.Provider() != "azure" {
+				t.Fatalf("expected an llm.Error from azure, got %v", err)
+			}
+			if tc.retryIn > 0 && (le.RetryAfter() == nil || *le.RetryAfter() != tc.retryIn) {
+				t.Fatalf("retry_after: %v want %v", le.RetryAfter(), tc.retryIn)
+			}
+		})
+	}
+}
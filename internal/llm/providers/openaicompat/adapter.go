@@ -52,6 +52,18 @@ func NewAdapter(cfg Config) *Adapter {
 
 func (a *Adapter) Name() string { return a.cfg.Provider }
 
+// setHeaders applies auth and extra headers. Keyless local servers get no
+// Authorization header.
+func (a *Adapter) setHeaders(httpReq *http.Request) {
+	if a.cfg.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+a.cfg.APIKey)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range a.cfg.ExtraHeaders {
+		httpReq.Header.Set(k, v)
+	}
+}
+
 func (a *Adapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
 	requestCtx, cancel := withDefaultRequestDeadline(ctx)
 	defer cancel()
@@ -65,11 +77,7 @@ func (a *Adapter) Complete(ctx context.Context, req llm.Request) (llm.Response,
 	if err != nil {
 		return llm.Response{}, llm.WrapContextError(a.cfg.Provider, err)
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+a.cfg.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-	for k, v := range a.cfg.ExtraHeaders {
-		httpReq.Header.Set(k, v)
-	}
+	a.setHeaders(httpReq)
 
 	resp, err := a.client.Do(httpReq)
 	if err != nil {
@@ -101,11 +109,7 @@ func (a *Adapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, erro
 		cancelAll()
 		return nil, llm.WrapContextError(a.cfg.Provider, err)
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+a.cfg.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-	for k, v := range a.cfg.ExtraHeaders {
-		httpReq.Header.Set(k, v)
-	}
+	a.setHeaders(httpReq)
 
 	resp, err := a.client.Do(httpReq)
 	if err != nil {
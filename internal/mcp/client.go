@@ -0,0 +1,257 @@
+// Package mcp is a minimal Model Context Protocol client. It connects to a
+// tool server over stdio or streamable HTTP, lists its tools, and calls them.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// ProtocolVersion is the MCP revision this client speaks.
+const ProtocolVersion = "2025-06-18"
+
+// ServerConfig describes how to reach one MCP server. Exactly one of Command
+// (stdio) or URL (streamable HTTP) must be set.
+type ServerConfig struct {
+	Name string
+
+	// Command starts a stdio server: argv[0] and its arguments.
+	Command []string
+	Env     []string // extra KEY=VALUE entries appended to the parent environment
+	Dir     string
+
+	// URL is the streamable HTTP endpoint.
+	URL     string
+	Headers map[string]string
+}
+
+// Tool is one entry from tools/list.
+type Tool struct {
+	Name        string         `json:"name"`
+	Title       string         `json:"title,omitempty"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// Content is one item of a tools/call result.
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Data     string `json:"data,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	Resource *struct {
+		URI  string `json:"uri"`
+		Text string `json:"text,omitempty"`
+	} `json:"resource,omitempty"`
+}
+
+// CallResult is the result of tools/call.
+type CallResult struct {
+	Content           []Content `json:"content"`
+	StructuredContent any       `json:"structuredContent,omitempty"`
+	IsError           bool      `json:"isError,omitempty"`
+}
+
+// Text renders the result for a model: text items verbatim, other items as
+// short placeholders, and structured content as JSON when there is no text.
+func (r CallResult) Text() string {
+	var parts []string
+	for _, c := range r.Content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "resource":
+			if c.Resource != nil && c.Resource.Text != "" {
+				parts = append(parts, c.Resource.Text)
+			} else if c.Resource != nil {
+				parts = append(parts, fmt.Sprintf("[resource: %s]", c.Resource.URI))
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource: %s]", c.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s: %s]", c.Type, c.MimeType))
+		}
+	}
+	if len(parts) == 0 && r.StructuredContent != nil {
+		if b, err := json.Marshal(r.StructuredContent); err == nil {
+			return string(b)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// RPCError is a JSON-RPC error returned by the server.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// isResponse reports whether m answers a request (rather than being a
+// server-initiated request or notification).
+func (m rpcMessage) isResponse() bool {
+	return m.Method == "" && len(m.ID) > 0 && string(m.ID) != "null"
+}
+
+type transport interface {
+	// call sends req and waits for the response with the same ID.
+	call(ctx context.Context, req rpcRequest) (rpcMessage, error)
+	// notify sends a notification; no response is expected.
+	notify(ctx context.Context, req rpcRequest) error
+	close() error
+}
+
+// Client is a connected MCP session. It is safe for concurrent use.
+type Client struct {
+	name       string
+	t          transport
+	nextID     atomic.Int64
+	serverName string
+}
+
+// Connect starts or dials the server and completes the initialize handshake.
+func Connect(ctx context.Context, cfg ServerConfig) (*Client, error) {
+	var (
+		t   transport
+		err error
+	)
+	switch {
+	case len(cfg.Command) > 0 && strings.TrimSpace(cfg.URL) != "":
+		return nil, fmt.Errorf("mcp server %s: set command or url, not both", cfg.Name)
+	case len(cfg.Command) > 0:
+		t, err = startStdio(cfg)
+	case strings.TrimSpace(cfg.URL) != "":
+		t = newHTTPTransport(cfg)
+	default:
+		return nil, fmt.Errorf("mcp server %s: command or url is required", cfg.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{name: cfg.Name, t: t}
+	if err := c.initialize(ctx); err != nil {
+		_ = t.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Name returns the configured server name.
+func (c *Client) Name() string { return c.name }
+
+// ServerName returns the name the server reported during initialize.
+func (c *Client) ServerName() string { return c.serverName }
+
+func (c *Client) initialize(ctx context.Context) error {
+	var res struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name string `json:"name"`
+		} `json:"serverInfo"`
+	}
+	if err := c.request(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "kilroy", "version": "1"},
+	}, &res); err != nil {
+		return fmt.Errorf("mcp server %s: initialize: %w", c.name, err)
+	}
+	c.serverName = res.ServerInfo.Name
+	if h, ok := c.t.(*httpTransport); ok {
+		h.setProtocolVersion(res.ProtocolVersion)
+	}
+	if err := c.t.notify(ctx, rpcRequest{JSONRPC: "2.0", Method: "notifications/initialized"}); err != nil {
+		return fmt.Errorf("mcp server %s: initialized notification: %w", c.name, err)
+	}
+	return nil
+}
+
+// ListTools returns every tool the server offers, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var out []Tool
+	cursor := ""
+	for {
+		var params map[string]any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		var res struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor,omitempty"`
+		}
+		if err := c.request(ctx, "tools/list", params, &res); err != nil {
+			return nil, fmt.Errorf("mcp server %s: tools/list: %w", c.name, err)
+		}
+		out = append(out, res.Tools...)
+		if res.NextCursor == "" || res.NextCursor == cursor {
+			return out, nil
+		}
+		cursor = res.NextCursor
+	}
+}
+
+// CallTool invokes a tool. A tool-level failure is reported through
+// CallResult.IsError, not the error return.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (CallResult, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	var res CallResult
+	if err := c.request(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &res); err != nil {
+		return CallResult{}, fmt.Errorf("mcp server %s: tools/call %s: %w", c.name, name, err)
+	}
+	return res, nil
+}
+
+// Close shuts down the session (and the server process for stdio).
+func (c *Client) Close() error {
+	if c == nil || c.t == nil {
+		return nil
+	}
+	return c.t.close()
+}
+
+func (c *Client) request(ctx context.Context, method string, params any, out any) error {
+	id := c.nextID.Add(1)
+	msg, err := c.t.call(ctx, rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if out == nil || len(msg.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(msg.Result, out); err != nil {
+		return fmt.Errorf("decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+func idKey(raw json.RawMessage) string {
+	return strings.Trim(strings.TrimSpace(string(raw)), `"`)
+}
@@ -0,0 +1,224 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServerReply answers one JSON-RPC request for the fake "tickets" server.
+// Tools are paged two at a time to exercise cursors.
+func fakeServerReply(method string, params json.RawMessage) (any, *RPCError) {
+	switch method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "fake-tickets", "version": "0"},
+		}, nil
+	case "tools/list":
+		var p struct {
+			Cursor string `json:"cursor"`
+		}
+		_ = json.Unmarshal(params, &p)
+		schema := map[string]any{"type": "object", "properties": map[string]any{"id": map[string]any{"type": "string"}}, "required": []any{"id"}}
+		if p.Cursor == "" {
+			return map[string]any{
+				"tools": []any{
+					map[string]any{"name": "get_ticket", "description": "Fetch a ticket", "inputSchema": schema},
+					map[string]any{"name": "fail", "inputSchema": map[string]any{"type": "object"}},
+				},
+				"nextCursor": "page2",
+			}, nil
+		}
+		return map[string]any{"tools": []any{map[string]any{"name": "list_queues", "inputSchema": map[string]any{"type": "object"}}}}, nil
+	case "tools/call":
+		var p struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		_ = json.Unmarshal(params, &p)
+		switch p.Name {
+		case "get_ticket":
+			return map[string]any{"content": []any{map[string]any{"type": "text", "text": fmt.Sprintf("ticket %v: fix login", p.Arguments["id"])}}}, nil
+		case "fail":
+			return map[string]any{"content": []any{map[string]any{"type": "text", "text": "boom"}}, "isError": true}, nil
+		}
+		return nil, &RPCError{Code: -32602, Message: "unknown tool " + p.Name}
+	}
+	return nil, &RPCError{Code: -32601, Message: "method not found: " + method}
+}
+
+func fakeServerResponse(line []byte) ([]byte, bool) {
+	var msg rpcMessage
+	var req struct {
+		Params json.RawMessage `json:"params"`
+	}
+	if json.Unmarshal(line, &msg) != nil || json.Unmarshal(line, &req) != nil || len(msg.ID) == 0 {
+		return nil, false
+	}
+	result, rpcErr := fakeServerReply(msg.Method, req.Params)
+	out := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+	if rpcErr != nil {
+		out["error"] = rpcErr
+	} else {
+		out["result"] = result
+	}
+	b, _ := json.Marshal(out)
+	return b, true
+}
+
+// TestHelperStdioServer is not a real test: it runs the fake server over
+// stdio when started by the stdio transport test.
+func TestHelperStdioServer(t *testing.T) {
+	if os.Getenv("KILROY_MCP_TEST_SERVER") != "1" {
+		t.Skip("helper process")
+	}
+	fmt.Fprintln(os.Stderr, "fake server starting")
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		if strings.Contains(sc.Text(), `"exit_now"`) {
+			fmt.Fprintln(os.Stderr, "fake server crashed")
+			os.Exit(3)
+		}
+		if b, ok := fakeServerResponse(sc.Bytes()); ok {
+			// Servers may log to stdout; the client must skip non-JSON lines.
+			fmt.Println("log: handling request")
+			fmt.Println(string(b))
+		}
+	}
+	os.Exit(0)
+}
+
+func stdioTestConfig() ServerConfig {
+	return ServerConfig{
+		Name:    "tickets",
+		Command: []string{os.Args[0], "-test.run=^TestHelperStdioServer$"},
+		Env:     []string{"KILROY_MCP_TEST_SERVER=1"},
+	}
+}
+
+func exerciseClient(t *testing.T, c *Client) {
+	t.Helper()
+	ctx := context.Background()
+	if c.ServerName() != "fake-tickets" {
+		t.Fatalf("server name: %q", c.ServerName())
+	}
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	if strings.Join(names, ",") != "get_ticket,fail,list_queues" {
+		t.Fatalf("tools: %v", names)
+	}
+	if tools[0].InputSchema["type"] != "object" {
+		t.Fatalf("schema: %+v", tools[0].InputSchema)
+	}
+
+	res, err := c.CallTool(ctx, "get_ticket", map[string]any{"id": "T-1"})
+	if err != nil || res.IsError || res.Text() != "ticket T-1: fix login" {
+		t.Fatalf("CallTool get_ticket: %+v err=%v", res, err)
+	}
+	res, err = c.CallTool(ctx, "fail", nil)
+	if err != nil || !res.IsError || res.Text() != "boom" {
+		t.Fatalf("CallTool fail: %+v err=%v", res, err)
+	}
+	if _, err := c.CallTool(ctx, "nope", nil); err == nil || !strings.Contains(err.Error(), "unknown tool nope") {
+		t.Fatalf("expected RPC error, got %v", err)
+	}
+}
+
+func TestClient_Stdio(t *testing.T) {
+	c, err := Connect(context.Background(), stdioTestConfig())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	exerciseClient(t, c)
+}
+
+func TestClient_Stdio_ServerExitFailsPendingCalls(t *testing.T) {
+	c, err := Connect(context.Background(), stdioTestConfig())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = c.CallTool(ctx, "exit_now", nil)
+	if err == nil || !strings.Contains(err.Error(), "exited") || !strings.Contains(err.Error(), "fake server crashed") {
+		t.Fatalf("expected exit error with stderr tail, got %v", err)
+	}
+	if _, err := c.ListTools(ctx); err == nil {
+		t.Fatal("expected calls after exit to fail")
+	}
+}
+
+func TestClient_HTTP_JSONAndEventStream(t *testing.T) {
+	var sessionHeaders []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t0k" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var msg rpcMessage
+		_ = json.Unmarshal(body, &msg)
+		if msg.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "sess-1")
+		} else {
+			sessionHeaders = append(sessionHeaders, r.Header.Get("Mcp-Session-Id"))
+		}
+		resp, ok := fakeServerResponse(body)
+		if !ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if msg.Method == "tools/call" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", resp)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(resp)
+	}))
+	defer srv.Close()
+
+	c, err := Connect(context.Background(), ServerConfig{Name: "tickets", URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer t0k"}})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	exerciseClient(t, c)
+	_ = c.Close()
+	for _, h := range sessionHeaders {
+		if h != "sess-1" {
+			t.Fatalf("expected every post-initialize request to carry the session id, got %v", sessionHeaders)
+		}
+	}
+}
+
+func TestConnect_RequiresExactlyOneTransport(t *testing.T) {
+	if _, err := Connect(context.Background(), ServerConfig{Name: "x"}); err == nil {
+		t.Fatal("expected error without command or url")
+	}
+	if _, err := Connect(context.Background(), ServerConfig{Name: "x", Command: []string{"true"}, URL: "http://localhost"}); err == nil {
+		t.Fatal("expected error with both command and url")
+	}
+}
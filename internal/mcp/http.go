@@ -0,0 +1,173 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// httpTransport implements the streamable HTTP transport: every message is a
+// POST, answered with either a JSON body or an SSE stream.
+type httpTransport struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+}
+
+func newHTTPTransport(cfg ServerConfig) *httpTransport {
+	return &httpTransport{
+		name:    cfg.Name,
+		url:     strings.TrimSpace(cfg.URL),
+		headers: cfg.Headers,
+		client:  &http.Client{},
+	}
+}
+
+func (t *httpTransport) setProtocolVersion(v string) {
+	t.mu.Lock()
+	t.protocolVersion = strings.TrimSpace(v)
+	t.mu.Unlock()
+}
+
+func (t *httpTransport) post(ctx context.Context, req rpcRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.headers {
+		hr.Header.Set(k, v)
+	}
+	hr.Header.Set("Content-Type", "application/json")
+	hr.Header.Set("Accept", "application/json, text/event-stream")
+	t.mu.Lock()
+	if t.sessionID != "" {
+		hr.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		hr.Header.Set("MCP-Protocol-Version", t.protocolVersion)
+	}
+	t.mu.Unlock()
+	resp, err := t.client.Do(hr)
+	if err != nil {
+		return nil, fmt.Errorf("mcp server %s: %w", t.name, err)
+	}
+	if sid := strings.TrimSpace(resp.Header.Get("Mcp-Session-Id")); sid != "" {
+		t.mu.Lock()
+		t.sessionID = sid
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("mcp server %s: HTTP %d: %s", t.name, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, req rpcRequest) (rpcMessage, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return rpcMessage{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	want := strconv.FormatInt(*req.ID, 10)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return readSSEResponse(resp.Body, want, t.name)
+	}
+	var msg rpcMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return rpcMessage{}, fmt.Errorf("mcp server %s: decode response: %w", t.name, err)
+	}
+	return msg, nil
+}
+
+// readSSEResponse scans an SSE stream for the response with ID want, skipping
+// notifications and server requests sent ahead of it.
+func readSSEResponse(r io.Reader, want string, name string) (rpcMessage, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	flush := func() (rpcMessage, bool) {
+		defer data.Reset()
+		if data.Len() == 0 {
+			return rpcMessage{}, false
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(data.String()), &msg); err != nil {
+			return rpcMessage{}, false
+		}
+		return msg, msg.isResponse() && idKey(msg.ID) == want
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			if msg, ok := flush(); ok {
+				return msg, nil
+			}
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(v, " "))
+		}
+	}
+	if msg, ok := flush(); ok {
+		return msg, nil
+	}
+	if err := sc.Err(); err != nil {
+		return rpcMessage{}, fmt.Errorf("mcp server %s: read event stream: %w", name, err)
+	}
+	return rpcMessage{}, fmt.Errorf("mcp server %s: event stream ended without a response to request %s", name, want)
+}
+
+func (t *httpTransport) notify(ctx context.Context, req rpcRequest) error {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// close ends the server-side session when the server issued one.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	sid := t.sessionID
+	t.mu.Unlock()
+	if sid == "" {
+		return nil
+	}
+	hr, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range t.headers {
+		hr.Header.Set(k, v)
+	}
+	hr.Header.Set("Mcp-Session-Id", sid)
+	resp, err := t.client.Do(hr)
+	if err != nil {
+		return nil // best-effort
+	}
+	return resp.Body.Close()
+}
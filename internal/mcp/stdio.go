@@ -0,0 +1,213 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const stderrTailBytes = 4096
+
+// stdioTransport speaks newline-delimited JSON-RPC with a child process.
+type stdioTransport struct {
+	name string
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan rpcMessage
+	err     error // set once the process has exited
+	done    chan struct{}
+
+	stderr *tailBuffer
+}
+
+func startStdio(cfg ServerConfig) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command[0], cfg.Command[1:]...)
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	cmd.Dir = cfg.Dir
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	t := &stdioTransport{
+		name:    cfg.Name,
+		cmd:     cmd,
+		in:      in,
+		pending: map[string]chan rpcMessage{},
+		done:    make(chan struct{}),
+		stderr:  &tailBuffer{max: stderrTailBytes},
+	}
+	cmd.Stderr = t.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("mcp server %s: start %s: %w", cfg.Name, cfg.Command[0], err)
+	}
+	go t.readLoop(out)
+	return t, nil
+}
+
+func (t *stdioTransport) readLoop(out io.Reader) {
+	r := bufio.NewReaderSize(out, 64*1024)
+	var readErr error
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			t.handle(line)
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	waitErr := t.cmd.Wait()
+	msg := fmt.Sprintf("mcp server %s exited", t.name)
+	if waitErr != nil {
+		msg += ": " + waitErr.Error()
+	} else if readErr != nil && readErr != io.EOF {
+		msg += ": " + readErr.Error()
+	}
+	if tail := strings.TrimSpace(t.stderr.String()); tail != "" {
+		msg += "; stderr: " + tail
+	}
+	t.mu.Lock()
+	t.err = fmt.Errorf("%s", msg)
+	for id, ch := range t.pending {
+		close(ch)
+		delete(t.pending, id)
+	}
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *stdioTransport) handle(line []byte) {
+	var msg rpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return // not JSON-RPC; servers sometimes log to stdout
+	}
+	if msg.isResponse() {
+		t.mu.Lock()
+		ch := t.pending[idKey(msg.ID)]
+		delete(t.pending, idKey(msg.ID))
+		t.mu.Unlock()
+		if ch != nil {
+			ch <- msg
+		}
+		return
+	}
+	if msg.Method == "" || len(msg.ID) == 0 {
+		return // notification
+	}
+	// Server-initiated request: answer ping, decline everything else.
+	reply := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+	if msg.Method == "ping" {
+		reply["result"] = map[string]any{}
+	} else {
+		reply["error"] = RPCError{Code: -32601, Message: "method not supported by client: " + msg.Method}
+	}
+	_ = t.write(reply)
+}
+
+func (t *stdioTransport) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.in.Write(append(b, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, req rpcRequest) (rpcMessage, error) {
+	key := strconv.FormatInt(*req.ID, 10)
+	ch := make(chan rpcMessage, 1)
+	t.mu.Lock()
+	if t.err != nil {
+		err := t.err
+		t.mu.Unlock()
+		return rpcMessage{}, err
+	}
+	t.pending[key] = ch
+	t.mu.Unlock()
+	if err := t.write(req); err != nil {
+		t.forget(key)
+		return rpcMessage{}, fmt.Errorf("mcp server %s: write: %w", t.name, err)
+	}
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			t.mu.Lock()
+			err := t.err
+			t.mu.Unlock()
+			return rpcMessage{}, err
+		}
+		return msg, nil
+	case <-ctx.Done():
+		t.forget(key)
+		_ = t.write(rpcRequest{JSONRPC: "2.0", Method: "notifications/cancelled", Params: map[string]any{"requestId": *req.ID}})
+		return rpcMessage{}, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) forget(key string) {
+	t.mu.Lock()
+	delete(t.pending, key)
+	t.mu.Unlock()
+}
+
+func (t *stdioTransport) notify(ctx context.Context, req rpcRequest) error {
+	_ = ctx
+	return t.write(req)
+}
+
+// close closes stdin, gives the server a moment to exit, then kills it.
+func (t *stdioTransport) close() error {
+	_ = t.in.Close()
+	select {
+	case <-t.done:
+		return nil
+	case <-time.After(2 * time.Second):
+	}
+	if t.cmd.Process != nil {
+		_ = t.cmd.Process.Kill()
+	}
+	<-t.done
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
@@ -125,6 +125,34 @@ var builtinSpecs = map[string]Spec{
 		},
 		Failover: []string{"cerebras"},
 	},
+	"local": {
+		Key:     "local",
+		Aliases: []string{"ollama", "llama.cpp", "llamacpp", "vllm", "lmstudio"},
+		API: &APISpec{
+			Protocol:           ProtocolOpenAIChatCompletions,
+			DefaultBaseURL:     "http://127.0.0.1:11434",
+			DefaultPath:        "/v1/chat/completions",
+			DefaultAPIKeyEnv:   "LOCAL_LLM_API_KEY",
+			ProviderOptionsKey: "local",
+			ProfileFamily:      "local",
+			ModelsPath:         "/v1/models",
+			APIKeyOptional:     true,
+		},
+	},
+	"azure": {
+		Key:     "azure",
+		Aliases: []string{"azure_openai", "azure-openai"},
+		API: &APISpec{
+			Protocol: ProtocolAzureOpenAI,
+			// No default endpoint: set api.base_url or AZURE_OPENAI_ENDPOINT
+			// to the resource URL (https://<resource>.openai.azure.com).
+			DefaultPath:        "/openai/responses",
+			DefaultAPIKeyEnv:   "AZURE_OPENAI_API_KEY",
+			ProviderOptionsKey: "openai",
+			ProfileFamily:      "openai",
+			APIVersion:         "2025-04-01-preview",
+		},
+	},
 }
 
 func Builtin(key string) (Spec, bool) {
@@ -12,6 +12,10 @@ const (
 	ProtocolOpenAIChatCompletions APIProtocol = "openai_chat_completions"
 	ProtocolAnthropicMessages     APIProtocol = "anthropic_messages"
 	ProtocolGoogleGenerateContent APIProtocol = "google_generate_content"
+	// ProtocolAzureOpenAI is the OpenAI Responses API served from an Azure
+	// OpenAI resource: deployment names instead of model ids, an api-version
+	// query parameter and api-key header auth.
+	ProtocolAzureOpenAI APIProtocol = "azure_openai"
 )
 
 type APISpec struct {
@@ -21,6 +25,13 @@ type APISpec struct {
 	DefaultAPIKeyEnv   string
 	ProviderOptionsKey string
 	ProfileFamily      string
+	// ModelsPath, when set, is an OpenAI-compatible model listing endpoint
+	// (for example /v1/models) queried during preflight to discover models.
+	ModelsPath string
+	// APIKeyOptional providers may run without DefaultAPIKeyEnv set.
+	APIKeyOptional bool
+	// APIVersion is the api-version query parameter for azure_openai.
+	APIVersion string
 }
 
 type CLISpec struct {
@@ -144,3 +144,35 @@ func TestBuiltinFailoverDefaultsAreSingleHop(t *testing.T) {
 		}
 	}
 }
+
+func TestBuiltinLocalDefaultsToKeylessOpenAICompatAPI(t *testing.T) {
+	spec, ok := Builtin("ollama")
+	if !ok || spec.Key != "local" {
+		t.Fatalf("expected ollama to alias the local builtin, got %+v", spec)
+	}
+	if spec.API == nil {
+		t.Fatalf("expected local api spec")
+	}
+	if got := spec.API.Protocol; got != ProtocolOpenAIChatCompletions {
+		t.Fatalf("local protocol: got %q want %q", got, ProtocolOpenAIChatCompletions)
+	}
+	if !spec.API.APIKeyOptional || spec.API.ModelsPath != "/v1/models" || spec.API.ProfileFamily != "local" {
+		t.Fatalf("local api spec: %+v", spec.API)
+	}
+	if len(spec.Failover) != 0 {
+		t.Fatalf("local should not fail over to hosted providers, got %v", spec.Failover)
+	}
+}
+
+func TestBuiltinAzureUsesAzureOpenAIProtocol(t *testing.T) {
+	spec, ok := Builtin("azure-openai")
+	if !ok || spec.Key != "azure" || spec.API == nil {
+		t.Fatalf("expected azure-openai to alias the azure builtin, got %+v", spec)
+	}
+	if spec.API.Protocol != ProtocolAzureOpenAI || spec.API.DefaultAPIKeyEnv != "AZURE_OPENAI_API_KEY" || spec.API.APIVersion == "" {
+		t.Fatalf("azure api spec: %+v", spec.API)
+	}
+	if spec.API.ProfileFamily != "openai" || spec.CLI != nil || len(spec.Failover) != 0 {
+		t.Fatalf("azure should reuse the openai profile with no cli or failover: %+v", spec)
+	}
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scopes a token can hold. Health checks need no scope.
+const (
+	ScopeRead   = "read"   // list pipelines, status, events, context, questions
+	ScopeSubmit = "submit" // submit and cancel pipelines
+	ScopeAnswer = "answer" // answer human-gate questions
+)
+
+var knownScopes = map[string]bool{ScopeRead: true, ScopeSubmit: true, ScopeAnswer: true}
+
+// TokensEnvVar holds tokens as whitespace-separated name:token:scope[,scope]
+// entries, for deployments that prefer env over a tokens file.
+const TokensEnvVar = "KILROY_SERVER_TOKENS"
+
+// Token is one API credential. Exactly one of Token or TokenSHA256 (hex) is
+// set; only the hash is kept in memory.
+type Token struct {
+	Name        string   `json:"name" yaml:"name"`
+	Token       string   `json:"token,omitempty" yaml:"token,omitempty"`
+	TokenSHA256 string   `json:"token_sha256,omitempty" yaml:"token_sha256,omitempty"`
+	Scopes      []string `json:"scopes" yaml:"scopes"`
+}
+
+type tokensFile struct {
+	Tokens []Token `json:"tokens" yaml:"tokens"`
+}
+
+// LoadTokensFile reads tokens from a YAML or JSON file of the form
+// {tokens: [{name, token | token_sha256, scopes}]}.
+func LoadTokensFile(path string) ([]Token, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f tokensFile
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if len(f.Tokens) == 0 {
+		return nil, fmt.Errorf("%s: no tokens defined", path)
+	}
+	return f.Tokens, nil
+}
+
+// ParseTokensEnv parses the TokensEnvVar format: name:token:scope[,scope]
+// entries separated by whitespace. The name ends at the first ":" and the
+// scopes start after the last, so the token itself may contain ":".
+func ParseTokensEnv(v string) ([]Token, error) {
+	var out []Token
+	for _, entry := range strings.Fields(v) {
+		name, rest, ok := strings.Cut(entry, ":")
+		i := strings.LastIndex(rest, ":")
+		if !ok || i < 0 {
+			return nil, fmt.Errorf("%s: entry %q: want name:token:scopes", TokensEnvVar, redactEntry(entry))
+		}
+		out = append(out, Token{Name: name, Token: rest[:i], Scopes: strings.Split(rest[i+1:], ",")})
+	}
+	return out, nil
+}
+
+func redactEntry(entry string) string {
+	if name, _, ok := strings.Cut(entry, ":"); ok {
+		return name + ":***"
+	}
+	return "***"
+}
+
+type authToken struct {
+	name   string
+	hash   [sha256.Size]byte
+	scopes map[string]bool
+}
+
+// authenticator checks bearer tokens. A nil authenticator allows everything.
+type authenticator struct {
+	tokens []authToken
+}
+
+func newAuthenticator(tokens []Token) (*authenticator, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	a := &authenticator{}
+	names := map[string]bool{}
+	for i, t := range tokens {
+		name := strings.TrimSpace(t.Name)
+		if name == "" {
+			return nil, fmt.Errorf("token %d: name is required", i+1)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("token %s: duplicate name", name)
+		}
+		names[name] = true
+		at := authToken{name: name, scopes: map[string]bool{}}
+		switch {
+		case t.Token != "" && t.TokenSHA256 != "":
+			return nil, fmt.Errorf("token %s: set token or token_sha256, not both", name)
+		case t.Token != "":
+			at.hash = sha256.Sum256([]byte(t.Token))
+		case t.TokenSHA256 != "":
+			raw, err := hex.DecodeString(strings.TrimSpace(t.TokenSHA256))
+			if err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("token %s: token_sha256 must be 64 hex characters", name)
+			}
+			copy(at.hash[:], raw)
+		default:
+			return nil, fmt.Errorf("token %s: token or token_sha256 is required", name)
+		}
+		for _, sc := range t.Scopes {
+			sc = strings.TrimSpace(sc)
+			if !knownScopes[sc] {
+				return nil, fmt.Errorf("token %s: unknown scope %q (want read, submit or answer)", name, sc)
+			}
+			at.scopes[sc] = true
+		}
+		if len(at.scopes) == 0 {
+			return nil, fmt.Errorf("token %s: at least one scope is required", name)
+		}
+		a.tokens = append(a.tokens, at)
+	}
+	return a, nil
+}
+
+// identify returns the token matching the request's bearer credential.
+// Every configured token is compared so timing does not reveal which matched.
+func (a *authenticator) identify(r *http.Request) (*authToken, bool) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(raw) == "" {
+		return nil, false
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(raw)))
+	var found *authToken
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare(sum[:], a.tokens[i].hash[:]) == 1 {
+			found = &a.tokens[i]
+		}
+	}
+	return found, found != nil
+}
+
+type identityKey struct{}
+
+// requestIdentity returns the token name that authorized the request, or
+// "anonymous" when auth is disabled.
+func requestIdentity(ctx context.Context) string {
+	if name, ok := ctx.Value(identityKey{}).(string); ok {
+		return name
+	}
+	return "anonymous"
+}
+
+// require wraps a handler with the scope check and, for mutating methods, an
+// audit record.
+func (s *Server) require(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			w = rec
+			defer func() { s.audit.record(r, rec.status) }()
+		}
+		if s.auth != nil {
+			tok, ok := s.auth.identify(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="kilroy"`)
+				writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "unauthorized", Details: "a valid bearer token is required"})
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), identityKey{}, tok.name))
+			if !tok.scopes[scope] {
+				writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "forbidden", Details: fmt.Sprintf("token %s lacks the %s scope", tok.name, scope)})
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// auditLog appends one JSON line per mutating request. With no path it
+// writes through the server logger.
+type auditLog struct {
+	mu     sync.Mutex
+	path   string
+	logger interface{ Printf(string, ...any) }
+}
+
+func (a *auditLog) record(r *http.Request, status int) {
+	if a == nil {
+		return
+	}
+	entry := map[string]any{
+		"ts":          time.Now().UTC().Format(time.RFC3339Nano),
+		"identity":    requestIdentity(r.Context()),
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"status":      status,
+		"remote_addr": r.RemoteAddr,
+	}
+	if id := r.PathValue("id"); id != "" {
+		entry["run_id"] = id
+	}
+	if qid := r.PathValue("qid"); qid != "" {
+		entry["question_id"] = qid
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.path == "" {
+		a.logger.Printf("audit %s", b)
+		return
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		a.logger.Printf("audit log %s: %v; entry: %s", a.path, err, b)
+		return
+	}
+	_, _ = f.Write(append(b, '\n'))
+	_ = f.Close()
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+)
+
+func newAuthTestServer(t *testing.T, auditPath string) (*Server, *httptest.Server) {
+	t.Helper()
+	sum := sha256.Sum256([]byte("gate-token"))
+	srv, err := New(Config{
+		Addr: ":0",
+		Tokens: []Token{
+			{Name: "viewer", Token: "view-token", Scopes: []string{ScopeRead}},
+			{Name: "gatekeeper", TokenSHA256: hex.EncodeToString(sum[:]), Scopes: []string{ScopeRead, ScopeAnswer}},
+			{Name: "ci", Token: "ci-token", Scopes: []string{ScopeSubmit}},
+		},
+		AuditLogPath: auditPath,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(srv.httpSrv.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Shutdown()
+	})
+	return srv, ts
+}
+
+func doAuthRequest(t *testing.T, method, url, token, body string) (*http.Response, ErrorResponse) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	var e ErrorResponse
+	if resp.StatusCode >= 400 {
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+	}
+	return resp, e
+}
+
+func TestAuth_EnforcesBearerTokenScopes(t *testing.T) {
+	audit := filepath.Join(t.TempDir(), "audit.ndjson")
+	srv, ts := newAuthTestServer(t, audit)
+	_, _, wi := registerTestPipeline(t, srv, "run-1")
+	go wi.Ask(engine.Question{Text: "ship it?"})
+	qs := waitForPending(t, wi, 1)
+
+	// Health stays open for liveness probes.
+	if resp, _ := doAuthRequest(t, "GET", ts.URL+"/health", "", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("health: %d", resp.StatusCode)
+	}
+
+	resp, e := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-1", "", "")
+	if resp.StatusCode != http.StatusUnauthorized || e.Error != "unauthorized" || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("missing token: %d %+v", resp.StatusCode, e)
+	}
+	if resp, _ := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-1", "wrong", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong token: %d", resp.StatusCode)
+	}
+	if resp, _ := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-1", "view-token", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("viewer read: %d", resp.StatusCode)
+	}
+
+	answerURL := ts.URL + "/pipelines/run-1/questions/" + qs[0].QuestionID + "/answer"
+	resp, e = doAuthRequest(t, "POST", answerURL, "view-token", `{"value":"A"}`)
+	if resp.StatusCode != http.StatusForbidden || e.Error != "forbidden" || !strings.Contains(e.Details, "answer") {
+		t.Fatalf("viewer answer: %d %+v", resp.StatusCode, e)
+	}
+	if resp, _ := doAuthRequest(t, "POST", ts.URL+"/pipelines/run-1/cancel", "gate-token", ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("gatekeeper cancel: %d", resp.StatusCode)
+	}
+	if resp, e := doAuthRequest(t, "POST", answerURL, "gate-token", `{"value":"A"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("gatekeeper answer: %d %+v", resp.StatusCode, e)
+	}
+	if resp, _ := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-1", "ci-token", ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("ci read: %d", resp.StatusCode)
+	}
+
+	b, err := os.ReadFile(audit)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 audited POSTs, got %d:\n%s", len(lines), b)
+	}
+	var last map[string]any
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil {
+		t.Fatalf("decode audit line: %v", err)
+	}
+	if last["identity"] != "gatekeeper" || last["status"] != float64(200) || last["run_id"] != "run-1" || last["question_id"] != qs[0].QuestionID {
+		t.Fatalf("audit entry: %v", last)
+	}
+	if strings.Contains(string(b), "gate-token") {
+		t.Fatal("audit log must not contain token secrets")
+	}
+}
+
+func TestAuth_TokenConfigValidation(t *testing.T) {
+	cases := []struct {
+		tokens []Token
+		want   string
+	}{
+		{[]Token{{Token: "x", Scopes: []string{ScopeRead}}}, "name is required"},
+		{[]Token{{Name: "a", Scopes: []string{ScopeRead}}}, "token or token_sha256 is required"},
+		{[]Token{{Name: "a", Token: "x", Scopes: []string{"admin"}}}, "unknown scope"},
+		{[]Token{{Name: "a", Token: "x"}}, "at least one scope"},
+		{[]Token{{Name: "a", TokenSHA256: "abc", Scopes: []string{ScopeRead}}}, "64 hex"},
+		{[]Token{{Name: "a", Token: "x", Scopes: []string{ScopeRead}}, {Name: "a", Token: "y", Scopes: []string{ScopeRead}}}, "duplicate"},
+	}
+	for _, tc := range cases {
+		if _, err := newAuthenticator(tc.tokens); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%+v: expected %q, got %v", tc.tokens, tc.want, err)
+		}
+	}
+}
+
+func TestLoadTokensFileAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.yaml")
+	if err := os.WriteFile(path, []byte(`
+tokens:
+  - name: alice
+    token: s3cret
+    scopes: [read, answer]
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	toks, err := LoadTokensFile(path)
+	if err != nil || len(toks) != 1 || toks[0].Name != "alice" || len(toks[0].Scopes) != 2 {
+		t.Fatalf("LoadTokensFile: %+v err=%v", toks, err)
+	}
+
+	toks, err = ParseTokensEnv("ci:t1:submit,read\n  bob:t2:answer")
+	if err != nil || len(toks) != 2 || toks[0].Token != "t1" || toks[1].Scopes[0] != "answer" {
+		t.Fatalf("ParseTokensEnv: %+v err=%v", toks, err)
+	}
+	toks, err = ParseTokensEnv("ops:ab:cd::ef:read,cancel")
+	if err != nil || len(toks) != 1 || toks[0].Name != "ops" || toks[0].Token != "ab:cd::ef" || strings.Join(toks[0].Scopes, ",") != "read,cancel" {
+		t.Fatalf("ParseTokensEnv with a colon in the token: %+v err=%v", toks, err)
+	}
+	if _, err := ParseTokensEnv("ci-s3cret"); err == nil || strings.Contains(err.Error(), "s3cret") {
+		t.Fatalf("expected a redacted parse error, got %v", err)
+	}
+}
@@ -90,6 +90,7 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 		Interviewer: interviewer,
 		Cancel:      cancel,
 		StartedAt:   time.Now().UTC(),
+		store:       s.store,
 	}
 
 	if err := s.registry.Register(runID, ps); err != nil {
@@ -97,6 +98,10 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusConflict, err.Error())
 		return
 	}
+	if s.store != nil {
+		broadcaster.logPath = s.store.eventsPath(runID)
+		ps.persist()
+	}
 
 	// Launch pipeline in a background goroutine.
 	go func() {
@@ -106,6 +111,7 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 			RunID:         runID,
 			AllowTestShim: req.AllowTestShim,
 			ForceModels:   req.ForceModels,
+			Params:        req.Params,
 			ProgressSink:  broadcaster.Send,
 			Interviewer:   interviewer,
 			OnEngineReady: func(e *engine.Engine) {
@@ -125,6 +131,10 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) handleListPipelines(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.registry.Statuses())
+}
+
 func (s *Server) handleGetPipeline(w http.ResponseWriter, r *http.Request) {
 	runID := r.PathValue("id")
 	if runID == "" {
@@ -170,6 +180,11 @@ func (s *Server) handleCancelPipeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if ps.Cancel == nil {
+		// Restored from the state dir: this server does not own the run.
+		writeError(w, http.StatusConflict, fmt.Sprintf("pipeline %s is not running in this server; use kilroy attractor stop --logs-root", runID))
+		return
+	}
 	ps.Cancel(fmt.Errorf("canceled via HTTP API"))
 	ps.Interviewer.Cancel()
 	writeJSON(w, http.StatusOK, map[string]string{"status": "canceling"})
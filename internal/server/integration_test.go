@@ -17,7 +17,10 @@ import (
 // newTestServer creates a Server and wraps its mux in httptest.Server.
 func newTestServer(t *testing.T) (*Server, *httptest.Server) {
 	t.Helper()
-	srv := New(Config{Addr: ":0"})
+	srv, err := New(Config{Addr: ":0"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
 	ts := httptest.NewServer(srv.httpSrv.Handler)
 	t.Cleanup(func() {
 		ts.Close()
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -19,11 +20,16 @@ type PipelineState struct {
 	StartedAt   time.Time
 	LogsRoot    string
 
+	// store persists the pipeline record when the server has a state dir.
+	store *stateStore
+
 	mu     sync.Mutex
 	eng    *engine.Engine
 	result *engine.Result
 	err    error
 	done   bool
+	// final is the terminal status of a pipeline restored from the state dir.
+	final *PipelineStatus
 }
 
 // SetEngine stores a reference to the live engine (for context inspection).
@@ -31,6 +37,10 @@ func (ps *PipelineState) SetEngine(e *engine.Engine) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 	ps.eng = e
+	if ps.LogsRoot == "" && e != nil {
+		ps.LogsRoot = e.LogsRoot
+	}
+	ps.persistLocked()
 }
 
 // SetResult records the terminal outcome of the pipeline.
@@ -40,13 +50,60 @@ func (ps *PipelineState) SetResult(res *engine.Result, err error) {
 	ps.result = res
 	ps.err = err
 	ps.done = true
+	ps.persistLocked()
+}
+
+// setFinal marks a restored pipeline as finished with the given status.
+func (ps *PipelineState) setFinal(status PipelineStatus) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.final = &status
+	ps.done = true
+	ps.persistLocked()
+}
+
+// Done reports whether the pipeline has finished.
+func (ps *PipelineState) Done() bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.done
+}
+
+// persist writes the pipeline record to the state dir, if any.
+func (ps *PipelineState) persist() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.persistLocked()
+}
+
+func (ps *PipelineState) persistLocked() {
+	if ps.store == nil {
+		return
+	}
+	rec := pipelineRecord{
+		RunID:     ps.RunID,
+		StartedAt: ps.StartedAt,
+		LogsRoot:  ps.LogsRoot,
+		Done:      ps.done,
+	}
+	if ps.done {
+		status := ps.statusLocked()
+		rec.Status = &status
+	}
+	ps.store.saveRecord(rec)
 }
 
 // Status returns the current pipeline status for the HTTP API.
 func (ps *PipelineState) Status() PipelineStatus {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
+	return ps.statusLocked()
+}
 
+func (ps *PipelineState) statusLocked() PipelineStatus {
+	if ps.final != nil {
+		return *ps.final
+	}
 	status := PipelineStatus{
 		RunID:    ps.RunID,
 		State:    "running",
@@ -147,6 +204,27 @@ func (r *PipelineRegistry) List() []string {
 	return ids
 }
 
+// Statuses returns the status of every pipeline, oldest first.
+func (r *PipelineRegistry) Statuses() []PipelineStatus {
+	r.mu.RLock()
+	states := make([]*PipelineState, 0, len(r.pipelines))
+	for _, ps := range r.pipelines {
+		states = append(states, ps)
+	}
+	r.mu.RUnlock()
+	sort.Slice(states, func(i, j int) bool {
+		if !states[i].StartedAt.Equal(states[j].StartedAt) {
+			return states[i].StartedAt.Before(states[j].StartedAt)
+		}
+		return states[i].RunID < states[j].RunID
+	})
+	out := make([]PipelineStatus, 0, len(states))
+	for _, ps := range states {
+		out = append(out, ps.Status())
+	}
+	return out
+}
+
 // CancelAll cancels all running pipelines with the given reason.
 func (r *PipelineRegistry) CancelAll(reason string) {
 	r.mu.RLock()
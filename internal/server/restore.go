@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+// followPollInterval is how often a restored, still-alive run's
+// progress.ndjson is polled for new events.
+var followPollInterval = time.Second
+
+// interruptedReason is reported for runs that were still running when the
+// server stopped and whose process is gone.
+const interruptedReason = "interrupted: the server stopped before the run finished (resume with kilroy attractor resume --logs-root)"
+
+// restore re-registers every pipeline found in the state dir.
+func (s *Server) restore() {
+	recs, err := s.store.loadRecords()
+	if err != nil {
+		s.logger.Printf("restore pipelines: %v", err)
+		return
+	}
+	for _, rec := range recs {
+		if err := s.restorePipeline(rec); err != nil {
+			s.logger.Printf("restore pipeline %s: %v", rec.RunID, err)
+		}
+	}
+	if len(recs) > 0 {
+		s.logger.Printf("restored %d pipeline(s) from %s", len(recs), s.store.dir)
+	}
+}
+
+// restorePipeline rebuilds one registry entry. Finished runs keep their
+// recorded status. Unfinished runs are checked against their logs root with
+// the same logic as `attractor status`: a live run process is followed
+// through progress.ndjson, a finished one reports final.json, and anything
+// else is marked interrupted. Restored runs have no engine, so they cannot be
+// canceled, and a question pending at a human gate is not restored: nothing
+// is left to receive its answer. Resuming the run asks it again.
+func (s *Server) restorePipeline(rec pipelineRecord) error {
+	history, err := s.store.loadEvents(rec.RunID)
+	if err != nil {
+		return err
+	}
+	b := NewBroadcaster()
+	b.history = history
+	b.logPath = s.store.eventsPath(rec.RunID)
+	ps := &PipelineState{
+		RunID:       rec.RunID,
+		Broadcaster: b,
+		Interviewer: NewWebInterviewer(0),
+		StartedAt:   rec.StartedAt,
+		LogsRoot:    rec.LogsRoot,
+		store:       s.store,
+	}
+	if err := s.registry.Register(rec.RunID, ps); err != nil {
+		return err
+	}
+
+	if rec.Done && rec.Status != nil {
+		ps.mu.Lock()
+		ps.final = rec.Status
+		ps.done = true
+		ps.mu.Unlock()
+		b.Close()
+		return nil
+	}
+
+	snap := loadRunSnapshot(rec.LogsRoot)
+	switch {
+	case snap != nil && (snap.State == runstate.StateSuccess || snap.State == runstate.StateFail):
+		ps.setFinal(statusFromSnapshot(ps, snap))
+		b.Close()
+	case snap != nil && snap.PIDAlive && snap.PID != os.Getpid():
+		go s.follow(s.baseCtx, ps)
+	default:
+		status := ps.Status()
+		status.State = string(runstate.StateFail)
+		status.FailureReason = interruptedReason
+		ps.setFinal(status)
+		b.Close()
+	}
+	return nil
+}
+
+func loadRunSnapshot(logsRoot string) *runstate.Snapshot {
+	if logsRoot == "" {
+		return nil
+	}
+	snap, err := runstate.LoadSnapshot(logsRoot)
+	if err != nil {
+		return nil
+	}
+	return snap
+}
+
+func statusFromSnapshot(ps *PipelineState, snap *runstate.Snapshot) PipelineStatus {
+	status := ps.Status()
+	status.State = string(snap.State)
+	status.FailureReason = snap.FailureReason
+	status.CurrentNodeID = ""
+	return status
+}
+
+// follow feeds new progress.ndjson lines of a restored run into its
+// broadcaster until the run process exits, then records the final status.
+func (s *Server) follow(ctx context.Context, ps *PipelineState) {
+	progress := filepath.Join(ps.LogsRoot, "progress.ndjson")
+	tick := time.NewTicker(followPollInterval)
+	defer tick.Stop()
+	for {
+		// Check liveness first so the last events written before exit are
+		// still read below.
+		snap := loadRunSnapshot(ps.LogsRoot)
+		// The broadcaster history mirrors progress.ndjson line for line.
+		if evs, err := readEventLines(progress, len(ps.Broadcaster.History())); err == nil {
+			for _, ev := range evs {
+				ps.Broadcaster.Send(ev)
+			}
+		}
+		if snap == nil || !snap.PIDAlive {
+			if snap != nil && (snap.State == runstate.StateSuccess || snap.State == runstate.StateFail) {
+				ps.setFinal(statusFromSnapshot(ps, snap))
+			} else {
+				status := ps.Status()
+				status.State = string(runstate.StateFail)
+				status.FailureReason = interruptedReason
+				ps.setFinal(status)
+			}
+			ps.Broadcaster.Close()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func newStateTestServer(t *testing.T, stateDir string) (*Server, *httptest.Server) {
+	t.Helper()
+	srv, err := New(Config{Addr: ":0", StateDir: stateDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(srv.httpSrv.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Shutdown()
+	})
+	return srv, ts
+}
+
+// registerPersistentPipeline registers a pipeline the way handleSubmitPipeline
+// does when the server has a state dir.
+func registerPersistentPipeline(t *testing.T, srv *Server, runID string, logsRoot string) *PipelineState {
+	t.Helper()
+	b := NewBroadcaster()
+	b.logPath = srv.store.eventsPath(runID)
+	_, cancel := context.WithCancelCause(context.Background())
+	ps := &PipelineState{
+		RunID:       runID,
+		Broadcaster: b,
+		Interviewer: NewWebInterviewer(time.Second),
+		Cancel:      cancel,
+		StartedAt:   time.Now().UTC(),
+		LogsRoot:    logsRoot,
+		store:       srv.store,
+	}
+	if err := srv.registry.Register(runID, ps); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	ps.persist()
+	return ps
+}
+
+func getJSON(t *testing.T, url string, out any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("decode %s: %v", url, err)
+	}
+}
+
+func TestRestore_FinishedRunKeepsStatusAndEventHistory(t *testing.T) {
+	stateDir := t.TempDir()
+	srv1, _ := newStateTestServer(t, stateDir)
+	ps := registerPersistentPipeline(t, srv1, "run-done", "")
+	ps.Broadcaster.Send(map[string]any{"event": "stage_attempt_start", "node_id": "a"})
+	ps.Broadcaster.Send(map[string]any{"event": "stage_attempt_end", "node_id": "a"})
+	ps.SetResult(&engine.Result{FinalStatus: runtime.FinalSuccess, RunBranch: "attractor/run/run-done"}, nil)
+	ps.Broadcaster.Close()
+	srv1.Shutdown()
+
+	_, ts := newStateTestServer(t, stateDir)
+	var list []PipelineStatus
+	getJSON(t, ts.URL+"/pipelines", &list)
+	if len(list) != 1 || list[0].RunID != "run-done" || list[0].State != "success" || list[0].RunBranch != "attractor/run/run-done" {
+		t.Fatalf("list: %+v", list)
+	}
+
+	// Resume after event 1: only event 2 is replayed, then done.
+	req, _ := http.NewRequest("GET", ts.URL+"/pipelines/run-done/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+	var lines []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	want := []string{"id: 2", `data: {"event":"stage_attempt_end","node_id":"a"}`, "event: done", "data: {}"}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("stream:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRestore_UnfinishedRunWithoutProcessIsInterrupted(t *testing.T) {
+	stateDir := t.TempDir()
+	logsRoot := t.TempDir()
+	srv1, _ := newStateTestServer(t, stateDir)
+	registerPersistentPipeline(t, srv1, "run-lost", logsRoot)
+	// Simulate the server dying mid-run: no result is recorded.
+
+	srv2, ts := newStateTestServer(t, stateDir)
+	var status PipelineStatus
+	getJSON(t, ts.URL+"/pipelines/run-lost", &status)
+	if status.State != "fail" || !strings.Contains(status.FailureReason, "interrupted") || status.LogsRoot != logsRoot {
+		t.Fatalf("status: %+v", status)
+	}
+	// Questions pending when the server stopped are not restored.
+	var questions []PendingQuestion
+	getJSON(t, ts.URL+"/pipelines/run-lost/questions", &questions)
+	if len(questions) != 0 {
+		t.Fatalf("questions: %+v", questions)
+	}
+
+	resp, err := http.Post(ts.URL+"/pipelines/run-lost/cancel", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST cancel: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("cancel status: %d", resp.StatusCode)
+	}
+	if got := len(srv2.registry.List()); got != 1 {
+		t.Fatalf("registry size: %d", got)
+	}
+}
+
+func TestRestore_FollowsRunThatIsStillAlive(t *testing.T) {
+	old := followPollInterval
+	followPollInterval = 20 * time.Millisecond
+	t.Cleanup(func() { followPollInterval = old })
+
+	// Stand-in for a run process that outlived the server.
+	proc := exec.Command("sleep", "30")
+	if err := proc.Start(); err != nil {
+		t.Skipf("sleep unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Process.Kill(); _ = proc.Wait() })
+
+	stateDir := t.TempDir()
+	logsRoot := t.TempDir()
+	writeFile := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(logsRoot, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendProgress := func(line string) {
+		t.Helper()
+		f, err := os.OpenFile(filepath.Join(logsRoot, "progress.ndjson"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintln(f, line)
+		f.Close()
+	}
+	writeFile("run.pid", fmt.Sprint(proc.Process.Pid))
+
+	srv1, _ := newStateTestServer(t, stateDir)
+	ps := registerPersistentPipeline(t, srv1, "run-live", logsRoot)
+	first := `{"event":"stage_attempt_start","node_id":"a"}`
+	appendProgress(first)
+	var ev map[string]any
+	_ = json.Unmarshal([]byte(first), &ev)
+	ps.Broadcaster.Send(ev)
+
+	srv2, _ := newStateTestServer(t, stateDir)
+	restored, ok := srv2.registry.Get("run-live")
+	if !ok {
+		t.Fatal("run-live not restored")
+	}
+	if restored.Done() || restored.Status().State != "running" {
+		t.Fatalf("expected a running pipeline, got %+v", restored.Status())
+	}
+
+	appendProgress(`{"event":"stage_attempt_start","node_id":"b"}`)
+	waitFor(t, func() bool { return len(restored.Broadcaster.History()) == 2 })
+	if got := restored.Status().CurrentNodeID; got != "b" {
+		t.Fatalf("current node: %q", got)
+	}
+
+	writeFile("final.json", `{"status":"success","run_id":"run-live"}`)
+	_ = proc.Process.Kill()
+	_ = proc.Wait()
+	waitFor(t, restored.Done)
+	if st := restored.Status(); st.State != "success" {
+		t.Fatalf("final status: %+v", st)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,12 +2,14 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 )
@@ -15,20 +17,35 @@ import (
 // Config holds server configuration.
 type Config struct {
 	Addr string // listen address, e.g. ":8080"
+
+	// StateDir persists the pipeline registry and event history so runs
+	// survive a server restart. Empty keeps everything in memory.
+	StateDir string
+
+	// Tokens enables bearer-token auth. Empty leaves the API open.
+	Tokens []Token
+
+	// AuditLogPath receives one JSON line per mutating request. Defaults to
+	// <StateDir>/audit.ndjson, or the server log without a state dir.
+	AuditLogPath string
 }
 
 // Server is the HTTP server for managing Attractor pipelines.
 type Server struct {
 	config   Config
 	registry *PipelineRegistry
+	store    *stateStore
+	auth     *authenticator
+	audit    *auditLog
 	baseCtx  context.Context
 	cancel   context.CancelFunc
 	httpSrv  *http.Server
 	logger   *log.Logger
 }
 
-// New creates a new Server with the given config.
-func New(cfg Config) *Server {
+// New creates a new Server with the given config. With a StateDir, pipelines
+// recorded by a previous server are restored before New returns.
+func New(cfg Config) (*Server, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	s := &Server{
 		config:   cfg,
@@ -37,18 +54,38 @@ func New(cfg Config) *Server {
 		cancel:   cancel,
 		logger:   log.New(os.Stderr, "[kilroy-server] ", log.LstdFlags),
 	}
+	store, err := newStateStore(cfg.StateDir, s.logger)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s.store = store
+	auth, err := newAuthenticator(cfg.Tokens)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("server auth: %w", err)
+	}
+	s.auth = auth
+	s.audit = &auditLog{path: cfg.AuditLogPath, logger: s.logger}
+	if s.audit.path == "" && s.store != nil {
+		s.audit.path = filepath.Join(s.store.dir, "audit.ndjson")
+	}
+	if s.store != nil {
+		s.restore()
+	}
 
 	mux := http.NewServeMux()
 
 	// Go 1.22+ method+pattern routing.
 	mux.HandleFunc("GET /health", s.handleHealth)
-	mux.HandleFunc("POST /pipelines", s.handleSubmitPipeline)
-	mux.HandleFunc("GET /pipelines/{id}", s.handleGetPipeline)
-	mux.HandleFunc("GET /pipelines/{id}/events", s.handlePipelineEvents)
-	mux.HandleFunc("POST /pipelines/{id}/cancel", s.handleCancelPipeline)
-	mux.HandleFunc("GET /pipelines/{id}/context", s.handleGetContext)
-	mux.HandleFunc("GET /pipelines/{id}/questions", s.handleGetQuestions)
-	mux.HandleFunc("POST /pipelines/{id}/questions/{qid}/answer", s.handleAnswerQuestion)
+	mux.HandleFunc("GET /pipelines", s.require(ScopeRead, s.handleListPipelines))
+	mux.HandleFunc("POST /pipelines", s.require(ScopeSubmit, s.handleSubmitPipeline))
+	mux.HandleFunc("GET /pipelines/{id}", s.require(ScopeRead, s.handleGetPipeline))
+	mux.HandleFunc("GET /pipelines/{id}/events", s.require(ScopeRead, s.handlePipelineEvents))
+	mux.HandleFunc("POST /pipelines/{id}/cancel", s.require(ScopeSubmit, s.handleCancelPipeline))
+	mux.HandleFunc("GET /pipelines/{id}/context", s.require(ScopeRead, s.handleGetContext))
+	mux.HandleFunc("GET /pipelines/{id}/questions", s.require(ScopeRead, s.handleGetQuestions))
+	mux.HandleFunc("POST /pipelines/{id}/questions/{qid}/answer", s.require(ScopeAnswer, s.handleAnswerQuestion))
 
 	s.httpSrv = &http.Server{
 		Handler:      csrfProtect(mux, cfg.Addr),
@@ -58,7 +95,7 @@ func New(cfg Config) *Server {
 		BaseContext:  func(net.Listener) context.Context { return ctx },
 	}
 
-	return s
+	return s, nil
 }
 
 // ListenAndServe starts the server and blocks until shutdown.
@@ -73,6 +110,9 @@ func (s *Server) ListenAndServe() error {
 	}()
 
 	s.logger.Printf("listening on %s", s.config.Addr)
+	if s.auth == nil {
+		s.logger.Printf("no API tokens configured: every client has full access")
+	}
 	s.httpSrv.Addr = s.config.Addr
 	err := s.httpSrv.ListenAndServe()
 	if err == http.ErrServerClosed {
@@ -92,14 +132,14 @@ func csrfProtect(next http.Handler, _ string) http.Handler {
 			if origin != "" {
 				u, err := url.Parse(origin)
 				if err != nil {
-					http.Error(w, `{"error":"invalid Origin header"}`, http.StatusForbidden)
+					writeError(w, http.StatusForbidden, "invalid Origin header")
 					return
 				}
 				// Allow only localhost-family origins. This blocks browser-based
 				// CSRF from remote pages while allowing local web UIs.
 				host := u.Hostname()
 				if host != "localhost" && host != "127.0.0.1" && host != "::1" {
-					http.Error(w, `{"error":"cross-origin request blocked"}`, http.StatusForbidden)
+					writeError(w, http.StatusForbidden, "cross-origin request blocked")
 					return
 				}
 			}
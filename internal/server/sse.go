@@ -4,11 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 )
 
 // Broadcaster fans out progress events to multiple SSE clients.
 // One Broadcaster per pipeline run. Thread-safe.
+//
+// Events are numbered from 1 in the order they were sent; the number is the
+// SSE event ID, so a reconnecting client can resume with Last-Event-ID.
 type Broadcaster struct {
 	mu      sync.Mutex
 	history []map[string]any
@@ -16,6 +22,11 @@ type Broadcaster struct {
 	nextID  uint64
 	closed  bool
 	doneCh  chan struct{} // closed only on real broadcaster Close(), not slow-client drops
+
+	// logPath, when set, receives every event as one JSON line through
+	// logFile, which is opened on the first event and closed by Close.
+	logPath string
+	logFile *os.File
 }
 
 // NewBroadcaster creates a new event broadcaster.
@@ -35,6 +46,14 @@ func (b *Broadcaster) Send(ev map[string]any) {
 		return
 	}
 	b.history = append(b.history, ev)
+	if b.logPath != "" {
+		if b.logFile == nil {
+			b.logFile, _ = openEventLog(b.logPath)
+		}
+		if b.logFile != nil {
+			writeEventLine(b.logFile, ev)
+		}
+	}
 	for id, ch := range b.clients {
 		select {
 		case ch <- ev:
@@ -51,22 +70,37 @@ func (b *Broadcaster) Send(ev map[string]any) {
 // The done channel is closed only when the broadcaster is closed (pipeline finished),
 // NOT when a slow client is dropped. This lets callers distinguish the two cases.
 func (b *Broadcaster) Subscribe() (<-chan map[string]any, <-chan struct{}, func()) {
+	ch, doneCh, unsub, _ := b.SubscribeAfter(0)
+	return ch, doneCh, unsub
+}
+
+// SubscribeAfter is Subscribe, but the replay skips the first after events.
+// after is clamped to the history length and returned, so the first event
+// delivered has the returned offset plus one as its ID.
+func (b *Broadcaster) SubscribeAfter(after int) (<-chan map[string]any, <-chan struct{}, func(), int) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	ch := make(chan map[string]any, len(b.history)+256)
+	if after < 0 {
+		after = 0
+	}
+	if after > len(b.history) {
+		after = len(b.history)
+	}
+	replay := b.history[after:]
+	ch := make(chan map[string]any, len(replay)+256)
 	id := b.nextID
 	b.nextID++
 
 	// Replay history. Channel is sized to fit all history plus live headroom,
 	// so this never blocks while holding the mutex.
-	for _, ev := range b.history {
+	for _, ev := range replay {
 		ch <- ev
 	}
 
 	if b.closed {
 		close(ch)
-		return ch, b.doneCh, func() {}
+		return ch, b.doneCh, func() {}, after
 	}
 
 	b.clients[id] = ch
@@ -78,7 +112,7 @@ func (b *Broadcaster) Subscribe() (<-chan map[string]any, <-chan struct{}, func(
 			close(ch)
 		}
 	}
-	return ch, b.doneCh, unsub
+	return ch, b.doneCh, unsub, after
 }
 
 // Close signals that no more events will be sent. All client channels are closed.
@@ -87,6 +121,10 @@ func (b *Broadcaster) Close() {
 	defer b.mu.Unlock()
 	b.closed = true
 	close(b.doneCh)
+	if b.logFile != nil {
+		_ = b.logFile.Close()
+		b.logFile = nil
+	}
 	for id, ch := range b.clients {
 		close(ch)
 		delete(b.clients, id)
@@ -117,8 +155,13 @@ func WriteSSE(w http.ResponseWriter, r *http.Request, b *Broadcaster) {
 	w.WriteHeader(http.StatusOK)
 	flusher.Flush()
 
-	events, doneCh, unsub := b.Subscribe()
+	// EventSource clients resend the last ID they saw when reconnecting.
+	// An ID past the end of the history (stale, or from before a restart)
+	// resumes at the end, numbered from where the history actually stops.
+	after, _ := strconv.Atoi(strings.TrimSpace(r.Header.Get("Last-Event-ID")))
+	events, doneCh, unsub, after := b.SubscribeAfter(after)
 	defer unsub()
+	nextID := after + 1
 
 	ctx := r.Context()
 	for {
@@ -140,9 +183,11 @@ func WriteSSE(w http.ResponseWriter, r *http.Request, b *Broadcaster) {
 			}
 			data, err := json.Marshal(ev)
 			if err != nil {
+				nextID++
 				continue
 			}
-			fmt.Fprintf(w, "data: %s\n\n", data)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", nextID, data)
+			nextID++
 			flusher.Flush()
 		}
 	}
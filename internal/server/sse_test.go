@@ -1,6 +1,9 @@
 package server
 
 import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -214,3 +217,69 @@ func TestBroadcaster_SlowClientDropDoesNotCloseDoneCh(t *testing.T) {
 
 	b.Close()
 }
+
+func TestBroadcaster_SubscribeAfterSkipsSeenEvents(t *testing.T) {
+	b := NewBroadcaster()
+	b.Send(map[string]any{"event": "first"})
+	b.Send(map[string]any{"event": "second"})
+	b.Close()
+
+	ch, _, unsub, after := b.SubscribeAfter(1)
+	defer unsub()
+	if after != 1 {
+		t.Fatalf("offset: got %d want 1", after)
+	}
+	var events []string
+	for ev := range ch {
+		events = append(events, ev["event"].(string))
+	}
+	if len(events) != 1 || events[0] != "second" {
+		t.Fatalf("unexpected replay: %v", events)
+	}
+}
+
+func TestWriteSSE_LastEventIDPastHistoryResumesAtEnd(t *testing.T) {
+	b := NewBroadcaster()
+	b.Send(map[string]any{"event": "first"})
+	b.Send(map[string]any{"event": "second"})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteSSE(w, r, b)
+	}))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Last-Event-ID", "10")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b.mu.Lock()
+		subscribed := len(b.clients) == 1
+		b.mu.Unlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client never subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.Send(map[string]any{"event": "third"})
+	b.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	// The third event is event 3, not 11, so reconnecting with its ID works.
+	if len(lines) != 4 || lines[0] != "id: 3" || lines[1] != `data: {"event":"third"}` || lines[2] != "event: done" {
+		t.Fatalf("stream: %q", lines)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// stateStore persists the pipeline registry and each pipeline's event
+// history so a restarted server can re-list runs and replay their events.
+//
+// Layout under the state dir:
+//
+//	runs/<run_id>/pipeline.json  — pipelineRecord
+//	runs/<run_id>/events.ndjson  — broadcaster history, one event per line
+type stateStore struct {
+	dir    string
+	logger *log.Logger
+}
+
+// pipelineRecord is the on-disk form of a registry entry.
+type pipelineRecord struct {
+	RunID     string          `json:"run_id"`
+	StartedAt time.Time       `json:"started_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	LogsRoot  string          `json:"logs_root,omitempty"`
+	Done      bool            `json:"done"`
+	Status    *PipelineStatus `json:"status,omitempty"` // terminal status once done
+}
+
+func newStateStore(dir string, logger *log.Logger) (*stateStore, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(abs, "runs"), 0o755); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	return &stateStore{dir: abs, logger: logger}, nil
+}
+
+func (s *stateStore) runDir(runID string) string {
+	return filepath.Join(s.dir, "runs", runID)
+}
+
+func (s *stateStore) eventsPath(runID string) string {
+	return filepath.Join(s.runDir(runID), "events.ndjson")
+}
+
+// saveRecord writes the record atomically. Failures are logged, not returned:
+// persistence must never fail a run.
+func (s *stateStore) saveRecord(rec pipelineRecord) {
+	rec.UpdatedAt = time.Now().UTC()
+	dir := s.runDir(rec.RunID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		s.logger.Printf("persist pipeline %s: %v", rec.RunID, err)
+		return
+	}
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		s.logger.Printf("persist pipeline %s: %v", rec.RunID, err)
+		return
+	}
+	tmp := filepath.Join(dir, "pipeline.json.tmp")
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		s.logger.Printf("persist pipeline %s: %v", rec.RunID, err)
+		return
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "pipeline.json")); err != nil {
+		s.logger.Printf("persist pipeline %s: %v", rec.RunID, err)
+	}
+}
+
+// loadRecords returns every readable pipeline record, oldest first. Entries
+// that cannot be decoded are logged and skipped.
+func (s *stateStore) loadRecords() ([]pipelineRecord, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, "runs"))
+	if err != nil {
+		return nil, err
+	}
+	var out []pipelineRecord
+	for _, e := range entries {
+		if !e.IsDir() || !validRunID.MatchString(e.Name()) {
+			continue
+		}
+		path := filepath.Join(s.runDir(e.Name()), "pipeline.json")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				s.logger.Printf("skip %s: %v", path, err)
+			}
+			continue
+		}
+		var rec pipelineRecord
+		if err := json.Unmarshal(b, &rec); err != nil || rec.RunID != e.Name() {
+			s.logger.Printf("skip %s: invalid pipeline record", path)
+			continue
+		}
+		out = append(out, rec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out, nil
+}
+
+// loadEvents reads the persisted event history for a run. A truncated last
+// line (the server died mid-write) is dropped.
+func (s *stateStore) loadEvents(runID string) ([]map[string]any, error) {
+	return readEventLines(s.eventsPath(runID), 0)
+}
+
+// readEventLines decodes the JSON lines of path after skipping the first skip
+// lines. Lines that do not decode are ignored.
+func readEventLines(path string, skip int) ([]map[string]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var out []map[string]any
+	r := bufio.NewReader(f)
+	for n := 0; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == nil && n >= skip {
+			var ev map[string]any
+			if json.Unmarshal(line, &ev) == nil {
+				out = append(out, ev)
+			}
+		}
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+// openEventLog opens path for appending event lines.
+func openEventLog(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+}
+
+// writeEventLine appends ev to f as one JSON line. The write goes straight to
+// the file, unbuffered, so history survives an abrupt exit as
+// progress.ndjson does.
+func writeEventLine(f *os.File, ev map[string]any) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	_, _ = f.Write(append(b, '\n'))
+}
@@ -20,6 +20,9 @@ type SubmitPipelineRequest struct {
 	// ForceModels maps provider -> model for overrides.
 	ForceModels map[string]string `json:"force_models,omitempty"`
 
+	// Params supplies values for the parameters the graph declares.
+	Params map[string]string `json:"params,omitempty"`
+
 	// AllowTestShim enables test shim mode.
 	AllowTestShim bool `json:"allow_test_shim,omitempty"`
 }